@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"weblang/wl/jscompiler"
+	"weblang/wl/jscompiler/sourcemap"
+	"weblang/wl/scanner"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+var (
+	buildMinify bool
+	buildPrune  bool
+	buildReport bool
+	buildBigInt bool
+)
+
+func buildFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&buildMinify, "minify", false, "minify the page scripts and runtime")
+	fs.BoolVar(&buildPrune, "prune", false, "leave code the pages don't reach out of their scripts")
+	fs.BoolVar(&buildReport, "report", false, "with -prune, print what each page kept and dropped")
+	fs.BoolVar(&buildBigInt, "bigint", false, "represent ints as BigInts wrapping at 64 bits")
+}
+
+const buildHelp = `Build compiles each page of the site to an .html file of the same
+relative path in the output directory, next to an .html.map source map
+of its script, and copies the stylesheets of the site there.
+
+The packages of the site other pages import are compiled to javascript
+modules, dir/pkg.js for the package of the directory dir/pkg, next to
+.js.map source maps. Pages importing them load them, and the runtime
+module wl.runtime.js and the modules of the flows in flows/, from the
+root of the site.
+
+Ints are numbers whose arithmetic panics on overflow, or BigInts
+wrapping at 64 bits with -bigint. -minify minifies the page scripts and
+runtime and -prune leaves out the declarations and runtime helpers a
+page doesn't reach; with -report, what each page kept and dropped is
+printed.
+`
+
+// runBuild compiles the site into its output directory
+func runBuild(cmd *command, flags *siteFlags, args []string, stdout, stderr io.Writer) int {
+	if !noArgs(cmd, args, stderr) {
+		return exitUsage
+	}
+	s := load(flags, stderr)
+	if s == nil {
+		return exitError
+	}
+	var report io.Writer
+	if buildReport {
+		report = stdout
+	}
+	cfg := jscompiler.Config{Minify: buildMinify, Prune: buildPrune}
+	if buildBigInt {
+		cfg.Ints = jscompiler.BigInts
+	}
+	if err := s.build(flags.output(), cfg, report); err != nil {
+		scanner.PrintError(stderr, err)
+		return exitError
+	}
+	return exitOK
+}
+
+// build writes an .html file and its source map for each page of s and
+// copies its stylesheets to the directory out. The pages are compiled
+// with cfg; if the pages are pruned and report isn't nil, what each
+// page kept and dropped is written to report.
+func (s *site) build(out string, cfg jscompiler.Config, report io.Writer) error {
+	pages := 0
+	for _, d := range s.dirs {
+		pages += len(d.pages)
+	}
+	if pages == 0 {
+		return fmt.Errorf("no %s pages to build in %s", extPage, s.root)
+	}
+	// the modules are compiled before the pages importing them, which
+	// await their async functions
+	if err := s.buildModules(out, &cfg); err != nil {
+		return err
+	}
+	for _, d := range s.dirs {
+		dir := filepath.Join(out, filepath.FromSlash(d.rel))
+		if len(d.pages) > 0 || len(d.css) > 0 {
+			if err := os.MkdirAll(dir, 0777); err != nil {
+				return err
+			}
+		}
+		for _, p := range d.pages {
+			var buf bytes.Buffer
+			file := filepath.Join(out, filepath.FromSlash(p.name)+".html")
+			m := sourcemap.New(filepath.Base(file))
+			m.Content = ioutil.ReadFile
+			m.SourceName = sourceName(filepath.Join(s.root, filepath.FromSlash(d.rel)))
+			cfg.SourceMap = m
+			if cfg.Prune && report != nil {
+				cfg.Report = &jscompiler.Report{}
+			}
+			err := cfg.CompilePage(&buf, s.fset, d.pkg, d.info, d.files, p.tmpl, p.info, s.flows...)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(file, buf.Bytes(), 0666); err != nil {
+				return err
+			}
+			data, err := m.MarshalJSON()
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(file+".map", data, 0666); err != nil {
+				return err
+			}
+			if cfg.Report != nil {
+				fmt.Fprintf(report, "%s:\n", p.name)
+				if _, err := cfg.Report.WriteTo(report); err != nil {
+					return err
+				}
+			}
+		}
+		for _, name := range d.css {
+			src := filepath.Join(s.root, filepath.FromSlash(d.rel), name)
+			if err := copyFile(filepath.Join(dir, name), src); err != nil {
+				return fmt.Errorf("copying %s: %v", src, err)
+			}
+		}
+	}
+	return nil
+}
+
+// buildModules writes the modules of the packages of s imported by
+// other packages, each after those it imports, to the directory out.
+// If there are any, the runtime module and the modules of the flows of
+// s are written too.
+func (s *site) buildModules(out string, cfg *jscompiler.Config) error {
+	imported := make(map[*siteDir]bool)
+	for _, d := range s.pkgs {
+		for _, dep := range s.deps(d.pkg) {
+			imported[dep] = true
+		}
+	}
+	if len(imported) == 0 {
+		return nil
+	}
+	for _, d := range s.pkgs {
+		if !imported[d] {
+			continue
+		}
+		mo := &moduleOutputer{
+			fset: s.fset,
+			file: filepath.Join(out, filepath.FromSlash(jscompiler.ModuleFile(d.rel))),
+			dir:  filepath.Join(s.root, filepath.FromSlash(path.Dir(d.rel))),
+		}
+		if err := cfg.Compile(d.pkg, d.info, d.files, mo); err != nil {
+			return err
+		}
+		if mo.err != nil {
+			return mo.err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := cfg.WriteRuntime(&buf); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(out, jscompiler.ModuleFile(jscompiler.RuntimeModule)), buf.Bytes()); err != nil {
+		return err
+	}
+	for _, f := range s.flows {
+		buf.Reset()
+		if err := cfg.CompileFlowModule(&buf, f); err != nil {
+			return err
+		}
+		file := filepath.Join(out, filepath.FromSlash(jscompiler.ModuleFile(f.Package.Path())))
+		if err := writeFile(file, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moduleOutputer writes the module of a package of a site to file,
+// next to its source map
+type moduleOutputer struct {
+	fset *token.FileSet
+	file string
+	dir  string // the directory the source map names sources relative to
+	buf  bytes.Buffer
+	m    *sourcemap.Map
+	err  error
+}
+
+func (o *moduleOutputer) WriterFor(pkg *types.Package) io.Writer {
+	return &o.buf
+}
+
+func (o *moduleOutputer) MapFor(pkg *types.Package) (*token.FileSet, *sourcemap.Map) {
+	o.m = sourcemap.New(filepath.Base(o.file))
+	o.m.Content = ioutil.ReadFile
+	o.m.SourceName = sourceName(o.dir)
+	return o.fset, o.m
+}
+
+func (o *moduleOutputer) Done(pkg *types.Package, writer io.Writer) {
+	if o.err = writeFile(o.file, o.buf.Bytes()); o.err != nil {
+		return
+	}
+	data, err := o.m.MarshalJSON()
+	if err != nil {
+		o.err = err
+		return
+	}
+	o.err = ioutil.WriteFile(o.file+".map", data, 0666)
+}
+
+// writeFile writes data to file, creating its directory if needed
+func writeFile(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0666)
+}
+
+// sourceName returns the names of the source files in the source maps
+// of the pages of the directory dir: their paths relative to dir, which
+// the output directory mirrors
+func sourceName(dir string) func(file string) string {
+	return func(file string) string {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return filepath.Base(file)
+		}
+		return filepath.ToSlash(rel)
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import "io"
+
+const checkHelp = `Check parses and type-checks the packages and templates of the site,
+printing their errors, without writing any output.
+`
+
+// runCheck parses and type-checks the site without writing any output
+func runCheck(cmd *command, flags *siteFlags, args []string, stdout, stderr io.Writer) int {
+	if !noArgs(cmd, args, stderr) {
+		return exitUsage
+	}
+	if load(flags, stderr) == nil {
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around each hunk
+const diffContext = 3
+
+// diff returns a unified diff of the lines of a and b, or nil if they
+// are equal. The file names label the old and new versions.
+func diff(oldName, newName string, a, b []byte) []byte {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	x, y := splitLines(a), splitLines(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	// the edit script as lines prefixed with ' ', '-' or '+'
+	type line struct {
+		op   byte
+		text string
+		i, j int // lines of x and y before this one
+	}
+	var script []line
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			script = append(script, line{' ', x[i], i, j})
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			script = append(script, line{'-', x[i], i, j})
+			i++
+		default:
+			script = append(script, line{'+', y[j], i, j})
+			j++
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+	for k := 0; k < len(script); {
+		if script[k].op == ' ' {
+			k++
+			continue
+		}
+		// a hunk extends to the last change followed by no more than
+		// 2*diffContext unchanged lines
+		start := k - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := k
+		for n := k; n < len(script); n++ {
+			if script[n].op != ' ' {
+				end = n + 1
+			} else if n-end >= 2*diffContext {
+				break
+			}
+		}
+		stop := end + diffContext
+		if stop > len(script) {
+			stop = len(script)
+		}
+
+		var oldLines, newLines int
+		for _, l := range script[start:stop] {
+			if l.op != '+' {
+				oldLines++
+			}
+			if l.op != '-' {
+				newLines++
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(script[start].i, oldLines), hunkRange(script[start].j, newLines))
+		for _, l := range script[start:stop] {
+			buf.WriteByte(l.op)
+			buf.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		k = stop
+	}
+	return buf.Bytes()
+}
+
+// hunkRange formats the start line and line count of a hunk
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+// splitLines splits s after each newline
+func splitLines(s []byte) []string {
+	var lines []string
+	for len(s) > 0 {
+		i := bytes.IndexByte(s, '\n')
+		if i < 0 {
+			i = len(s) - 1
+		}
+		lines = append(lines, string(s[:i+1]))
+		s = s[i+1:]
+	}
+	return lines
+}
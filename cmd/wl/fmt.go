@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"weblang/wl/format"
+	"weblang/wl/page"
+)
+
+// fmt flags
+var (
+	fmtList  bool
+	fmtWrite bool
+	fmtDiff  bool
+)
+
+func fmtFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&fmtList, "l", false, "list files whose formatting differs")
+	fs.BoolVar(&fmtWrite, "w", false, "write the result to the source file instead of standard output")
+	fs.BoolVar(&fmtDiff, "d", false, "print diffs instead of the formatted source")
+}
+
+// formatters format the sources of a site by file extension
+var formatters = map[string]func(src []byte) ([]byte, error){
+	extWL:       format.Source,
+	extPage:     page.Format,
+	extComp:     page.Format,
+	extTemplate: page.Format,
+}
+
+const fmtHelp = `Fmt formats the .wl files and templates of the paths, files or
+directories, by default the package root. Like gofmt, it prints the
+formatted sources unless -l lists the files whose formatting differs,
+-w rewrites them or -d prints diffs.
+`
+
+// runFmt formats the sources of the site like gofmt: by default the
+// formatted sources are printed, -l lists the files that aren't
+// formatted, -w rewrites them and -d prints diffs. Arguments name files
+// or directories to format instead of the package root.
+func runFmt(cmd *command, flags *siteFlags, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		args = []string{flags.root}
+	}
+	code := exitOK
+	for _, arg := range args {
+		err := filepath.Walk(arg, func(file string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				if file != arg && strings.HasPrefix(fi.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if formatters[filepath.Ext(file)] == nil {
+				if file == arg {
+					fmt.Fprintf(stderr, "wl fmt: %s is not a weblang source file\n", file)
+					code = exitError
+				}
+				return nil
+			}
+			if err := formatFile(file, fi.Mode(), stdout); err != nil {
+				fmt.Fprintf(stderr, "%v\n", err)
+				code = exitError
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "wl: %v\n", err)
+			code = exitError
+		}
+	}
+	return code
+}
+
+// formatFile formats file, reporting the result to stdout as selected
+// by the fmt flags
+func formatFile(file string, mode os.FileMode, stdout io.Writer) error {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	res, err := formatters[filepath.Ext(file)](src)
+	if err != nil {
+		return fmt.Errorf("%s:%v", file, err)
+	}
+
+	if !bytes.Equal(src, res) {
+		if fmtList {
+			fmt.Fprintln(stdout, file)
+		}
+		if fmtWrite {
+			if err := ioutil.WriteFile(file, res, mode); err != nil {
+				return err
+			}
+		}
+		if fmtDiff {
+			fmt.Fprintf(stdout, "diff %s.orig %s\n", file, file)
+			stdout.Write(diff(file+".orig", file, src, res))
+		}
+	}
+	if !fmtList && !fmtWrite && !fmtDiff {
+		stdout.Write(res)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Command wl checks, builds, formats, serves and tests weblang sites.
+//
+// Usage:
+//
+//	wl <command> [flags] [arguments]
+//
+// The commands are:
+//
+//	check   parse and type-check the site, printing errors
+//	build   compile the site into its output directory
+//	fmt     format the sources of the site
+//	run     build the site and serve its output directory
+//	repl    evaluate wl declarations and expressions interactively
+//	test    run the tests of the _test.wl files of the site
+//
+// A site is a directory tree of .wl, .wlpage, .wlcomp, .wltemplate,
+// .flow and .css files rooted at the package root given by -root. The
+// .wl files of each directory form the package backing the pages in it.
+// Output goes to the directory given by -o, root/output by default.
+//
+// Run wl <command> -h for the details and flags of a command.
+//
+// Exit status is 0 on success, 1 if the sources have errors, tests
+// failed or the command failed, and 2 for invalid usage.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"weblang/wl/scanner"
+)
+
+// Exit codes
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// command is a wl subcommand
+type command struct {
+	name  string
+	args  string // the arguments taken, for the usage line
+	short string
+	long  string // the details printed by wl <command> -h
+	run   func(cmd *command, flags *siteFlags, args []string, stdout, stderr io.Writer) int
+
+	// setFlags declares the command's own flags, if any
+	setFlags func(fs *flag.FlagSet)
+
+	// output is set for the commands writing the site to the output
+	// directory, which take the -o flag
+	output bool
+}
+
+var commands = []*command{
+	{name: "check", short: "parse and type-check the site, printing errors", long: checkHelp, run: runCheck},
+	{name: "build", short: "compile the site into its output directory", long: buildHelp, output: true, run: runBuild, setFlags: buildFlags},
+	{name: "fmt", args: "[path ...]", short: "format the sources of the site", long: fmtHelp, run: runFmt, setFlags: fmtFlags},
+	{name: "run", short: "build the site and serve its output directory", long: runHelp, output: true, run: runRun, setFlags: runFlags},
+	{name: "repl", args: "[file.wl ...]", short: "evaluate wl declarations and expressions interactively", long: replHelp, run: runRepl},
+	{name: "test", short: "run the tests of the _test.wl files of the site", long: testHelp, run: runTest, setFlags: testFlags},
+}
+
+// siteFlags are the flags shared by the commands
+type siteFlags struct {
+	root string // package root
+	out  string // output directory, defaults to root/output
+}
+
+func (f *siteFlags) output() string {
+	if f.out != "" {
+		return f.out
+	}
+	return filepath.Join(f.root, "output")
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the wl command with args and returns its exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	name := args[0]
+	if name == "help" || name == "-h" || name == "-help" {
+		usage(stdout)
+		return exitOK
+	}
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		fs := flag.NewFlagSet("wl "+name, flag.ContinueOnError)
+		fs.SetOutput(stderr)
+		flags := &siteFlags{}
+		fs.StringVar(&flags.root, "root", ".", "package root of the site")
+		if cmd.output {
+			fs.StringVar(&flags.out, "o", "", "output directory (default root/output)")
+		}
+		if cmd.setFlags != nil {
+			cmd.setFlags(fs)
+		}
+		fs.Usage = func() { cmd.usage(fs) }
+		if err := fs.Parse(args[1:]); err != nil {
+			if err == flag.ErrHelp {
+				return exitOK
+			}
+			return exitUsage
+		}
+		return cmd.run(cmd, flags, fs.Args(), stdout, stderr)
+	}
+	fmt.Fprintf(stderr, "wl: unknown command %q\n", name)
+	usage(stderr)
+	return exitUsage
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: wl <command> [flags]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "\t%-6s  %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintf(w, "\nRun wl <command> -h for the flags of a command.\n")
+}
+
+// usage prints the usage line, details and flags fs of cmd to the
+// output of fs
+func (cmd *command) usage(fs *flag.FlagSet) {
+	w := fs.Output()
+	line := "wl " + cmd.name + " [flags]"
+	if cmd.args != "" {
+		line += " " + cmd.args
+	}
+	fmt.Fprintf(w, "usage: %s\n\n%s\nflags:\n", line, cmd.long)
+	fs.PrintDefaults()
+}
+
+// load loads the site of flags, printing its errors to stderr. It
+// returns nil if the site has errors or can't be read.
+func load(flags *siteFlags, stderr io.Writer) *site {
+	s, err := loadSite(flags.root, flags.output())
+	if err != nil {
+		fmt.Fprintf(stderr, "wl: %v\n", err)
+		return nil
+	}
+	if len(s.errors) > 0 {
+		scanner.PrintError(stderr, s.errors)
+		return nil
+	}
+	return s
+}
+
+// noArgs reports extra arguments of a command that takes none
+func noArgs(cmd *command, args []string, stderr io.Writer) bool {
+	if len(args) > 0 {
+		fmt.Fprintf(stderr, "wl %s: unexpected arguments %q\n", cmd.name, args)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSite writes the files of a site to a temporary directory
+func writeSite(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "wlsite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, src := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+var helloSite = map[string]string{
+	"index.wl": `package main
+
+var message = "Hello World!"
+`,
+	"index.wlpage": `<!doctype html>
+<html>
+<head><title>Hello Weblang</title></head>
+<body><h1>{{message}}</h1></body>
+</html>`,
+	"index.css": `h1 { color: red; }`,
+	"about/about.wl": `package about
+
+var who = "us"
+`,
+	"about/layout.wltemplate": `<html><head><title>About</title></head><body><placeholder id="main"/></body></html>`,
+	"about/index.wlpage":      `<placeholder id="main"><p>About {{who}}</p></placeholder>`,
+}
+
+func TestBuild(t *testing.T) {
+	root := writeSite(t, helloSite)
+	defer os.RemoveAll(root)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"build", "-root", root}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("build exit code, want %v got %v: %s", exitOK, code, stderr.String())
+	}
+
+	out := filepath.Join(root, "output")
+	for _, test := range []struct {
+		file string
+		want string
+	}{
+		{"index.html", "<title>Hello Weblang</title>"},
+		{"index.html", `"Hello World!"`},
+		{"index.css", "color: red"},
+		{"about/index.html", "<title>About</title>"},
+		{"about/index.html", `"us"`},
+		{"index.html", "//# sourceMappingURL=index.html.map\n</script>"},
+		{"index.html.map", `"version":3`},
+		{"index.html.map", `index.wlpage"`},
+		{"about/index.html.map", `"file":"index.html"`},
+		{"about/index.html.map", `"sources":["about.wl","index.wlpage"]`},
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(out, filepath.FromSlash(test.file)))
+		if err != nil {
+			t.Errorf("%s: %v", test.file, err)
+			continue
+		}
+		if !strings.Contains(string(data), test.want) {
+			t.Errorf("%s: want %s in\n%s", test.file, test.want, data)
+		}
+	}
+
+	// a second build skips the output directory
+	if code := run([]string{"build", "-root", root}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("rebuild exit code, want %v got %v: %s", exitOK, code, stderr.String())
+	}
+
+	other := filepath.Join(root, "dist")
+	if code := run([]string{"build", "-root", root, "-o", other}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("build -o exit code, want %v got %v: %s", exitOK, code, stderr.String())
+	}
+	if _, err := os.Stat(filepath.Join(other, "index.html")); err != nil {
+		t.Errorf("build -o: %v", err)
+	}
+
+	min := filepath.Join(root, "min")
+	if code := run([]string{"build", "-root", root, "-o", min, "-minify"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("build -minify exit code, want %v got %v: %s", exitOK, code, stderr.String())
+	}
+	data, err := ioutil.ReadFile(filepath.Join(min, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `let message="Hello World!";wl.mount(`; !strings.Contains(string(data), want) {
+		t.Errorf("build -minify: want %s in\n%s", want, data)
+	}
+
+	big := filepath.Join(root, "big")
+	if code := run([]string{"build", "-root", root, "-o", big, "-bigint"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("build -bigint exit code, want %v got %v: %s", exitOK, code, stderr.String())
+	}
+	data, err = ioutil.ReadFile(filepath.Join(big, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "wl.bigints();\n"; !strings.Contains(string(data), want) {
+		t.Errorf("build -bigint: want %s in\n%s", want, data)
+	}
+
+	stdout.Reset()
+	pruned := filepath.Join(root, "pruned")
+	if code := run([]string{"build", "-root", root, "-o", pruned, "-prune", "-report"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("build -prune exit code, want %v got %v: %s", exitOK, code, stderr.String())
+	}
+	for _, want := range []string{"index:\nkept var message: template binding at ", "dropped runtime flow\n", "about/index:\n"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("build -prune -report: want %q in\n%s", want, stdout.String())
+		}
+	}
+	data, err = ioutil.ReadFile(filepath.Join(pruned, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "function flow(") {
+		t.Errorf("build -prune: unused runtime helpers kept in\n%s", data)
+	}
+}
+
+// TestBuildModules checks the packages of a site imported by other
+// packages are compiled to modules the pages import, which run
+func TestBuildModules(t *testing.T) {
+	root := writeSite(t, map[string]string{
+		"lib/strs/strs.wl": `package strs
+
+func Twice(s string) string {
+	return s + s
+}
+`,
+		"lib/greet/greet.wl": `package greet
+
+import "lib/strs"
+
+func Hello(name string) string {
+	return strs.Twice("hi ") + name
+}
+`,
+		"lib/greet/greet_test.wl": `package greet
+
+import "testing"
+
+func TestHello(t testing.T) {
+	if got := Hello("wl"); got != "hi hi wl" {
+		t.Errorf("Hello() = %s", got)
+	}
+}
+`,
+		"index.wl": `package main
+
+import "lib/greet"
+
+var message = greet.Hello("wl")
+`,
+		"index.wlpage": `<body><h1>{{message}}</h1></body>`,
+	})
+	defer os.RemoveAll(root)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"build", "-root", root}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("build exit code, want %v got %v: %s", exitOK, code, stderr.String())
+	}
+	out := filepath.Join(root, "output")
+	for _, test := range []struct {
+		file string
+		want string
+	}{
+		{"index.html", "<script type=\"module\">\nimport wl from \"/wl.runtime.js\";\nimport * as greet from \"/lib/greet.js\";\n"},
+		{"lib/greet.js", "import wl from \"../wl.runtime.js\";\nimport * as strs from \"./strs.js\";\n"},
+		{"lib/greet.js", "//# sourceMappingURL=greet.js.map"},
+		{"lib/greet.js.map", `"sources":["greet/greet.wl"]`},
+		{"lib/strs.js", "export function Twice(s) {"},
+		{"wl.runtime.js", "export default wl;\n"},
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(out, filepath.FromSlash(test.file)))
+		if err != nil {
+			t.Errorf("%s: %v", test.file, err)
+			continue
+		}
+		if !strings.Contains(string(data), test.want) {
+			t.Errorf("%s: want %s in\n%s", test.file, test.want, data)
+		}
+	}
+
+	// the tests of a package run with the packages it imports
+	stdout.Reset()
+	if code := run([]string{"test", "-root", root}, &stdout, &stderr); code != exitOK {
+		t.Errorf("test exit code, want %v got %v: %s%s", exitOK, code, stdout.String(), stderr.String())
+	}
+
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not found, not running the modules")
+	}
+	if err := ioutil.WriteFile(filepath.Join(out, "package.json"), []byte(`{"type": "module"}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	url := "file://" + filepath.ToSlash(filepath.Join(out, "lib", "greet.js"))
+	script := "globalThis.document = {}; globalThis.window = {};\n" +
+		"const greet = await import(\"" + url + "\");\nconsole.log(greet.Hello(\"wl\"));\n"
+	got, err := exec.Command(node, "--input-type=module", "-e", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("node: %v\n%s", err, got)
+	}
+	if want := "hi hi wl\n"; string(got) != want {
+		t.Errorf("modules output, want %q got %q", want, got)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"legacy", map[string]string{"index.page": "<p>hi</p>", "index.code": "var x = 1"}, "index.code: unrecognized source file"},
+		{"no pages", map[string]string{"lib.wl": "package lib\n"}, "no .wlpage pages to build"},
+		{"unsupported", map[string]string{
+			"index.wl": `package main
+
+func f() int {
+	for {
+		break
+	}
+	return 1
+}
+`,
+			"index.wlpage": "<p>{{f()}}</p>",
+		}, "index.wl:4:2: "},
+		{"async initializer", map[string]string{
+			"index.wl":     "package main\n\nimport \"http\"\n\nvar status = http.Get(\"/x\").Status\n",
+			"index.wlpage": "<p>{{status}}</p>",
+		}, `index.wl:5:14: async call http.Get("/x") outside of a function`},
+		{"action in head style", map[string]string{
+			"index.wl":     "package main\n\nvar x = \"red\"\n",
+			"index.wlpage": "<html><head><style>p { color: {{x}}; }</style></head><body><p>hi</p></body></html>",
+		}, "index.wlpage:1:31: actions are only supported inside <body>"},
+		{"action in head script", map[string]string{
+			"index.wl":     "package main\n\nvar x = 1\n",
+			"index.wlpage": "<html><head><script>var n = {{x}};</script></head><body><p>hi</p></body></html>",
+		}, "index.wlpage:1:29: actions are only supported inside <body>"},
+		{"import cycle", map[string]string{
+			"a/a.wl":       "package a\n\nimport \"b\"\n\nvar A = b.B\n",
+			"b/b.wl":       "package b\n\nimport \"a\"\n\nvar B = a.A\n",
+			"index.wl":     "package main\n\nimport \"a\"\n\nvar x = a.A\n",
+			"index.wlpage": "<p>{{x}}</p>",
+		}, `import cycle through package "a"`},
+	} {
+		root := writeSite(t, test.files)
+		var stdout, stderr bytes.Buffer
+		if code := run([]string{"build", "-root", root}, &stdout, &stderr); code != exitError {
+			t.Errorf("%s: exit code, want %v got %v: %s", test.name, exitError, code, stderr.String())
+		}
+		if !strings.Contains(stderr.String(), test.want) {
+			t.Errorf("%s: want %q in the errors:\n%s", test.name, test.want, stderr.String())
+		}
+		os.RemoveAll(root)
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	root := writeSite(t, map[string]string{
+		"index.wl":     "package main\n\nvar count int = \"one\"\n",
+		"index.wlpage": `<p>{{count}}</p>`,
+		"bad/bad.wl":   "package bad\n\nvar = 1\n",
+	})
+	defer os.RemoveAll(root)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"check", "-root", root}, &stdout, &stderr); code != exitError {
+		t.Fatalf("check exit code, want %v got %v", exitError, code)
+	}
+	for _, want := range []string{
+		"index.wl:3:17: cannot convert \"one\"",
+		"bad.wl:3:5: expected 'IDENT', found '='",
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("want %s in errors:\n%s", want, stderr.String())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "output")); !os.IsNotExist(err) {
+		t.Errorf("check wrote output")
+	}
+}
+
+func TestFmt(t *testing.T) {
+	const (
+		wlSrc   = "package main\nvar  message =   \"hi\"\n"
+		wlFmt   = "package main\n\nvar message = \"hi\"\n"
+		pageSrc = "<ul>\n{{for _,m:=range  items}}\n<li>{{ m+\"!\" }}</li>\n{{/for}}\n</ul>\n"
+		pageFmt = "<ul>\n{{for _, m := range items}}\n\t<li>{{m + \"!\"}}</li>\n{{/for}}\n</ul>\n"
+	)
+	root := writeSite(t, map[string]string{
+		"index.wl":     wlSrc,
+		"index.wlpage": pageSrc,
+		"ok.wl":        wlFmt,
+	})
+	defer os.RemoveAll(root)
+	wl, wlpage := filepath.Join(root, "index.wl"), filepath.Join(root, "index.wlpage")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"fmt", wl}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("fmt exit code, want %v got %v: %s", exitOK, code, stderr.String())
+	}
+	if want, got := wlFmt, stdout.String(); want != got {
+		t.Errorf("fmt, want %q got %q", want, got)
+	}
+
+	stdout.Reset()
+	if code := run([]string{"fmt", "-l", "-root", root}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("fmt -l exit code, want %v got %v: %s", exitOK, code, stderr.String())
+	}
+	if want, got := wl+"\n"+wlpage+"\n", stdout.String(); want != got {
+		t.Errorf("fmt -l, want %q got %q", want, got)
+	}
+
+	stdout.Reset()
+	if code := run([]string{"fmt", "-d", wlpage}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("fmt -d exit code, want %v got %v: %s", exitOK, code, stderr.String())
+	}
+	for _, want := range []string{
+		"--- " + wlpage + ".orig\n+++ " + wlpage + "\n",
+		"@@ -1,5 +1,5 @@\n <ul>\n-{{for _,m:=range  items}}\n-<li>{{ m+\"!\" }}</li>\n+{{for _, m := range items}}\n+\t<li>{{m + \"!\"}}</li>\n {{/for}}\n",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("fmt -d, want %q in\n%s", want, stdout.String())
+		}
+	}
+
+	if code := run([]string{"fmt", "-w", "-root", root}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("fmt -w exit code, want %v got %v: %s", exitOK, code, stderr.String())
+	}
+	for file, want := range map[string]string{wl: wlFmt, wlpage: pageFmt} {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(data); want != got {
+			t.Errorf("fmt -w %s, want %q got %q", file, want, got)
+		}
+	}
+
+	stderr.Reset()
+	bad := writeSite(t, map[string]string{"bad.wlpage": "<p>{{if x}}</p>"})
+	defer os.RemoveAll(bad)
+	if code := run([]string{"fmt", "-l", "-root", bad}, &stdout, &stderr); code != exitError {
+		t.Errorf("fmt of a bad template exit code, want %v got %v", exitError, code)
+	}
+	if !strings.Contains(stderr.String(), "bad.wlpage:1:") {
+		t.Errorf("fmt of a bad template, want positioned error, got %s", stderr.String())
+	}
+}
+
+func TestUsage(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"frobnicate"},
+		{"build", "-nosuchflag"},
+		{"check", "extra"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := run(args, &stdout, &stderr); code != exitUsage {
+			t.Errorf("%q: exit code, want %v got %v", args, exitUsage, code)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"fmt", "-h"}, &stdout, &stderr); code != exitOK {
+		t.Errorf("fmt -h: exit code, want %v got %v", exitOK, code)
+	}
+	for _, want := range []string{"usage: wl fmt [flags] [path ...]\n", "Like gofmt", "-w\t"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("fmt -h: want %q in\n%s", want, stderr.String())
+		}
+	}
+	if strings.Contains(stderr.String(), "-o ") {
+		t.Errorf("fmt -h: fmt takes no -o flag:\n%s", stderr.String())
+	}
+
+	stderr.Reset()
+	if code := run([]string{"repl", "-h"}, &stdout, &stderr); code != exitOK {
+		t.Errorf("repl -h: exit code, want %v got %v", exitOK, code)
+	}
+	if want := "there is no len builtin"; !strings.Contains(stderr.String(), want) {
+		t.Errorf("repl -h: want %q in\n%s", want, stderr.String())
+	}
+}
+
+func TestRepl(t *testing.T) {
+	dir := writeSite(t, map[string]string{
+		"shapes.wl": `package shapes
+
+type square struct {
+	Side int
+}
+
+func (s square) Area() int {
+	return s.Side * s.Side
+}
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	defer func(r io.Reader) { stdin = r }(stdin)
+	stdin = strings.NewReader(`x := 40
+x + 2
+"hi"
+type Color enum {
+	Red = 0
+	Green = 1
+}
+Color.Green
+var bad int = "s"
+bad
+func twice(n int) int {
+	return n * 2
+}
+twice(x)
+:type twice
+:load ` + filepath.Join(dir, "shapes.wl") + `
+square{Side: 3}.Area()
+for i := 0; i < 2; i++ {
+	println(i)
+}
+:frobnicate
+`)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"repl"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("repl exit code, want %v got %v: %s", exitOK, code, stderr.String())
+	}
+	for _, want := range []string{
+		"42 (int)\n",
+		`"hi" (string)` + "\n",
+		"Green (Color)\n",
+		"80 (int)\n",
+		"func(n int) int\n",
+		"9 (int)\n",
+		"0\n1\n",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("want %q in the output:\n%s", want, stdout.String())
+		}
+	}
+	for _, want := range []string{
+		"repl:1: cannot convert",
+		"repl:1: undeclared name: bad",
+		"unknown command :frobnicate",
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("want %q in the errors:\n%s", want, stderr.String())
+		}
+	}
+}
+
+func TestTest(t *testing.T) {
+	root := writeSite(t, map[string]string{
+		"calc/calc.wl": `package calc
+
+func Add(a int, b int) int {
+	return a + b
+}
+`,
+		"calc/calc_test.wl": `package calc
+
+import "testing"
+
+func TestAdd(t testing.T) {
+	tests := []struct {
+		name string
+		a    int
+		b    int
+		want int
+	}{
+		{"zero", 0, 0, 0},
+		{"wrong", 1, 1, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t testing.T) {
+			if got := Add(tt.a, tt.b); got != tt.want {
+				t.Errorf("Add(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPass(t testing.T) {
+}
+`,
+	})
+	defer os.RemoveAll(root)
+
+	defer func() { testRun, testVerbose = "", false }()
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"test", "-root", root}, &stdout, &stderr); code != exitError {
+		t.Fatalf("test exit code, want %v got %v: %s", exitError, code, stderr.String())
+	}
+	for _, want := range []string{
+		"--- FAIL: TestAdd (",
+		"    --- FAIL: TestAdd/wrong (",
+		"        calc_test.wl:18: Add(1, 1) = 2, want 3\n",
+		"FAIL\tcalc\t",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("want %q in the output:\n%s", want, stdout.String())
+		}
+	}
+	if strings.Contains(stdout.String(), "TestPass") {
+		t.Errorf("passing test reported without -v:\n%s", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := run([]string{"test", "-root", root, "-v", "-run", "Add/zero"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("test -run exit code, want %v got %v: %s", exitOK, code, stdout.String())
+	}
+	for _, want := range []string{"=== RUN   TestAdd/zero\n", "    --- PASS: TestAdd/zero (", "ok  \tcalc\t"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("want %q in the output:\n%s", want, stdout.String())
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"weblang/wl/ast"
+	"weblang/wl/eval"
+	"weblang/wl/importer"
+	"weblang/wl/object"
+	"weblang/wl/parser"
+	"weblang/wl/scanner"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// stdin is the input of wl repl
+var stdin io.Reader = os.Stdin
+
+// replFile is the file name of the positions of the inputs of the REPL
+const replFile = "repl"
+
+// repl is an interactive session. Its declarations are checked into
+// one package by the same checker, so each input sees the declarations
+// of the inputs before it, and run by an interpreter keeping the values
+// of their variables.
+type repl struct {
+	fset    *token.FileSet
+	pkg     *types.Package
+	checker *types.Checker
+	info    *types.Info
+	conf    *types.Config
+	errs    scanner.ErrorList // of the declarations being checked
+	files   []*ast.File       // the declarations declared
+	in      *eval.Interpreter
+	stdout  io.Writer
+	stderr  io.Writer
+
+	// initialized are the package variables initialized by the inputs
+	// before
+	initialized map[*types.Var]bool
+}
+
+const replHelp = `Repl reads declarations, statements and expressions from the standard
+input, printing the values of expressions with their types. Each input
+sees the declarations of the ones before; an input with unclosed braces
+goes on on the next lines. The files given as arguments are declared
+first.
+
+The commands :type expr and :load file print the type of an expression
+and declare the declarations of a file.
+
+The REPL runs what the type checker accepts, which doesn't cover all of
+the language yet: there is no len builtin, slices have no methods such
+as Filter or Length, functions are func literals rather than fn(t)
+expressions, and union types aren't checked.
+`
+
+// runRepl reads, checks and evaluates the declarations, statements and
+// expressions of stdin, after loading the files of args
+func runRepl(cmd *command, flags *siteFlags, args []string, stdout, stderr io.Writer) int {
+	r := newRepl(stdout, stderr)
+	for _, file := range args {
+		if !r.load(file) {
+			return exitError
+		}
+	}
+
+	prompt := "> "
+	var input strings.Builder
+	lines := bufio.NewScanner(stdin)
+	for {
+		fmt.Fprint(stdout, prompt)
+		if !lines.Scan() {
+			fmt.Fprintln(stdout)
+			break
+		}
+		input.WriteString(lines.Text() + "\n")
+		if !complete(input.String()) {
+			prompt = "... "
+			continue
+		}
+		src := strings.TrimSpace(input.String())
+		input.Reset()
+		prompt = "> "
+		if src == ":quit" {
+			break
+		}
+		r.handle(src)
+	}
+	if err := lines.Err(); err != nil {
+		fmt.Fprintf(stderr, "wl repl: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func newRepl(stdout, stderr io.Writer) *repl {
+	fset := token.NewFileSet()
+	r := &repl{
+		fset:        fset,
+		pkg:         types.NewPackage("main", "main"),
+		info:        newInfo(),
+		in:          eval.New(fset, stdout),
+		stdout:      stdout,
+		stderr:      stderr,
+		initialized: make(map[*types.Var]bool),
+	}
+	r.conf = &types.Config{
+		Importer: importer.Default(),
+		Error: func(err error) {
+			if err, ok := err.(types.Error); ok {
+				r.errs.Add(err.Fset.Position(err.Pos), err.Msg)
+			}
+		},
+	}
+	r.checker = types.NewChecker(r.conf, fset, r.pkg, r.info)
+	return r
+}
+
+// complete reports whether src has no unclosed parentheses, brackets or
+// braces, so more lines are read before evaluating an input ending in
+// an open block
+func complete(src string) bool {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	s.Init(file, []byte(src), nil, 0)
+	depth := 0
+	for {
+		_, tok, _ := s.Scan()
+		switch tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.EOF:
+			return depth <= 0
+		}
+	}
+}
+
+// handle evaluates the input src: a command, declarations, statements
+// or an expression, whose values are printed
+func (r *repl) handle(src string) {
+	switch {
+	case src == "":
+	case strings.HasPrefix(src, ":type "):
+		r.typeOf(strings.TrimSpace(strings.TrimPrefix(src, ":type ")))
+	case strings.HasPrefix(src, ":load "):
+		r.load(strings.TrimSpace(strings.TrimPrefix(src, ":load ")))
+	case strings.HasPrefix(src, ":"):
+		fmt.Fprintf(r.stderr, "unknown command %s; the commands are :type expr, :load file and :quit\n", strings.Fields(src)[0])
+	default:
+		if f, err := parser.ParseFile(r.fset, replFile, "package main\n//line "+replFile+":1\n"+src, 0); err == nil && len(f.Decls) > 0 {
+			r.declare(f)
+			return
+		}
+		r.stmts(src)
+	}
+}
+
+// stmts evaluates the statements src. A single expression is evaluated
+// and its values printed, and short variable declarations declare
+// package variables so the next inputs can use them.
+func (r *repl) stmts(src string) {
+	f, err := parser.ParseFile(r.fset, replFile, "package main\nfunc _() {\n//line "+replFile+":1\n"+src+"\n}", 0)
+	if err != nil {
+		r.errors(err)
+		return
+	}
+	body := f.Decls[0].(*ast.FuncDecl).Body
+	if len(body.List) == 1 {
+		switch s := body.List[0].(type) {
+		case *ast.ExprStmt:
+			r.eval(s.X)
+			return
+		case *ast.AssignStmt:
+			if s.Tok == token.DEFINE {
+				spec := &ast.ValueSpec{Values: s.Rhs}
+				for _, x := range s.Lhs {
+					spec.Names = append(spec.Names, x.(*ast.Ident))
+				}
+				r.declare(&ast.File{Name: f.Name, Decls: []ast.Decl{
+					&ast.GenDecl{TokPos: s.Pos(), Tok: token.VAR, Specs: []ast.Spec{spec}},
+				}})
+				return
+			}
+		case *ast.DeclStmt:
+			r.declare(&ast.File{Name: f.Name, Decls: []ast.Decl{s.Decl}})
+			return
+		}
+	}
+
+	info := newInfo()
+	lit := &ast.FuncLit{Type: &ast.FuncType{Func: body.Lbrace, Params: &ast.FieldList{}}, Body: body}
+	if _, err := types.CheckExpr(r.fset, r.pkg, r.pkg.Scope(), lit, info); err != nil {
+		r.errors(err)
+		return
+	}
+	if err := r.in.Exec(r.pkg, info, body.List); err != nil {
+		r.errors(err)
+	}
+}
+
+// declare checks the declarations of f into the package and loads them,
+// initializing the variables it declares
+func (r *repl) declare(f *ast.File) bool {
+	f.Name.Name = r.pkg.Name()
+
+	// the objects of declarations with errors would stay in the
+	// package, so they are checked with the ones before first
+	r.errs = nil
+	if _, err := r.conf.Check(r.pkg.Name(), r.fset, append(r.files[:len(r.files):len(r.files)], f), nil); err != nil {
+		r.errors(r.errs)
+		return false
+	}
+	if err := r.checker.Files([]*ast.File{f}); err != nil {
+		r.errors(err)
+		return false
+	}
+	r.files = append(r.files, f)
+
+	// the checker orders the initializers of all the inputs
+	info := *r.info
+	info.InitOrder = nil
+	for _, init := range r.info.InitOrder {
+		if !r.initialized[init.Lhs[0]] {
+			info.InitOrder = append(info.InitOrder, init)
+			for _, v := range init.Lhs {
+				r.initialized[v] = true
+			}
+		}
+	}
+	if err := r.in.Load(r.pkg, &info, []*ast.File{f}); err != nil {
+		r.errors(err)
+		return false
+	}
+	return true
+}
+
+// eval evaluates the expression x, printing its values and their types
+func (r *repl) eval(x ast.Expr) {
+	info := newInfo()
+	tv, err := types.CheckExpr(r.fset, r.pkg, r.pkg.Scope(), x, info)
+	if err != nil {
+		r.errors(err)
+		return
+	}
+	if tv.IsType() || tv.IsBuiltin() {
+		fmt.Fprintf(r.stderr, "%s is not an expression\n", types.ExprString(x))
+		return
+	}
+	values, err := r.in.Eval(r.pkg, info, x)
+	if err != nil {
+		r.errors(err)
+		return
+	}
+	if len(values) == 0 {
+		return
+	}
+
+	t := tv.Type
+	if tuple, ok := t.(*types.Tuple); ok {
+		var b strings.Builder
+		for i, v := range values {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(formatValue(v, tuple.At(i).Type()))
+		}
+		fmt.Fprintf(r.stdout, "%s %s\n", b.String(), typeString(t))
+		return
+	}
+	t = types.Default(t)
+	fmt.Fprintf(r.stdout, "%s (%s)\n", formatValue(values[0], t), typeString(t))
+}
+
+// typeOf prints the type of the expression src
+func (r *repl) typeOf(src string) {
+	x, err := parser.ParseExprFrom(r.fset, replFile, src, 0)
+	if err != nil {
+		r.errors(err)
+		return
+	}
+	tv, err := types.CheckExpr(r.fset, r.pkg, r.pkg.Scope(), x, newInfo())
+	if err != nil {
+		r.errors(err)
+		return
+	}
+	fmt.Fprintln(r.stdout, typeString(tv.Type))
+}
+
+// load declares the declarations of the wl file, whatever its package
+// clause, reporting whether it succeeded
+func (r *repl) load(file string) bool {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(r.stderr, "wl repl: %v\n", err)
+		return false
+	}
+	f, err := parser.ParseFile(r.fset, file, src, 0)
+	if err != nil {
+		r.errors(err)
+		return false
+	}
+	return r.declare(f)
+}
+
+// errors prints the errors err of an input
+func (r *repl) errors(err error) {
+	switch err := err.(type) {
+	case scanner.ErrorList:
+		scanner.PrintError(r.stderr, err)
+	case *eval.Panic:
+		fmt.Fprintln(r.stderr, err)
+		for _, s := range err.Stack {
+			fmt.Fprintln(r.stderr, s)
+		}
+	default:
+		fmt.Fprintln(r.stderr, err)
+	}
+}
+
+// formatValue formats the value v of type t, quoting strings
+func formatValue(v object.Object, t types.Type) string {
+	if s, ok := v.(*object.String); ok && types.Identical(t.Underlying(), types.Typ[types.String]) {
+		return strconv.Quote(s.Value)
+	}
+	return v.Inspect()
+}
+
+// typeString returns the name of t qualified by package names, leaving
+// the types of the REPL's package unqualified
+func typeString(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string {
+		if p.Name() == "main" {
+			return ""
+		}
+		return p.Name()
+	})
+}
+
+func newInfo() *types.Info {
+	return &types.Info{
+		Types:     make(map[ast.Expr]types.TypeAndValue),
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Implicits: make(map[ast.Node]types.Object),
+	}
+}
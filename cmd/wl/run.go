@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"weblang/wl/jscompiler"
+	"weblang/wl/scanner"
+)
+
+var addr string
+
+func runFlags(fs *flag.FlagSet) {
+	fs.StringVar(&addr, "addr", "localhost:8080", "address to serve the site on")
+}
+
+const runHelp = `Run builds the site like wl build and serves its output directory on
+the address given by -addr.
+`
+
+// runRun builds the site and serves its output directory
+func runRun(cmd *command, flags *siteFlags, args []string, stdout, stderr io.Writer) int {
+	if !noArgs(cmd, args, stderr) {
+		return exitUsage
+	}
+	s := load(flags, stderr)
+	if s == nil {
+		return exitError
+	}
+	out := flags.output()
+	if err := s.build(out, jscompiler.Config{}, nil); err != nil {
+		scanner.PrintError(stderr, err)
+		return exitError
+	}
+	fmt.Fprintf(stdout, "serving %s on http://%s/\n", out, addr)
+	if err := http.ListenAndServe(addr, http.FileServer(http.Dir(out))); err != nil {
+		fmt.Fprintf(stderr, "wl: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
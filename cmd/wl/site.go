@@ -0,0 +1,371 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"weblang/wl/ast"
+	"weblang/wl/flow"
+	"weblang/wl/importer"
+	"weblang/wl/page"
+	"weblang/wl/parser"
+	"weblang/wl/scanner"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// Source file extensions of a site
+const (
+	extWL       = ".wl"
+	extPage     = ".wlpage"
+	extComp     = ".wlcomp"
+	extTemplate = ".wltemplate"
+	extFlow     = ".flow"
+	extCSS      = ".css"
+)
+
+// legacyExts are the extensions of the sources of the earlier site
+// format, which aren't supported anymore, by the extension replacing
+// them
+var legacyExts = map[string]string{
+	".page": extPage,
+	".code": extWL,
+}
+
+// site is the parsed and checked sources of a site directory. The wl
+// files of each directory form the package backing the pages in it.
+type site struct {
+	root   string
+	fset   *token.FileSet
+	dirs   []*siteDir
+	pkgs   []*siteDir // directories whose package checked, after those it imports
+	flows  []*flow.Info
+	imp    types.Importer
+	errors scanner.ErrorList
+}
+
+// siteDir is a directory of a site
+type siteDir struct {
+	rel    string // slash separated path relative to the site root, "" for the root
+	files  []*ast.File
+	pkg    *types.Package
+	info   *types.Info
+	pages  []*sitePage
+	comps  []*page.Component
+	layout *page.Template
+	css    []string // file names
+	tests  []string // _test.wl files, checked by wl test only
+	broken bool     // a wl file has syntax errors
+
+	checking bool // the package is being checked, importing it is a cycle
+	checked  bool
+}
+
+// sitePage is a page of a site
+type sitePage struct {
+	name string // slash separated path relative to the root, without extension
+	tmpl *page.Template
+	info *page.Info
+}
+
+// loadSite parses and checks the site in root, skipping the directory
+// skip. Errors in the sources are collected in the site's errors; the
+// returned error is only set if reading the site failed.
+func loadSite(root, skip string) (*site, error) {
+	s := &site{root: root, fset: token.NewFileSet()}
+	byDir := make(map[string]*siteDir)
+	var flowFiles []string
+
+	skipAbs, _ := filepath.Abs(skip)
+	err := filepath.Walk(root, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			abs, _ := filepath.Abs(file)
+			if file != root && (strings.HasPrefix(fi.Name(), ".") || skip != "" && abs == skipAbs) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, filepath.Dir(file))
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+		d := byDir[rel]
+		if d == nil {
+			d = &siteDir{rel: rel}
+			byDir[rel] = d
+			s.dirs = append(s.dirs, d)
+		}
+
+		switch filepath.Ext(file) {
+		case extWL:
+			if strings.HasSuffix(file, "_test"+extWL) {
+				d.tests = append(d.tests, file)
+			} else {
+				s.parseWL(d, file)
+			}
+		case extPage:
+			s.parsePage(d, file)
+		case extComp:
+			s.parseComponent(d, file)
+		case extTemplate:
+			s.parseLayout(d, file)
+		case extFlow:
+			flowFiles = append(flowFiles, file)
+		case extCSS:
+			d.css = append(d.css, fi.Name())
+		default:
+			if ext, ok := legacyExts[filepath.Ext(file)]; ok {
+				s.errors.Add(token.Position{Filename: file}, fmt.Sprintf("unrecognized source file: %s files aren't supported anymore, use %s", filepath.Ext(file), ext))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(s.dirs, func(i, j int) bool { return s.dirs[i].rel < s.dirs[j].rel })
+
+	pages := make(map[string]bool)
+	for _, d := range s.dirs {
+		for _, p := range d.pages {
+			pages[p.name] = true
+		}
+	}
+	for _, file := range flowFiles {
+		s.checkFlow(file, pages)
+	}
+
+	for _, d := range s.dirs {
+		s.checkDir(d)
+	}
+	s.errors.Sort()
+	return s, nil
+}
+
+// addError adds err, a scanner.ErrorList, types.Error or other error,
+// to the site's errors
+func (s *site) addError(err error) {
+	switch err := err.(type) {
+	case nil:
+	case scanner.ErrorList:
+		s.errors = append(s.errors, err...)
+	case *scanner.Error:
+		s.errors = append(s.errors, err)
+	case types.Error:
+		s.errors.Add(err.Fset.Position(err.Pos), err.Msg)
+	default:
+		s.errors.Add(token.Position{}, err.Error())
+	}
+}
+
+func (s *site) parseWL(d *siteDir, file string) {
+	f, err := parser.ParseFile(s.fset, file, nil, parser.AllErrors)
+	s.addError(err)
+	if err != nil {
+		d.broken = true
+		return
+	}
+	d.files = append(d.files, f)
+}
+
+func (s *site) parsePage(d *siteDir, file string) {
+	tmpl, err := page.ParseFile(s.fset, file, nil)
+	s.addError(err)
+	if err != nil {
+		return
+	}
+	name := strings.TrimSuffix(filepath.Base(file), extPage)
+	d.pages = append(d.pages, &sitePage{name: path.Join(d.rel, name), tmpl: tmpl})
+}
+
+func (s *site) parseComponent(d *siteDir, file string) {
+	tmpl, err := page.ParseFile(s.fset, file, nil)
+	s.addError(err)
+	if err != nil {
+		return
+	}
+	name := strings.TrimSuffix(filepath.Base(file), extComp)
+	d.comps = append(d.comps, &page.Component{Name: name, Template: tmpl})
+}
+
+func (s *site) parseLayout(d *siteDir, file string) {
+	tmpl, err := page.ParseFile(s.fset, file, nil)
+	s.addError(err)
+	if err != nil {
+		return
+	}
+	if d.layout != nil {
+		s.errors.Add(s.fset.Position(templatePos(tmpl)), "more than one layout in directory, also "+d.layout.Name)
+		return
+	}
+	d.layout = tmpl
+}
+
+func templatePos(tmpl *page.Template) token.Pos {
+	if len(tmpl.Nodes) > 0 {
+		return tmpl.Nodes[0].Pos()
+	}
+	return token.NoPos
+}
+
+func (s *site) checkFlow(file string, pages map[string]bool) {
+	f, err := flow.ParseFile(s.fset, file, nil)
+	s.addError(err)
+	if err != nil {
+		return
+	}
+	finfo, err := flow.Check(s.fset, f, pages)
+	s.addError(err)
+	if err == nil {
+		s.flows = append(s.flows, finfo)
+	}
+}
+
+// checkDir type-checks the package of d and its pages, once. The
+// packages of the site it imports are checked first.
+func (s *site) checkDir(d *siteDir) {
+	if d.checked || d.broken || len(d.files) == 0 && len(d.pages) == 0 {
+		return
+	}
+	d.checking = true
+	defer func() {
+		d.checking = false
+		d.checked = true
+	}()
+
+	conf := types.Config{
+		Importer: s.importer(),
+		Error:    func(err error) { s.addError(err) },
+	}
+	d.info = &types.Info{
+		Types:     make(map[ast.Expr]types.TypeAndValue),
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Implicits: make(map[ast.Node]types.Object),
+	}
+	path := d.rel
+	if path == "" {
+		path = "main"
+	}
+	pkg, err := conf.Check(path, s.fset, d.files, d.info)
+	if err != nil {
+		// reported by conf.Error; pages can't be checked against a
+		// broken package
+		return
+	}
+	d.pkg = pkg
+	s.pkgs = append(s.pkgs, d)
+
+	for _, p := range d.pages {
+		if page.UsesLayout(p.tmpl) {
+			if d.layout == nil {
+				s.errors.Add(s.fset.Position(templatePos(p.tmpl)), "page fills placeholders but there is no "+extTemplate+" layout in its directory")
+				continue
+			}
+			tmpl, err := page.ApplyLayout(s.fset, d.layout, p.tmpl)
+			s.addError(err)
+			if err != nil {
+				continue
+			}
+			p.tmpl = tmpl
+		}
+		p.info, err = page.Check(s.fset, pkg, d.info, p.tmpl, d.comps...)
+		s.addError(err)
+	}
+}
+
+// importer returns the importer of the packages of the site, which
+// resolves the builtin packages, the packages declared by its flows and
+// the packages of its directories by their path relative to the root.
+// All packages of the site share it, so they share the packages they
+// import.
+func (s *site) importer() types.Importer {
+	if s.imp == nil {
+		var flowPkgs []*types.Package
+		for _, f := range s.flows {
+			flowPkgs = append(flowPkgs, f.Package)
+		}
+		s.imp = &siteImporter{site: s, builtin: importer.With(flowPkgs...)}
+	}
+	return s.imp
+}
+
+// siteImporter imports the packages of the directories of a site,
+// checking them on demand, and the packages of builtin
+type siteImporter struct {
+	site    *site
+	builtin types.Importer
+}
+
+func (i *siteImporter) Import(path string) (*types.Package, error) {
+	d := i.site.dir(path)
+	if d == nil || importer.IsBuiltin(path) || strings.HasPrefix(path, flow.PackagePrefix) {
+		return i.builtin.Import(path)
+	}
+	if d.checking {
+		return nil, fmt.Errorf("import cycle through package %q", path)
+	}
+	if len(d.files) == 0 && !d.broken {
+		return nil, fmt.Errorf("no %s files in package %q", extWL, path)
+	}
+	i.site.checkDir(d)
+	if d.pkg == nil {
+		return nil, fmt.Errorf("package %q has errors", path)
+	}
+	return d.pkg, nil
+}
+
+// dir returns the directory of the site whose package has the import
+// path, or nil. The package of the root directory can't be imported.
+func (s *site) dir(path string) *siteDir {
+	for _, d := range s.dirs {
+		if d.rel != "" && d.rel == path {
+			return d
+		}
+	}
+	return nil
+}
+
+// deps returns the directories of the packages of the site pkg imports,
+// directly or not, each after those it imports
+func (s *site) deps(pkg *types.Package) []*siteDir {
+	imported := make(map[*types.Package]bool)
+	var walk func(pkg *types.Package)
+	walk = func(pkg *types.Package) {
+		for _, imp := range pkg.Imports() {
+			if !imported[imp] {
+				imported[imp] = true
+				walk(imp)
+			}
+		}
+	}
+	walk(pkg)
+	var deps []*siteDir
+	for _, d := range s.pkgs {
+		if imported[d.pkg] {
+			deps = append(deps, d)
+		}
+	}
+	return deps
+}
+
+// copyFile copies the file src to dst
+func copyFile(dst, src string) error {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, data, 0666)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"weblang/wl/ast"
+	"weblang/wl/eval"
+	"weblang/wl/parser"
+	"weblang/wl/scanner"
+	"weblang/wl/types"
+)
+
+var (
+	testRun     string
+	testVerbose bool
+)
+
+func testFlags(fs *flag.FlagSet) {
+	fs.StringVar(&testRun, "run", "", "run only the tests and subtests matching the slash separated patterns")
+	fs.BoolVar(&testVerbose, "v", false, "report the tests that pass and their logs too")
+}
+
+const testHelp = `Test checks the package of each directory of the site with its
+_test.wl files and runs their functions TestXxx(t testing.T) in process,
+like go test: the methods of t log failures at their position, stop the
+test or run subtests. -run selects tests and subtests by the patterns of
+the elements of their names, and -v reports the tests that pass.
+`
+
+// runTest checks the package of each directory of the site with its
+// _test.wl files and runs their tests
+func runTest(cmd *command, flags *siteFlags, args []string, stdout, stderr io.Writer) int {
+	if !noArgs(cmd, args, stderr) {
+		return exitUsage
+	}
+	opts := &eval.TestOptions{Verbose: testVerbose}
+	if testRun != "" {
+		for _, elem := range strings.Split(testRun, "/") {
+			re, err := regexp.Compile(elem)
+			if err != nil {
+				fmt.Fprintf(stderr, "wl test: invalid -run pattern: %v\n", err)
+				return exitUsage
+			}
+			opts.Run = append(opts.Run, re)
+		}
+	}
+
+	s := load(flags, stderr)
+	if s == nil {
+		return exitError
+	}
+	code := exitOK
+	for _, d := range s.dirs {
+		if len(d.tests) > 0 && !s.test(d, opts, stdout, stderr) {
+			code = exitError
+		}
+	}
+	return code
+}
+
+// test checks the package of d with its test files and runs its tests,
+// reporting whether they passed
+func (s *site) test(d *siteDir, opts *eval.TestOptions, stdout, stderr io.Writer) bool {
+	path := d.rel
+	if path == "" {
+		path = "main"
+	}
+	start := time.Now()
+	fail := func() bool {
+		fmt.Fprintf(stdout, "FAIL\t%s\t%.3fs\n", path, time.Since(start).Seconds())
+		return false
+	}
+
+	var errs scanner.ErrorList
+	files := append([]*ast.File(nil), d.files...)
+	for _, file := range d.tests {
+		f, err := parser.ParseFile(s.fset, file, nil, parser.AllErrors)
+		if err != nil {
+			scanner.PrintError(stderr, err)
+			return fail()
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{
+		Importer: s.importer(),
+		Error: func(err error) {
+			if err, ok := err.(types.Error); ok {
+				errs.Add(err.Fset.Position(err.Pos), err.Msg)
+			}
+		},
+	}
+	info := newInfo()
+	pkg, err := conf.Check(path, s.fset, files, info)
+	if err != nil {
+		errs.Sort()
+		scanner.PrintError(stderr, errs)
+		return fail()
+	}
+
+	// the tests are the functions TestXxx of the test files
+	var tests []string
+	for _, f := range files[len(d.files):] {
+		for _, decl := range f.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Recv != nil || !isTest(fd.Name.Name) {
+				continue
+			}
+			if !eval.IsTestFunc(info.Defs[fd.Name].(*types.Func)) {
+				errs.Add(s.fset.Position(fd.Name.Pos()), fmt.Sprintf("wrong signature for %s, must be: func %s(t testing.T)", fd.Name.Name, fd.Name.Name))
+				continue
+			}
+			if opts.Match(0, fd.Name.Name) {
+				tests = append(tests, fd.Name.Name)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		scanner.PrintError(stderr, errs)
+		return fail()
+	}
+
+	in := eval.New(s.fset, stdout)
+	for _, dep := range s.deps(pkg) {
+		if err := in.Load(dep.pkg, dep.info, dep.files); err != nil {
+			fmt.Fprintln(stdout, err)
+			return fail()
+		}
+	}
+	if err := in.Load(pkg, info, files); err != nil {
+		fmt.Fprintln(stdout, err)
+		return fail()
+	}
+	passed := true
+	for _, name := range tests {
+		ok, err := in.RunTest(pkg, name, opts)
+		if err != nil {
+			fmt.Fprintf(stderr, "wl test: %v\n", err)
+		}
+		passed = passed && ok
+	}
+	if !passed {
+		fmt.Fprintln(stdout, "FAIL")
+		return fail()
+	}
+	fmt.Fprintf(stdout, "ok  \t%s\t%.3fs\n", path, time.Since(start).Seconds())
+	return true
+}
+
+// isTest reports whether name is the name of a test function: Test,
+// not followed by a lower case letter
+func isTest(name string) bool {
+	if !strings.HasPrefix(name, "Test") {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(name[len("Test"):])
+	return !unicode.IsLower(r)
+}
@@ -173,6 +173,10 @@ func (f *Field) End() token.Pos {
 	if f.Tag != nil {
 		return f.Tag.End()
 	}
+	if f.Type == nil {
+		// untyped lambda parameter
+		return f.Names[len(f.Names)-1].End()
+	}
 	return f.Type.End()
 }
 
@@ -683,6 +687,18 @@ func (id *Ident) String() string {
 	return "<nil>"
 }
 
+// Unparen returns the expression with any enclosing parentheses removed.
+//
+func Unparen(e Expr) Expr {
+	for {
+		p, ok := e.(*ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.X
+	}
+}
+
 // ----------------------------------------------------------------------------
 // Statements
 
@@ -754,13 +770,13 @@ type (
 	/*GoStmt struct {
 		Go   token.Pos // position of "go" keyword
 		Call *CallExpr
-	}
+	}*/
 
 	// A DeferStmt node represents a defer statement.
 	DeferStmt struct {
 		Defer token.Pos // position of "defer" keyword
 		Call  *CallExpr
-	}*/
+	}
 
 	// A ReturnStmt node represents a return statement.
 	ReturnStmt struct {
@@ -878,7 +894,7 @@ func (s *IncDecStmt) Pos() token.Pos { return s.X.Pos() }
 func (s *AssignStmt) Pos() token.Pos { return s.Lhs[0].Pos() }
 
 //func (s *GoStmt) Pos() token.Pos         { return s.Go }
-//func (s *DeferStmt) Pos() token.Pos      { return s.Defer }
+func (s *DeferStmt) Pos() token.Pos       { return s.Defer }
 func (s *ReturnStmt) Pos() token.Pos      { return s.Return }
 func (s *BranchStmt) Pos() token.Pos      { return s.TokPos }
 func (s *BlockStmt) Pos() token.Pos       { return s.Lbrace }
@@ -914,7 +930,7 @@ func (s *IncDecStmt) End() token.Pos {
 func (s *AssignStmt) End() token.Pos { return s.Rhs[len(s.Rhs)-1].End() }
 
 //func (s *GoStmt) End() token.Pos     { return s.Call.End() }
-//func (s *DeferStmt) End() token.Pos  { return s.Call.End() }
+func (s *DeferStmt) End() token.Pos { return s.Call.End() }
 
 func (s *ReturnStmt) End() token.Pos {
 	if n := len(s.Results); n > 0 {
@@ -972,7 +988,7 @@ func (*IncDecStmt) stmtNode() {}
 func (*AssignStmt) stmtNode() {}
 
 //func (*GoStmt) stmtNode()         {}
-//func (*DeferStmt) stmtNode()      {}
+func (*DeferStmt) stmtNode() {}
 
 func (*ReturnStmt) stmtNode()      {}
 func (*BranchStmt) stmtNode()      {}
@@ -237,10 +237,10 @@ func Walk(v Visitor, node Node) {
 
 	/*case *GoStmt:
 		Walk(v, n.Call)
-
+	*/
 	case *DeferStmt:
 		Walk(v, n.Call)
-	*/
+
 	case *ReturnStmt:
 		walkExprList(v, n.Results)
 
@@ -0,0 +1,503 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+	"weblang/wl/ast"
+	"weblang/wl/object"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// A frame is the state of a call of a function
+type frame struct {
+	fn     *object.Function
+	name   string
+	caller *frame
+	pos    token.Pos // position of the statement running
+
+	defers []deferred
+	panic  *Panic
+
+	// deferredBy is the frame running the call as a deferred call,
+	// whose panic recover stops
+	deferredBy *frame
+
+	// results are the results returned, or the environment of the
+	// named results
+	results []object.Object
+	named   *object.Environment
+}
+
+// deferred is a deferred call, or the handler of a catch statement
+// which handles the panics whose value implements catch
+type deferred struct {
+	fn    object.Object
+	args  []object.Object
+	catch *types.Interface
+}
+
+// call calls the function value fn with args, returning its results
+func (in *Interpreter) call(fn object.Object, args []object.Object) []object.Object {
+	switch fn := fn.(type) {
+	case *object.Function:
+		return in.callFunction(fn, nil, args)
+	case *object.Method:
+		if f, ok := fn.Func.(*object.Function); ok {
+			return in.callFunction(f, fn.Recv, args)
+		}
+		return in.call(fn.Func, append([]object.Object{fn.Recv}, args...))
+	case *object.Builtin:
+		in.deferring = nil
+		if res := fn.Fn(args...); res != nil {
+			return []object.Object{res}
+		}
+		return nil
+	}
+	panic(RuntimeError("invalid memory address or nil pointer dereference"))
+}
+
+// callFunction calls the function or method fn with the receiver recv
+// and args. The deferred calls of fn run when it returns or panics; the
+// panics they don't recover go on unwinding the callers.
+func (in *Interpreter) callFunction(fn *object.Function, recv object.Object, args []object.Object) []object.Object {
+	fr := &frame{fn: fn, name: fn.Name, caller: in.current, pos: fn.Body.Pos(), deferredBy: in.deferring}
+	if fn.Name == "" {
+		fr.name = "func literal"
+	}
+	in.deferring = nil
+	in.current = fr
+	defer func() { in.current = fr.caller }()
+
+	env := object.NewEnclosedEnvironment(fn.Env)
+	if fn.Recv != nil {
+		bind(env, fn.Recv, []object.Object{recv})
+	}
+	bind(env, fn.Params, args)
+	results := fn.Sig.Results()
+	if fn.Results != nil && len(fn.Results.List) > 0 && len(fn.Results.List[0].Names) > 0 {
+		fr.named = env
+		var zero []object.Object
+		for i := 0; i < results.Len(); i++ {
+			zero = append(zero, object.Zero(results.At(i).Type()))
+		}
+		bind(env, fn.Results, zero)
+	}
+
+	e := &evaluator{in: in, info: fn.Info, fr: fr}
+	e.body(fn.Body.List, env)
+
+	if fr.named != nil {
+		var values []object.Object
+		for _, f := range fn.Results.List {
+			for _, name := range f.Names {
+				v, ok := env.Get(name.Name)
+				if !ok || name.Name == "_" {
+					v = object.Zero(results.At(len(values)).Type())
+				}
+				values = append(values, v)
+			}
+		}
+		return values
+	}
+	if fr.results == nil && results.Len() > 0 {
+		// recovered from a panic
+		for i := 0; i < results.Len(); i++ {
+			fr.results = append(fr.results, object.Zero(results.At(i).Type()))
+		}
+	}
+	return fr.results
+}
+
+// bind declares the variables of fields in env, with the values of
+// values in order
+func bind(env *object.Environment, fields *ast.FieldList, values []object.Object) {
+	if fields == nil {
+		return
+	}
+	i := 0
+	for _, f := range fields.List {
+		if len(f.Names) == 0 {
+			i++
+			continue
+		}
+		for _, name := range f.Names {
+			if name.Name != "_" && i < len(values) {
+				env.Set(name.Name, values[i])
+			}
+			i++
+		}
+	}
+}
+
+// body runs the statements of the body of a function, then its deferred
+// calls, panicking again unless they recovered the panic of the body
+func (e *evaluator) body(list []ast.Stmt, env *object.Environment) {
+	func() {
+		defer e.panicked()
+		e.stmts(list, env)
+	}()
+	e.unwind()
+	if p := e.fr.panic; p != nil {
+		p.Stack = append(p.Stack, fmt.Sprintf("%s\n\t%s", e.fr.name, e.in.fset.Position(e.fr.pos)))
+		panic(p)
+	}
+}
+
+// panicked records the panic unwinding the frame, if any; it must be
+// deferred
+func (e *evaluator) panicked() {
+	if r := recover(); r != nil {
+		p, ok := r.(*Panic)
+		if !ok {
+			panic(r)
+		}
+		e.fr.panic = p
+	}
+}
+
+// unwind runs the deferred calls of the frame in last in first out
+// order. A panic in a deferred call replaces the one unwinding.
+func (e *evaluator) unwind() {
+	fr := e.fr
+	for len(fr.defers) > 0 {
+		d := fr.defers[len(fr.defers)-1]
+		fr.defers = fr.defers[:len(fr.defers)-1]
+		func() {
+			defer e.panicked()
+			if d.catch != nil {
+				if fr.panic == nil || !handles(fr.panic.Value, d.catch) {
+					return
+				}
+				v := fr.panic.Value
+				fr.panic = nil
+				e.in.call(d.fn, []object.Object{v})
+				return
+			}
+			e.in.deferring = fr
+			e.in.call(d.fn, d.args)
+		}()
+		e.in.deferring = nil
+	}
+}
+
+// handles reports whether a catch handler for panics of the interface
+// iface handles the panic of value v
+func handles(v object.Object, iface *types.Interface) bool {
+	box, ok := v.(*object.Interface)
+	return ok && types.Implements(box.Dynamic, iface)
+}
+
+// recover stops the panic of the frame running the current call as a
+// deferred call, returning its value
+func (e *evaluator) recover() object.Object {
+	d := e.fr.deferredBy
+	if d == nil || d.panic == nil || d.panic.goexit {
+		return object.NULL
+	}
+	v := d.panic.Value
+	d.panic = nil
+	return v
+}
+
+// call evaluates the call expression call, returning the results
+func (e *evaluator) call(call *ast.CallExpr, env *object.Environment) []object.Object {
+	if tv := e.info.Types[call.Fun]; tv.IsType() {
+		x := call.Args[0]
+		return []object.Object{e.convert(e.expr(x, env), e.typeOf(x), tv.Type)}
+	}
+	if name := e.builtin(call); name != "" {
+		return e.builtinCall(name, call, env)
+	}
+
+	fn := e.callee(call.Fun, env)
+	args := e.args(call, env)
+	e.fr.pos = call.Lparen
+	return e.in.call(fn, args)
+}
+
+// callee evaluates the function call calls, binding methods to their
+// receiver
+func (e *evaluator) callee(fun ast.Expr, env *object.Environment) object.Object {
+	if sel, ok := ast.Unparen(fun).(*ast.SelectorExpr); ok {
+		if m, ok := e.info.Uses[sel.Sel].(*types.Func); ok && m.Type().(*types.Signature).Recv() != nil {
+			if tv := e.info.Types[sel.X]; !tv.IsType() {
+				return e.in.method(e.expr(sel.X, env), tv.Type, m)
+			}
+		}
+	}
+	return e.expr(fun, env)
+}
+
+// args evaluates the arguments of call like assignments to the
+// parameters, passing the arguments of a variadic parameter in a slice
+func (e *evaluator) args(call *ast.CallExpr, env *object.Environment) []object.Object {
+	sig := e.typeOf(call.Fun).Underlying().(*types.Signature)
+	params := sig.Params()
+
+	var values []object.Object
+	var from []types.Type
+	if len(call.Args) == 1 && e.tuple(call.Args[0]) {
+		// f(g()) passes the results of g
+		values = e.values(call.Args[0], env)
+		for i := range values {
+			from = append(from, e.resultType(call.Args[0], i))
+		}
+	} else {
+		for _, a := range call.Args {
+			values = append(values, e.expr(a, env))
+			from = append(from, e.typeOf(a))
+		}
+	}
+
+	n := params.Len()
+	var args []object.Object
+	for i, v := range values {
+		if sig.Variadic() && i >= n-1 && !call.Ellipsis.IsValid() {
+			break
+		}
+		args = append(args, e.convertValue(v, from[i], params.At(i).Type()))
+	}
+	if sig.Variadic() && !call.Ellipsis.IsValid() {
+		elem := params.At(n - 1).Type().Underlying().(*types.Slice).Elem()
+		rest := &object.Array{}
+		for i := n - 1; i < len(values); i++ {
+			rest.Elements = append(rest.Elements, e.convertValue(values[i], from[i], elem))
+		}
+		args = append(args, rest)
+	}
+	return args
+}
+
+// method returns the method m of the value x of type t bound to its
+// receiver: the dynamic value of interfaces, or the embedded field
+// declaring the method if it is promoted
+func (in *Interpreter) method(x object.Object, t types.Type, m *types.Func) object.Object {
+	for {
+		if types.IsInterface(t) {
+			box, ok := x.(*object.Interface)
+			if !ok {
+				panic(RuntimeError("invalid memory address or nil pointer dereference"))
+			}
+			x, t = box.Value, box.Dynamic
+		}
+		obj, index, _ := types.LookupFieldOrMethod(t, false, m.Pkg(), m.Name())
+		f, ok := obj.(*types.Func)
+		if !ok {
+			panic(fmt.Sprintf("eval: %s has no method %s", t, m.Name()))
+		}
+		for _, i := range index[:len(index)-1] {
+			t = t.Underlying().(*types.Struct).Field(i).Type()
+			x = x.(*object.Struct).Fields[i]
+		}
+		if types.IsInterface(t) {
+			// promoted from an embedded interface
+			continue
+		}
+		return &object.Method{Recv: x, Func: in.function(f)}
+	}
+}
+
+// function returns the value of the function or method fn
+func (in *Interpreter) function(fn *types.Func) object.Object {
+	if f, ok := in.funcs[fn]; ok {
+		return f
+	}
+	f := in.native(fn)
+	in.funcs[fn] = f
+	return f
+}
+
+// builtin returns the name of the builtin function call calls, or ""
+func (e *evaluator) builtin(call *ast.CallExpr) string {
+	ident, ok := ast.Unparen(call.Fun).(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	if b, ok := e.info.Uses[ident].(*types.Builtin); ok {
+		return b.Name()
+	}
+	return ""
+}
+
+// builtinCall calls the builtin function name
+func (e *evaluator) builtinCall(name string, call *ast.CallExpr, env *object.Environment) []object.Object {
+	switch name {
+	case "make":
+		t := e.info.Types[call.Args[0]].Type
+		if _, ok := t.Underlying().(*types.Map); ok {
+			return []object.Object{object.NewHash()}
+		}
+		n := e.length(call.Args[1], env)
+		c := n
+		if len(call.Args) > 2 {
+			c = e.length(call.Args[2], env)
+			if c < n {
+				panic(RuntimeError("makeslice: cap out of range"))
+			}
+		}
+		elems := make([]object.Object, n, c)
+		elem := t.Underlying().(*types.Slice).Elem()
+		for i := range elems {
+			elems[i] = object.Zero(elem)
+		}
+		return []object.Object{&object.Array{Elements: elems}}
+	case "new":
+		return []object.Object{object.Zero(e.info.Types[call.Args[0]].Type)}
+	case "recover":
+		return []object.Object{e.recover()}
+	case "append":
+		s := e.expr(call.Args[0], env)
+		elems := elements(s)
+		if call.Ellipsis.IsValid() {
+			return []object.Object{&object.Array{Elements: append(elems, elements(e.expr(call.Args[1], env))...)}}
+		}
+		elem := e.typeOf(call).Underlying().(*types.Slice).Elem()
+		for _, a := range call.Args[1:] {
+			elems = append(elems, e.assign(a, elem, env))
+		}
+		return []object.Object{&object.Array{Elements: elems}}
+	}
+
+	var args []object.Object
+	if len(call.Args) == 1 && e.tuple(call.Args[0]) {
+		args = e.values(call.Args[0], env)
+	} else {
+		for _, a := range call.Args {
+			args = append(args, e.assign(a, e.paramType(name, a), env))
+		}
+	}
+	e.fr.pos = call.Lparen
+	if res := e.apply(name, args); res != nil {
+		return []object.Object{res}
+	}
+	return nil
+}
+
+// paramType returns the type of the parameter of the builtin function
+// name the argument a is passed as
+func (e *evaluator) paramType(name string, a ast.Expr) types.Type {
+	if name == "panic" {
+		return types.NewInterfaceType(nil, nil).Complete()
+	}
+	return e.typeOf(a)
+}
+
+// apply applies the builtin function name taking values to args, which
+// may be deferred
+func (e *evaluator) apply(name string, args []object.Object) object.Object {
+	switch name {
+	case "panic":
+		panic(e.in.newPanic(args[0]))
+	case "print", "println":
+		var b strings.Builder
+		for i, a := range args {
+			if i > 0 && name == "println" {
+				b.WriteString(" ")
+			}
+			b.WriteString(a.Inspect())
+		}
+		if name == "println" {
+			b.WriteString("\n")
+		}
+		if e.in.Out != nil {
+			fmt.Fprint(e.in.Out, b.String())
+		}
+	case "assert":
+		if b, ok := args[0].(*object.Boolean); ok && !b.Value {
+			panic(RuntimeError("assertion failed"))
+		}
+	case "trace":
+	default:
+		panic(fmt.Sprintf("eval: unsupported builtin %s", name))
+	}
+	return nil
+}
+
+// length evaluates the length or capacity argument x of make
+func (e *evaluator) length(x ast.Expr, env *object.Environment) int {
+	n := e.expr(x, env).(*object.Integer).Value
+	if n < 0 {
+		panic(RuntimeError("makeslice: len out of range"))
+	}
+	return int(n)
+}
+
+// elements returns the elements of the slice s, which are nil for nil
+func elements(s object.Object) []object.Object {
+	if a, ok := s.(*object.Array); ok {
+		return a.Elements
+	}
+	return nil
+}
+
+// deferStmt evaluates the function and arguments of the deferred call
+// and pushes it onto the frame
+func (e *evaluator) deferStmt(s *ast.DeferStmt, env *object.Environment) {
+	call := s.Call
+	d := deferred{}
+	if name := e.builtin(call); name != "" {
+		for _, a := range call.Args {
+			d.args = append(d.args, e.assign(a, e.paramType(name, a), env))
+		}
+		d.fn = &object.Builtin{Name: name, Fn: func(args ...object.Object) object.Object {
+			if name == "recover" {
+				// not called by the deferred call, so it recovers nothing
+				return nil
+			}
+			return e.apply(name, args)
+		}}
+	} else {
+		d.fn = e.callee(call.Fun, env)
+		d.args = e.args(call, env)
+	}
+	e.fr.defers = append(e.fr.defers, d)
+}
+
+// catchStmt pushes the handler of the catch statement onto the frame
+func (e *evaluator) catchStmt(s *ast.CatchStmt, env *object.Environment) {
+	sig := e.typeOf(s.Fun).Underlying().(*types.Signature)
+	iface := sig.Params().At(0).Type().Underlying().(*types.Interface)
+	e.fr.defers = append(e.fr.defers, deferred{fn: e.expr(s.Fun, env), catch: iface})
+}
+
+// newPanic returns the panic of the boxed value v
+func (in *Interpreter) newPanic(v object.Object) *Panic {
+	text := PanicText(v, func(recv object.Object, t types.Type, m *types.Func) string {
+		res := in.call(in.method(recv, t, m), nil)
+		return res[0].(*object.String).Value
+	})
+	return &Panic{Value: v, Text: text}
+}
+
+// PanicText describes the panic value v like Go's runtime does, calling
+// the Error or String method m of values of type t with call
+func PanicText(v object.Object, call func(recv object.Object, t types.Type, m *types.Func) string) string {
+	box, ok := v.(*object.Interface)
+	if !ok {
+		return "nil"
+	}
+	t := box.Dynamic
+	for _, name := range []string{"Error", "String"} {
+		obj, _, _ := types.LookupFieldOrMethod(t, false, nil, name)
+		if m, ok := obj.(*types.Func); ok {
+			sig := m.Type().(*types.Signature)
+			if sig.Params().Len() == 0 && sig.Results().Len() == 1 && isString(sig.Results().At(0).Type()) {
+				return call(box.Value, t, m)
+			}
+		}
+	}
+	switch t.Underlying().(type) {
+	case *types.Struct, *types.Interface, *types.Slice, *types.Map, *types.Signature:
+		return "(" + typeString(t) + ")"
+	case *types.Enum:
+		return typeString(t) + "(" + box.Value.Inspect() + ")"
+	}
+	if _, named := t.(*types.Named); !named {
+		return box.Value.Inspect()
+	}
+	if s, ok := box.Value.(*object.String); ok {
+		return fmt.Sprintf("%s(%q)", typeString(t), s.Value)
+	}
+	return typeString(t) + "(" + box.Value.Inspect() + ")"
+}
@@ -0,0 +1,268 @@
+// Package eval executes type-checked wl packages directly in Go, without
+// compiling them to javascript, for running tests and the REPL.
+//
+// Values are the objects of package object. They behave like in pages
+// compiled with BigInts: ints are 64 bits wide and wrap, the zero values
+// of slices and maps are empty rather than nil, struct values are copied
+// where they are stored or passed except to the receivers of methods,
+// which share them, and interface values box their value with its
+// dynamic type. A panic unwinds the calls of the interpreter, running
+// their deferred calls and catch handlers, and is returned as a *Panic
+// if nothing recovers it.
+//
+// The functions of the builtin packages are implemented where that
+// makes sense outside of a browser: the requests of package http are
+// made by an http.Client, and the testing.T of package testing reports
+// the tests run by RunTest. Union types aren't type-checked, so packages
+// can't use them yet.
+package eval
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"weblang/wl/ast"
+	"weblang/wl/object"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// An Interpreter executes the packages loaded into it
+type Interpreter struct {
+	// Out receives the output of print and println
+	Out io.Writer
+
+	// Client makes the requests of package http; http.DefaultClient is
+	// used if it is nil
+	Client *http.Client
+
+	fset  *token.FileSet
+	pkgs  map[*types.Package]*object.Environment
+	funcs map[*types.Func]object.Object
+
+	// current is the frame of the function running
+	current *frame
+
+	// deferring is the frame whose deferred call is starting, which
+	// the call may recover the panic of
+	deferring *frame
+}
+
+// New returns an interpreter for the packages parsed with fset, writing
+// the output of print and println to out
+func New(fset *token.FileSet, out io.Writer) *Interpreter {
+	return &Interpreter{
+		Out:   out,
+		fset:  fset,
+		pkgs:  make(map[*types.Package]*object.Environment),
+		funcs: make(map[*types.Func]object.Object),
+	}
+}
+
+// A Panic is a panic nothing recovered
+type Panic struct {
+	// Value is the boxed value passed to panic, or the error of a
+	// runtime error
+	Value object.Object
+
+	// Text describes the value like the message printed by Go
+	Text string
+
+	// Stack lists the functions the panic unwound, innermost first,
+	// with the position they were at
+	Stack []string
+
+	// goexit is set for the panics stopping tests, like runtime.Goexit
+	// in Go, which recover doesn't stop
+	goexit bool
+}
+
+func (p *Panic) Error() string {
+	return "panic: " + p.Text
+}
+
+// Load declares the functions and methods of the package pkg checked
+// from files, then initializes its variables and runs its init
+// functions. info must record the Types, Defs, Uses and Implicits of
+// the package. The wl packages it imports must be loaded first.
+//
+// Files checked into a package already loaded, like the inputs of the
+// REPL, are loaded next to its files: the variables declared before
+// keep their values.
+func (in *Interpreter) Load(pkg *types.Package, info *types.Info, files []*ast.File) error {
+	env, ok := in.pkgs[pkg]
+	if !ok {
+		env = object.NewEnvironment()
+		in.pkgs[pkg] = env
+	}
+
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		if v, ok := scope.Lookup(name).(*types.Var); ok {
+			if _, ok := env.Get(name); !ok {
+				env.Set(name, object.Zero(v.Type()))
+			}
+		}
+	}
+
+	var inits []*object.Function
+	for _, f := range files {
+		for _, d := range f.Decls {
+			fd, ok := d.(*ast.FuncDecl)
+			if !ok || fd.Body == nil {
+				continue
+			}
+			obj, ok := info.Defs[fd.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+			sig := obj.Type().(*types.Signature)
+			fn := &object.Function{
+				Name:    obj.Name(),
+				Sig:     sig,
+				Recv:    fd.Recv,
+				Params:  fd.Type.Params,
+				Results: fd.Type.Results,
+				Body:    fd.Body,
+				Env:     env,
+				Info:    info,
+			}
+			in.funcs[obj] = fn
+			switch {
+			case fd.Recv != nil:
+			case obj.Name() == "init":
+				inits = append(inits, fn)
+			default:
+				env.Set(obj.Name(), fn)
+			}
+		}
+	}
+
+	return in.protect(func() {
+		e := in.evaluator(info, "init")
+		for _, init := range info.InitOrder {
+			var values []object.Object
+			if len(init.Lhs) == 1 {
+				values = []object.Object{e.assign(init.Rhs, init.Lhs[0].Type(), env)}
+			} else {
+				values = e.values(init.Rhs, env)
+			}
+			for i, v := range init.Lhs {
+				if v.Name() != "_" {
+					env.Set(v.Name(), e.convertValue(values[i], e.resultType(init.Rhs, i), v.Type()))
+				}
+			}
+		}
+		for _, fn := range inits {
+			in.call(fn, nil)
+		}
+	})
+}
+
+// Lookup returns the value of the function or variable name declared
+// by the loaded package pkg
+func (in *Interpreter) Lookup(pkg *types.Package, name string) (object.Object, bool) {
+	env, ok := in.pkgs[pkg]
+	if !ok {
+		return nil, false
+	}
+	return env.Get(name)
+}
+
+// Call calls the function name of the loaded package pkg with args,
+// returning its results
+func (in *Interpreter) Call(pkg *types.Package, name string, args ...object.Object) (results []object.Object, err error) {
+	fn, ok := in.Lookup(pkg, name)
+	if !ok {
+		return nil, fmt.Errorf("%s.%s not found", pkg.Name(), name)
+	}
+	err = in.protect(func() {
+		results = in.call(fn, args)
+	})
+	return results, err
+}
+
+// CallValue calls the function value fn with args, returning its
+// results
+func (in *Interpreter) CallValue(fn object.Object, args ...object.Object) (results []object.Object, err error) {
+	err = in.protect(func() {
+		results = in.call(fn, args)
+	})
+	return results, err
+}
+
+// Eval evaluates the expression x checked with info in the scope of
+// the loaded package pkg, returning its values: none for calls of
+// functions without results, and one for other expressions
+func (in *Interpreter) Eval(pkg *types.Package, info *types.Info, x ast.Expr) (values []object.Object, err error) {
+	env, ok := in.pkgs[pkg]
+	if !ok {
+		return nil, fmt.Errorf("package %s not loaded", pkg.Name())
+	}
+	err = in.protect(func() {
+		e := in.evaluator(info, "eval")
+		if call, ok := ast.Unparen(x).(*ast.CallExpr); ok {
+			values = e.call(call, env)
+			return
+		}
+		values = []object.Object{e.expr(x, env)}
+	})
+	return values, err
+}
+
+// Exec executes the statements list checked with info in the scope of
+// the loaded package pkg. The variables they declare are added to the
+// package.
+func (in *Interpreter) Exec(pkg *types.Package, info *types.Info, list []ast.Stmt) error {
+	env, ok := in.pkgs[pkg]
+	if !ok {
+		return fmt.Errorf("package %s not loaded", pkg.Name())
+	}
+	return in.protect(func() {
+		e := in.evaluator(info, "exec")
+		for _, s := range list {
+			if e.stmt(s, env) != normal {
+				return
+			}
+		}
+	})
+}
+
+// Fset returns the file set of the positions of the packages
+func (in *Interpreter) Fset() *token.FileSet {
+	return in.fset
+}
+
+// Position returns the position of the statement the innermost wl
+// function running is at, for the functions of builtin packages
+func (in *Interpreter) Position() token.Position {
+	if in.current == nil {
+		return token.Position{}
+	}
+	return in.fset.Position(in.current.pos)
+}
+
+// protect runs f, returning the panic unwinding it
+func (in *Interpreter) protect(f func()) (err error) {
+	current := in.current
+	defer func() {
+		in.current, in.deferring = current, nil
+		if r := recover(); r != nil {
+			p, ok := r.(*Panic)
+			if !ok {
+				panic(r)
+			}
+			err = p
+		}
+	}()
+	f()
+	return nil
+}
+
+// evaluator returns an evaluator of code checked with info outside of
+// functions, running in a frame named name until protect returns
+func (in *Interpreter) evaluator(info *types.Info, name string) *evaluator {
+	fr := &frame{name: name, caller: in.current}
+	in.current = fr
+	return &evaluator{in: in, info: info, fr: fr}
+}
@@ -0,0 +1,156 @@
+package eval_test
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"testing"
+	"weblang/wl/ast"
+	"weblang/wl/eval"
+	"weblang/wl/eval/evaltest"
+	"weblang/wl/object"
+	"weblang/wl/parser"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// TestConformance runs the conformance programs of package evaltest
+func TestConformance(t *testing.T) {
+	evaltest.Run(t, func(t *testing.T, p *evaltest.Package, out io.Writer) error {
+		in := eval.New(p.Fset, out)
+		if err := in.Load(p.Pkg, p.Info, p.Files); err != nil {
+			t.Fatalf("Error during load: %v", err)
+		}
+		_, err := in.Call(p.Pkg, "main")
+		return err
+	})
+}
+
+func TestEvalExec(t *testing.T) {
+	in, pkg, fset := load(t, `package p
+
+var total int
+
+func add(n int) {
+	total += n
+}`, nil)
+
+	check := func(src string) *types.Info {
+		info := evaltest.NewInfo()
+		f, err := parser.ParseFile(fset, "exec.wl", "package p\nfunc _() {\n"+src+"\n}", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := f.Decls[0].(*ast.FuncDecl).Body
+		if _, err := types.CheckExpr(fset, pkg, pkg.Scope(), &ast.FuncLit{Type: &ast.FuncType{Params: &ast.FieldList{}}, Body: body}, info); err != nil {
+			t.Fatal(err)
+		}
+		if err := in.Exec(pkg, info, body.List); err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+	check("add(2)\nadd(3)")
+
+	x, err := parser.ParseExprFrom(fset, "eval.wl", "total * 2", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := evaltest.NewInfo()
+	if _, err := types.CheckExpr(fset, pkg, pkg.Scope(), x, info); err != nil {
+		t.Fatal(err)
+	}
+	values, err := in.Eval(pkg, info, x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "10", values[0].Inspect(); want != got {
+		t.Errorf("wanted %s, got %s", want, got)
+	}
+
+	res, err := in.Call(pkg, "add", &object.Integer{Value: 1})
+	if err != nil || len(res) != 0 {
+		t.Fatalf("unexpected results %v, %v", res, err)
+	}
+	if v, _ := in.Lookup(pkg, "total"); v.Inspect() != "6" {
+		t.Errorf("total wanted 6, got %s", v.Inspect())
+	}
+}
+
+func TestRunTest(t *testing.T) {
+	var out bytes.Buffer
+	in, pkg, _ := load(t, `package p
+
+import "testing"
+
+func TestTable(t testing.T) {
+	for _, n := range []int{1, 2, 3} {
+		t.Run("even", func(t testing.T) {
+			if n%2 != 0 {
+				t.Errorf("%d is odd", n)
+			}
+		})
+	}
+}
+
+func TestFatal(t testing.T) {
+	defer func() {
+		if recover() != nil {
+			t.Error("recovered")
+		}
+	}()
+	t.Fatal("stop")
+	t.Error("not reached")
+}
+
+func TestPass(t testing.T) {
+	t.Log("hidden")
+}`, &out)
+
+	for _, test := range []struct {
+		name   string
+		run    []*regexp.Regexp
+		passed bool
+		output string
+	}{
+		{"TestTable", nil, false, `--- FAIL: TestTable (0.00s)
+    --- FAIL: TestTable/even (0.00s)
+        test.wl:9: 1 is odd
+    --- FAIL: TestTable/even#02 (0.00s)
+        test.wl:9: 3 is odd
+`},
+		{"TestTable", []*regexp.Regexp{regexp.MustCompile(""), regexp.MustCompile("#01")}, true, ""},
+		{"TestFatal", nil, false, `--- FAIL: TestFatal (0.00s)
+    test.wl:21: stop
+`},
+		{"TestPass", nil, true, ""},
+	} {
+		out.Reset()
+		passed, err := in.RunTest(pkg, test.name, &eval.TestOptions{Run: test.run})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if passed != test.passed {
+			t.Errorf("%s: passed wanted %v, got %v", test.name, test.passed, passed)
+		}
+		if got := out.String(); got != test.output {
+			t.Errorf("%s: output wanted:\n%s\ngot:\n%s", test.name, test.output, got)
+		}
+	}
+	if _, err := in.RunTest(pkg, "missing", &eval.TestOptions{}); err == nil {
+		t.Error("expected an error running a missing test")
+	}
+}
+
+// load checks and loads the package of src, writing its output to out
+func load(t *testing.T, src string, out *bytes.Buffer) (*eval.Interpreter, *types.Package, *token.FileSet) {
+	p := evaltest.Check(t, "test.wl", src)
+	in := eval.New(p.Fset, nil)
+	if out != nil {
+		in.Out = out
+	}
+	if err := in.Load(p.Pkg, p.Info, p.Files); err != nil {
+		t.Fatalf("Error during load: %v", err)
+	}
+	return in, p.Pkg, p.Fset
+}
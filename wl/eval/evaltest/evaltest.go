@@ -0,0 +1,109 @@
+// Package evaltest holds the conformance programs the interpreters of
+// wl, the one of package eval and the vm, are tested with, and the
+// helpers checking and running them.
+//
+// The programs are the .wl files of testdata. Each is a main package
+// ending with an Output comment holding what running its main function
+// prints, followed by the panic ending it, if any, and its stack.
+package evaltest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"weblang/wl/ast"
+	"weblang/wl/eval"
+	"weblang/wl/importer"
+	"weblang/wl/parser"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// Package is a package checked by Check
+type Package struct {
+	Fset  *token.FileSet
+	Pkg   *types.Package
+	Info  *types.Info
+	Files []*ast.File
+}
+
+// Check parses and type-checks the package of src from the file name,
+// failing t if it has errors
+func Check(t testing.TB, name, src string) *Package {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name, src, 0)
+	if err != nil {
+		t.Fatalf("Error during parse: %v", err)
+	}
+	files := []*ast.File{f}
+	conf := types.Config{Importer: importer.Default()}
+	info := NewInfo()
+	pkg, err := conf.Check(f.Name.Name, fset, files, info)
+	if err != nil {
+		t.Fatalf("Error During Type Check: %v", err)
+	}
+	return &Package{Fset: fset, Pkg: pkg, Info: info, Files: files}
+}
+
+// NewInfo returns the type information the interpreters need
+func NewInfo() *types.Info {
+	return &types.Info{
+		Types:     make(map[ast.Expr]types.TypeAndValue),
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Implicits: make(map[ast.Node]types.Object),
+	}
+}
+
+// Run checks each conformance program and runs it with run in a subtest,
+// comparing what it prints to out and the error it returns with its
+// Output comment
+func Run(t *testing.T, run func(t *testing.T, p *Package, out io.Writer) error) {
+	_, file, _, _ := runtime.Caller(0)
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(file), "testdata", "*.wl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no programs found")
+	}
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.Base(file)
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := run(t, Check(t, name, string(src)), &out); err != nil {
+				fmt.Fprintln(&out, err)
+				if p, ok := err.(*eval.Panic); ok {
+					for _, s := range p.Stack {
+						fmt.Fprintln(&out, s)
+					}
+				}
+			}
+			if want, got := expectedOutput(string(src)), out.String(); want != got {
+				t.Errorf("output wanted:\n%s\ngot:\n%s", want, got)
+			}
+		})
+	}
+}
+
+// expectedOutput returns the text of the Output comment ending src
+func expectedOutput(src string) string {
+	i := strings.Index(src, "// Output:\n")
+	if i < 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(src[i:]), "\n")[1:] {
+		b.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "//"), " ") + "\n")
+	}
+	return b.String()
+}
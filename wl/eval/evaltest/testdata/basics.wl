@@ -0,0 +1,42 @@
+package main
+
+const greeting = "hello"
+
+var counter = next()
+
+func next() int {
+	return 41 + 1
+}
+
+func divmod(a, b int) (q, r int) {
+	q = a / b
+	r = a % b
+	return
+}
+
+func main() {
+	println(greeting, counter)
+	q, r := divmod(17, 5)
+	println(q, r)
+	x := 7
+	x += 3
+	x *= 2
+	x--
+	println(x, -x, x > 10 && x < 20, !(x == 19))
+	f := 1.5
+	f = f * 2
+	println(f, float(x)/2, int(f))
+	s := "wl"
+	s += "!"
+	println(s, s[1:], s[0], s < "x")
+	var big int = 9223372036854775807
+	println(big + 1)
+}
+
+// Output:
+// hello 42
+// 3 2
+// 19 -19 true false
+// 3 9.5 3
+// wl! l! w true
+// -9223372036854775808
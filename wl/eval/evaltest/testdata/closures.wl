@@ -0,0 +1,35 @@
+package main
+
+func counter() func() int {
+	n := 0
+	return func() int {
+		n++
+		return n
+	}
+}
+
+func apply(f func(int) int, x int) int {
+	return f(x)
+}
+
+func main() {
+	c := counter()
+	c()
+	c()
+	println(c(), counter()())
+	k := 10
+	println(apply(func(x int) int { return x + k }, 5))
+	var fs []func() int
+	for i := 0; i < 3; i++ {
+		fs = append(fs, func() int { return i })
+	}
+	for _, f := range fs {
+		print(f())
+	}
+	println()
+}
+
+// Output:
+// 3 1
+// 15
+// 012
@@ -0,0 +1,45 @@
+package main
+
+func classify(n int) string {
+	switch {
+	case n < 0:
+		return "negative"
+	case n == 0:
+		fallthrough
+	case n == 1:
+		return "small"
+	default:
+		return "large"
+	}
+}
+
+func main() {
+	println(classify(-1), classify(0), classify(1), classify(5))
+outer:
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if j == 2 {
+				continue outer
+			}
+			if i == 2 {
+				break outer
+			}
+			print(i, j, " ")
+		}
+	}
+	println()
+	n := 0
+	for n < 10 {
+		n += 3
+	}
+	if m := n * 2; m > 20 {
+		println("big", m)
+	} else {
+		println("small", m)
+	}
+}
+
+// Output:
+// negative small small large
+// 00 01 10 11 
+// big 24
@@ -0,0 +1,68 @@
+package main
+
+type failure struct {
+	code int
+}
+
+func (f failure) Error() string {
+	return "failed"
+}
+
+func safeDiv(a, b int) (q int, err string) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = "recovered"
+		}
+	}()
+	q = a / b
+	return
+}
+
+func order() {
+	defer println()
+	for i := 0; i < 3; i++ {
+		defer print(i)
+	}
+}
+
+func report(e error) {
+	println("caught", e.Error())
+}
+
+func risky(fail bool) int {
+	catch report
+	if fail {
+		panic(failure{1})
+	}
+	return 1
+}
+
+func index(s []int, i int) int {
+	catch func(e error) {
+		println(e.Error())
+	}
+	return s[i]
+}
+
+func main() {
+	println(safeDiv(7, 2))
+	println(safeDiv(1, 0))
+	order()
+	println(risky(false), risky(true))
+	println(index([]int{1}, 3))
+	var x interface{} = "s"
+	n := x.(int)
+	println(n)
+}
+
+// Output:
+// 3 
+// 0 recovered
+// 210
+// caught failed
+// 1 0
+// runtime error: index out of range [3] with length 1
+// 0
+// panic: interface conversion: interface{} is string, not int
+// main
+//	defer.wl:54:2
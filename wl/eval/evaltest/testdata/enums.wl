@@ -0,0 +1,32 @@
+package main
+
+type color enum {
+	Red = 0
+	Green = 1
+	Blue = 2
+}
+
+func (c color) warm() bool {
+	return c == color.Red
+}
+
+func name(c color) string {
+	switch c {
+	case color.Red:
+		return "red"
+	case color.Green, color.Blue:
+		return "cool"
+	}
+	return "?"
+}
+
+func main() {
+	var c color
+	println(c, c.warm(), name(c))
+	c = color.Blue
+	println(c, c.warm(), name(c), c == color.Blue)
+}
+
+// Output:
+// Red true red
+// Blue false cool true
@@ -0,0 +1,61 @@
+package main
+
+type shape interface {
+	area() float
+}
+
+type square struct {
+	side float
+}
+
+func (s square) area() float {
+	return s.side * s.side
+}
+
+type circle struct {
+	r float
+}
+
+func (c circle) area() float {
+	return 3 * c.r * c.r
+}
+
+type any interface{}
+
+func kind(x any) string {
+	switch y := x.(type) {
+	case square:
+		return "square " + y.String()
+	case int, string:
+		return "basic"
+	case nil:
+		return "nil"
+	default:
+		return "other"
+	}
+}
+
+func (s square) String() string {
+	return "of side"
+}
+
+func main() {
+	shapes := []shape{square{2}, circle{1}}
+	total := 0.0
+	for _, s := range shapes {
+		total += s.area()
+	}
+	println(total)
+	var x any = square{1}
+	println(kind(x), kind(3), kind(nil), kind(circle{}))
+	v, ok := x.(shape)
+	println(v.area(), ok, x == square{1}, x != nil)
+	_, ok = x.(circle)
+	println(ok)
+}
+
+// Output:
+// 7
+// square of side basic nil other
+// 1 true true true
+// false
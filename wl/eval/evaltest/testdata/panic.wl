@@ -0,0 +1,24 @@
+package main
+
+func inner(n int) int {
+	return 10 / n
+}
+
+func outer() int {
+	return inner(0)
+}
+
+func main() {
+	println("dividing")
+	println(outer())
+}
+
+// Output:
+// dividing
+// panic: runtime error: integer divide by zero
+// inner
+//	panic.wl:4:2
+// outer
+//	panic.wl:8:14
+// main
+//	panic.wl:13:15
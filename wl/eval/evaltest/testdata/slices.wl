@@ -0,0 +1,45 @@
+package main
+
+type point struct {
+	x, y int
+}
+
+func sum(xs ...int) int {
+	total := 0
+	for _, x := range xs {
+		total += x
+	}
+	return total
+}
+
+func main() {
+	var s []int
+	for i := 0; i < 5; i++ {
+		s = append(s, i*i)
+	}
+	println(s, s[2], s[1:3])
+	t := s[1:3]
+	t[0] = 100
+	println(s)
+	println(sum(), sum(1, 2, 3), sum(s...))
+	m := make([]string, 2)
+	m[1] = "b"
+	println(m, []int{3: 1, 2})
+	ps := []point{{1, 2}, {3, 4}}
+	p := ps[0]
+	p.x = 9
+	ps[1].y = 8
+	println(ps, p)
+	for i, c := range "héllo" {
+		print(" ", i, c)
+	}
+	println()
+}
+
+// Output:
+// [0 1 4 9 16] 4 [1 4]
+// [0 100 4 9 16]
+// 0 6 129
+// [ b] [0 0 0 1 2]
+// [{1 2} {3 8}] {9 2}
+//  0h 1é 3l 4l 5o
@@ -0,0 +1,46 @@
+package main
+
+type point struct {
+	x, y int
+}
+
+type named struct {
+	point
+	name string
+}
+
+func (p point) sum() int {
+	return p.x + p.y
+}
+
+// moved moves its receiver, which methods share with their caller
+func (p point) moved(dx int) point {
+	p.x += dx
+	return p
+}
+
+func main() {
+	a := point{1, 2}
+	b := a
+	b.x = 10
+	println(a.x, b.x, a == b, a == point{x: 1, y: 2})
+	c := a.moved(5)
+	println(a.x, c.x, c.sum())
+	n := named{point: point{3, 4}, name: "n"}
+	println(n.x, n.sum(), n.name)
+	n.y = 6
+	println(n.point.y, n)
+	f := point.sum
+	println(f(a))
+	g := c.sum
+	c.x = 0
+	println(g(), c.sum())
+}
+
+// Output:
+// 1 10 false true
+// 6 6 8
+// 3 7 n
+// 6 {{3 6} n}
+// 8
+// 2 2
@@ -0,0 +1,566 @@
+package eval
+
+import (
+	"fmt"
+	"weblang/wl/ast"
+	"weblang/wl/constant"
+	"weblang/wl/object"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// An evaluator runs the code of a function checked with info in the
+// frame of a call
+type evaluator struct {
+	in   *Interpreter
+	info *types.Info
+	fr   *frame
+
+	// label is the label of the statement a break or continue
+	// statement leaves, or ""
+	label string
+}
+
+// expr evaluates the expression x, which has a single value
+func (e *evaluator) expr(x ast.Expr, env *object.Environment) object.Object {
+	tv := e.info.Types[x]
+	if tv.Value != nil {
+		return constValue(tv.Value, tv.Type)
+	}
+
+	switch x := x.(type) {
+	case *ast.Ident:
+		return e.ident(x, env)
+	case *ast.ParenExpr:
+		return e.expr(x.X, env)
+	case *ast.FuncLit:
+		return &object.Function{
+			Sig:     tv.Type.(*types.Signature),
+			Params:  x.Type.Params,
+			Results: x.Type.Results,
+			Body:    x.Body,
+			Env:     env,
+			Info:    e.info,
+		}
+	case *ast.CompositeLit:
+		return e.compositeLit(x, tv.Type, env)
+	case *ast.SelectorExpr:
+		return e.selector(x, env)
+	case *ast.IndexExpr:
+		v, _ := e.index(x, env)
+		return v
+	case *ast.SliceExpr:
+		return e.slice(x, env)
+	case *ast.TypeAssertExpr:
+		v, _ := e.assert(x, env, false)
+		return v
+	case *ast.CallExpr:
+		res := e.call(x, env)
+		if len(res) == 0 {
+			return object.NULL
+		}
+		return res[0]
+	case *ast.UnaryExpr:
+		return e.unary(x, env)
+	case *ast.BinaryExpr:
+		return e.binary(x, env)
+	}
+	panic(fmt.Sprintf("eval: unsupported expression %T", x))
+}
+
+// values evaluates x, returning the results of calls of functions with
+// several results and the values of comma-ok expressions
+func (e *evaluator) values(x ast.Expr, env *object.Environment) []object.Object {
+	if !e.tuple(x) {
+		return []object.Object{e.expr(x, env)}
+	}
+	switch x := ast.Unparen(x).(type) {
+	case *ast.CallExpr:
+		return e.call(x, env)
+	case *ast.IndexExpr:
+		v, ok := e.index(x, env)
+		return []object.Object{v, object.NativeBool(ok)}
+	case *ast.TypeAssertExpr:
+		v, ok := e.assert(x, env, true)
+		return []object.Object{v, object.NativeBool(ok)}
+	}
+	panic(fmt.Sprintf("eval: unsupported multi-valued expression %T", x))
+}
+
+// typeOf returns the type of x
+func (e *evaluator) typeOf(x ast.Expr) types.Type {
+	return e.info.TypeOf(x)
+}
+
+// tuple reports whether x has several values, or none
+func (e *evaluator) tuple(x ast.Expr) bool {
+	_, ok := e.typeOf(x).(*types.Tuple)
+	return ok
+}
+
+// resultType returns the type of the value i of x
+func (e *evaluator) resultType(x ast.Expr, i int) types.Type {
+	t := e.typeOf(x)
+	if tuple, ok := t.(*types.Tuple); ok {
+		return tuple.At(i).Type()
+	}
+	return t
+}
+
+// assign evaluates x where it is assigned to a variable of type to
+func (e *evaluator) assign(x ast.Expr, to types.Type, env *object.Environment) object.Object {
+	return e.convertValue(e.expr(x, env), e.typeOf(x), to)
+}
+
+// convertValue converts the value v of type from where it is assigned
+// to a variable of type to: interfaces box the values of other types,
+// and struct values are copied
+func (e *evaluator) convertValue(v object.Object, from, to types.Type) object.Object {
+	if v == object.NULL {
+		return v
+	}
+	if to != nil && from != nil && types.IsInterface(to) && !types.IsInterface(from) {
+		return &object.Interface{Dynamic: from, Value: object.Copy(v)}
+	}
+	return object.Copy(v)
+}
+
+// convert converts the value v of type from to the type to, like the
+// conversion to(v)
+func (e *evaluator) convert(v object.Object, from, to types.Type) object.Object {
+	if types.IsInterface(to) {
+		return e.convertValue(v, from, to)
+	}
+	switch t := to.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case isInteger(t):
+			if f, ok := v.(*object.Float); ok {
+				return &object.Integer{Value: int64(f.Value)}
+			}
+		case isFloat(t):
+			if i, ok := v.(*object.Integer); ok {
+				return &object.Float{Value: float64(i.Value)}
+			}
+		case isString(t):
+			if i, ok := v.(*object.Integer); ok {
+				return &object.String{Value: string(rune(i.Value))}
+			}
+		}
+	case *types.Struct:
+		s := object.Copy(v).(*object.Struct)
+		s.StructType = to
+		return s
+	case *types.Enum:
+		if m, ok := v.(*object.Enum); ok {
+			return &object.Enum{EnumType: to, Member: m.Member}
+		}
+	}
+	return v
+}
+
+// constValue returns the object of the constant val of type t
+func constValue(val constant.Value, t types.Type) object.Object {
+	switch val.Kind() {
+	case constant.Bool:
+		return object.NativeBool(constant.BoolVal(val))
+	case constant.String:
+		return &object.String{Value: constant.StringVal(val)}
+	case constant.Int, constant.Float:
+		if b, ok := t.Underlying().(*types.Basic); ok && isFloat(b) {
+			f, _ := constant.Float64Val(val)
+			return &object.Float{Value: f}
+		}
+		i, _ := constant.Int64Val(constant.ToInt(val))
+		return &object.Integer{Value: i}
+	}
+	panic(fmt.Sprintf("eval: unsupported constant %s", val))
+}
+
+// ident evaluates the identifier x
+func (e *evaluator) ident(x *ast.Ident, env *object.Environment) object.Object {
+	switch obj := e.info.Uses[x].(type) {
+	case *types.Var:
+		if global(obj) {
+			env = e.in.pkgs[obj.Pkg()]
+		}
+		if v, ok := env.Get(obj.Name()); ok {
+			return v
+		}
+		panic(fmt.Sprintf("eval: undefined variable %s", obj.Name()))
+	case *types.Func:
+		return e.in.function(obj)
+	case *types.Nil:
+		return object.NULL
+	}
+	panic(fmt.Sprintf("eval: unsupported identifier %s", x.Name))
+}
+
+// global reports whether v is a package-level variable
+func global(v *types.Var) bool {
+	return v.Pkg() != nil && v.Parent() == v.Pkg().Scope()
+}
+
+// compositeLit evaluates the composite literal x of type t
+func (e *evaluator) compositeLit(x *ast.CompositeLit, t types.Type, env *object.Environment) object.Object {
+	switch u := t.Underlying().(type) {
+	case *types.Struct:
+		s := object.Zero(t).(*object.Struct)
+		for i, elt := range x.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				f := e.info.Uses[kv.Key.(*ast.Ident)].(*types.Var)
+				i = fieldIndex(u, f)
+				elt = kv.Value
+			}
+			s.Fields[i] = e.assign(elt, u.Field(i).Type(), env)
+		}
+		return s
+	case *types.Slice:
+		a := &object.Array{}
+		i := 0
+		for _, elt := range x.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				n, _ := constant.Int64Val(e.info.Types[kv.Key].Value)
+				i = int(n)
+				elt = kv.Value
+			}
+			for len(a.Elements) <= i {
+				a.Elements = append(a.Elements, object.Zero(u.Elem()))
+			}
+			a.Elements[i] = e.assign(elt, u.Elem(), env)
+			i++
+		}
+		return a
+	case *types.Map:
+		h := object.NewHash()
+		for _, elt := range x.Elts {
+			kv := elt.(*ast.KeyValueExpr)
+			h.Set(e.assign(kv.Key, u.Key(), env), e.assign(kv.Value, u.Elem(), env))
+		}
+		return h
+	}
+	panic(fmt.Sprintf("eval: unsupported composite literal of type %s", t))
+}
+
+// fieldIndex returns the index of the field f of s
+func fieldIndex(s *types.Struct, f *types.Var) int {
+	for i := 0; i < s.NumFields(); i++ {
+		if s.Field(i) == f {
+			return i
+		}
+	}
+	panic(fmt.Sprintf("eval: %s has no field %s", s, f.Name()))
+}
+
+// selector evaluates the selector expression x: a qualified identifier,
+// enum member, field, method value or method expression
+func (e *evaluator) selector(x *ast.SelectorExpr, env *object.Environment) object.Object {
+	if id, ok := x.X.(*ast.Ident); ok {
+		if _, ok := e.info.Uses[id].(*types.PkgName); ok {
+			return e.ident(x.Sel, env)
+		}
+	}
+
+	switch obj := e.info.Uses[x.Sel].(type) {
+	case *types.Const:
+		return &object.Enum{EnumType: obj.Type(), Member: obj}
+	case *types.Func:
+		tv := e.info.Types[x.X]
+		if tv.IsType() {
+			// the method expression T.m takes the receiver first
+			return &object.Builtin{Name: types.ExprString(x), Fn: func(args ...object.Object) object.Object {
+				res := e.in.call(e.in.method(args[0], tv.Type, obj), args[1:])
+				if len(res) == 0 {
+					return nil
+				}
+				return res[0]
+			}}
+		}
+		return e.in.method(e.expr(x.X, env), tv.Type, obj)
+	case *types.Var:
+		v := e.expr(x.X, env)
+		for _, i := range e.path(x) {
+			v = v.(*object.Struct).Fields[i]
+		}
+		return v
+	}
+	panic(fmt.Sprintf("eval: unsupported selector %s", types.ExprString(x)))
+}
+
+// path returns the indices of the fields the field selector x selects,
+// through the embedded fields it is promoted from
+func (e *evaluator) path(x *ast.SelectorExpr) []int {
+	f := e.info.Uses[x.Sel].(*types.Var)
+	_, index, _ := types.LookupFieldOrMethod(e.typeOf(x.X), false, f.Pkg(), f.Name())
+	return index
+}
+
+// index evaluates the index expression x, reporting whether the key of
+// a map is present
+func (e *evaluator) index(x *ast.IndexExpr, env *object.Environment) (object.Object, bool) {
+	v := e.expr(x.X, env)
+	switch t := e.typeOf(x.X).Underlying().(type) {
+	case *types.Basic:
+		s := v.(*object.String).Value
+		i := e.intIndex(x.Index, len(s), env)
+		return &object.String{Value: s[i : i+1]}, true
+	case *types.Slice:
+		elems := elements(v)
+		return elems[e.intIndex(x.Index, len(elems), env)], true
+	case *types.Map:
+		key := e.assign(x.Index, t.Key(), env)
+		if h, ok := v.(*object.Hash); ok {
+			if v, ok := h.Get(hashable(key)); ok {
+				return v, true
+			}
+		}
+		return object.Zero(t.Elem()), false
+	}
+	panic(fmt.Sprintf("eval: unsupported index expression %s", types.ExprString(x)))
+}
+
+// intIndex evaluates the index x of a slice or string of length n
+func (e *evaluator) intIndex(x ast.Expr, n int, env *object.Environment) int {
+	i := e.expr(x, env).(*object.Integer).Value
+	if i < 0 || i >= int64(n) {
+		panic(RuntimeError("index out of range [%d] with length %d", i, n))
+	}
+	return int(i)
+}
+
+// hashable returns the map key v
+func hashable(v object.Object) object.Hashable {
+	h, ok := v.(object.Hashable)
+	if !ok {
+		panic(RuntimeError("hash of unhashable type %s", v.Type()))
+	}
+	return h
+}
+
+// slice evaluates the slice expression x
+func (e *evaluator) slice(x *ast.SliceExpr, env *object.Environment) object.Object {
+	v := e.expr(x.X, env)
+	var n, max int
+	s, isString := v.(*object.String)
+	if isString {
+		n = len(s.Value)
+		max = n
+	} else {
+		elems := elements(v)
+		n, max = len(elems), cap(elems)
+	}
+
+	bound := func(x ast.Expr, def int) int {
+		if x == nil {
+			return def
+		}
+		return int(e.expr(x, env).(*object.Integer).Value)
+	}
+	lo, hi := bound(x.Low, 0), bound(x.High, n)
+	m := bound(x.Max, max)
+	if hi < 0 || hi > max || m > max || hi > m {
+		panic(RuntimeError("slice bounds out of range [:%d] with capacity %d", hi, max))
+	}
+	if lo < 0 || lo > hi {
+		panic(RuntimeError("slice bounds out of range [%d:%d]", lo, hi))
+	}
+	if isString {
+		return &object.String{Value: s.Value[lo:hi]}
+	}
+	return &object.Array{Elements: elements(v)[lo:hi:m]}
+}
+
+// assert evaluates the type assertion x. Failed assertions panic
+// unless commaOk is set, then they return the zero value.
+func (e *evaluator) assert(x *ast.TypeAssertExpr, env *object.Environment, commaOk bool) (object.Object, bool) {
+	v := e.expr(x.X, env)
+	t := e.info.Types[x.Type].Type
+	if res, ok := assertType(v, t); ok {
+		return res, true
+	}
+	if commaOk {
+		return object.Zero(t), false
+	}
+
+	from := typeString(e.typeOf(x.X))
+	box, ok := v.(*object.Interface)
+	switch {
+	case !ok:
+		panic(ErrorPanic(fmt.Sprintf("interface conversion: %s is nil, not %s", from, typeString(t))))
+	case types.IsInterface(t):
+		m, _ := types.MissingMethod(box.Dynamic, t.Underlying().(*types.Interface), true)
+		panic(ErrorPanic(fmt.Sprintf("interface conversion: %s is not %s: missing method %s", typeString(box.Dynamic), typeString(t), m.Name())))
+	}
+	panic(ErrorPanic(fmt.Sprintf("interface conversion: %s is %s, not %s", from, typeString(box.Dynamic), typeString(t))))
+}
+
+// assertType returns the value of the interface value v as type t,
+// reporting whether v holds a t
+func assertType(v object.Object, t types.Type) (object.Object, bool) {
+	box, ok := v.(*object.Interface)
+	if !ok {
+		return nil, false
+	}
+	if iface, ok := t.Underlying().(*types.Interface); ok {
+		return box, types.Implements(box.Dynamic, iface)
+	}
+	return box.Value, types.Identical(box.Dynamic, t)
+}
+
+// unary evaluates the unary expression x
+func (e *evaluator) unary(x *ast.UnaryExpr, env *object.Environment) object.Object {
+	v := e.expr(x.X, env)
+	switch x.Op {
+	case token.ADD:
+		return v
+	case token.SUB:
+		switch v := v.(type) {
+		case *object.Integer:
+			return &object.Integer{Value: -v.Value}
+		case *object.Float:
+			return &object.Float{Value: -v.Value}
+		}
+	case token.XOR:
+		return &object.Integer{Value: ^v.(*object.Integer).Value}
+	case token.NOT:
+		return object.NativeBool(!v.(*object.Boolean).Value)
+	}
+	panic(fmt.Sprintf("eval: unsupported unary operation %s%s", x.Op, v.Type()))
+}
+
+// binary evaluates the binary expression x
+func (e *evaluator) binary(x *ast.BinaryExpr, env *object.Environment) object.Object {
+	switch x.Op {
+	case token.LAND:
+		if !e.expr(x.X, env).(*object.Boolean).Value {
+			return object.FALSE
+		}
+		return e.expr(x.Y, env)
+	case token.LOR:
+		if e.expr(x.X, env).(*object.Boolean).Value {
+			return object.TRUE
+		}
+		return e.expr(x.Y, env)
+	case token.EQL, token.NEQ:
+		eq := e.equal(e.expr(x.X, env), e.typeOf(x.X), e.expr(x.Y, env), e.typeOf(x.Y))
+		return object.NativeBool(eq == (x.Op == token.EQL))
+	}
+	return operate(x.Op, e.expr(x.X, env), e.expr(x.Y, env))
+}
+
+// equal reports whether the values x of type xt and y of type yt are
+// equal, comparing interfaces with the other values boxed
+func (e *evaluator) equal(x object.Object, xt types.Type, y object.Object, yt types.Type) bool {
+	switch {
+	case types.IsInterface(xt) && !types.IsInterface(yt):
+		y = e.convertValue(y, yt, xt)
+	case types.IsInterface(yt) && !types.IsInterface(xt):
+		x = e.convertValue(x, xt, yt)
+	}
+	eq, ok := object.Equal(x, y)
+	if !ok {
+		panic(RuntimeError("comparing uncomparable type %s", typeString(x.(*object.Interface).Dynamic)))
+	}
+	return eq
+}
+
+// operate applies the arithmetic or ordering operator op to x and y
+func operate(op token.Token, x, y object.Object) object.Object {
+	switch x := x.(type) {
+	case *object.Integer:
+		a, b := x.Value, y.(*object.Integer).Value
+		switch op {
+		case token.ADD:
+			return &object.Integer{Value: a + b}
+		case token.SUB:
+			return &object.Integer{Value: a - b}
+		case token.MUL:
+			return &object.Integer{Value: a * b}
+		case token.QUO, token.REM:
+			if b == 0 {
+				panic(RuntimeError("integer divide by zero"))
+			}
+			if op == token.QUO {
+				return &object.Integer{Value: a / b}
+			}
+			return &object.Integer{Value: a % b}
+		case token.AND:
+			return &object.Integer{Value: a & b}
+		case token.OR:
+			return &object.Integer{Value: a | b}
+		case token.XOR:
+			return &object.Integer{Value: a ^ b}
+		case token.SHL, token.SHR:
+			if b < 0 {
+				panic(RuntimeError("negative shift amount"))
+			}
+			if op == token.SHL {
+				return &object.Integer{Value: a << uint64(b)}
+			}
+			return &object.Integer{Value: a >> uint64(b)}
+		case token.LSS:
+			return object.NativeBool(a < b)
+		case token.LEQ:
+			return object.NativeBool(a <= b)
+		case token.GTR:
+			return object.NativeBool(a > b)
+		case token.GEQ:
+			return object.NativeBool(a >= b)
+		}
+	case *object.Float:
+		a, b := x.Value, y.(*object.Float).Value
+		switch op {
+		case token.ADD:
+			return &object.Float{Value: a + b}
+		case token.SUB:
+			return &object.Float{Value: a - b}
+		case token.MUL:
+			return &object.Float{Value: a * b}
+		case token.QUO:
+			return &object.Float{Value: a / b}
+		case token.LSS:
+			return object.NativeBool(a < b)
+		case token.LEQ:
+			return object.NativeBool(a <= b)
+		case token.GTR:
+			return object.NativeBool(a > b)
+		case token.GEQ:
+			return object.NativeBool(a >= b)
+		}
+	case *object.String:
+		a, b := x.Value, y.(*object.String).Value
+		switch op {
+		case token.ADD:
+			return &object.String{Value: a + b}
+		case token.LSS:
+			return object.NativeBool(a < b)
+		case token.LEQ:
+			return object.NativeBool(a <= b)
+		case token.GTR:
+			return object.NativeBool(a > b)
+		case token.GEQ:
+			return object.NativeBool(a >= b)
+		}
+	}
+	panic(fmt.Sprintf("eval: unsupported operation %s %s %s", x.Type(), op, y.Type()))
+}
+
+// typeString returns the name of t qualified by package names
+func typeString(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string { return p.Name() })
+}
+
+func isInteger(t types.Type) bool {
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&types.IsInteger != 0
+}
+
+func isFloat(t types.Type) bool {
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&types.IsFloat != 0
+}
+
+func isString(t types.Type) bool {
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&types.IsString != 0
+}
@@ -0,0 +1,130 @@
+package eval
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"weblang/wl/object"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// errorType is the type of the errors of runtime panics, like the
+// runtime.Error of compiled pages
+var errorType = func() *types.Named {
+	pkg := types.NewPackage("runtime", "runtime")
+	obj := types.NewTypeName(token.NoPos, pkg, "Error", nil)
+	named := types.NewNamed(obj, types.NewStruct(nil, nil), nil)
+	res := types.NewTuple(types.NewParam(token.NoPos, pkg, "", types.Typ[types.String]))
+	recv := types.NewParam(token.NoPos, pkg, "", named)
+	named.AddMethod(types.NewFunc(token.NoPos, pkg, "Error", types.NewSignature(recv, nil, res, false)))
+	return named
+}()
+
+// RuntimeError returns the panic of a runtime error
+func RuntimeError(format string, args ...interface{}) *Panic {
+	return ErrorPanic("runtime error: " + fmt.Sprintf(format, args...))
+}
+
+// ErrorPanic returns the panic of an error with the message msg
+func ErrorPanic(msg string) *Panic {
+	return &Panic{
+		Value: &object.Interface{Dynamic: errorType, Value: &object.Error{Message: msg}},
+		Text:  msg,
+	}
+}
+
+// A native implements a function or method of a builtin package
+type native func(client func() *http.Client, fn *types.Func, args []object.Object) object.Object
+
+// natives are the functions of the builtin packages by package path,
+// and name or receiver type and method name
+var natives = map[string]map[string]native{
+	"runtime": {
+		"Error.Error": func(client func() *http.Client, fn *types.Func, args []object.Object) object.Object {
+			return &object.String{Value: args[0].(*object.Error).Message}
+		},
+	},
+	"http": {
+		"Get": func(client func() *http.Client, fn *types.Func, args []object.Object) object.Object {
+			url := args[0].(*object.String).Value
+			return response(client(), fn, func(c *http.Client) (*http.Response, error) {
+				return c.Get(url)
+			})
+		},
+		"Post": func(client func() *http.Client, fn *types.Func, args []object.Object) object.Object {
+			url := args[0].(*object.String).Value
+			contentType := args[1].(*object.String).Value
+			body := args[2].(*object.String).Value
+			return response(client(), fn, func(c *http.Client) (*http.Response, error) {
+				return c.Post(url, contentType, strings.NewReader(body))
+			})
+		},
+	},
+	"router": {
+		"Path": func(client func() *http.Client, fn *types.Func, args []object.Object) object.Object {
+			return object.Zero(fn.Type().(*types.Signature).Results().At(0).Type())
+		},
+	},
+}
+
+// native returns the implementation of the function or method fn of a
+// builtin package
+func (in *Interpreter) native(fn *types.Func) object.Object {
+	return Native(fn, func() *http.Client { return in.Client })
+}
+
+// Native returns the implementation of the function or method fn of a
+// builtin package, making http requests with the client returned by
+// client, or http.DefaultClient if it is nil. The functions without an
+// implementation panic when they are called.
+func Native(fn *types.Func, client func() *http.Client) *object.Builtin {
+	name := fn.Name()
+	if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+		if named, ok := recv.Type().(*types.Named); ok {
+			name = named.Obj().Name() + "." + name
+		}
+	}
+	path := ""
+	if fn.Pkg() != nil {
+		path = fn.Pkg().Path()
+	}
+	f, ok := natives[path][name]
+	return &object.Builtin{Name: path + "." + name, Fn: func(args ...object.Object) object.Object {
+		if !ok {
+			panic(ErrorPanic(fmt.Sprintf("%s.%s is not available", path, name)))
+		}
+		return f(client, fn, args)
+	}}
+}
+
+// response makes the request of the http function fn with client,
+// returning the http.Response of the server's response
+func response(client *http.Client, fn *types.Func, request func(*http.Client) (*http.Response, error)) object.Object {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := request(client)
+	if err != nil {
+		panic(ErrorPanic(err.Error()))
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		panic(ErrorPanic(err.Error()))
+	}
+
+	t := fn.Type().(*types.Signature).Results().At(0).Type()
+	res := object.Zero(t).(*object.Struct)
+	s := t.Underlying().(*types.Struct)
+	for i := 0; i < s.NumFields(); i++ {
+		switch s.Field(i).Name() {
+		case "Status":
+			res.Fields[i] = &object.Integer{Value: int64(resp.StatusCode)}
+		case "Body":
+			res.Fields[i] = &object.String{Value: string(body)}
+		}
+	}
+	return res
+}
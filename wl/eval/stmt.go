@@ -0,0 +1,577 @@
+package eval
+
+import (
+	"fmt"
+	"weblang/wl/ast"
+	"weblang/wl/object"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// control is how a statement transfers control
+type control int
+
+const (
+	normal control = iota
+	breaking
+	continuing
+	fallingThrough
+	returning
+)
+
+// stmts executes the statement list. The variables each statement
+// declares are declared in a new environment, so the closures created
+// before see the variables they were created with.
+func (e *evaluator) stmts(list []ast.Stmt, env *object.Environment) control {
+	for _, s := range list {
+		if declares(s) {
+			env = object.NewEnclosedEnvironment(env)
+		}
+		if c := e.stmt(s, env); c != normal {
+			return c
+		}
+	}
+	return normal
+}
+
+// declares reports whether s declares variables
+func declares(s ast.Stmt) bool {
+	switch s := s.(type) {
+	case *ast.AssignStmt:
+		return s.Tok == token.DEFINE
+	case *ast.DeclStmt:
+		d, ok := s.Decl.(*ast.GenDecl)
+		return ok && d.Tok == token.VAR
+	}
+	return false
+}
+
+// block executes the statements of a block in a new environment
+func (e *evaluator) block(list []ast.Stmt, env *object.Environment) control {
+	return e.stmts(list, object.NewEnclosedEnvironment(env))
+}
+
+// stmt executes the statement s
+func (e *evaluator) stmt(s ast.Stmt, env *object.Environment) control {
+	e.fr.pos = s.Pos()
+
+	switch s := s.(type) {
+	case *ast.EmptyStmt:
+	case *ast.ExprStmt:
+		if call, ok := ast.Unparen(s.X).(*ast.CallExpr); ok {
+			e.call(call, env)
+		} else {
+			e.expr(s.X, env)
+		}
+	case *ast.DeclStmt:
+		e.declStmt(s.Decl.(*ast.GenDecl), env)
+	case *ast.AssignStmt:
+		e.assignStmt(s, env)
+	case *ast.IncDecStmt:
+		loc := e.location(s.X, env)
+		one := object.Object(&object.Integer{Value: 1})
+		if isFloat(e.typeOf(s.X)) {
+			one = &object.Float{Value: 1}
+		}
+		op := token.ADD
+		if s.Tok == token.DEC {
+			op = token.SUB
+		}
+		loc.set(operate(op, loc.get(), one))
+	case *ast.BlockStmt:
+		return e.block(s.List, env)
+	case *ast.IfStmt:
+		env = object.NewEnclosedEnvironment(env)
+		if s.Init != nil {
+			e.stmt(s.Init, env)
+		}
+		if e.expr(s.Cond, env).(*object.Boolean).Value {
+			return e.block(s.Body.List, env)
+		}
+		if s.Else != nil {
+			return e.stmt(s.Else, env)
+		}
+	case *ast.ForStmt:
+		return e.forStmt(s, "", env)
+	case *ast.RangeStmt:
+		return e.rangeStmt(s, "", env)
+	case *ast.SwitchStmt:
+		return e.switchStmt(s, "", env)
+	case *ast.TypeSwitchStmt:
+		return e.typeSwitchStmt(s, "", env)
+	case *ast.LabeledStmt:
+		label := s.Label.Name
+		var c control
+		switch t := s.Stmt.(type) {
+		case *ast.ForStmt:
+			c = e.forStmt(t, label, env)
+		case *ast.RangeStmt:
+			c = e.rangeStmt(t, label, env)
+		case *ast.SwitchStmt:
+			c = e.switchStmt(t, label, env)
+		case *ast.TypeSwitchStmt:
+			c = e.typeSwitchStmt(t, label, env)
+		default:
+			c = e.stmt(t, env)
+		}
+		if c == breaking && e.label == label {
+			e.label = ""
+			return normal
+		}
+		return c
+	case *ast.BranchStmt:
+		if s.Label != nil {
+			e.label = s.Label.Name
+		}
+		switch s.Tok {
+		case token.BREAK:
+			return breaking
+		case token.CONTINUE:
+			return continuing
+		case token.FALLTHROUGH:
+			return fallingThrough
+		}
+		panic(fmt.Sprintf("eval: unsupported branch statement %s", s.Tok))
+	case *ast.ReturnStmt:
+		e.returnStmt(s, env)
+		return returning
+	case *ast.DeferStmt:
+		e.deferStmt(s, env)
+	case *ast.CatchStmt:
+		e.catchStmt(s, env)
+	default:
+		panic(fmt.Sprintf("eval: unsupported statement %T", s))
+	}
+	return normal
+}
+
+// declStmt declares the variables of a var declaration in env
+func (e *evaluator) declStmt(d *ast.GenDecl, env *object.Environment) {
+	if d.Tok != token.VAR {
+		return
+	}
+	for _, spec := range d.Specs {
+		s := spec.(*ast.ValueSpec)
+		values := make([]object.Object, len(s.Names))
+		switch {
+		case len(s.Values) == 0:
+			for i, name := range s.Names {
+				values[i] = object.Zero(e.info.Defs[name].Type())
+			}
+		case len(s.Values) == len(s.Names):
+			for i, name := range s.Names {
+				values[i] = e.assign(s.Values[i], e.info.Defs[name].Type(), env)
+			}
+		default:
+			res := e.values(s.Values[0], env)
+			for i, name := range s.Names {
+				values[i] = e.convertValue(res[i], e.resultType(s.Values[0], i), e.info.Defs[name].Type())
+			}
+		}
+		for i, name := range s.Names {
+			if name.Name != "_" {
+				env.Set(name.Name, values[i])
+			}
+		}
+	}
+}
+
+// assignStmt executes an assignment or short variable declaration
+func (e *evaluator) assignStmt(s *ast.AssignStmt, env *object.Environment) {
+	switch s.Tok {
+	case token.ASSIGN, token.DEFINE:
+	default:
+		// x op= y
+		loc := e.location(s.Lhs[0], env)
+		op := s.Tok + (token.ADD - token.ADD_ASSIGN)
+		loc.set(operate(op, loc.get(), e.expr(s.Rhs[0], env)))
+		return
+	}
+
+	// the operands of the left hand side are evaluated first
+	locs := make([]location, len(s.Lhs))
+	for i, x := range s.Lhs {
+		if id, ok := x.(*ast.Ident); ok && s.Tok == token.DEFINE {
+			if obj := e.info.Defs[id]; obj != nil || id.Name == "_" {
+				name := id.Name
+				locs[i] = location{set: func(v object.Object) {
+					if name != "_" {
+						env.Set(name, v)
+					}
+				}}
+				continue
+			}
+		}
+		locs[i] = e.location(x, env)
+	}
+
+	values := make([]object.Object, len(s.Lhs))
+	if len(s.Rhs) == len(s.Lhs) {
+		for i, x := range s.Rhs {
+			values[i] = e.assign(x, e.lhsType(s.Lhs[i]), env)
+		}
+	} else {
+		res := e.values(s.Rhs[0], env)
+		for i := range values {
+			values[i] = e.convertValue(res[i], e.resultType(s.Rhs[0], i), e.lhsType(s.Lhs[i]))
+		}
+	}
+	for i, loc := range locs {
+		loc.set(values[i])
+	}
+}
+
+// lhsType returns the type of the variable or element assigned by x,
+// or nil for the blank identifier
+func (e *evaluator) lhsType(x ast.Expr) types.Type {
+	if id, ok := x.(*ast.Ident); ok {
+		if obj := e.info.Defs[id]; obj != nil {
+			return obj.Type()
+		}
+		if obj := e.info.Uses[id]; obj != nil {
+			return obj.Type()
+		}
+		return nil
+	}
+	return e.typeOf(x)
+}
+
+// A location is a variable, element or field assigned to
+type location struct {
+	get func() object.Object
+	set func(object.Object)
+}
+
+// location evaluates the operands of the assignable expression x
+func (e *evaluator) location(x ast.Expr, env *object.Environment) location {
+	switch x := ast.Unparen(x).(type) {
+	case *ast.Ident:
+		if x.Name == "_" {
+			return location{set: func(object.Object) {}}
+		}
+		v, _ := e.info.Uses[x].(*types.Var)
+		if v == nil {
+			v = e.info.Defs[x].(*types.Var)
+		}
+		name := x.Name
+		if global(v) {
+			env = e.in.pkgs[v.Pkg()]
+		}
+		return location{
+			get: func() object.Object {
+				obj, _ := env.Get(name)
+				return obj
+			},
+			set: func(obj object.Object) {
+				if !env.Assign(name, obj) {
+					env.Set(name, obj)
+				}
+			},
+		}
+	case *ast.IndexExpr:
+		v := e.expr(x.X, env)
+		switch t := e.typeOf(x.X).Underlying().(type) {
+		case *types.Slice:
+			elems := elements(v)
+			i := e.intIndex(x.Index, len(elems), env)
+			return location{
+				get: func() object.Object { return elems[i] },
+				set: func(obj object.Object) { elems[i] = obj },
+			}
+		case *types.Map:
+			key := e.assign(x.Index, t.Key(), env)
+			h, ok := v.(*object.Hash)
+			return location{
+				get: func() object.Object {
+					if ok {
+						if v, ok := h.Get(hashable(key)); ok {
+							return v
+						}
+					}
+					return object.Zero(t.Elem())
+				},
+				set: func(obj object.Object) {
+					if !ok {
+						panic(ErrorPanic("assignment to entry in nil map"))
+					}
+					hashable(key)
+					h.Set(key, obj)
+				},
+			}
+		}
+	case *ast.SelectorExpr:
+		if _, ok := e.info.Uses[x.Sel].(*types.Var); ok {
+			v := e.expr(x.X, env)
+			path := e.path(x)
+			for _, i := range path[:len(path)-1] {
+				v = v.(*object.Struct).Fields[i]
+			}
+			s, i := v.(*object.Struct), path[len(path)-1]
+			return location{
+				get: func() object.Object { return s.Fields[i] },
+				set: func(obj object.Object) { s.Fields[i] = obj },
+			}
+		}
+		if id, ok := x.X.(*ast.Ident); ok {
+			if _, ok := e.info.Uses[id].(*types.PkgName); ok {
+				return e.location(x.Sel, env)
+			}
+		}
+	}
+	panic(fmt.Sprintf("eval: cannot assign to %s", types.ExprString(x)))
+}
+
+// loop reports how a loop goes on after its body transferred control
+// with c: whether it stops, and the control of the loop if it does
+func (e *evaluator) loop(c control, label string) (stop bool, res control) {
+	switch c {
+	case normal:
+		return false, normal
+	case breaking, continuing:
+		if e.label != "" && e.label != label {
+			return true, c
+		}
+		e.label = ""
+		return c == breaking, normal
+	}
+	return true, c
+}
+
+// forStmt executes the for statement s labeled label. Each iteration
+// has its own copy of the variables declared by the init statement.
+func (e *evaluator) forStmt(s *ast.ForStmt, label string, env *object.Environment) control {
+	env = object.NewEnclosedEnvironment(env)
+	var vars []string
+	if s.Init != nil {
+		e.stmt(s.Init, env)
+		if a, ok := s.Init.(*ast.AssignStmt); ok && a.Tok == token.DEFINE {
+			for _, x := range a.Lhs {
+				if id := x.(*ast.Ident); e.info.Defs[id] != nil && id.Name != "_" {
+					vars = append(vars, id.Name)
+				}
+			}
+		}
+	}
+
+	iter := env
+	for {
+		if s.Cond != nil && !e.expr(s.Cond, iter).(*object.Boolean).Value {
+			return normal
+		}
+		if stop, c := e.loop(e.block(s.Body.List, iter), label); stop {
+			return c
+		}
+		if len(vars) > 0 {
+			next := object.NewEnclosedEnvironment(env)
+			for _, name := range vars {
+				v, _ := iter.Get(name)
+				next.Set(name, object.Copy(v))
+			}
+			iter = next
+		}
+		if s.Post != nil {
+			e.stmt(s.Post, iter)
+		}
+	}
+}
+
+// rangeStmt executes the range statement s labeled label. It ranges
+// over the elements or keys the operand had when the loop started.
+func (e *evaluator) rangeStmt(s *ast.RangeStmt, label string, env *object.Environment) control {
+	v := e.expr(s.X, env)
+
+	var keys, values []object.Object
+	switch v := v.(type) {
+	case *object.String:
+		for i, r := range v.Value {
+			keys = append(keys, &object.Integer{Value: int64(i)})
+			values = append(values, &object.String{Value: string(r)})
+		}
+	case *object.Array:
+		for i, elem := range v.Elements {
+			keys = append(keys, &object.Integer{Value: int64(i)})
+			values = append(values, elem)
+		}
+	case *object.Hash:
+		for _, k := range v.Keys {
+			p := v.Pairs[k]
+			keys = append(keys, p.Key)
+			values = append(values, p.Value)
+		}
+	}
+
+	for i, key := range keys {
+		if h, ok := v.(*object.Hash); ok {
+			// the current value of each key, skipping the keys removed
+			p, ok := h.Pairs[hashable(key).HashKey()]
+			if !ok {
+				continue
+			}
+			values[i] = p.Value
+		}
+
+		iter := object.NewEnclosedEnvironment(env)
+		for j, x := range []ast.Expr{s.Key, s.Value} {
+			if x == nil {
+				continue
+			}
+			val := key
+			if j == 1 {
+				val = object.Copy(values[i])
+			}
+			if s.Tok == token.DEFINE {
+				if id := x.(*ast.Ident); id.Name != "_" {
+					iter.Set(id.Name, val)
+				}
+			} else {
+				e.location(x, env).set(val)
+			}
+		}
+		if stop, c := e.loop(e.block(s.Body.List, iter), label); stop {
+			return c
+		}
+	}
+	return normal
+}
+
+// switchStmt executes the switch statement s labeled label
+func (e *evaluator) switchStmt(s *ast.SwitchStmt, label string, env *object.Environment) control {
+	env = object.NewEnclosedEnvironment(env)
+	if s.Init != nil {
+		e.stmt(s.Init, env)
+	}
+	var tag object.Object = object.TRUE
+	var tagType types.Type = types.Typ[types.Bool]
+	if s.Tag != nil {
+		tag, tagType = e.expr(s.Tag, env), e.typeOf(s.Tag)
+	}
+
+	match := -1
+	clauses := s.Body.List
+loop:
+	for i, c := range clauses {
+		clause := c.(*ast.CaseClause)
+		if clause.List == nil {
+			if match < 0 {
+				match = i
+			}
+			continue
+		}
+		for _, x := range clause.List {
+			if e.equal(tag, tagType, e.expr(x, env), e.typeOf(x)) {
+				match = i
+				break loop
+			}
+		}
+	}
+	if match < 0 {
+		return normal
+	}
+	for i := match; i < len(clauses); i++ {
+		c := e.block(clauses[i].(*ast.CaseClause).Body, env)
+		if c == fallingThrough {
+			continue
+		}
+		return e.switchControl(c, label)
+	}
+	return normal
+}
+
+// switchControl returns the control of a switch statement labeled label
+// whose clause transferred control with c
+func (e *evaluator) switchControl(c control, label string) control {
+	if c == breaking && (e.label == "" || e.label == label) {
+		e.label = ""
+		return normal
+	}
+	return c
+}
+
+// typeSwitchStmt executes the type switch statement s labeled label
+func (e *evaluator) typeSwitchStmt(s *ast.TypeSwitchStmt, label string, env *object.Environment) control {
+	env = object.NewEnclosedEnvironment(env)
+	if s.Init != nil {
+		e.stmt(s.Init, env)
+	}
+	var name string
+	var guard ast.Expr
+	switch a := s.Assign.(type) {
+	case *ast.ExprStmt:
+		guard = a.X
+	case *ast.AssignStmt:
+		name, guard = a.Lhs[0].(*ast.Ident).Name, a.Rhs[0]
+	}
+	v := e.expr(ast.Unparen(guard).(*ast.TypeAssertExpr).X, env)
+
+	var match *ast.CaseClause
+	value := v
+loop:
+	for _, c := range s.Body.List {
+		clause := c.(*ast.CaseClause)
+		if clause.List == nil {
+			if match == nil {
+				match = clause
+			}
+			continue
+		}
+		for _, x := range clause.List {
+			tv := e.info.Types[x]
+			if tv.IsNil() {
+				if v == object.NULL {
+					match = clause
+					break loop
+				}
+				continue
+			}
+			if res, ok := assertType(v, tv.Type); ok {
+				match = clause
+				if len(clause.List) == 1 {
+					value = res
+				}
+				break loop
+			}
+		}
+	}
+	if match == nil {
+		return normal
+	}
+	clauseEnv := object.NewEnclosedEnvironment(env)
+	if name != "" && name != "_" {
+		clauseEnv.Set(name, value)
+	}
+	return e.switchControl(e.stmts(match.Body, clauseEnv), label)
+}
+
+// returnStmt sets the results of the function returning
+func (e *evaluator) returnStmt(s *ast.ReturnStmt, env *object.Environment) {
+	fr := e.fr
+	if len(s.Results) == 0 {
+		return
+	}
+	results := fr.fn.Sig.Results()
+	values := make([]object.Object, results.Len())
+	if len(s.Results) == results.Len() {
+		for i, x := range s.Results {
+			values[i] = e.assign(x, results.At(i).Type(), env)
+		}
+	} else {
+		res := e.values(s.Results[0], env)
+		for i := range values {
+			values[i] = e.convertValue(res[i], e.resultType(s.Results[0], i), results.At(i).Type())
+		}
+	}
+
+	if fr.named == nil {
+		fr.results = values
+		return
+	}
+	i := 0
+	for _, f := range fr.fn.Results.List {
+		for _, name := range f.Names {
+			if name.Name != "_" {
+				fr.named.Assign(name.Name, values[i])
+			}
+			i++
+		}
+	}
+}
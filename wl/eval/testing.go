@@ -0,0 +1,265 @@
+package eval
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"weblang/wl/object"
+	"weblang/wl/types"
+)
+
+// TestOptions are the options of RunTest
+type TestOptions struct {
+	// Run selects the tests and subtests to run like go test -run: the
+	// elements of their names separated by slashes must match the
+	// pattern of the same level, if there is one
+	Run []*regexp.Regexp
+
+	// Verbose reports the tests that pass and their logs too
+	Verbose bool
+}
+
+// Match reports whether the test or subtest named elem at level, 0 for
+// tests, is selected by the Run patterns
+func (o *TestOptions) Match(level int, elem string) bool {
+	return level >= len(o.Run) || o.Run[level].MatchString(elem)
+}
+
+// IsTestFunc reports whether the signature of fn is the one of test
+// functions, taking a testing.T and returning nothing
+func IsTestFunc(fn *types.Func) bool {
+	sig := fn.Type().(*types.Signature)
+	if sig.Recv() != nil || sig.Params().Len() != 1 || sig.Results().Len() != 0 {
+		return false
+	}
+	t, ok := sig.Params().At(0).Type().(*types.Named)
+	return ok && t.Obj().Pkg() != nil && t.Obj().Pkg().Path() == "testing" && t.Obj().Name() == "T"
+}
+
+// RunTest runs the test function name of the loaded package pkg and the
+// subtests it runs, writing the report of their failures to Out like go
+// test. A test fails if it panics, after its deferred calls ran; unlike
+// in Go, the other tests still run. It reports whether the test passed.
+func (in *Interpreter) RunTest(pkg *types.Package, name string, opts *TestOptions) (passed bool, err error) {
+	obj, _ := pkg.Scope().Lookup(name).(*types.Func)
+	fn, ok := in.Lookup(pkg, name)
+	if obj == nil || !ok || !IsTestFunc(obj) {
+		return false, fmt.Errorf("%s.%s is not a test function", pkg.Name(), name)
+	}
+	t := &test{
+		in:   in,
+		opts: opts,
+		typ:  obj.Type().(*types.Signature).Params().At(0).Type(),
+		name: name,
+	}
+	return t.run(fn), nil
+}
+
+// A test is the state of a test or subtest running, which the
+// testing.T values passed to it hold in their field
+type test struct {
+	in     *Interpreter
+	opts   *TestOptions
+	typ    types.Type // testing.T
+	name   string
+	level  int
+	parent *test
+	failed bool
+
+	// output is the report of the logs and subtests of the test,
+	// indented under its own line
+	output strings.Builder
+
+	// subtests counts the subtests run by name, to tell apart the ones
+	// with the same name
+	subtests map[string]int
+}
+
+func (t *test) Type() object.ObjectType { return "TEST" }
+func (t *test) Inspect() string         { return "testing.T" }
+
+// run runs the test function fn, then reports the test to the output
+// of its parent, or Out for tests. It reports whether the test passed.
+func (t *test) run(fn object.Object) bool {
+	in := t.in
+	if t.opts.Verbose && in.Out != nil {
+		fmt.Fprintf(in.Out, "=== RUN   %s\n", t.name)
+	}
+	start := time.Now()
+	err := in.protect(func() {
+		in.call(fn, []object.Object{&object.Struct{StructType: t.typ, Fields: []object.Object{t}}})
+	})
+	if p, ok := err.(*Panic); ok && !p.goexit {
+		t.failed = true
+		fmt.Fprintf(&t.output, "    %s\n", p)
+		for _, s := range p.Stack {
+			fmt.Fprintf(&t.output, "        %s\n", strings.Replace(s, "\n", "\n        ", -1))
+		}
+	}
+
+	var report string
+	if t.failed || t.opts.Verbose {
+		status := "PASS"
+		if t.failed {
+			status = "FAIL"
+		}
+		report = fmt.Sprintf("--- %s: %s (%.2fs)\n%s", status, t.name, time.Since(start).Seconds(), t.output.String())
+	}
+	switch {
+	case t.parent != nil:
+		if t.failed {
+			t.parent.failed = true
+		}
+		t.parent.output.WriteString(indent(report))
+	case in.Out != nil:
+		fmt.Fprint(in.Out, report)
+	}
+	return !t.failed
+}
+
+// subtest runs fn as the subtest name of t, if it is selected, and
+// reports whether it passed
+func (t *test) subtest(name string, fn object.Object) bool {
+	elem := strings.Replace(name, " ", "_", -1)
+	if t.subtests == nil {
+		t.subtests = make(map[string]int)
+	}
+	if n := t.subtests[elem]; n > 0 {
+		t.subtests[elem] = n + 1
+		elem = fmt.Sprintf("%s#%02d", elem, n)
+	} else {
+		t.subtests[elem] = 1
+	}
+	if !t.opts.Match(t.level+1, elem) {
+		return true
+	}
+	sub := &test{
+		in:     t.in,
+		opts:   t.opts,
+		typ:    t.typ,
+		name:   t.name + "/" + elem,
+		level:  t.level + 1,
+		parent: t,
+	}
+	return sub.run(fn)
+}
+
+// log adds the message msg to the output of t, at the position of the
+// call logging it
+func (t *test) log(msg string) {
+	pos := t.in.Position()
+	msg = strings.Replace(strings.TrimSuffix(msg, "\n"), "\n", "\n        ", -1)
+	fmt.Fprintf(&t.output, "    %s:%d: %s\n", filepath.Base(pos.Filename), pos.Line, msg)
+}
+
+// failNow stops the test, running its deferred calls
+func (t *test) failNow() {
+	t.failed = true
+	panic(&Panic{Value: object.NULL, Text: "test stopped by FailNow", goexit: true})
+}
+
+// indent indents the lines of s
+func indent(s string) string {
+	if s == "" {
+		return s
+	}
+	return "    " + strings.Replace(strings.TrimSuffix(s, "\n"), "\n", "\n    ", -1) + "\n"
+}
+
+// testOf returns the test the testing.T value x was passed to
+func testOf(x object.Object) *test {
+	if s, ok := x.(*object.Struct); ok && len(s.Fields) == 1 {
+		if t, ok := s.Fields[0].(*test); ok {
+			return t
+		}
+	}
+	panic(ErrorPanic("testing: T used outside of a test"))
+}
+
+// goValues returns the Go values of the elements of the slice args, for
+// formatting them with package fmt
+func goValues(args object.Object) []interface{} {
+	var values []interface{}
+	for _, x := range args.(*object.Array).Elements {
+		values = append(values, goValue(x))
+	}
+	return values
+}
+
+func goValue(x object.Object) interface{} {
+	switch x := x.(type) {
+	case *object.Interface:
+		return goValue(x.Value)
+	case *object.Null:
+		return nil
+	case *object.Integer:
+		return x.Value
+	case *object.Float:
+		return x.Value
+	case *object.String:
+		return x.Value
+	case *object.Boolean:
+		return x.Value
+	}
+	return x.Inspect()
+}
+
+// the natives of package testing are registered when the package is
+// initialized, as running subtests calls the interpreter, which looks
+// them up
+func init() {
+	natives["testing"] = map[string]native{
+		"T.Error": func(client func() *http.Client, fn *types.Func, args []object.Object) object.Object {
+			t := testOf(args[0])
+			t.log(fmt.Sprintln(goValues(args[1])...))
+			t.failed = true
+			return nil
+		},
+		"T.Errorf": func(client func() *http.Client, fn *types.Func, args []object.Object) object.Object {
+			t := testOf(args[0])
+			t.log(fmt.Sprintf(args[1].(*object.String).Value, goValues(args[2])...))
+			t.failed = true
+			return nil
+		},
+		"T.Fatal": func(client func() *http.Client, fn *types.Func, args []object.Object) object.Object {
+			t := testOf(args[0])
+			t.log(fmt.Sprintln(goValues(args[1])...))
+			t.failNow()
+			return nil
+		},
+		"T.Fatalf": func(client func() *http.Client, fn *types.Func, args []object.Object) object.Object {
+			t := testOf(args[0])
+			t.log(fmt.Sprintf(args[1].(*object.String).Value, goValues(args[2])...))
+			t.failNow()
+			return nil
+		},
+		"T.Log": func(client func() *http.Client, fn *types.Func, args []object.Object) object.Object {
+			testOf(args[0]).log(fmt.Sprintln(goValues(args[1])...))
+			return nil
+		},
+		"T.Logf": func(client func() *http.Client, fn *types.Func, args []object.Object) object.Object {
+			testOf(args[0]).log(fmt.Sprintf(args[1].(*object.String).Value, goValues(args[2])...))
+			return nil
+		},
+		"T.Fail": func(client func() *http.Client, fn *types.Func, args []object.Object) object.Object {
+			testOf(args[0]).failed = true
+			return nil
+		},
+		"T.FailNow": func(client func() *http.Client, fn *types.Func, args []object.Object) object.Object {
+			testOf(args[0]).failNow()
+			return nil
+		},
+		"T.Failed": func(client func() *http.Client, fn *types.Func, args []object.Object) object.Object {
+			return object.NativeBool(testOf(args[0]).failed)
+		},
+		"T.Name": func(client func() *http.Client, fn *types.Func, args []object.Object) object.Object {
+			return &object.String{Value: testOf(args[0]).name}
+		},
+		"T.Run": func(client func() *http.Client, fn *types.Func, args []object.Object) object.Object {
+			return object.NativeBool(testOf(args[0]).subtest(args[1].(*object.String).Value, args[2]))
+		},
+	}
+}
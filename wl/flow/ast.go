@@ -0,0 +1,44 @@
+package flow
+
+import (
+	"weblang/wl/ast"
+	"weblang/wl/token"
+)
+
+// Flow is a parsed .flow file
+type Flow struct {
+	Filename string
+	Flow     token.Pos  // position of "flow" keyword
+	Name     *ast.Ident // flow name, also the name of its package
+	State    []*Field   // state carried between steps
+	Start    *ast.Ident // first step, or nil if missing
+	Steps    []*Step
+}
+
+// Field is a state field: Name Type
+type Field struct {
+	Name *ast.Ident
+	Type ast.Expr // type name or slice of a type name
+}
+
+// Step is a step of a flow, shown by a page
+type Step struct {
+	Step        token.Pos // position of "step" keyword
+	Name        *ast.Ident
+	Page        *ast.BasicLit // page name as a string literal, or nil
+	Transitions []*Transition
+}
+
+// PageName returns the name of the page showing s
+func (s *Step) PageName() string {
+	if s.Page != nil {
+		return unquote(s.Page.Value)
+	}
+	return s.Name.Name
+}
+
+// Transition moves a flow from a step to Target when Event is triggered
+type Transition struct {
+	Event  *ast.Ident
+	Target *ast.Ident
+}
@@ -0,0 +1,206 @@
+package flow
+
+import (
+	"fmt"
+	"sort"
+	"weblang/wl/ast"
+	"weblang/wl/scanner"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// PackagePrefix is the import path prefix of the packages declared by
+// flows: a flow named login is imported as "flows/login"
+const PackagePrefix = "flows/"
+
+// Back and Forward are the functions every flow package declares to
+// move through the steps visited so far; they can't be used as events
+const (
+	Back    = "Back"
+	Forward = "Forward"
+)
+
+// Info holds the results of checking a flow
+type Info struct {
+	Flow *Flow // the checked flow
+
+	// Package declares a variable for each state field and a function
+	// for each event
+	Package *types.Package
+
+	// State maps each state field to its variable in Package
+	State map[*Field]*types.Var
+
+	// Steps maps step names to their declaration
+	Steps map[string]*Step
+
+	// Events are the names of the events of all transitions, sorted
+	Events []string
+}
+
+// Check checks f and declares its package. pages holds the names of the
+// pages of the site; each step must be shown by one of them. Errors are
+// returned as a scanner.ErrorList sorted by position.
+func Check(fset *token.FileSet, f *Flow, pages map[string]bool) (*Info, error) {
+	c := &checker{
+		fset: fset,
+		info: &Info{
+			Flow:    f,
+			Package: types.NewPackage(PackagePrefix+f.Name.Name, f.Name.Name),
+			State:   make(map[*Field]*types.Var),
+			Steps:   make(map[string]*Step),
+		},
+	}
+	c.state(f)
+	c.steps(f, pages)
+	c.reachable(f)
+
+	c.errors.Sort()
+	return c.info, c.errors.Err()
+}
+
+type checker struct {
+	fset   *token.FileSet
+	info   *Info
+	errors scanner.ErrorList
+}
+
+func (c *checker) errorf(pos token.Pos, format string, args ...interface{}) {
+	c.errors.Add(c.fset.Position(pos), fmt.Sprintf(format, args...))
+}
+
+// state declares a package variable for each state field
+func (c *checker) state(f *Flow) {
+	pkg := c.info.Package
+	for _, fld := range f.State {
+		name := fld.Name.Name
+		if !ast.IsExported(name) {
+			c.errorf(fld.Name.Pos(), "state field %s must be exported", name)
+		}
+		var typ types.Type = types.Typ[types.Invalid]
+		tv, err := types.CheckExpr(c.fset, pkg, pkg.Scope(), fld.Type, nil)
+		switch {
+		case err != nil:
+			if terr, ok := err.(types.Error); ok {
+				c.errors.Add(terr.Fset.Position(terr.Pos), terr.Msg)
+			} else {
+				c.errorf(fld.Type.Pos(), "%v", err)
+			}
+		case !tv.IsType():
+			c.errorf(fld.Type.Pos(), "%s is not a type", types.ExprString(fld.Type))
+		case !isStateType(tv.Type):
+			c.errorf(fld.Type.Pos(), "invalid type %s of state field %s: must be a basic type or a slice of them", tv.Type, name)
+		default:
+			typ = tv.Type
+		}
+
+		v := types.NewVar(fld.Name.Pos(), pkg, name, typ)
+		if alt := pkg.Scope().Insert(v); alt != nil {
+			c.errorf(fld.Name.Pos(), "state field %s redeclared", name)
+			continue
+		}
+		c.info.State[fld] = v
+	}
+}
+
+// isStateType reports whether t can be the type of a state field, which
+// the runtime keeps in session storage as JSON: a basic type or a slice
+// of them
+func isStateType(t types.Type) bool {
+	switch t := t.(type) {
+	case *types.Basic:
+		return true
+	case *types.Slice:
+		return isStateType(t.Elem())
+	}
+	return false
+}
+
+// steps checks the steps and their transitions, declaring a package
+// function for each event
+func (c *checker) steps(f *Flow, pages map[string]bool) {
+	for _, s := range f.Steps {
+		if prev := c.info.Steps[s.Name.Name]; prev != nil {
+			c.errorf(s.Name.Pos(), "step %s redeclared (previous at %s)", s.Name.Name, c.fset.Position(prev.Name.Pos()))
+			continue
+		}
+		c.info.Steps[s.Name.Name] = s
+	}
+
+	switch {
+	case f.Start == nil:
+		c.errorf(f.Flow, "flow %s has no start step", f.Name.Name)
+	case c.info.Steps[f.Start.Name] == nil:
+		c.errorf(f.Start.Pos(), "undeclared start step %s", f.Start.Name)
+	}
+
+	events := make(map[string]bool)
+	for _, s := range f.Steps {
+		if c.info.Steps[s.Name.Name] != s {
+			continue
+		}
+		if page := s.PageName(); !pages[page] {
+			pos := s.Name.Pos()
+			if s.Page != nil {
+				pos = s.Page.Pos()
+			}
+			c.errorf(pos, "step %s: no page %q", s.Name.Name, page)
+		}
+
+		seen := make(map[string]bool)
+		for _, t := range s.Transitions {
+			name := t.Event.Name
+			switch {
+			case name == Back || name == Forward:
+				c.errorf(t.Event.Pos(), "cannot use %s as an event", name)
+				continue
+			case !ast.IsExported(name):
+				c.errorf(t.Event.Pos(), "event %s must be exported", name)
+			case seen[name]:
+				c.errorf(t.Event.Pos(), "duplicate transition for %s in step %s", name, s.Name.Name)
+			}
+			seen[name] = true
+			if c.info.Steps[t.Target.Name] == nil {
+				c.errorf(t.Target.Pos(), "transition %s from step %s to undeclared step %s", name, s.Name.Name, t.Target.Name)
+			}
+			if !events[name] {
+				events[name] = true
+				c.info.Events = append(c.info.Events, name)
+			}
+		}
+	}
+	sort.Strings(c.info.Events)
+
+	pkg := c.info.Package
+	for _, name := range append([]string{Back, Forward}, c.info.Events...) {
+		fn := types.NewFunc(token.NoPos, pkg, name, types.NewSignature(nil, nil, nil, false))
+		if alt := pkg.Scope().Insert(fn); alt != nil {
+			c.errorf(alt.Pos(), "state field %s conflicts with event %s", name, name)
+		}
+	}
+	pkg.MarkComplete()
+}
+
+// reachable reports the steps that can't be reached from the start step
+func (c *checker) reachable(f *Flow) {
+	if f.Start == nil || c.info.Steps[f.Start.Name] == nil {
+		return
+	}
+	seen := map[string]bool{f.Start.Name: true}
+	work := []string{f.Start.Name}
+	for len(work) > 0 {
+		s := c.info.Steps[work[0]]
+		work = work[1:]
+		for _, t := range s.Transitions {
+			if to := t.Target.Name; !seen[to] && c.info.Steps[to] != nil {
+				seen[to] = true
+				work = append(work, to)
+			}
+		}
+	}
+	for _, s := range f.Steps {
+		if !seen[s.Name.Name] && c.info.Steps[s.Name.Name] == s {
+			c.errorf(s.Name.Pos(), "step %s is unreachable from start step %s", s.Name.Name, f.Start.Name)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package flow
+
+import (
+	"fmt"
+	"testing"
+	"weblang/wl/ast"
+	"weblang/wl/scanner"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+var loginPages = map[string]bool{
+	"login/email":    true,
+	"login/password": true,
+	"login/reset":    true,
+	"welcome":        true,
+}
+
+func TestCheckFlow(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "login.flow", loginSrc)
+	if err != nil {
+		t.Fatalf("Error during parse: %v", err)
+	}
+	info, err := Check(fset, f, loginPages)
+	if err != nil {
+		t.Fatalf("Error during check: %v", err)
+	}
+
+	pkg := info.Package
+	if want, got := "flows/login", pkg.Path(); want != got {
+		t.Errorf("package path, want %v got %v", want, got)
+	}
+	if want, got := "[Done Forgot Next]", fmt.Sprint(info.Events); want != got {
+		t.Errorf("events, want %v got %v", want, got)
+	}
+
+	tries, ok := pkg.Scope().Lookup("Tries").(*types.Var)
+	if !ok || tries.Type().String() != "[]int" {
+		t.Errorf("state var Tries, got %v", pkg.Scope().Lookup("Tries"))
+	}
+	if info.State[f.State[0]] != pkg.Scope().Lookup("Email") {
+		t.Errorf("state field Email not recorded")
+	}
+	for _, name := range []string{"Next", "Done", "Forgot", "Back", "Forward"} {
+		fn, ok := pkg.Scope().Lookup(name).(*types.Func)
+		if !ok {
+			t.Errorf("no func %s", name)
+			continue
+		}
+		if want, got := "func()", fn.Type().String(); want != got {
+			t.Errorf("%s type, want %v got %v", name, want, got)
+		}
+	}
+}
+
+// TestCheckStateStruct checks struct state fields, which flows built
+// rather than parsed can declare, are rejected too
+func TestCheckStateStruct(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "test.flow", "flow f\nstate { A int }\nstart a\nstep a")
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	f.State[0].Type = &ast.StructType{Struct: f.State[0].Type.Pos(), Fields: &ast.FieldList{}}
+	_, err = Check(fset, f, map[string]bool{"a": true})
+	list, _ := err.(scanner.ErrorList)
+	if want := "2:11: invalid type struct{} of state field A"; !containsError(list, want) {
+		t.Errorf("want error %q got %v", want, list)
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"flow f\nstep a", "1:1: flow f has no start step"},
+		{"flow f\nstart b\nstep a", "2:7: undeclared start step b"},
+		{"flow f\nstart a\nstep a \"missing\"", `3:8: step a: no page "missing"`},
+		{"flow f\nstart a\nstep a { Next -> b }", "3:18: transition Next from step a to undeclared step b"},
+		{"flow f\nstart a\nstep a\nstep welcome", "4:6: step welcome is unreachable from start step a"},
+		{"flow f\nstart a\nstep a { Next -> a; Next -> a }", "3:21: duplicate transition for Next in step a"},
+		{"flow f\nstart a\nstep a { next -> a }", "3:10: event next must be exported"},
+		{"flow f\nstart a\nstep a { Back -> a }", "3:10: cannot use Back as an event"},
+		{"flow f\nstart a\nstep a\nstep a", "4:6: step a redeclared"},
+		{"flow f\nstate { email string }\nstart a\nstep a", "2:9: state field email must be exported"},
+		{"flow f\nstate { A string; A int }\nstart a\nstep a", "2:19: state field A redeclared"},
+		{"flow f\nstate { A Todo }\nstart a\nstep a", "2:11: undeclared name: Todo"},
+		{"flow f\nstate { Next int }\nstart a\nstep a { Next -> a }", "2:9: state field Next conflicts with event Next"},
+		{"flow f\nstate { A error }\nstart a\nstep a", "2:11: invalid type error of state field A: must be a basic type or a slice of them"},
+		{"flow f\nstate { A [][]error }\nstart a\nstep a", "2:11: invalid type [][]error of state field A"},
+	}
+
+	pages := map[string]bool{"a": true, "welcome": true}
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		f, err := ParseFile(fset, "test.flow", test.src)
+		if err != nil {
+			t.Fatalf("%q: parse error: %v", test.src, err)
+		}
+		_, err = Check(fset, f, pages)
+		list, _ := err.(scanner.ErrorList)
+		if !containsError(list, test.err) {
+			t.Errorf("%q: want error %q got %v", test.src, test.err, list)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+/*
+Package flow parses and checks .flow files, which describe multi-page
+flows such as a login or signup: the pages the user steps through, the
+state carried between them and the transitions page code triggers.
+
+	flow login
+
+	state {
+		Email    string
+		Remember bool
+	}
+
+	start email
+
+	step email "login/email" {
+		Next -> password
+	}
+
+	step password "login/password" {
+		Forgot -> reset
+		Done   -> welcome
+	}
+
+	step reset "login/reset"
+
+	step welcome
+
+Each step is shown by a page, named by the string after the step name or
+else by the step name itself. Checking a flow produces a wl package,
+imported by pages as "flows/login", declaring a variable for each state
+field and a function for each event, which moves the flow to the target
+of the event's transition from the current step. Back and Forward move
+through the steps visited so far. State fields are basic types or slices
+of them, which the runtime keeps in session storage between the pages.
+*/
+package flow
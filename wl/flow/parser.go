@@ -0,0 +1,266 @@
+package flow
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"weblang/wl/ast"
+	"weblang/wl/scanner"
+	"weblang/wl/token"
+)
+
+// ParseFile parses a .flow file. If src != nil it is used as the source
+// (string, []byte or io.Reader), otherwise the file named filename is
+// read. Errors are returned as a scanner.ErrorList sorted by position;
+// the returned flow holds the declarations parsed before each error.
+func ParseFile(fset *token.FileSet, filename string, src interface{}) (*Flow, error) {
+	text, err := readSource(filename, src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{}
+	p.file = fset.AddFile(filename, -1, len(text))
+	p.scanner.Init(p.file, text, func(pos token.Position, msg string) {
+		p.errors.Add(pos, msg)
+	}, 0)
+	p.next()
+
+	f := p.parseFlow()
+	f.Filename = filename
+	p.errors.Sort()
+	return f, p.errors.Err()
+}
+
+func readSource(filename string, src interface{}) ([]byte, error) {
+	if src != nil {
+		switch s := src.(type) {
+		case string:
+			return []byte(s), nil
+		case []byte:
+			return s, nil
+		case *bytes.Buffer:
+			if s != nil {
+				return s.Bytes(), nil
+			}
+		case io.Reader:
+			return ioutil.ReadAll(s)
+		}
+		return nil, errors.New("invalid source")
+	}
+	return ioutil.ReadFile(filename)
+}
+
+// bailout is panicked to stop parsing a declaration after an error
+type bailout struct{}
+
+type parser struct {
+	file    *token.File
+	scanner scanner.Scanner
+	errors  scanner.ErrorList
+
+	pos token.Pos
+	tok token.Token
+	lit string
+}
+
+func (p *parser) next() {
+	p.pos, p.tok, p.lit = p.scanner.Scan()
+}
+
+func (p *parser) errorf(pos token.Pos, format string, args ...interface{}) {
+	p.errors.Add(p.file.Position(pos), fmt.Sprintf(format, args...))
+}
+
+// errorExpected reports what was expected at the current token and
+// stops parsing the current declaration
+func (p *parser) errorExpected(what string) {
+	found := "'" + p.tok.String() + "'"
+	switch {
+	case p.tok == token.SEMICOLON && p.lit == "\n":
+		found = "newline"
+	case p.tok.IsLiteral():
+		found += " " + p.lit
+	}
+	p.errorf(p.pos, "expected %s, found %s", what, found)
+	panic(bailout{})
+}
+
+func (p *parser) expect(tok token.Token) token.Pos {
+	pos := p.pos
+	if p.tok != tok {
+		p.errorExpected("'" + tok.String() + "'")
+	}
+	p.next()
+	return pos
+}
+
+// keyword reports whether the current token is the identifier kw,
+// which the flow syntax uses as a keyword
+func (p *parser) keyword(kw string) bool {
+	return p.tok == token.IDENT && p.lit == kw
+}
+
+func (p *parser) expectKeyword(kw string) token.Pos {
+	pos := p.pos
+	if !p.keyword(kw) {
+		p.errorExpected("'" + kw + "'")
+	}
+	p.next()
+	return pos
+}
+
+func (p *parser) ident() *ast.Ident {
+	id := &ast.Ident{NamePos: p.pos, Name: p.lit}
+	if p.tok != token.IDENT {
+		p.errorExpected("name")
+	}
+	p.next()
+	return id
+}
+
+// endDecl consumes the end of a declaration
+func (p *parser) endDecl() {
+	if p.tok != token.EOF {
+		p.expect(token.SEMICOLON)
+	}
+}
+
+// skipDecl skips to the start of the next declaration after an error
+func (p *parser) skipDecl() {
+	depth := 0
+	for p.tok != token.EOF {
+		switch p.tok {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+		case token.SEMICOLON:
+			if depth <= 0 {
+				p.next()
+				return
+			}
+		}
+		p.next()
+	}
+}
+
+func (p *parser) parseFlow() *Flow {
+	f := new(Flow)
+	p.decl(func() {
+		f.Flow = p.expectKeyword("flow")
+		f.Name = p.ident()
+		p.endDecl()
+	})
+	if f.Name == nil {
+		f.Name = &ast.Ident{NamePos: f.Flow, Name: "_"}
+	}
+
+	for p.tok != token.EOF {
+		p.decl(func() {
+			switch {
+			case p.keyword("state"):
+				p.next()
+				p.expect(token.LBRACE)
+				for p.tok != token.RBRACE && p.tok != token.EOF {
+					f.State = append(f.State, p.parseField())
+				}
+				p.expect(token.RBRACE)
+			case p.keyword("start"):
+				pos := p.pos
+				p.next()
+				start := p.ident()
+				if f.Start != nil {
+					p.errorf(pos, "duplicate start step")
+				}
+				f.Start = start
+			case p.keyword("step"):
+				f.Steps = append(f.Steps, p.parseStep())
+			default:
+				p.errorExpected("'state', 'start' or 'step'")
+			}
+			p.endDecl()
+		})
+	}
+	return f
+}
+
+// decl parses a declaration with parse, skipping the rest of it if
+// there is an error
+func (p *parser) decl(parse func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			p.skipDecl()
+		}
+	}()
+	parse()
+}
+
+func (p *parser) parseField() *Field {
+	fld := &Field{Name: p.ident(), Type: p.parseType()}
+	if p.tok != token.RBRACE {
+		p.expect(token.SEMICOLON)
+	}
+	return fld
+}
+
+// parseType parses a type name or a slice of one
+func (p *parser) parseType() ast.Expr {
+	if p.tok == token.LBRACK {
+		lbrack := p.pos
+		p.next()
+		p.expect(token.RBRACK)
+		return &ast.ArrayType{Lbrack: lbrack, Elt: p.parseType()}
+	}
+	if p.tok != token.IDENT {
+		p.errorExpected("type")
+	}
+	return p.ident()
+}
+
+func (p *parser) parseStep() *Step {
+	s := &Step{Step: p.pos}
+	p.next()
+	s.Name = p.ident()
+	if p.tok == token.STRING {
+		s.Page = &ast.BasicLit{ValuePos: p.pos, Kind: token.STRING, Value: p.lit}
+		p.next()
+	}
+	if p.tok != token.LBRACE {
+		return s
+	}
+	p.next()
+	for p.tok != token.RBRACE && p.tok != token.EOF {
+		t := &Transition{Event: p.ident()}
+		// "->" scans as '-' '>'
+		if p.tok != token.SUB {
+			p.errorExpected("'->'")
+		}
+		p.next()
+		if p.tok != token.GTR {
+			p.errorExpected("'->'")
+		}
+		p.next()
+		t.Target = p.ident()
+		s.Transitions = append(s.Transitions, t)
+		if p.tok != token.RBRACE {
+			p.expect(token.SEMICOLON)
+		}
+	}
+	p.expect(token.RBRACE)
+	return s
+}
+
+func unquote(lit string) string {
+	s, err := strconv.Unquote(lit)
+	if err != nil {
+		return lit
+	}
+	return s
+}
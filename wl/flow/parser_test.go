@@ -0,0 +1,115 @@
+package flow
+
+import (
+	"strings"
+	"testing"
+	"weblang/wl/ast"
+	"weblang/wl/scanner"
+	"weblang/wl/token"
+)
+
+const loginSrc = `// signing in
+flow login
+
+state {
+	Email    string
+	Remember bool
+	Tries    []int
+}
+
+start email
+
+step email "login/email" {
+	Next -> password
+}
+
+step password "login/password" {
+	Forgot -> reset
+	Done   -> welcome
+}
+
+step reset "login/reset" { Done -> email }
+
+step welcome
+`
+
+func TestParseFlow(t *testing.T) {
+	f := parse(t, loginSrc)
+
+	if want, got := "login", f.Name.Name; want != got {
+		t.Errorf("flow name, want %v got %v", want, got)
+	}
+	if want, got := 3, len(f.State); want != got {
+		t.Fatalf("state fields, want %v got %v", want, got)
+	}
+	if want, got := "Remember", f.State[1].Name.Name; want != got {
+		t.Errorf("state field, want %v got %v", want, got)
+	}
+	if _, ok := f.State[2].Type.(*ast.ArrayType); !ok {
+		t.Errorf("slice type, want *ast.ArrayType got %T", f.State[2].Type)
+	}
+	if want, got := "email", f.Start.Name; want != got {
+		t.Errorf("start, want %v got %v", want, got)
+	}
+
+	if want, got := 4, len(f.Steps); want != got {
+		t.Fatalf("steps, want %v got %v", want, got)
+	}
+	password := f.Steps[1]
+	if want, got := "login/password", password.PageName(); want != got {
+		t.Errorf("page, want %v got %v", want, got)
+	}
+	if len(password.Transitions) != 2 {
+		t.Fatalf("transitions, want 2 got %v", len(password.Transitions))
+	}
+	if tr := password.Transitions[1]; tr.Event.Name != "Done" || tr.Target.Name != "welcome" {
+		t.Errorf("transition, want Done -> welcome got %v -> %v", tr.Event.Name, tr.Target.Name)
+	}
+	if want, got := 1, len(f.Steps[2].Transitions); want != got {
+		t.Errorf("single line step transitions, want %v got %v", want, got)
+	}
+	if welcome := f.Steps[3]; welcome.Page != nil || welcome.PageName() != "welcome" {
+		t.Errorf("default page, want welcome got %v", welcome.PageName())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{`step a`, "1:1: expected 'flow', found 'IDENT' step"},
+		{"flow f\nstate { A }", "2:11: expected type, found '}'"},
+		{"flow f\nstep a { Next > b }", "2:15: expected '->', found '>'"},
+		{"flow f\nstart a\nstart b", "3:1: duplicate start step"},
+		{"flow f\nsteps a", "2:1: expected 'state', 'start' or 'step', found 'IDENT' steps"},
+		{"flow f\nstep a {\nNext -> \n}\nstep b", "3:9: expected name, found newline"},
+	}
+
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		_, err := ParseFile(fset, "test.flow", test.src)
+		list, _ := err.(scanner.ErrorList)
+		if !containsError(list, test.err) {
+			t.Errorf("%q: want error %q got %v", test.src, test.err, list)
+		}
+	}
+}
+
+func containsError(list scanner.ErrorList, msg string) bool {
+	for _, e := range list {
+		if strings.Contains(e.Error(), msg) {
+			return true
+		}
+	}
+	return false
+}
+
+func parse(t *testing.T, src string) *Flow {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "test.flow", src)
+	if err != nil {
+		t.Fatalf("Error during parse: %v", err)
+	}
+	return f
+}
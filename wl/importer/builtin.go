@@ -0,0 +1,210 @@
+package importer
+
+import (
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// builtinPackages are the packages provided by the weblang runtime
+// rather than by wl source files
+var builtinPackages = map[string]func() *types.Package{
+	"events":  eventsPackage,
+	"html":    htmlPackage,
+	"http":    httpPackage,
+	"router":  routerPackage,
+	"testing": testingPackage,
+}
+
+// asyncFuncs are the functions of the builtin packages the runtime
+// implements asynchronously, by package path
+var asyncFuncs = map[string]map[string]bool{
+	"http": {"Get": true, "Post": true},
+}
+
+// eventsPackage defines the typed event objects passed to page
+// event handlers, one named struct per event kind
+func eventsPackage() *types.Package {
+	pkg := types.NewPackage("events", "events")
+
+	mouse := []field{
+		{"X", types.Typ[types.Int]},
+		{"Y", types.Typ[types.Int]},
+		{"Button", types.Typ[types.Int]},
+		{"AltKey", types.Typ[types.Bool]},
+		{"CtrlKey", types.Typ[types.Bool]},
+		{"ShiftKey", types.Typ[types.Bool]},
+		{"MetaKey", types.Typ[types.Bool]},
+	}
+	key := []field{
+		{"Key", types.Typ[types.String]},
+		{"Code", types.Typ[types.String]},
+		{"AltKey", types.Typ[types.Bool]},
+		{"CtrlKey", types.Typ[types.Bool]},
+		{"ShiftKey", types.Typ[types.Bool]},
+		{"MetaKey", types.Typ[types.Bool]},
+		{"Repeat", types.Typ[types.Bool]},
+	}
+	value := []field{
+		{"Value", types.Typ[types.String]},
+	}
+
+	defStruct(pkg, "Click", mouse)
+	defStruct(pkg, "DblClick", mouse)
+	defStruct(pkg, "MouseEnter", mouse)
+	defStruct(pkg, "MouseLeave", mouse)
+	defStruct(pkg, "KeyUp", key)
+	defStruct(pkg, "KeyDown", key)
+	defStruct(pkg, "KeyPress", key)
+	defStruct(pkg, "Input", value)
+	defStruct(pkg, "Change", value)
+	defStruct(pkg, "Checked", []field{{"Checked", types.Typ[types.Bool]}})
+	defStruct(pkg, "Focus", nil)
+	defStruct(pkg, "Blur", nil)
+	defStruct(pkg, "Submit", nil)
+
+	return pkg
+}
+
+// htmlPackage defines the element types page variables can be declared
+// with to reference elements in the page template
+func htmlPackage() *types.Package {
+	pkg := types.NewPackage("html", "html")
+
+	common := []field{
+		{"Hidden", types.Typ[types.Bool]},
+	}
+	with := func(fields ...field) []field {
+		return append(append([]field(nil), common...), fields...)
+	}
+	value := field{"Value", types.Typ[types.String]}
+	disabled := field{"Disabled", types.Typ[types.Bool]}
+	placeholder := field{"Placeholder", types.Typ[types.String]}
+
+	defStruct(pkg, "Element", common)
+	defStruct(pkg, "Input", with(value, disabled, placeholder, field{"Checked", types.Typ[types.Bool]}))
+	defStruct(pkg, "TextArea", with(value, disabled, placeholder))
+	defStruct(pkg, "Select", with(value, disabled))
+	defStruct(pkg, "Button", with(disabled))
+	defStruct(pkg, "A", with(field{"Href", types.Typ[types.String]}))
+	defStruct(pkg, "Form", common)
+	defStruct(pkg, "Label", common)
+	defStruct(pkg, "Div", common)
+	defStruct(pkg, "Span", common)
+
+	// Safe is markup or a value trusted to be output without escaping
+	safe := types.NewTypeName(token.NoPos, pkg, "Safe", nil)
+	types.NewNamed(safe, types.Typ[types.String], nil)
+	pkg.Scope().Insert(safe)
+
+	return pkg
+}
+
+// routerPackage defines the routes pages declare to bind page variables
+// to the segments of the URL
+func routerPackage() *types.Package {
+	pkg := types.NewPackage("router", "router")
+
+	route := defStruct(pkg, "Route", nil)
+
+	// Path declares a route: "#/" patterns match location.hash and "/"
+	// patterns the path, {name} segments bind the page variable name
+	pattern := types.NewParam(token.NoPos, pkg, "pattern", types.Typ[types.String])
+	result := types.NewParam(token.NoPos, pkg, "", route)
+	sig := types.NewSignature(nil, types.NewTuple(pattern), types.NewTuple(result), false)
+	pkg.Scope().Insert(types.NewFunc(token.NoPos, pkg, "Path", sig))
+
+	return pkg
+}
+
+// httpPackage defines the requests pages make to servers. Requests
+// panic if the server can't be reached; responses with any status are
+// returned.
+func httpPackage() *types.Package {
+	pkg := types.NewPackage("http", "http")
+
+	resp := defStruct(pkg, "Response", []field{
+		{"Status", types.Typ[types.Int]},
+		{"Body", types.Typ[types.String]},
+	})
+	str := types.Typ[types.String]
+	defFunc(pkg, "Get", []field{{"url", str}}, resp)
+	defFunc(pkg, "Post", []field{{"url", str}, {"contentType", str}, {"body", str}}, resp)
+
+	return pkg
+}
+
+// testingPackage defines the T passed to the TestXxx functions of
+// _test.wl files, which report failures and run subtests through it
+func testingPackage() *types.Package {
+	pkg := types.NewPackage("testing", "testing")
+
+	// the state of the test is hidden in a field, as T values are copied
+	t := defStruct(pkg, "T", []field{{"state", types.Typ[types.Int]}})
+	str := types.Typ[types.String]
+	args := field{"args", types.NewSlice(types.NewInterfaceType(nil, nil).Complete())}
+	format := field{"format", str}
+	defMethod(t, "Error", []field{args}, true, nil)
+	defMethod(t, "Errorf", []field{format, args}, true, nil)
+	defMethod(t, "Fatal", []field{args}, true, nil)
+	defMethod(t, "Fatalf", []field{format, args}, true, nil)
+	defMethod(t, "Log", []field{args}, true, nil)
+	defMethod(t, "Logf", []field{format, args}, true, nil)
+	defMethod(t, "Fail", nil, false, nil)
+	defMethod(t, "FailNow", nil, false, nil)
+	defMethod(t, "Failed", nil, false, types.Typ[types.Bool])
+	defMethod(t, "Name", nil, false, str)
+
+	// Run runs f as the subtest name of the test, reporting whether it
+	// passed
+	f := types.NewSignature(nil, types.NewTuple(types.NewParam(token.NoPos, pkg, "t", t)), nil, false)
+	defMethod(t, "Run", []field{{"name", str}, {"f", f}}, false, types.Typ[types.Bool])
+
+	return pkg
+}
+
+type field struct {
+	name string
+	typ  types.Type
+}
+
+// defStruct declares the named struct type name with the given fields in pkg
+func defStruct(pkg *types.Package, name string, fields []field) *types.Named {
+	var vars []*types.Var
+	for _, f := range fields {
+		vars = append(vars, types.NewField(token.NoPos, pkg, f.name, f.typ, false))
+	}
+
+	obj := types.NewTypeName(token.NoPos, pkg, name, nil)
+	typ := types.NewNamed(obj, types.NewStruct(vars, nil), nil)
+	pkg.Scope().Insert(obj)
+	return typ
+}
+
+// defFunc declares the function name with the given parameters and
+// result in pkg
+func defFunc(pkg *types.Package, name string, params []field, result types.Type) {
+	var vars []*types.Var
+	for _, p := range params {
+		vars = append(vars, types.NewParam(token.NoPos, pkg, p.name, p.typ))
+	}
+	res := types.NewTuple(types.NewParam(token.NoPos, pkg, "", result))
+	sig := types.NewSignature(nil, types.NewTuple(vars...), res, false)
+	pkg.Scope().Insert(types.NewFunc(token.NoPos, pkg, name, sig))
+}
+
+// defMethod declares the method name of the named type recv with the
+// given parameters, the last one variadic if variadic is set, and
+// result, if it isn't nil
+func defMethod(recv *types.Named, name string, params []field, variadic bool, result types.Type) {
+	pkg := recv.Obj().Pkg()
+	var vars []*types.Var
+	for _, p := range params {
+		vars = append(vars, types.NewParam(token.NoPos, pkg, p.name, p.typ))
+	}
+	var res *types.Tuple
+	if result != nil {
+		res = types.NewTuple(types.NewParam(token.NoPos, pkg, "", result))
+	}
+	r := types.NewParam(token.NoPos, pkg, "t", recv)
+	recv.AddMethod(types.NewFunc(token.NoPos, pkg, name, types.NewSignature(r, types.NewTuple(vars...), res, variadic)))
+}
@@ -1,17 +1,60 @@
 package importer
 
 import (
+	"fmt"
 	"weblang/wl/types"
 )
 
+// Default returns an importer that resolves the packages built
+// into the weblang runtime (see builtin.go)
 func Default() types.Importer {
-	return &importer{}
+	return &importer{
+		pkgs: make(map[string]*types.Package),
+	}
 }
 
-type importer struct {
+// With returns an importer that resolves the builtin packages and pkgs,
+// which are already complete, such as the packages declared by flows
+func With(pkgs ...*types.Package) types.Importer {
+	imp := &importer{
+		pkgs: make(map[string]*types.Package),
+	}
+	for _, pkg := range pkgs {
+		imp.pkgs[pkg.Path()] = pkg
+	}
+	return imp
+}
+
+// IsBuiltin reports whether path is the path of a package built into the
+// weblang runtime, which has no wl sources to compile
+func IsBuiltin(path string) bool {
+	_, ok := builtinPackages[path]
+	return ok
+}
+
+// IsAsync reports whether fn is a function of a builtin package the
+// runtime implements asynchronously, returning a promise of its result
+func IsAsync(fn *types.Func) bool {
+	pkg := fn.Pkg()
+	return pkg != nil && asyncFuncs[pkg.Path()][fn.Name()]
+}
 
+type importer struct {
+	pkgs map[string]*types.Package
 }
 
 func (i *importer) Import(path string) (*types.Package, error) {
-	return nil, nil
-}
\ No newline at end of file
+	if pkg, ok := i.pkgs[path]; ok {
+		return pkg, nil
+	}
+
+	def, ok := builtinPackages[path]
+	if !ok {
+		return nil, fmt.Errorf("unknown package %q", path)
+	}
+
+	pkg := def()
+	pkg.MarkComplete()
+	i.pkgs[path] = pkg
+	return pkg, nil
+}
@@ -0,0 +1,160 @@
+package jscompiler
+
+import (
+	"weblang/wl/ast"
+	"weblang/wl/constant"
+	"weblang/wl/jscompiler/jsast"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// IntModel selects how wl ints are represented in javascript
+type IntModel int
+
+const (
+	// SafeInts represents ints as numbers. Arithmetic panics when a
+	// result leaves the range numbers hold exactly, ±(2^53-1).
+	SafeInts IntModel = iota
+
+	// BigInts represents ints as BigInts, wrapping results to 64 bits
+	// like Go does
+	BigInts
+)
+
+// isInt reports whether the value of x has an integer type
+func (c *jsCompiler) isInt(x ast.Expr) bool {
+	tv, ok := c.info.Types[x]
+	if !ok {
+		return false
+	}
+	b, ok := underlying(tv.Type).(*types.Basic)
+	return ok && b.Info()&types.IsInteger != 0
+}
+
+// isFloat reports whether the value of x has a floating-point type
+func (c *jsCompiler) isFloat(x ast.Expr) bool {
+	tv, ok := c.info.Types[x]
+	if !ok {
+		return false
+	}
+	b, ok := underlying(tv.Type).(*types.Basic)
+	return ok && b.Info()&types.IsFloat != 0
+}
+
+// folds reports whether the constant expression x is replaced by its
+// value: always when minifying, and for integer expressions other than
+// names, as javascript doesn't compute them like wl. For BigInts, names
+// of untyped constants are replaced too, as their uses needn't be ints.
+func (c *jsCompiler) folds(x ast.Expr) bool {
+	if c.minify {
+		return true
+	}
+	ident, ok := x.(*ast.Ident)
+	if !ok {
+		return c.isInt(x)
+	}
+	obj, ok := c.info.Uses[ident].(*types.Const)
+	if !ok || c.ints != BigInts {
+		return false
+	}
+	b, ok := obj.Type().(*types.Basic)
+	return ok && b.Info()&types.IsUntyped != 0
+}
+
+// constant returns the literal of the constant value of x, which is a
+// BigInt literal for integers in the BigInts model
+func (c *jsCompiler) constant(x ast.Expr, val constant.Value) jsast.Expr {
+	if c.ints == BigInts && c.isInt(x) && val.Kind() == constant.Int {
+		return &jsast.BasicLiteral{Value: val.ExactString() + "n"}
+	}
+	return constValue(val)
+}
+
+// bitwiseOps are the runtime helpers of the bitwise operations, which
+// javascript's operators would do on 32 bits
+var bitwiseOps = map[token.Token]string{
+	token.AND: "and",
+	token.OR:  "or",
+	token.XOR: "xor",
+	token.SHL: "shl",
+	token.SHR: "shr",
+}
+
+// intArith returns the integer operation x op y. Division and remainder
+// truncate towards zero and panic on a zero divisor, bitwise operations
+// work on 64 bits; the other arithmetic operations are checked for
+// overflow, or wrapped to 64 bits for BigInts.
+func (c *jsCompiler) intArith(op token.Token, x, y jsast.Expr) jsast.Expr {
+	// the printer parenthesizes operands where needed
+	x, y = unparen(x), unparen(y)
+	if name, ok := bitwiseOps[op]; ok {
+		return runtimeCall(name, x, y)
+	}
+	switch op {
+	case token.QUO:
+		return runtimeCall("div", x, y)
+	case token.REM:
+		return runtimeCall("rem", x, y)
+	case token.ADD, token.SUB, token.MUL:
+		return c.intResult(&jsast.BinaryExpression{Lhs: x, Op: op.String(), Rhs: y})
+	}
+	return &jsast.BinaryExpression{Lhs: x, Op: c.convertOp(op), Rhs: y}
+}
+
+// intResult checks the integer result x for overflow, or wraps it to 64
+// bits for BigInts
+func (c *jsCompiler) intResult(x jsast.Expr) jsast.Expr {
+	if c.ints == BigInts {
+		return runtimeCall("i64", x)
+	}
+	return runtimeCall("int", x)
+}
+
+// arithAssign returns the operator of the assignment operator tok, if
+// it is one
+func arithAssign(tok token.Token) (token.Token, bool) {
+	if tok >= token.ADD_ASSIGN && tok <= token.SHR_ASSIGN {
+		return tok - token.ADD_ASSIGN + token.ADD, true
+	}
+	return tok, false
+}
+
+// conversion returns the numeric conversion call, or nil if it isn't
+// one between ints and floats
+func (c *jsCompiler) conversion(call *ast.CallExpr) jsast.Expr {
+	if tv, ok := c.info.Types[call.Fun]; !ok || !tv.IsType() || len(call.Args) != 1 {
+		return nil
+	}
+	from := call.Args[0]
+	if !(c.isInt(call) || c.isFloat(call)) || !(c.isInt(from) || c.isFloat(from)) {
+		return nil
+	}
+	arg := c.convertExpr(from)
+	switch {
+	case c.isInt(call) && c.isFloat(from):
+		trunc := &jsast.CallExpr{
+			Fun:  &jsast.SelectorExpr{X: &jsast.Identifier{Name: "Math"}, Sel: "trunc"},
+			Args: []jsast.Expr{unparen(arg)},
+		}
+		if c.ints == BigInts {
+			return runtimeCall("i64", &jsast.CallExpr{Fun: &jsast.Identifier{Name: "BigInt"}, Args: []jsast.Expr{trunc}})
+		}
+		return runtimeCall("int", trunc)
+	case c.isFloat(call) && c.isInt(from):
+		if c.ints == BigInts {
+			return &jsast.CallExpr{Fun: &jsast.Identifier{Name: "Number"}, Args: []jsast.Expr{unparen(arg)}}
+		}
+	}
+	return arg
+}
+
+// unparen returns x without enclosing parentheses
+func unparen(x jsast.Expr) jsast.Expr {
+	for {
+		p, ok := x.(*jsast.ParenExpr)
+		if !ok {
+			return x
+		}
+		x = p.X
+	}
+}
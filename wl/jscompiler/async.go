@@ -0,0 +1,195 @@
+package jscompiler
+
+import (
+	"fmt"
+	"weblang/wl/ast"
+	"weblang/wl/importer"
+	"weblang/wl/jscompiler/jsast"
+	"weblang/wl/types"
+)
+
+// Browser I/O is asynchronous, so the builtin functions doing it return
+// promises. Functions calling them, directly or through other
+// functions, are compiled to async functions awaiting those calls;
+// functions that don't stay synchronous. Panics of awaited calls are
+// rejections, which await throws again, so deferred calls and recover
+// work across awaits.
+//
+// The call graph is found from the types of the package. Calls of an
+// interface method are async if an async method of that name has a
+// receiver implementing the interface, and calls of function values are
+// async if an async function of the package is used as a value.
+// Packages calling the async functions of an import must be compiled
+// with the Config that compiled the import.
+
+// calls are the calls of a function body deciding if it is async
+type calls struct {
+	funcs   []*types.Func // functions and methods called
+	methods []*types.Func // interface methods called
+	values  []*types.Func // functions used as values
+	dynamic bool          // calls function values
+}
+
+// findAsync finds the functions and function literals of files which
+// are async
+func (c *jsCompiler) findAsync(files []*ast.File) {
+	bodies := make(map[ast.Node]*calls)
+	for _, f := range files {
+		for _, d := range f.Decls {
+			if fd, ok := d.(*ast.FuncDecl); ok && fd.Body != nil {
+				c.scanCalls(fd, fd.Body, bodies)
+			}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for fn, b := range bodies {
+			_, lit := fn.(*ast.FuncLit)
+			dynamic := lit && c.async[fn]
+			for _, v := range b.values {
+				dynamic = dynamic || c.isAsync(v)
+			}
+			if dynamic && !c.dynamic {
+				c.dynamic = true
+				changed = true
+			}
+		}
+		for fn, b := range bodies {
+			if c.async[fn] || !c.callsAsync(b) {
+				continue
+			}
+			c.async[fn] = true
+			if fd, ok := fn.(*ast.FuncDecl); ok {
+				if obj, ok := c.info.Defs[fd.Name].(*types.Func); ok {
+					c.asyncFuncs[obj] = true
+				}
+			}
+			changed = true
+		}
+	}
+}
+
+// scanCalls records the calls of the function fn with the given body in
+// bodies, along with those of the function literals in it
+func (c *jsCompiler) scanCalls(fn ast.Node, body *ast.BlockStmt, bodies map[ast.Node]*calls) {
+	b := &calls{}
+	bodies[fn] = b
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			c.scanCalls(n, n.Body, bodies)
+			return false
+		case *ast.CallExpr:
+			if tv := c.info.Types[n.Fun]; tv.IsType() || c.builtin(n) != "" {
+				return true
+			}
+			f := c.callee(n)
+			if f == nil {
+				b.dynamic = true
+				return true
+			}
+			if recv := f.Type().(*types.Signature).Recv(); recv != nil && isInterface(recv.Type()) {
+				b.methods = append(b.methods, f)
+			} else {
+				b.funcs = append(b.funcs, f)
+			}
+			// the function called isn't used as a value
+			if sel, ok := ast.Unparen(n.Fun).(*ast.SelectorExpr); ok {
+				ast.Inspect(sel.X, visit)
+			}
+			for _, a := range n.Args {
+				ast.Inspect(a, visit)
+			}
+			return false
+		case *ast.Ident:
+			if f, ok := c.info.Uses[n].(*types.Func); ok {
+				b.values = append(b.values, f)
+			}
+		}
+		return true
+	}
+	ast.Inspect(body, visit)
+}
+
+// callsAsync reports whether a function making calls b is async
+func (c *jsCompiler) callsAsync(b *calls) bool {
+	if b.dynamic && c.dynamic {
+		return true
+	}
+	for _, f := range b.funcs {
+		if c.isAsync(f) {
+			return true
+		}
+	}
+	for _, m := range b.methods {
+		if c.asyncMethod(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAsync reports whether the function or method fn is async
+func (c *jsCompiler) isAsync(fn *types.Func) bool {
+	return c.asyncFuncs[fn] || importer.IsAsync(fn)
+}
+
+// asyncMethod reports whether calls of the interface method m are
+// async: whether an async method of the same name has a receiver
+// implementing the interface
+func (c *jsCompiler) asyncMethod(m *types.Func) bool {
+	iface, ok := underlying(m.Type().(*types.Signature).Recv().Type()).(*types.Interface)
+	if !ok {
+		return false
+	}
+	for fn := range c.asyncFuncs {
+		recv := fn.Type().(*types.Signature).Recv()
+		if recv != nil && fn.Name() == m.Name() && types.Implements(recv.Type(), iface) {
+			return true
+		}
+	}
+	return false
+}
+
+// awaited reports whether call calls an async function
+func (c *jsCompiler) awaited(call *ast.CallExpr) bool {
+	if tv := c.info.Types[call.Fun]; tv.IsType() || c.builtin(call) != "" {
+		return false
+	}
+	fn := c.callee(call)
+	if fn == nil {
+		return c.dynamic
+	}
+	if recv := fn.Type().(*types.Signature).Recv(); recv != nil && isInterface(recv.Type()) {
+		return c.asyncMethod(fn)
+	}
+	return c.isAsync(fn)
+}
+
+// await returns the converted call x of an async function, awaiting it.
+// Only functions can await, so async calls initializing package
+// variables are reported at the call.
+func (c *jsCompiler) await(call *ast.CallExpr, x jsast.Expr) jsast.Expr {
+	if !c.awaits {
+		c.pos = call.Pos()
+		panic(fmt.Sprintf("async call %s outside of a function, only functions can wait for it", types.ExprString(call)))
+	}
+	return &jsast.UnaryExpression{Op: "await ", Exp: x}
+}
+
+// awaitsIn reports whether the expression x calls async functions
+func (c *jsCompiler) awaitsIn(x ast.Expr) bool {
+	found := false
+	ast.Inspect(x, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.CallExpr:
+			found = found || c.awaited(n)
+		}
+		return !found
+	})
+	return found
+}
@@ -1,9 +1,18 @@
 package jscompiler
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	pathpkg "path"
+	"runtime"
+	"strings"
 	"weblang/wl/ast"
+	"weblang/wl/flow"
+	"weblang/wl/jscompiler/jsast"
 	"weblang/wl/jscompiler/jsprinter"
+	"weblang/wl/jscompiler/sourcemap"
+	"weblang/wl/token"
 	"weblang/wl/types"
 )
 
@@ -13,25 +22,204 @@ type Outputer interface {
 	Done(pkg *types.Package, writer io.Writer)
 }
 
+// MapOutputer is an Outputer that also takes a source map for each
+// package. The map is filled in while the module is written and is
+// complete when Done is called, so the outputer can write it next to
+// the module.
+type MapOutputer interface {
+	Outputer
+
+	// MapFor returns the file set the package was parsed with and the
+	// map to fill in for its module
+	MapFor(pkg *types.Package) (*token.FileSet, *sourcemap.Map)
+}
+
+// Config controls the javascript written by the compiler
+type Config struct {
+	// Minify writes the javascript without whitespace or redundant
+	// parentheses, with short local names and constant expressions
+	// folded into literals. Exported names are kept. Pages have their
+	// runtime stripped of comments and whitespace too.
+	Minify bool
+
+	// SourceMap, if set, is filled in by CompilePage with the source
+	// map of the page script
+	SourceMap *sourcemap.Map
+
+	// Prune leaves the declarations and runtime helpers a page doesn't
+	// reach out of its script. Entry points are the expressions and
+	// event handlers of the templates, the variables the runtime
+	// assigns and the initializers of package variables calling
+	// functions.
+	Prune bool
+
+	// Ints selects how ints are represented, SafeInts by default. Pages
+	// compiled with BigInts have the runtime hand ints to them as
+	// BigInts too.
+	Ints IntModel
+
+	// Report, if set along with Prune, is filled in by CompilePage with
+	// what was kept and why, and what was dropped
+	Report *Report
+
+	// async holds the async functions of the packages compiled, which
+	// packages importing them await
+	async map[*types.Func]bool
+}
+
 // Compile takes a package as a set of ast files and type information
-// and uses the given outputer to write it to files
-func Compile(pkg *types.Package, ast []*ast.File, out Outputer) error {
+// and uses the given outputer to write it to files. The information
+// must include the Types, Defs, Uses and Implicits of the package.
+func Compile(pkg *types.Package, info *types.Info, ast []*ast.File, out Outputer) error {
+	return (&Config{}).Compile(pkg, info, ast, out)
+}
 
-	c := &jsCompiler{
-		symbols: &symbolMap{
-			store: make(map[string]string),
-		},
+// Compile is like the package level Compile, with the output controlled
+// by cfg. Source maps are written for outputers implementing
+// MapOutputer.
+func (cfg *Config) Compile(pkg *types.Package, info *types.Info, ast []*ast.File, out Outputer) (err error) {
+	c := cfg.newCompiler(info)
+	c.exports = true
+	var m *sourcemap.Map
+	mo, ok := out.(MapOutputer)
+	if ok {
+		c.fset, m = mo.MapFor(pkg)
 	}
+	defer c.catch(&err)
 
 	jsmodule, err := c.Compile(pkg, ast)
 	if err != nil {
 		return err
 	}
+	jsmodule.Imports = append([]jsast.Import{runtimeImport(pkg.Path())}, jsmodule.Imports...)
 
 	writer := out.WriterFor(pkg)
-	if err := jsprinter.Fprint(writer, jsmodule); err != nil {
+	if ok {
+		if err := cfg.newPrinter(writer, c.fset, m).Fprint(jsmodule); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(writer, m.Comment()); err != nil {
+			return err
+		}
+	} else if err := cfg.newPrinter(writer, nil, nil).Fprint(jsmodule); err != nil {
 		return err
 	}
 	out.Done(pkg, writer)
 	return nil
 }
+
+// RuntimeModule is the import path of the module of the page runtime,
+// which the modules of packages import; see WriteRuntime
+const RuntimeModule = "wl.runtime"
+
+// WriteRuntime writes the page runtime as the module compiled modules
+// and pages importing them share, to the file ModuleFile(RuntimeModule)
+// of the output. It exports the runtime object as its default export.
+func (cfg *Config) WriteRuntime(w io.Writer) error {
+	runtime := runtimeFor(nil, nil)
+	if cfg.Minify {
+		runtime = minifyRuntime(runtime)
+	}
+	if cfg.Ints == BigInts {
+		// the runtime hands ints to the modules as BigInts
+		runtime += "wl.bigints();\n"
+	}
+	_, err := io.WriteString(w, runtime+"export default wl;\n")
+	return err
+}
+
+// runtimeImport returns the import of the runtime module by the module
+// of the package with the import path
+func runtimeImport(path string) jsast.Import {
+	return jsast.Import{Alias: "wl", File: moduleSpecifier(path, RuntimeModule), Default: true}
+}
+
+// CompileFlowModule writes the module of the package declared by a
+// checked flow, whose default export is the runtime object of the flow.
+// Compiled modules and pages importing site packages import the flow
+// object from it, so they share the state of the flow.
+func (cfg *Config) CompileFlowModule(w io.Writer, finfo *flow.Info) error {
+	decl := compileFlow(finfo, cfg.Ints).(*jsast.VarDecl)
+	mod := &jsast.Module{
+		Name:    finfo.Package.Name(),
+		Imports: []jsast.Import{runtimeImport(finfo.Package.Path())},
+		Decls: []jsast.Decl{
+			decl,
+			&jsast.ExportDecl{Specs: []jsast.ExportSpec{{Local: decl.Name, Name: "default"}}},
+		},
+	}
+	return cfg.newPrinter(w, nil, nil).Fprint(mod)
+}
+
+// ModuleFile returns the file the module of the package with the import
+// path is written to, relative to the root of the output
+func ModuleFile(path string) string {
+	return path + ".js"
+}
+
+// moduleSpecifier returns the specifier the module of the package from
+// imports the module of the package to with: the relative path between
+// their module files
+func moduleSpecifier(from, to string) string {
+	dir := strings.Split(pathpkg.Dir(ModuleFile(from)), "/")
+	file := strings.Split(ModuleFile(to), "/")
+	if dir[0] == "." {
+		dir = nil
+	}
+	n := 0
+	for n < len(dir) && n < len(file)-1 && dir[n] == file[n] {
+		n++
+	}
+	spec := strings.Repeat("../", len(dir)-n) + strings.Join(file[n:], "/")
+	if !strings.HasPrefix(spec, "../") {
+		spec = "./" + spec
+	}
+	return spec
+}
+
+func (cfg *Config) newCompiler(info *types.Info) *jsCompiler {
+	if cfg.async == nil {
+		cfg.async = make(map[*types.Func]bool)
+	}
+	symbols := newSymbolMap()
+	symbols.short = cfg.Minify
+	return &jsCompiler{
+		info:    info,
+		symbols: symbols,
+		minify:  cfg.Minify,
+		ints:    cfg.Ints,
+
+		clones:     make(map[*types.TypeName]bool),
+		analyzed:   make(map[*types.Func]bool),
+		modified:   make(map[*types.Var]bool),
+		async:      make(map[ast.Node]bool),
+		asyncFuncs: cfg.async,
+	}
+}
+
+// catch turns the panic of a construct the compiler doesn't support, if
+// any, into the error err, at the position of the last node converted;
+// it must be deferred
+func (c *jsCompiler) catch(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	msg := fmt.Sprint(r)
+	if _, ok := r.(runtime.Error); ok {
+		msg = "internal compiler error: " + msg
+	}
+	if c.fset != nil && c.pos.IsValid() {
+		*err = fmt.Errorf("%s: %s", c.fset.Position(c.pos), msg)
+		return
+	}
+	*err = errors.New(msg)
+}
+
+func (cfg *Config) newPrinter(w io.Writer, fset *token.FileSet, m *sourcemap.Map) *jsprinter.Printer {
+	p := jsprinter.NewPrinter(w, fset, m)
+	if cfg.Minify {
+		p.Mode = jsprinter.Minify
+	}
+	return p
+}
@@ -1,11 +1,14 @@
 package jscompiler
 
 import (
+	"fmt"
 	"io"
 	"strings"
 	"testing"
 	"weblang/wl/ast"
+	"weblang/wl/flow"
 	"weblang/wl/importer"
+	"weblang/wl/jscompiler/sourcemap"
 	"weblang/wl/parser"
 	"weblang/wl/token"
 	"weblang/wl/types"
@@ -66,11 +69,12 @@ type test enum {
     Yu = 2
 }
 
-func a() {
+func a() bool {
 	var v = test.Blah
 	if v == test.Yu { 
     	return false
 	}
+	return true
 }`)
 
 	if want, got := `const test = Object.freeze({
@@ -83,6 +87,7 @@ let v = test.Blah;
 if (v === test.Yu) {
 return false;
 };
+return true;
 };`, output; want != got {
 		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
 	}
@@ -105,9 +110,10 @@ func a() bool {
 	return true
 }`)
 
-	if want, got := `class Test {
- val;
- val2;
+	if want, got := `export const Test$type = {id: "p.Test", name: "Test", pkg: "p", kind: "struct", comparable: true, fields: ["val", "val2"], methods: [], equal: Test$equal};
+export class Test {
+ val = 0;
+ val2 = "";
 };
 function a() {
 let v = new Test();
@@ -115,13 +121,1290 @@ if (v.val === 100) {
 return false;
 };
 return true;
+};
+export function Test$clone($v) {
+let $c = new Test();
+$c.val = $v.val;
+$c.val2 = $v.val2;
+return $c;
+};
+export function Test$equal($a, $b) {
+return $a.val === $b.val && $a.val2 === $b.val2;
 };`, output; want != got {
 		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
 	}
 }
 
-func compileProgram(t *testing.T, src string) string {
+func TestMethods(t *testing.T) {
+	output := compileProgram(t, `
+package p
+
+type counter struct {
+	n int
+}
+
+func (c counter) inc(by int) {
+	c.n = c.n + by
+}
+
+func (_ counter) zero() int {
+	return 0
+}`)
+
+	if want, got := `class counter {
+ n = 0;
+};
+counter.prototype.inc = function (by) {
+let c = this;
+c.n = wl.int(c.n + by);
+};
+counter.prototype.zero = function () {
+return 0;
+};`, output; want != got {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestReservedNames(t *testing.T) {
+	output := compileProgram(t, `
+package p
+
+var new int
+var class = "c"
+var Object = 1
+
+func delete(this int) int {
+	var arguments = this
+	if arguments == 0 {
+		var this = 2
+		return this + new
+	}
+	return arguments
+}
+
+func f(function int) int {
+	return delete(function) + Object
+}`)
+
+	if want, got := `let new$ = 0;
+let class$ = "c";
+let Object$ = 1;
+function delete$(this$) {
+let arguments$ = this$;
+if (arguments$ === 0) {
+let this$1 = 2;
+return wl.int(this$1 + new$);
+};
+return arguments$;
+};
+function f(function$) {
+return wl.int(delete$(function$) + Object$);
+};
+export { Object$ as Object };`, output; want != got {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestShadowing(t *testing.T) {
+	const src = `
+package p
+
+var x = 10
+
+func f(x int) int {
+	y := x
+	{
+		x := x + 1
+		y = y + x
+	}
+	if x := x * 2; x > 0 {
+		y = y + x
+	}
+	return y
+}
+
+func g() int {
+	x := x + 1
+	return x
+}`
+	for _, minify := range []bool{false, true} {
+		out := newTestOutputer(t, 1)
+		compileConfig(t, &Config{Minify: minify}, token.NewFileSet(), src, out)
+		if got := runJS(t, out.Output()+"\nconsole.log(f(1), g());"); got != "5 11\n" {
+			t.Errorf("minify %v: want 5 11, got %s in\n%s", minify, got, out.Output())
+		}
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	out := newTestOutputer(t, 1)
+	compileConfig(t, &Config{}, token.NewFileSet(), `
+package p
+
+type point struct {
+	X, Y int
+}
+
+func f() {
+	defer println("deferred", 1)
+	var ps []point
+	p := point{1, 2}
+	ps = append(ps, p, point{3, 4})
+	p.X = 5
+	more := append(ps, ps...)
+	more[0].Y = 9
+	grid := make([]point, 2)
+	grid[0].X = 7
+	n := new(int)
+	print("a", 1, 2)
+	println(ps[0].X, ps[0].Y, ps[1].X, more[2].X, grid[0].X, grid[1].X, n)
+}`, out)
+	if got := runJS(t, out.Output()+"\nf();"); got != "a12\n1 2 3 1 7 0 0\ndeferred 1\n" {
+		t.Errorf("want the output of f, got:\n%s\nof:\n%s", got, out.Output())
+	}
+}
+
+func TestMinify(t *testing.T) {
+	out := newTestOutputer(t, 1)
+	compileConfig(t, &Config{Minify: true}, token.NewFileSet(), `
+package p
+
+const limit = 2 * 5
+
+var Count int
+
+func add(step int) {
+	var next = (Count + step) * (3 - 1)
+	if next > limit {
+		var delete = next - -1
+		Count = -(delete + 1)
+	}
+}
+
+type test enum {
+	None = iota
+	Some
+}
+
+func isSome(v test) bool {
+	return v == test.Some && !(limit > 10)
+}
+
+func signs(a float, n int) float {
+	m := -(-n)
+	return -(-a) * +(+a) * float(m)
+}`, out)
+
+	// locals are shortened in the sorted order of their scope, constants
+	// folded and parentheses only kept where the operators need them
+	want := `const limit=10;export let Count=0;function add(b){let a=wl.int(wl.int(Count+b)*2);if(a>10){let c=wl.int(a- -1);Count=-wl.int(c+1);};};` +
+		`const test=Object.freeze({None:{name:"None",value:0},Some:{name:"Some",value:1}});` +
+		`function isSome(a){return a===test.Some&&true;};` +
+		`function signs(a,c){let b=- -c;return- -a*+ +a*b;};`
+	if got := out.Output(); got != want {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestIntArithmetic(t *testing.T) {
+	const src = `package p
+
+const half = 7 / 2
+
+func f(a int, b int, x float) float {
+	var q int = a / b
+	q %= b
+	q = q - -a
+	var y float = x / 2
+	return float(q) + y + float(int(x)) + half
+}`
+	out := newTestOutputer(t, 1)
+	compileWith(t, token.NewFileSet(), src, out)
+	want := `const half = 3;
+function f(a, b, x) {
+let q = wl.div(a, b);
+q = wl.rem(q, b);
+q = wl.int(q - -a);
+let y = x / 2;
+return q + y + wl.int(Math.trunc(x)) + half;
+};`
+	if got := out.Output(); got != want {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+
+	out = newTestOutputer(t, 1)
+	compileConfig(t, &Config{Ints: BigInts}, token.NewFileSet(), src, out)
+	want = `const half = 3n;
+function f(a, b, x) {
+let q = wl.div(a, b);
+q = wl.rem(q, b);
+q = wl.i64(q - wl.i64(-a));
+let y = x / 2;
+return Number(q) + y + Number(wl.i64(BigInt(Math.trunc(x)))) + 3;
+};`
+	if got := out.Output(); got != want {
+		t.Fatalf("BigInts output wanted:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestBitwise(t *testing.T) {
+	const src = `package p
+
+const big = 1 << 40
+
+func f(x int) int {
+	var Math = x << 40
+	Math |= x >> 2
+	Math ^= ^x & 255
+	return Math + big
+}`
+	out := newTestOutputer(t, 1)
+	compileWith(t, token.NewFileSet(), src, out)
+	want := `const big = 1099511627776;
+function f(x) {
+let Math$ = wl.shl(x, 40);
+Math$ = wl.or(Math$, wl.shr(x, 2));
+Math$ = wl.xor(Math$, wl.and(wl.not(x), 255));
+return wl.int(Math$ + big);
+};`
+	if got := out.Output(); got != want {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+
+	out = newTestOutputer(t, 1)
+	compileConfig(t, &Config{Ints: BigInts}, token.NewFileSet(), src, out)
+	want = `const big = 1099511627776n;
+function f(x) {
+let Math$ = wl.shl(x, 40n);
+Math$ = wl.or(Math$, wl.shr(x, 2n));
+Math$ = wl.xor(Math$, wl.and(wl.not(x), 255n));
+return wl.i64(Math$ + 1099511627776n);
+};`
+	if got := out.Output(); got != want {
+		t.Fatalf("BigInts output wanted:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestStructCopy(t *testing.T) {
+	output := compileProgram(t, `
+package p
+
+type point struct {
+	x int
+	y int
+}
+
+type line struct {
+	from point
+	to   point
+}
+
+func moved(p point) point {
+	p.x = p.x + 1
+	return p
+}
+
+func xOf(p point) int {
+	return p.x
+}
+
+var g point
+
+func readAfter(p point) int {
+	g.x = 5
+	return p.x
+}
+
+func f() line {
+	var a point = point{x: 1, y: 2}
+	var b point = a
+	b = moved(a)
+	var x int = xOf(a)
+	x = readAfter(g)
+	var ps []point = []point{a, b}
+	var l line = line{from: ps[0], to: point{3, x}}
+	return l
+}`)
+
+	if want, got := `class point {
+ x = 0;
+ y = 0;
+};
+class line {
+ from = new point();
+ to = new point();
+};
+function moved(p) {
+p.x = wl.int(p.x + 1);
+return point$clone(p);
+};
+function xOf(p) {
+return p.x;
+};
+let g = new point();
+function readAfter(p) {
+g.x = 5;
+return p.x;
+};
+function f() {
+let a = Object.assign(new point(), {x: 1, y: 2});
+let b = point$clone(a);
+b = moved(point$clone(a));
+let x = xOf(a);
+x = readAfter(point$clone(g));
+let ps = [point$clone(a), point$clone(b)];
+let l = Object.assign(new line(), {from: point$clone(ps[0]), to: Object.assign(new point(), {x: 3, y: x})});
+return line$clone(l);
+};
+function point$clone($v) {
+let $c = new point();
+$c.x = $v.x;
+$c.y = $v.y;
+return $c;
+};
+function line$clone($v) {
+let $c = new line();
+$c.from = point$clone($v.from);
+$c.to = point$clone($v.to);
+return $c;
+};`, output; want != got {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestRange(t *testing.T) {
+	output := compileProgram(t, `
+package p
+
+type point struct {
+	x int
+}
+
+func shift(ps []point, s string) int {
+	var n int = 0
+	for _, p := range ps {
+		p.x = p.x + 1
+		n = n + p.x
+	}
+	var last point
+	for n, last = range ps {
+	}
+	for i := range s {
+		n = n + i
+	}
+	return n + last.x
+}`)
+
+	if want, got := `class point {
+ x = 0;
+};
+function shift(ps, s) {
+let n = 0;
+for (let [, p] of wl.range(ps)) {
+p = point$clone(p);
+p.x = wl.int(p.x + 1);
+n = wl.int(n + p.x);
+};
+let last = new point();
+for (let [$k, $v] of wl.range(ps)) {
+n = $k;
+last = point$clone($v);
+};
+for (let [i] of wl.range(s)) {
+n = wl.int(n + i);
+};
+return wl.int(n + last.x);
+};
+function point$clone($v) {
+let $c = new point();
+$c.x = $v.x;
+return $c;
+};`, output; want != got {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestStructEquality(t *testing.T) {
+	output := compileProgram(t, `
+package p
+
+type color enum {
+	Red = iota
+	Green
+}
+
+type point struct {
+	x int
+	c color
+}
+
+type line struct {
+	from point
+	to   point
+	tag  struct{ name string }
+}
+
+func same(a line, b line) bool {
+	return a == b
+}
+
+func moved(a point, b point) bool {
+	return a != b || a.c == color.Green
+}`)
+
+	if want, got := `const color = Object.freeze({
+Red: { name: "Red", value: 0 },
+Green: { name: "Green", value: 1 }
+});
+class point {
+ x = 0;
+ c = color.Red;
+};
+class line {
+ from = new point();
+ to = new point();
+ tag = {};
+};
+function same(a, b) {
+return line$equal(a, b);
+};
+function moved(a, b) {
+return !point$equal(a, b) || a.c === color.Green;
+};
+function line$equal($a, $b) {
+return point$equal($a.from, $b.from) && point$equal($a.to, $b.to) && $equal0($a.tag, $b.tag);
+};
+function point$equal($a, $b) {
+return $a.x === $b.x && $a.c === $b.c;
+};
+function $equal0($a, $b) {
+return $a.name === $b.name;
+};`, output; want != got {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+
+	// the checker rejects comparisons of types that aren't comparable
+	const src = `package p
+
+type list struct {
+	items []int
+}
+
+func same(a list, b list) bool {
+	return a == b
+}`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "test.wl", src, 0)
+	if err != nil {
+		t.Fatalf("Error during parse: %v", err)
+	}
+	conf := types.Config{Importer: importer.Default()}
+	_, err = conf.Check("p", fset, []*ast.File{f}, nil)
+	if err == nil || !strings.Contains(err.Error(), "cannot compare a == b") {
+		t.Fatalf("expected a comparison error, got %v", err)
+	}
+}
+
+func TestInterfaces(t *testing.T) {
+	output := compileProgram(t, `
+package p
+
+type shape interface {
+	area() float
+}
+
+type square struct {
+	side float
+}
+
+func (s square) area() float {
+	return s.side * s.side
+}
+
+type any interface{}
+
+func kind(x any) string {
+	switch y := x.(type) {
+	case square:
+		return "square"
+	case int, string:
+		return y.(string)
+	case nil:
+		return "nil"
+	default:
+		return "other"
+	}
+}
+
+func area(x any, s square) float {
+	v, ok := x.(shape)
+	if ok && x != nil && x == s {
+		return v.area()
+	}
+	return x.(square).side
+}
+
+func box(s square) any {
+	return s
+}`)
+
+	if want, got := `const square$type = {id: "p.square", name: "square", pkg: "p", kind: "struct", comparable: true, fields: ["side"], methods: ["area"], equal: square$equal};
+const $type0 = {id: "int", name: "", pkg: "", kind: "int", comparable: true, fields: [], methods: []};
+const $type1 = {id: "string", name: "", pkg: "", kind: "string", comparable: true, fields: [], methods: []};
+const shape$type = {id: "p.shape", name: "shape", pkg: "p", kind: "interface", comparable: true, fields: [], methods: ["area"]};
+class square {
+ side = 0;
+};
+square.prototype.area = function () {
+let s = this;
+return s.side * s.side;
+};
+function kind(x) {
+if (wl.is(x, square$type)) {
+let y = square$clone(x.$value);
+return "square";
+} else if (wl.is(x, $type0) || wl.is(x, $type1)) {
+let y = x;
+return wl.assert(y, $type1, "p.any");
+} else if (x === null) {
+let y = x;
+return "nil";
+} else {
+let y = x;
+return "other";
+};
+};
+function area(x, s) {
+let [v, ok] = wl.assertOk(x, shape$type, null);
+if (ok && x !== null && wl.same(x, wl.box(square$type, s))) {
+return v.$value.area();
+};
+return wl.assert(x, square$type, "p.any").side;
+};
+function box(s) {
+return wl.box(square$type, square$clone(s));
+};
+function square$clone($v) {
+let $c = new square();
+$c.side = $v.side;
+return $c;
+};
+function square$equal($a, $b) {
+return $a.side === $b.side;
+};`, output; want != got {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestNamedTypes(t *testing.T) {
+	output := compileProgram(t, `
+package p
+
+type any interface{}
+
+type name string
+
+type names []name
+
+type check func(n name) bool
+
+func kind(x any) int {
+	if n, ok := x.(name); ok && n != "" {
+		return 1
+	}
+	switch x.(type) {
+	case names:
+		return 2
+	case check:
+		return 3
+	}
+	return 0
+}
+
+func f() int {
+	var s string = "wl"
+	var n name = name(s)
+	var c check = func(n name) bool {
+		return n == ""
+	}
+	return kind(n) + kind(names{n}) + kind(c)
+}`)
+
+	if want, got := `const name$type = {id: "p.name", name: "name", pkg: "p", kind: "string", comparable: true, fields: [], methods: []};
+const names$type = {id: "p.names", name: "names", pkg: "p", kind: "slice", comparable: false, fields: [], methods: []};
+const check$type = {id: "p.check", name: "check", pkg: "p", kind: "func", comparable: false, fields: [], methods: []};
+function kind(x) {
+{
+let [n, ok] = wl.assertOk(x, name$type, "");
+if (ok && n !== "") {
+return 1;
+};
+};
+if (wl.is(x, names$type)) {
+return 2;
+} else if (wl.is(x, check$type)) {
+return 3;
+};
+return 0;
+};
+function f() {
+let s = "wl";
+let n = s;
+let c = function (n$) {
+return n$ === "";
+};
+return wl.int(wl.int(kind(wl.box(name$type, n)) + kind(wl.box(names$type, [n]))) + kind(wl.box(check$type, c)));
+};`, output; want != got {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+
+	fset := token.NewFileSet()
+	err := checkCompile(t, &Config{}, fset, `
+package p
+
+type name string
+
+func (n name) upper() name {
+	return n
+}`, &mapOutputer{testOutputer: newTestOutputer(t, 1), fset: fset})
+	if want := "test.wl:6:1: unsupported method on non-struct type name: only struct types can have methods in compiled code"; err == nil || err.Error() != want {
+		t.Errorf("error wanted %q, got %v", want, err)
+	}
+}
+
+func TestDefer(t *testing.T) {
+	output := compileProgram(t, `
+package p
+
+type file struct {
+	name string
+}
+
+func (f file) close() {
+}
+
+func log(f file) {
+}
+
+func open(name string) int {
+	var f = file{name: name}
+	defer f.close()
+	defer log(f)
+	if name == "" {
+		panic("no name")
+	}
+	return 1
+}
+
+func attempt(name string) int {
+	defer func() {
+		var r = recover()
+		if r != nil {
+			log(file{})
+		}
+	}()
+	return open(name)
+}`)
+
+	if want, got := `const $type0 = {id: "string", name: "", pkg: "", kind: "string", comparable: true, fields: [], methods: []};
+class file {
+ name = "";
+};
+file.prototype.close = function () {
+let f = this;
+};
+function log(f) {
+};
+function open(name) {
+let $f = wl.frame();
+try {
+let f = Object.assign(new file(), {name: name});
+wl.defer($f, f, "close", []);
+wl.defer($f, null, log, [file$clone(f)]);
+if (name === "") {
+wl.panic(wl.box($type0, "no name"));
+};
+return 1;
+} catch ($e) {
+wl.panicked($f, $e);
+} finally {
+wl.unwind($f);
+};
+return 0;
+};
+function attempt(name) {
+let $f = wl.frame();
+try {
+wl.defer($f, null, function $fn() {
+let $r = wl.recoverable($fn);
+let r = wl.recover($r);
+if (r !== null) {
+log(new file());
+};
+}, []);
+return open(name);
+} catch ($e) {
+wl.panicked($f, $e);
+} finally {
+wl.unwind($f);
+};
+return 0;
+};
+function file$clone($v) {
+let $c = new file();
+$c.name = $v.name;
+return $c;
+};`, output; want != got {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+
+	// only calls of functions can be deferred
+	for src, msg := range map[string]string{
+		"func f() { defer int(1) }": "defer requires function call, not conversion",
+		"func f() { defer f }":      "function must be invoked in defer statement",
+	} {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "test.wl", "package p\n"+src, 0)
+		if err == nil {
+			conf := types.Config{Importer: importer.Default()}
+			_, err = conf.Check("p", fset, []*ast.File{f}, nil)
+		}
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: expected error %q, got %v", src, msg, err)
+		}
+	}
+}
+
+func TestResults(t *testing.T) {
+	output := compileProgram(t, `
+package p
+
+func divmod(a int, b int) (int, int) {
+	return a / b, a % b
+}
+
+func nr() (r int) {
+	r = 3
+	return
+}
+
+func swap(a int, b int) (x int, y int) {
+	return b, a
+}
+
+func divRecover(a int, b int) (q int) {
+	defer func() {
+		if recover() != nil {
+			q = -1
+		}
+	}()
+	q = a / b
+	return q
+}
+
+func pair() (int, int) {
+	defer nr()
+	return divmod(7, 2)
+}
+
+func sum() int {
+	var q, r = divmod(7, 2)
+	q, r = swap(divmod(q, r))
+	s, _ := pair()
+	return q + r + s
+}`)
+
+	if want, got := `function divmod(a, b) {
+return [wl.div(a, b), wl.rem(a, b)];
+};
+function nr() {
+let r = 0;
+r = 3;
+return r;
+};
+function swap(a, b) {
+let x = 0;
+let y = 0;
+return [b, a];
+};
+function divRecover(a, b) {
+let q = 0;
+let $f = wl.frame();
+try {
+wl.defer($f, null, function $fn() {
+let $r = wl.recoverable($fn);
+if (wl.recover($r) !== null) {
+q = -1;
+};
+}, []);
+q = wl.div(a, b);
+q = q;
+return;
+} catch ($e) {
+wl.panicked($f, $e);
+} finally {
+wl.unwind($f);
+return q;
+};
+};
+function pair() {
+let $f = wl.frame();
+try {
+wl.defer($f, null, nr, []);
+return divmod(7, 2);
+} catch ($e) {
+wl.panicked($f, $e);
+} finally {
+wl.unwind($f);
+};
+return [0, 0];
+};
+function sum() {
+let [q, r] = divmod(7, 2);
+[q, r] = swap(...divmod(q, r));
+let [s, ] = pair();
+return wl.int(wl.int(q + r) + s);
+};`, output; want != got {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestCatch(t *testing.T) {
+	output := compileProgram(t, `
+package p
+
+func report(e error) {
+	print(e.Error())
+}
+
+func parse(s string) int {
+	catch report
+	catch func(v interface{}) {
+		print(v)
+	}
+	if s == "" {
+		panic("empty")
+	}
+	return 1
+}`)
+
+	if want, got := `const $type0 = {id: "error", name: "error", pkg: "", kind: "interface", comparable: true, fields: [], methods: ["Error"]};
+const $type1 = {id: "interface{}", name: "", pkg: "", kind: "interface", comparable: true, fields: [], methods: []};
+const $type2 = {id: "string", name: "", pkg: "", kind: "string", comparable: true, fields: [], methods: []};
+function report(e) {
+wl.print(e.$value.Error());
+};
+function parse(s) {
+let $f = wl.frame();
+try {
+wl.catcher($f, report, function ($v) {
+return wl.is($v, $type0);
+});
+wl.catcher($f, function (v) {
+wl.print(v);
+}, function ($v) {
+return wl.is($v, $type1);
+});
+if (s === "") {
+wl.panic(wl.box($type2, "empty"));
+};
+return 1;
+} catch ($e) {
+wl.panicked($f, $e);
+} finally {
+wl.unwind($f);
+};
+return 0;
+};`, output; want != got {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+
+	for src, msg := range map[string]string{
+		"func f() { catch 1 }":                              "catch requires a function of one interface parameter and no results",
+		"func f() { catch func(s string) {} }":              "catch requires a function of one interface parameter and no results",
+		"func f() { catch func(e error) int { return 0 } }": "catch requires a function of one interface parameter and no results",
+	} {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "test.wl", "package p\n"+src, 0)
+		if err == nil {
+			conf := types.Config{Importer: importer.Default()}
+			_, err = conf.Check("p", fset, []*ast.File{f}, nil)
+		}
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: expected error %q, got %v", src, msg, err)
+		}
+	}
+}
+
+func TestAsync(t *testing.T) {
+	output := compileProgram(t, `
+package p
+
+import "http"
+
+type source interface {
+	read() string
+}
+
+type remote struct {
+	url string
+}
+
+func (r remote) read() string {
+	return get(r.url)
+}
+
+type fixed struct {
+	text string
+}
+
+func (f fixed) read() string {
+	return f.text
+}
+
+func get(url string) string {
+	return http.Get(url).Body
+}
+
+func twice(s source) string {
+	return s.read() + s.read()
+}
+
+func double(n int) int {
+	return n * 2
+}
+
+func closed(url string) bool {
+	defer func() {
+		recover()
+	}()
+	return http.Post(url, "text/plain", "").Status == 410
+}`)
+
+	if want, got := `const http = wl.pkgs.http;
+class remote {
+ url = "";
+};
+remote.prototype.read = async function () {
+let r = this;
+return await get(r.url);
+};
+class fixed {
+ text = "";
+};
+fixed.prototype.read = function () {
+let f = this;
+return f.text;
+};
+async function get(url) {
+return (await http.Get(url)).Body;
+};
+async function twice(s) {
+return await s.$value.read() + await s.$value.read();
+};
+function double(n) {
+return wl.int(n * 2);
+};
+async function closed(url) {
+let $f = wl.frame();
+try {
+wl.defer($f, null, function $fn() {
+let $r = wl.recoverable($fn);
+wl.recover($r);
+}, []);
+return (await http.Post(url, "text/plain", "")).Status === 410;
+} catch ($e) {
+wl.panicked($f, $e);
+} finally {
+await wl.unwindAsync($f);
+};
+return false;
+};`, output; want != got {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+
+	// package variables can't be initialized by async calls
+	fset := token.NewFileSet()
+	err := checkCompile(t, &Config{}, fset, `
+package p
+
+import "http"
+
+var status = http.Get("/x").Status`, &mapOutputer{testOutputer: newTestOutputer(t, 1), fset: fset})
+	if want := `test.wl:6:14: async call http.Get("/x") outside of a function, only functions can wait for it`; err == nil || err.Error() != want {
+		t.Errorf("error wanted %q, got %v", want, err)
+	}
+}
+
+func TestModules(t *testing.T) {
 	fset := token.NewFileSet()
+	check := func(path string, imp types.Importer, srcs ...string) (*types.Package, *types.Info, []*ast.File) {
+		var files []*ast.File
+		for i, src := range srcs {
+			f, err := parser.ParseFile(fset, fmt.Sprintf("%s/%d.wl", path, i), src, 0)
+			if err != nil {
+				t.Fatalf("Error during parse: %v", err)
+			}
+			files = append(files, f)
+		}
+		conf := types.Config{Importer: imp}
+		info := &types.Info{
+			Types:     make(map[ast.Expr]types.TypeAndValue),
+			Defs:      make(map[*ast.Ident]types.Object),
+			Uses:      make(map[*ast.Ident]types.Object),
+			Implicits: make(map[ast.Node]types.Object),
+		}
+		pkg, err := conf.Check(path, fset, files, info)
+		if err != nil {
+			t.Fatalf("Error During Type Check: %v", err)
+		}
+		return pkg, info, files
+	}
+
+	util, info, files := check("app/util", importer.Default(), `package util
+
+func Double(n int) int {
+	return helper(n) * 2
+}
+
+func helper(n int) int {
+	return n
+}`)
+	out := newTestOutputer(t, 1)
+	if err := Compile(util, info, files, out); err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	want := `export function Double(n) {
+return wl.int(helper(n) * 2);
+};
+function helper(n) {
+return n;
+};`
+	if got := out.Output(); got != want {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+
+	// both files name their import list, a package level name takes the
+	// name of the util package
+	list, info, files := check("app/list", importer.Default(), `package list
+
+func Len() int {
+	return 0
+}`)
+	if err := Compile(list, info, files, newTestOutputer(t, 1)); err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	app, info, files := check("app", importer.With(util, list), `package app
+
+import list "app/util"
+
+var util = list.Double(2)
+`, `package app
+
+import list "app/list"
+
+func Size() int {
+	return list.Len() + util
+}`)
+	out = newTestOutputer(t, 1)
+	if err := Compile(app, info, files, out); err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	want = `import * as util$ from "./app/util.js";
+import * as list from "./app/list.js";
+
+
+let util = util$.Double(2);
+export function Size() {
+return wl.int(list.Len() + util);
+};`
+	if got := out.Output(); got != want {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+// TestExportedReservedName checks exported names renamed so they don't
+// collide with reserved names are exported and imported under their own
+// name
+func TestExportedReservedName(t *testing.T) {
+	fset := token.NewFileSet()
+	check := func(path, src string, imp types.Importer) (*types.Package, *types.Info, []*ast.File) {
+		f, err := parser.ParseFile(fset, path+".wl", src, 0)
+		if err != nil {
+			t.Fatalf("Error during parse: %v", err)
+		}
+		info := &types.Info{
+			Types:     make(map[ast.Expr]types.TypeAndValue),
+			Defs:      make(map[*ast.Ident]types.Object),
+			Uses:      make(map[*ast.Ident]types.Object),
+			Implicits: make(map[ast.Node]types.Object),
+		}
+		pkg, err := (&types.Config{Importer: imp}).Check(path, fset, []*ast.File{f}, info)
+		if err != nil {
+			t.Fatalf("Error During Type Check: %v", err)
+		}
+		return pkg, info, []*ast.File{f}
+	}
+
+	lib, info, files := check("lib", `package lib
+
+var Object = 1
+
+func Window() int {
+	return Object
+}`, importer.Default())
+	out := newTestOutputer(t, 1)
+	if err := Compile(lib, info, files, out); err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	want := `let Object$ = 1;
+export function Window() {
+return Object$;
+};
+export { Object$ as Object };`
+	if got := out.Output(); got != want {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+
+	app, info, files := check("app", `package app
+
+import "lib"
+
+var n = lib.Object + lib.Window()
+`, importer.With(lib))
+	out = newTestOutputer(t, 1)
+	if err := Compile(app, info, files, out); err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	if want, got := "let n = wl.int(lib.Object + lib.Window());", out.Output(); !strings.HasSuffix(got, want) {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+// TestRuntimeModule checks modules import the runtime module and the
+// modules of flows, which export the flow object
+func TestRuntimeModule(t *testing.T) {
+	fset := token.NewFileSet()
+	ff, err := flow.ParseFile(fset, "cart.flow", `flow cart
+
+state {
+	Count int
+}
+
+start items
+
+step items "cart" {
+	Next -> done
+}
+
+step done
+`)
+	if err != nil {
+		t.Fatalf("Error during flow parse: %v", err)
+	}
+	finfo, err := flow.Check(fset, ff, map[string]bool{"cart": true, "done": true})
+	if err != nil {
+		t.Fatalf("Error during flow check: %v", err)
+	}
+
+	f, err := parser.ParseFile(fset, "list.wl", `package list
+
+import "flows/cart"
+
+func Add() {
+	cart.Count = cart.Count + 1
+	cart.Next()
+}`, 0)
+	if err != nil {
+		t.Fatalf("Error during parse: %v", err)
+	}
+	info := &types.Info{
+		Types:     make(map[ast.Expr]types.TypeAndValue),
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Implicits: make(map[ast.Node]types.Object),
+	}
+	conf := types.Config{Importer: importer.With(finfo.Package)}
+	pkg, err := conf.Check("app/list", fset, []*ast.File{f}, info)
+	if err != nil {
+		t.Fatalf("Error During Type Check: %v", err)
+	}
+	var out rawOutputer
+	if err := Compile(pkg, info, []*ast.File{f}, &out); err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	want := `import wl from "../wl.runtime.js";
+import cart from "../flows/cart.js";
+`
+	if got := out.String(); !strings.HasPrefix(got, want) {
+		t.Errorf("module wanted to start with:\n%v\ngot:\n%v", want, got)
+	}
+
+	var mod strings.Builder
+	if err := (&Config{}).CompileFlowModule(&mod, finfo); err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	want = `import wl from "../wl.runtime.js";
+
+
+const cart = wl.flow({name: "cart", start: "items", state: {Count: 0}, events: ["Next"], steps: {items: {page: "/cart.html", on: {Next: "done"}}, done: {page: "/done.html", on: {}}}});
+export { cart as default };
+`
+	if got := mod.String(); got != want {
+		t.Errorf("flow module wanted:\n%v\ngot:\n%v", want, got)
+	}
+
+	for _, ints := range []IntModel{SafeInts, BigInts} {
+		var rt strings.Builder
+		if err := (&Config{Ints: ints}).WriteRuntime(&rt); err != nil {
+			t.Fatalf("writing runtime: %v", err)
+		}
+		want := "})();\nexport default wl;\n"
+		if ints == BigInts {
+			want = "})();\nwl.bigints();\nexport default wl;\n"
+		}
+		if got := rt.String(); !strings.HasSuffix(got, want) {
+			t.Errorf("runtime module with ints %v wanted to end with %q, got %q", ints, want, got[len(got)-40:])
+		}
+	}
+}
+
+func TestModuleSpecifier(t *testing.T) {
+	for _, test := range []struct{ from, to, want string }{
+		{"app", "app/util", "./app/util.js"},
+		{"app/util", "app/list", "./list.js"},
+		{"app/util", "lib", "../lib.js"},
+		{"app/util", "lib/strings", "../lib/strings.js"},
+		{"a/b/c", "a/d", "../d.js"},
+	} {
+		if got := moduleSpecifier(test.from, test.to); got != test.want {
+			t.Errorf("moduleSpecifier(%s, %s), want %s got %s", test.from, test.to, test.want, got)
+		}
+	}
+}
+
+func compileProgram(t *testing.T, src string) string {
+	out := newTestOutputer(t, 1)
+	compileWith(t, token.NewFileSet(), src, out)
+	return out.Output()
+}
+
+// compileWith compiles the package of src to out
+func compileWith(t *testing.T, fset *token.FileSet, src string, out Outputer) {
+	compileConfig(t, &Config{}, fset, src, out)
+}
+
+// compileConfig compiles the package of src to out with the
+// configuration cfg
+func compileConfig(t *testing.T, cfg *Config, fset *token.FileSet, src string, out Outputer) {
+	if err := checkCompile(t, cfg, fset, src, out); err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+}
+
+// checkCompile type checks the package of src and compiles it to out
+// with the configuration cfg, returning the error of the compiler
+func checkCompile(t *testing.T, cfg *Config, fset *token.FileSet, src string, out Outputer) error {
 	f, err := parser.ParseFile(fset, "test.wl", src, 0)
 
 	if err != nil {
@@ -132,19 +1415,66 @@ func compileProgram(t *testing.T, src string) string {
 
 	// typecheck
 	conf := types.Config{Importer: importer.Default()}
-	pkg, err := conf.Check(f.Name.Name, fset, astF, nil)
+	info := &types.Info{
+		Types:     make(map[ast.Expr]types.TypeAndValue),
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Implicits: make(map[ast.Node]types.Object),
+	}
+	pkg, err := conf.Check(f.Name.Name, fset, astF, info)
 	if err != nil {
 		t.Fatalf("Error During Type Check: %v", err)
 	}
 
-	out := newTestOutputer(t, 1)
-	err = Compile(pkg, astF, out)
+	return cfg.Compile(pkg, info, astF, out)
+}
 
-	if err != nil {
-		t.Fatalf("compile error: %v", err)
+func TestSourceMap(t *testing.T) {
+	fset := token.NewFileSet()
+	out := &mapOutputer{testOutputer: newTestOutputer(t, 1), fset: fset}
+	compileWith(t, fset, `package p
+
+var total int
+
+func add(n int) {
+	total = total + n
+}`, out)
+
+	want := `let total = 0;
+function add(n) {
+total = wl.int(total + n);
+};
+//# sourceMappingURL=p.js.map`
+	if got := out.Output(); got != want {
+		t.Fatalf("output wanted:\n%v\ngot:\n%v", want, got)
 	}
 
-	return out.Output()
+	// let total -> 3:5, function add -> 5:1, the identifiers of the
+	// assignment -> 6:2, 6:10 and 6:18 with their names and the overflow
+	// check of the sum -> 6:10, after the lines of the runtime import
+	if want, got := ";;;AAEI;AAEJ;AACCA,QAAQ,OAAAA,QAAQC", out.m.Mappings(); want != got {
+		t.Errorf("mappings wanted %v, got %v", want, got)
+	}
+}
+
+// rawOutputer keeps the module of a package as it was written
+type rawOutputer struct {
+	strings.Builder
+}
+
+func (o *rawOutputer) WriterFor(pkg *types.Package) io.Writer    { return &o.Builder }
+func (o *rawOutputer) Done(pkg *types.Package, writer io.Writer) {}
+
+// mapOutputer is a testOutputer also taking source maps
+type mapOutputer struct {
+	*testOutputer
+	fset *token.FileSet
+	m    *sourcemap.Map
+}
+
+func (o *mapOutputer) MapFor(pkg *types.Package) (*token.FileSet, *sourcemap.Map) {
+	o.m = sourcemap.New(pkg.Name() + ".js")
+	return o.fset, o.m
 }
 
 type testOutputer struct {
@@ -172,8 +1502,14 @@ func (o *testOutputer) WriterFor(pkg *types.Package) io.Writer {
 func (o *testOutputer) Done(pkg *types.Package, writer io.Writer) {
 	name := pkg.Name()
 	buf := writer.(*strings.Builder)
-	// trim off start/end whitespace to make testing easier
-	o.output[name] = strings.TrimSpace(buf.String())
+	// trim off start/end whitespace and the import of the runtime every
+	// module starts with, checked by TestRuntimeModule, to make testing
+	// easier
+	out := strings.TrimSpace(buf.String())
+	if strings.HasPrefix(out, "import wl from") {
+		out = strings.TrimSpace(out[strings.Index(out, ";")+1:])
+	}
+	o.output[name] = out
 }
 func (o *testOutputer) Output() string {
 	if len(o.pending) != 1 {
@@ -0,0 +1,157 @@
+package jscompiler
+
+import (
+	"fmt"
+	"sort"
+	"weblang/wl/ast"
+	"weblang/wl/jscompiler/jsast"
+	"weblang/wl/page"
+	"weblang/wl/types"
+)
+
+// parameters of component render functions; $ can't start a wl
+// identifier so they can't collide with names in the template
+const (
+	selfParam  = "$self"  // the component instance
+	slotsParam = "$slots" // content filling the slots, by name
+	keyParam   = "$key"   // key of the instance
+	propsParam = "$c"     // the instance in the function setting props
+)
+
+// components converts the template of each component into a render
+// function named after the component, sorted by name
+func (pc *pageCompiler) components() []jsast.Node {
+	comps := make([]*page.Component, 0, len(pc.info.Components))
+	for comp := range pc.info.Components {
+		comps = append(comps, comp)
+	}
+	sort.Slice(comps, func(i, j int) bool { return comps[i].Name < comps[j].Name })
+
+	var decls []jsast.Node
+	for _, comp := range comps {
+		pc.self = pc.info.Components[comp].Self
+		pc.inComp = true
+		name := renderName(comp)
+		decls = append(decls, &jsast.FuncDecl{Func: jsast.FunctionLiteral{
+			Name:   &name,
+			Params: []string{selfParam, slotsParam, keyParam},
+			Body: []jsast.Stmt{
+				&jsast.ReturnStmt{Result: &jsast.ArrayLiteral{Elts: pc.nodes(comp.Template.Nodes)}},
+			},
+		}})
+	}
+	pc.self = nil
+	pc.inComp = false
+	return decls
+}
+
+func renderName(comp *page.Component) string {
+	return comp.Name + "$render"
+}
+
+// instance converts a use of a component into a wl.component call,
+// which renders the instance for the key of the use site
+func (pc *pageCompiler) instance(n *page.Element, inst *page.Instance) jsast.Expr {
+	ci := pc.info.Components[inst.Component]
+	if ci == nil || ci.Props == nil {
+		pc.errorf(n.Pos(), "component <%s> was not type-checked", n.Name)
+		return &jsast.ArrayLiteral{}
+	}
+	key := pc.siteKey(inst.Key)
+
+	props := &jsast.FunctionLiteral{Params: []string{propsParam}}
+	for _, a := range n.Attrs {
+		f := inst.Props[a]
+		if f == nil {
+			continue
+		}
+		var value jsast.Expr
+		switch a := a.(type) {
+		case *page.Attr:
+			value = pc.propValue(a, f.Type())
+		case *page.EventAttr:
+			if _, call := a.Handler.(*ast.CallExpr); call {
+				value = pc.callHandler(a.Handler)
+			} else {
+				value = pc.convertExpr(a.Handler)
+			}
+		}
+		props.Body = append(props.Body, &jsast.AssignStmt{
+			Lhs: &jsast.SelectorExpr{X: &jsast.Identifier{Name: propsParam}, Sel: pc.symbols.name(f)},
+			Op:  "=",
+			Rhs: value,
+		})
+	}
+
+	var names []string
+	for name := range inst.Slots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	slots := &jsast.ObjectLiteral{}
+	for _, name := range names {
+		slots.Props = append(slots.Props, &jsast.Property{
+			Key:   jsString(name),
+			Value: &jsast.ArrayLiteral{Elts: pc.nodes(inst.Slots[name])},
+		})
+	}
+
+	return runtimeCall("component",
+		key,
+		pc.objectRef(ci.Props.Obj()),
+		props,
+		slots,
+		&jsast.Identifier{Name: renderName(inst.Component)},
+	)
+}
+
+// propValue converts an attribute setting a prop: the value of a
+// single action, true for a boolean attribute or else a string. Props
+// of type to are passed like arguments, so values are boxed and copied
+// as needed.
+func (pc *pageCompiler) propValue(a *page.Attr, to types.Type) jsast.Expr {
+	if !a.HasValue {
+		return &jsast.Identifier{Name: "true"}
+	}
+	if len(a.Value) == 1 {
+		if x, ok := a.Value[0].(*page.Action); ok {
+			return pc.assign(x.X, to)
+		}
+	}
+	return pc.attrValue(a.Value)
+}
+
+// siteKey returns the key of the component instance rendered by the
+// next use site: the site number, the keys of the enclosing loops and,
+// in a component template, the key of the enclosing instance. The key
+// attribute of the use, if any, replaces the key of the innermost loop,
+// so instances follow their items when items are removed or reordered.
+func (pc *pageCompiler) siteKey(attr ast.Expr) jsast.Expr {
+	pc.sites++
+	var key jsast.Expr = stringLit(fmt.Sprintf("c%d", pc.sites))
+	if pc.inComp {
+		key = &jsast.BinaryExpression{
+			Lhs: &jsast.BinaryExpression{Lhs: &jsast.Identifier{Name: keyParam}, Op: "+", Rhs: stringLit("/")},
+			Op:  "+",
+			Rhs: key,
+		}
+	}
+	var keys []jsast.Expr
+	for _, k := range pc.loops {
+		keys = append(keys, &jsast.Identifier{Name: k})
+	}
+	if attr != nil {
+		if len(keys) > 0 {
+			keys = keys[:len(keys)-1]
+		}
+		keys = append(keys, pc.convertExpr(attr))
+	}
+	for _, k := range keys {
+		key = &jsast.BinaryExpression{
+			Lhs: &jsast.BinaryExpression{Lhs: key, Op: "+", Rhs: stringLit(":")},
+			Op:  "+",
+			Rhs: k,
+		}
+	}
+	return key
+}
@@ -0,0 +1,408 @@
+package jscompiler
+
+import (
+	"strings"
+	"weblang/wl/ast"
+	"weblang/wl/importer"
+	"weblang/wl/jscompiler/jsast"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// wl structs are values while javascript objects are shared, so struct
+// values are cloned where wl copies them: when stored by a declaration
+// or assignment, passed to a function, returned, or used as an element
+// of a composite literal. Values that can't be shared aren't cloned:
+// composite literals and results of calls, which are copies already,
+// and arguments for parameters of functions that can't change them,
+// see analyze.
+//
+// Methods share their receiver, so they can update it. Values of range
+// loops are cloned for each iteration, while loop values of template
+// {{for}} blocks are the elements themselves, so bindings in the loop
+// update the elements; passing them to components as props copies them.
+
+// value converts x where its value is stored or passed on, cloning
+// struct values that may be shared
+func (c *jsCompiler) value(x ast.Expr) jsast.Expr {
+	js := c.convertExpr(x)
+	if t := c.structType(x); t != nil && !c.fresh(x) {
+		return c.clone(t, js)
+	}
+	return js
+}
+
+// rangeStmt converts the range loop n to a for...of loop over the key
+// and value pairs listed by the runtime, cloning struct values into the
+// loop variables
+func (c *jsCompiler) rangeStmt(n *ast.RangeStmt) jsast.Stmt {
+	args := []jsast.Expr{unparen(c.convertExpr(n.X))}
+	var elem types.Type
+	switch t := underlying(c.info.Types[n.X].Type).(type) {
+	case *types.Slice:
+		elem = t.Elem()
+	case *types.Map:
+		elem = t.Elem()
+		if b, ok := underlying(t.Key()).(*types.Basic); ok && b.Info()&types.IsInteger != 0 {
+			// object keys are strings
+			args = append(args, &jsast.Identifier{Name: "true"})
+		}
+	}
+	if _, ok := underlying(elem).(*types.Struct); !ok {
+		elem = nil
+	}
+
+	// the pattern binds the loop variables, or temporaries assigned to
+	// the expressions of the loop; $ can't occur in wl names
+	var names []string
+	var body []jsast.Stmt
+	for i, lhs := range []ast.Expr{n.Key, n.Value} {
+		if lhs == nil || isBlank(lhs) {
+			names = append(names, "")
+			continue
+		}
+		name := [...]string{"$k", "$v"}[i]
+		if n.Tok == token.DEFINE {
+			name = c.getJsIdent(lhs.(*ast.Ident))
+		}
+		names = append(names, name)
+		var value jsast.Expr = &jsast.Identifier{Name: name}
+		if i == 1 && elem != nil {
+			value = c.clone(elem, value)
+		} else if n.Tok == token.DEFINE {
+			continue
+		}
+		body = append(body, &jsast.AssignStmt{Lhs: c.convertExpr(lhs), Op: "=", Rhs: value})
+	}
+	body = append(body, c.convertStmt(n.Body).(*jsast.BlockStmt).Body...)
+	return &jsast.ForOfStmt{
+		Lhs:  "[" + strings.TrimSuffix(strings.Join(names, ", "), ", ") + "]",
+		X:    runtimeCall("range", args...),
+		Body: &jsast.BlockStmt{Body: body},
+	}
+}
+
+// structType returns the type of x if it is a struct type
+func (c *jsCompiler) structType(x ast.Expr) types.Type {
+	tv, ok := c.info.Types[x]
+	if !ok {
+		return nil
+	}
+	if _, ok := underlying(tv.Type).(*types.Struct); !ok {
+		return nil
+	}
+	return tv.Type
+}
+
+// fresh reports whether the value of x is a new object nothing else
+// refers to
+func (c *jsCompiler) fresh(x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.ParenExpr:
+		return c.fresh(x.X)
+	case *ast.CompositeLit:
+		return true
+	case *ast.CallExpr:
+		if tv, ok := c.info.Types[x.Fun]; ok && tv.IsType() {
+			// conversions don't copy
+			return len(x.Args) == 1 && c.fresh(x.Args[0])
+		}
+		return true
+	}
+	return false
+}
+
+// clone returns a copy of the struct value x of type t. Structs of
+// classes are copied by the clone function of their class, other
+// structs are plain objects.
+func (c *jsCompiler) clone(t types.Type, x jsast.Expr) jsast.Expr {
+	named, ok := t.(*types.Named)
+	if !ok || !c.compiled(named) {
+		return &jsast.CallExpr{
+			Fun:  &jsast.SelectorExpr{X: &jsast.Identifier{Name: "Object"}, Sel: "assign"},
+			Args: []jsast.Expr{&jsast.ObjectLiteral{}, unparen(x)},
+		}
+	}
+
+	return &jsast.CallExpr{Fun: c.cloneFunc(named), Args: []jsast.Expr{unparen(x)}}
+}
+
+// cloneFunc returns the clone function of the class of t, generating
+// it if t is declared by the package; the clone functions of other
+// packages are exported with their class
+func (c *jsCompiler) cloneFunc(t *types.Named) jsast.Expr {
+	if obj := t.Obj(); obj.Pkg() == c.pkg && !c.clones[obj] {
+		c.clones[obj] = true
+		c.cloneQueue = append(c.cloneQueue, obj)
+	}
+	return &jsast.Identifier{Name: cloneName(c.className(t))}
+}
+
+// exportHelpers generates the type descriptors of the exported types of
+// pkg, and the clone and equality functions of its exported struct
+// types, which importers use to box, copy and compare their values
+func (c *jsCompiler) exportHelpers(pkg *types.Package) {
+	for _, name := range pkg.Scope().Names() {
+		tn, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+		if !ok || !tn.Exported() {
+			continue
+		}
+		named, ok := tn.Type().(*types.Named)
+		if !ok {
+			continue
+		}
+		switch named.Underlying().(type) {
+		case *types.Struct:
+			c.cloneFunc(named)
+			c.equalFunc(named)
+			c.typeDesc(named)
+		case *types.Interface, *types.Enum, *types.Basic, *types.Slice, *types.Map, *types.Signature:
+			c.typeDesc(named)
+		}
+	}
+}
+
+// helperDecls returns the type descriptors, clone and equality
+// functions generated since the last call
+func (c *jsCompiler) helperDecls() []jsast.Decl {
+	// descriptors of structs use their equality function
+	decls := c.typeDecls()
+	decls = append(decls, c.cloneDecls()...)
+	return append(decls, c.equalDecls()...)
+}
+
+// compiled reports whether the named type t is declared by a compiled
+// wl package rather than a builtin one, so its structs are instances
+// of a class
+func (c *jsCompiler) compiled(t *types.Named) bool {
+	pkg := t.Obj().Pkg()
+	return pkg != nil && !importer.IsBuiltin(pkg.Path())
+}
+
+// className returns the reference to the class of the named struct
+// type t, qualified by the import binding for other packages
+func (c *jsCompiler) className(t *types.Named) string {
+	obj := t.Obj()
+	if obj.Pkg() != c.pkg {
+		return c.symbols.imports[obj.Pkg()] + "." + c.symbols.name(obj)
+	}
+	return c.symbols.name(obj)
+}
+
+// cloneName returns the name of the clone function of the class named
+// class; $ can't occur in wl names, so it can't collide with them
+func cloneName(class string) string {
+	return class + "$clone"
+}
+
+// cloneDecls returns the clone functions of the struct types of the
+// package cloned since the last call
+func (c *jsCompiler) cloneDecls() []jsast.Decl {
+	var decls []jsast.Decl
+	for len(c.cloneQueue) > 0 {
+		obj := c.cloneQueue[0]
+		c.cloneQueue = c.cloneQueue[1:]
+		decls = append(decls, c.cloneDecl(obj))
+	}
+	return decls
+}
+
+// cloneDecl returns the clone function of the struct type obj, which
+// copies each field into a new instance, cloning struct fields too
+func (c *jsCompiler) cloneDecl(obj *types.TypeName) jsast.Decl {
+	// the parameters can't collide with the class names
+	const src, dst = "$v", "$c"
+	class := c.symbols.name(obj)
+	fun := jsast.FunctionLiteral{Params: []string{src}}
+	name := cloneName(class)
+	fun.Name = &name
+
+	fun.Body = append(fun.Body, &jsast.DeclStmt{Decl: &jsast.VarDecl{
+		Kind:  "let",
+		Name:  dst,
+		Value: &jsast.ClassInstantiate{ClassName: class},
+	}})
+	st := obj.Type().Underlying().(*types.Struct)
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		var value jsast.Expr = &jsast.SelectorExpr{X: &jsast.Identifier{Name: src}, Sel: c.symbols.name(f)}
+		if _, ok := f.Type().Underlying().(*types.Struct); ok {
+			value = c.clone(f.Type(), value)
+		}
+		fun.Body = append(fun.Body, &jsast.AssignStmt{
+			Lhs: &jsast.SelectorExpr{X: &jsast.Identifier{Name: dst}, Sel: c.symbols.name(f)},
+			Op:  "=",
+			Rhs: value,
+		})
+	}
+	fun.Body = append(fun.Body, &jsast.ReturnStmt{Result: &jsast.Identifier{Name: dst}})
+	return &jsast.FuncDecl{IsExported: c.exports && obj.Exported(), Func: fun}
+}
+
+// args converts the arguments of call like assignments to the
+// parameters, except that struct values aren't cloned for parameters
+// of analyzed functions that never modify them
+func (c *jsCompiler) args(call *ast.CallExpr) []jsast.Expr {
+	var params *types.Tuple
+	fn := c.callee(call)
+	if fn != nil && c.analyzed[fn] {
+		params = fn.Type().(*types.Signature).Params()
+	}
+	if len(call.Args) == 1 && isTuple(c.info.Types[call.Args[0]].Type) {
+		// the results of the call passed on
+		return []jsast.Expr{&jsast.UnaryExpression{Op: "...", Exp: c.convertExpr(call.Args[0])}}
+	}
+	sig, _ := underlying(c.info.Types[call.Fun].Type).(*types.Signature)
+	var args []jsast.Expr
+	for i, a := range call.Args {
+		to := paramType(sig, i, call.Ellipsis.IsValid())
+		if params != nil && i < params.Len() && !c.modified[params.At(i)] && !isInterface(to) {
+			args = append(args, c.convertExpr(a))
+			continue
+		}
+		args = append(args, c.assign(a, to))
+	}
+	return args
+}
+
+// paramType returns the type of the parameter of sig argument i is
+// passed as, or nil if unknown. The arguments of a variadic parameter
+// are its elements, unless the call spreads a slice into it.
+func paramType(sig *types.Signature, i int, spread bool) types.Type {
+	if sig == nil {
+		return nil
+	}
+	n := sig.Params().Len()
+	if sig.Variadic() && i >= n-1 {
+		t := sig.Params().At(n - 1).Type()
+		if spread {
+			return t
+		}
+		if s, ok := underlying(t).(*types.Slice); ok {
+			return s.Elem()
+		}
+		return nil
+	}
+	if i < n {
+		return sig.Params().At(i).Type()
+	}
+	return nil
+}
+
+// callee returns the function or method call calls, or nil if it calls
+// a function value
+func (c *jsCompiler) callee(call *ast.CallExpr) *types.Func {
+	var ident *ast.Ident
+	switch fun := ast.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		ident = fun
+	case *ast.SelectorExpr:
+		ident = fun.Sel
+	default:
+		return nil
+	}
+	fn, _ := c.info.Uses[ident].(*types.Func)
+	return fn
+}
+
+// analyze finds the functions declared in files whose struct
+// parameters needn't be cloned unless the function modifies them:
+// assigns to a field of them, or calls a method on them, as methods may
+// modify their receiver. The value of an argument may only change while
+// the function runs if it changes it, so the functions analyzed make no
+// calls, create no closures and only assign to their own variables and
+// the fields of their struct variables, which are copies.
+func (c *jsCompiler) analyze(files []*ast.File) {
+	for _, f := range files {
+		for _, d := range f.Decls {
+			fd, ok := d.(*ast.FuncDecl)
+			if !ok || fd.Body == nil {
+				continue
+			}
+			fn, ok := c.info.Defs[fd.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+			local := true
+			ast.Inspect(fd.Body, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.AssignStmt:
+					for _, lhs := range n.Lhs {
+						local = local && c.localTarget(lhs, fn)
+						if sel, ok := ast.Unparen(lhs).(*ast.SelectorExpr); ok {
+							c.modifies(sel.X)
+						}
+					}
+				case *ast.IncDecStmt:
+					local = local && c.localTarget(n.X, fn)
+					if sel, ok := ast.Unparen(n.X).(*ast.SelectorExpr); ok {
+						c.modifies(sel.X)
+					}
+				case *ast.RangeStmt:
+					if n.Tok == token.ASSIGN {
+						local = local && (n.Key == nil || c.localTarget(n.Key, fn)) && (n.Value == nil || c.localTarget(n.Value, fn))
+					}
+				case *ast.CallExpr:
+					if tv, ok := c.info.Types[n.Fun]; !ok || !tv.IsType() {
+						local = false
+					}
+				case *ast.FuncLit:
+					local = false
+				}
+				return local
+			})
+			c.analyzed[fn] = local
+		}
+	}
+}
+
+// localTarget reports whether assigning to x only changes variables of
+// the function fn: x is one of its variables, or a field of one of its
+// struct variables other than the receiver, which hold copies
+func (c *jsCompiler) localTarget(x ast.Expr, fn *types.Func) bool {
+	field := false
+	for {
+		switch e := ast.Unparen(x).(type) {
+		case *ast.Ident:
+			if e.Name == "_" {
+				return true
+			}
+			v, ok := c.info.ObjectOf(e).(*types.Var)
+			if !ok || field && v == fn.Type().(*types.Signature).Recv() {
+				return false
+			}
+			return fn.Scope() != nil && fn.Scope().Contains(v.Pos())
+		case *ast.SelectorExpr:
+			if f, ok := c.info.Uses[e.Sel].(*types.Var); !ok || !f.IsField() {
+				return false
+			}
+			if _, ok := underlying(c.info.Types[e.X].Type).(*types.Struct); !ok {
+				return false
+			}
+			field = true
+			x = e.X
+		default:
+			return false
+		}
+	}
+}
+
+// modifies records that the variable x selects fields of is modified
+func (c *jsCompiler) modifies(x ast.Expr) {
+	for {
+		switch e := ast.Unparen(x).(type) {
+		case *ast.SelectorExpr:
+			if v, ok := c.info.Uses[e.Sel].(*types.Var); !ok || !v.IsField() {
+				return
+			}
+			x = e.X
+		case *ast.Ident:
+			if v, ok := c.info.Uses[e].(*types.Var); ok {
+				c.modified[v] = true
+			}
+			return
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package jscompiler
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"weblang/wl/ast"
+	"weblang/wl/page"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// Report lists what dead code elimination kept in a page, with the
+// reason each declaration was reached, and what it dropped
+type Report struct {
+	Kept    []Kept
+	Dropped []string // declarations and runtime helpers left out
+}
+
+// Kept is a declaration or runtime helper kept in a page
+type Kept struct {
+	Name   string // e.g. "func add", "method counter.inc" or "runtime url"
+	Reason string // the entry point or declaration that reached it
+}
+
+// WriteTo writes the report as one line per kept and dropped name
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	for _, k := range r.Kept {
+		fmt.Fprintf(&b, "kept %s: %s\n", k.Name, k.Reason)
+	}
+	for _, name := range r.Dropped {
+		fmt.Fprintf(&b, "dropped %s\n", name)
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// liveness is the set of package level declarations reachable from the
+// entry points of a page: the expressions and event handlers of its
+// templates, the variables the runtime assigns, and the initializers of
+// package variables that call functions. Declarations reach the objects
+// their bodies use, methods also reach the methods of live types
+// implementing the interface methods used.
+type liveness struct {
+	fset *token.FileSet
+	info *types.Info
+
+	decls   map[types.Object]ast.Node // declaration of each package level object
+	order   []types.Object            // package level objects in source order
+	methods map[string][]*types.Func  // methods declared by the package by name
+	ifaces  map[string]bool           // names of the interface methods used
+	live    map[types.Object]string   // reason each reached object is kept
+	pkgs    map[*types.Package]string // reason each used import is kept
+	queue   []types.Object            // reached objects whose uses aren't followed yet
+}
+
+// reach computes the declarations of the package files the page with
+// template tmpl, checked as pinfo, reaches
+func reach(fset *token.FileSet, info *types.Info, files []*ast.File, tmpl *page.Template, pinfo *page.Info) *liveness {
+	l := &liveness{
+		fset:    fset,
+		info:    info,
+		decls:   make(map[types.Object]ast.Node),
+		methods: make(map[string][]*types.Func),
+		ifaces:  make(map[string]bool),
+		live:    make(map[types.Object]string),
+		pkgs:    make(map[*types.Package]string),
+	}
+	var inits []types.Object
+	for _, f := range files {
+		for _, d := range f.Decls {
+			switch d := d.(type) {
+			case *ast.FuncDecl:
+				obj := info.Defs[d.Name]
+				l.declare(obj, d)
+				if fn, ok := obj.(*types.Func); ok && d.Recv != nil {
+					l.methods[fn.Name()] = append(l.methods[fn.Name()], fn)
+				}
+			case *ast.GenDecl:
+				for _, s := range d.Specs {
+					switch s := s.(type) {
+					case *ast.ValueSpec:
+						for _, name := range s.Names {
+							l.declare(info.Defs[name], s)
+							if d.Tok == token.VAR && hasCall(s.Values) {
+								inits = append(inits, info.Defs[name])
+							}
+						}
+					case *ast.TypeSpec:
+						l.declare(info.Defs[s.Name], s)
+					}
+				}
+			}
+		}
+	}
+
+	for _, obj := range inits {
+		l.use(obj, "package init")
+	}
+	l.template(tmpl.Nodes, pinfo)
+	comps := make([]*page.Component, 0, len(pinfo.Components))
+	for comp := range pinfo.Components {
+		comps = append(comps, comp)
+	}
+	sort.Slice(comps, func(i, j int) bool { return comps[i].Name < comps[j].Name })
+	for _, comp := range comps {
+		if props := pinfo.Components[comp].Props; props != nil {
+			l.use(props.Obj(), "component <"+comp.Name+">")
+		}
+		l.template(comp.Template.Nodes, pinfo)
+	}
+	for _, r := range pinfo.Routes {
+		l.use(r.Var, "route "+r.Pattern)
+		for _, s := range r.Segments {
+			if s.Param != nil {
+				l.use(s.Param, "route "+r.Pattern)
+			}
+		}
+	}
+
+	for len(l.queue) > 0 {
+		obj := l.queue[0]
+		l.queue = l.queue[1:]
+		l.follow(obj)
+	}
+	return l
+}
+
+func (l *liveness) declare(obj types.Object, node ast.Node) {
+	if obj == nil {
+		return
+	}
+	l.decls[obj] = node
+	l.order = append(l.order, obj)
+}
+
+// template uses the objects the expressions of nodes refer to, and the
+// variables bound to their elements
+func (l *liveness) template(nodes []page.Node, pinfo *page.Info) {
+	page.Inspect(nodes, func(n page.Node) bool {
+		at := l.fset.Position(n.Pos()).String()
+		switch n := n.(type) {
+		case *page.Action:
+			l.expr(n.X, "template binding at "+at)
+		case *page.IfBlock:
+			l.expr(n.Cond, "template binding at "+at)
+		case *page.ForBlock:
+			l.expr(n.X, "template binding at "+at)
+		case *page.EventAttr:
+			l.expr(n.Handler, "event handler at "+at)
+		case *page.Element:
+			if ref := pinfo.Refs[n]; ref != nil {
+				l.use(ref.Var, "element reference at "+at)
+			}
+		}
+		return true
+	})
+}
+
+// expr uses the objects x refers to
+func (l *liveness) expr(x ast.Node, reason string) {
+	ast.Inspect(x, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if obj := l.info.Uses[id]; obj != nil {
+				l.use(obj, reason)
+			}
+		}
+		return true
+	})
+}
+
+// use marks obj as reached for reason, if it is a package level
+// declaration or a package name. Using an interface method reaches the
+// methods of the same name of the live types.
+func (l *liveness) use(obj types.Object, reason string) {
+	if pkgName, ok := obj.(*types.PkgName); ok {
+		if _, ok := l.pkgs[pkgName.Imported()]; !ok {
+			l.pkgs[pkgName.Imported()] = reason
+		}
+		return
+	}
+	if fn, ok := obj.(*types.Func); ok && isInterfaceMethod(fn) {
+		if !l.ifaces[fn.Name()] {
+			l.ifaces[fn.Name()] = true
+			for _, m := range l.methods[fn.Name()] {
+				if _, ok := l.live[recvTypeName(m)]; ok {
+					l.use(m, "implements interface method "+fn.Name())
+				}
+			}
+		}
+		return
+	}
+	if _, ok := l.decls[obj]; !ok {
+		return
+	}
+	if _, ok := l.live[obj]; ok {
+		return
+	}
+	l.live[obj] = reason
+	l.queue = append(l.queue, obj)
+}
+
+// follow uses the objects the declaration of the live object obj
+// refers to
+func (l *liveness) follow(obj types.Object) {
+	node := l.decls[obj]
+	by := "used by " + declName(obj)
+	l.expr(node, by)
+	if spec, ok := node.(*ast.ValueSpec); ok {
+		// the names of a spec are declared together
+		for _, name := range spec.Names {
+			l.use(l.info.Defs[name], "declared with "+declName(obj))
+		}
+	}
+	if tn, ok := obj.(*types.TypeName); ok {
+		if named, ok := tn.Type().(*types.Named); ok {
+			for i := 0; i < named.NumMethods(); i++ {
+				if m := named.Method(i); l.ifaces[m.Name()] {
+					l.use(m, "implements interface method "+m.Name())
+				}
+			}
+		}
+	}
+}
+
+// keeps reports whether the declaration of obj is live; everything is
+// when there is no liveness
+func (l *liveness) keeps(obj types.Object) bool {
+	if l == nil {
+		return true
+	}
+	_, ok := l.live[obj]
+	return ok
+}
+
+// keepsPackage reports whether the runtime part of the imported package
+// pkg is used
+func (l *liveness) keepsPackage(pkg *types.Package) bool {
+	if l == nil {
+		return true
+	}
+	_, ok := l.pkgs[pkg]
+	return ok
+}
+
+// keepsDecl reports whether the top level declaration d is live, and
+// returns it with the dead specs of a GenDecl removed
+func (l *liveness) keepsDecl(d ast.Decl) (ast.Decl, bool) {
+	if l == nil {
+		return d, true
+	}
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		return d, l.keeps(l.info.Defs[d.Name])
+	case *ast.GenDecl:
+		var specs []ast.Spec
+		for _, s := range d.Specs {
+			switch s := s.(type) {
+			case *ast.ValueSpec:
+				if l.keeps(l.info.Defs[s.Names[0]]) {
+					specs = append(specs, s)
+				}
+			case *ast.TypeSpec:
+				if l.keeps(l.info.Defs[s.Name]) {
+					specs = append(specs, s)
+				}
+			default:
+				specs = append(specs, s)
+			}
+		}
+		if len(specs) == 0 {
+			return nil, false
+		}
+		cpy := *d
+		cpy.Specs = specs
+		return &cpy, true
+	}
+	return d, true
+}
+
+// report adds the package level declarations and the runtime parts of
+// the packages in pkgs to r, in source order
+func (l *liveness) report(r *Report, pkgs []*types.Package) {
+	for _, pkg := range pkgs {
+		name := "package " + pkg.Path()
+		if reason, ok := l.pkgs[pkg]; ok {
+			r.Kept = append(r.Kept, Kept{Name: name, Reason: reason})
+		} else {
+			r.Dropped = append(r.Dropped, name)
+		}
+	}
+	for _, obj := range l.order {
+		if obj.Name() == "_" {
+			continue
+		}
+		if reason, ok := l.live[obj]; ok {
+			r.Kept = append(r.Kept, Kept{Name: declName(obj), Reason: reason})
+		} else {
+			r.Dropped = append(r.Dropped, declName(obj))
+		}
+	}
+}
+
+// declName describes the package level object obj
+func declName(obj types.Object) string {
+	switch obj := obj.(type) {
+	case *types.Func:
+		if recv := obj.Type().(*types.Signature).Recv(); recv != nil {
+			return "method " + recvTypeName(obj).Name() + "." + obj.Name()
+		}
+		return "func " + obj.Name()
+	case *types.TypeName:
+		return "type " + obj.Name()
+	case *types.Const:
+		return "const " + obj.Name()
+	}
+	return "var " + obj.Name()
+}
+
+// recvTypeName returns the type name of the receiver of the method m
+func recvTypeName(m *types.Func) types.Object {
+	if named, ok := m.Type().(*types.Signature).Recv().Type().(*types.Named); ok {
+		return named.Obj()
+	}
+	return nil
+}
+
+func isInterfaceMethod(fn *types.Func) bool {
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return false
+	}
+	_, ok := recv.Type().Underlying().(*types.Interface)
+	return ok
+}
+
+// hasCall reports whether any of exprs calls a function, so evaluating
+// it may have effects
+func hasCall(exprs []ast.Expr) bool {
+	found := false
+	for _, x := range exprs {
+		ast.Inspect(x, func(n ast.Node) bool {
+			if _, ok := n.(*ast.CallExpr); ok {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// runtimeUses matches the runtime helpers a script refers to
+var runtimeUses = regexp.MustCompile(`\bwl\.([A-Za-z_]\w*)`)
+
+// usedHelpers returns the names of the runtime exports script refers to
+func usedHelpers(script string) map[string]bool {
+	used := make(map[string]bool)
+	for _, m := range runtimeUses.FindAllStringSubmatch(script, -1) {
+		used[m[1]] = true
+	}
+	return used
+}
@@ -0,0 +1,245 @@
+package jscompiler
+
+import (
+	"fmt"
+	"weblang/wl/ast"
+	"weblang/wl/jscompiler/jsast"
+	"weblang/wl/types"
+)
+
+// Functions deferring calls keep them on a frame made by wl.frame. The
+// body runs in a try statement: a panic is recorded on the frame by the
+// catch block, and the finally block runs the deferred calls in last in
+// first out order, throwing the panic again unless a deferred call
+// recovered it. A recovered function returns its named results, or the
+// zero values of its results. The function and arguments of a deferred
+// call are evaluated by the defer statement.
+//
+// panic throws a panic object holding the boxed value and the stack of
+// the functions it unwinds, which source maps resolve to wl code.
+// recover only stops a panic when called directly by a deferred call,
+// like Go's: functions calling recover ask the runtime on entry for the
+// frame of the panic if they were called as a deferred call, and
+// recover takes the value from that frame.
+//
+// A catch statement pushes its handler onto the frame like a deferred
+// call, which recovers the panic and passes its value to the handler if
+// the value implements the interface of its parameter.
+
+// names of the frame, the caught exception, the frame a function may
+// recover the panic of and a function literal in its body; $ can't
+// occur in wl names, so they can't collide with them
+const (
+	frameVar   = "$f"
+	caughtVar  = "$e"
+	recoverVar = "$r"
+	selfFunc   = "$fn"
+)
+
+// suspends reports whether body, not counting the function literals in
+// it, defers calls or catches panics, and calls recover
+func (c *jsCompiler) suspends(body []ast.Stmt) (defers, recovers bool) {
+	for _, s := range body {
+		ast.Inspect(s, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.DeferStmt, *ast.CatchStmt:
+				defers = true
+			case *ast.CallExpr:
+				if c.builtin(n) == "recover" {
+					recovers = true
+				}
+			}
+			return true
+		})
+	}
+	return defers, recovers
+}
+
+// builtin returns the name of the builtin function call calls, or ""
+func (c *jsCompiler) builtin(call *ast.CallExpr) string {
+	ident, ok := ast.Unparen(call.Fun).(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	if b, ok := c.info.Uses[ident].(*types.Builtin); ok {
+		return b.Name()
+	}
+	return ""
+}
+
+// builtinCall converts calls of builtins, returning nil for calls of
+// other functions. Slices are arrays, which append copies; new returns
+// the zero value of its type, as there are no pointers.
+func (c *jsCompiler) builtinCall(call *ast.CallExpr) jsast.Expr {
+	switch name := c.builtin(call); name {
+	case "":
+		return nil
+	case "panic", "print", "println":
+		return runtimeCall(name, c.args(call)...)
+	case "recover":
+		return runtimeCall("recover", &jsast.Identifier{Name: recoverVar})
+	case "append":
+		// the elements of the new array are copied values, like those
+		// of the array Go allocates when the slice is full
+		elem := underlying(c.info.Types[call].Type).(*types.Slice).Elem()
+		var copy jsast.Expr = &jsast.Identifier{Name: "null"}
+		_, structs := underlying(elem).(*types.Struct)
+		if structs {
+			const v = "$v"
+			copy = &jsast.FunctionLiteral{Params: []string{v}, Body: []jsast.Stmt{
+				&jsast.ReturnStmt{Result: c.clone(elem, &jsast.Identifier{Name: v})},
+			}}
+		}
+		x := c.convertExpr(call.Args[0])
+		if call.Ellipsis.IsValid() {
+			return runtimeCall("append", copy, x, c.convertExpr(call.Args[1]))
+		}
+		var elts []jsast.Expr
+		for _, a := range call.Args[1:] {
+			if structs {
+				elts = append(elts, c.convertExpr(a))
+			} else {
+				elts = append(elts, c.assign(a, elem))
+			}
+		}
+		return runtimeCall("append", copy, x, &jsast.ArrayLiteral{Elts: elts})
+	case "make":
+		t := c.info.Types[call.Args[0]].Type
+		s, ok := underlying(t).(*types.Slice)
+		if !ok {
+			return c.zeroValue(t)
+		}
+		// each element gets a zero value of its own
+		zero := &jsast.FunctionLiteral{Body: []jsast.Stmt{&jsast.ReturnStmt{Result: c.zeroValue(s.Elem())}}}
+		args := []jsast.Expr{zero}
+		for _, a := range call.Args[1:] {
+			args = append(args, c.convertExpr(a))
+		}
+		return runtimeCall("make", args...)
+	case "new":
+		return c.zeroValue(c.info.Types[call.Args[0]].Type)
+	default:
+		panic(fmt.Sprintf("unsupported builtin: %s", name))
+	}
+}
+
+// frame wraps the converted body of a function declared with body in
+// the frame running its deferred calls, and starts it by asking for the
+// frame of the panic it may recover. self refers to the function.
+func (c *jsCompiler) frame(fun []jsast.Stmt, body []ast.Stmt, self jsast.Expr) []jsast.Stmt {
+	defers, recovers := c.suspends(body)
+	if defers {
+		var unwind jsast.Expr = runtimeCall("unwind", &jsast.Identifier{Name: frameVar})
+		if c.awaits {
+			// deferred calls may be async
+			unwind = &jsast.UnaryExpression{Op: "await ", Exp: runtimeCall("unwindAsync", &jsast.Identifier{Name: frameVar})}
+		}
+		finally := []jsast.Stmt{&jsast.ExprStmt{Exp: unwind}}
+		if names := c.resultVars(); names != nil {
+			// the deferred calls may change the named results
+			finally = append(finally, &jsast.ReturnStmt{Result: namedResults(names)})
+		}
+		try := &jsast.TryStmt{
+			Body:  &jsast.BlockStmt{Body: fun},
+			Param: caughtVar,
+			Catch: &jsast.BlockStmt{Body: []jsast.Stmt{&jsast.ExprStmt{Exp: runtimeCall("panicked",
+				&jsast.Identifier{Name: frameVar},
+				&jsast.Identifier{Name: caughtVar},
+			)}}},
+			Finally: &jsast.BlockStmt{Body: finally},
+		}
+		fun = []jsast.Stmt{
+			&jsast.DeclStmt{Decl: &jsast.VarDecl{Kind: "let", Name: frameVar, Value: runtimeCall("frame")}},
+			try,
+		}
+		if c.results != nil && c.results.Len() > 0 && c.resultVars() == nil {
+			// reached when a deferred call recovers a panic
+			var zeros []jsast.Expr
+			for i := 0; i < c.results.Len(); i++ {
+				zeros = append(zeros, c.zeroValue(c.results.At(i).Type()))
+			}
+			fun = append(fun, &jsast.ReturnStmt{Result: resultsExpr(zeros)})
+		}
+	}
+	if recovers {
+		r := &jsast.DeclStmt{Decl: &jsast.VarDecl{Kind: "let", Name: recoverVar, Value: runtimeCall("recoverable", self)}}
+		fun = append([]jsast.Stmt{r}, fun...)
+	}
+	return fun
+}
+
+// deferStmt pushes the deferred call onto the frame, with its receiver
+// and arguments evaluated. The arguments are copied like assignments
+// to the parameters, as the function may modify them before the call.
+func (c *jsCompiler) deferStmt(n *ast.DeferStmt) jsast.Stmt {
+	call := n.Call
+	var recv jsast.Expr = &jsast.Identifier{Name: "null"}
+	var fn jsast.Expr
+	sig, _ := underlying(c.info.Types[call.Fun].Type).(*types.Signature)
+	var args []jsast.Expr
+	for i, a := range call.Args {
+		args = append(args, c.assign(a, paramType(sig, i, call.Ellipsis.IsValid())))
+	}
+	switch name := c.builtin(call); name {
+	case "":
+		fn = c.convertExpr(call.Fun)
+		if sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr); ok {
+			if m, ok := c.info.Uses[sel.Sel].(*types.Func); ok && m.Type().(*types.Signature).Recv() != nil {
+				// the method is looked up on the receiver now
+				x := unparen(fn).(*jsast.SelectorExpr)
+				recv, fn = x.X, stringLit(x.Sel)
+			}
+		}
+	case "panic", "recover", "print", "println":
+		fn = &jsast.SelectorExpr{X: &jsast.Identifier{Name: "wl"}, Sel: name}
+		if name == "recover" {
+			// not called by the deferred call, so it recovers nothing
+			args = []jsast.Expr{&jsast.Identifier{Name: "null"}}
+		}
+	default:
+		panic(fmt.Sprintf("unsupported deferred builtin: %s", name))
+	}
+
+	return &jsast.ExprStmt{Exp: runtimeCall("defer",
+		&jsast.Identifier{Name: frameVar},
+		recv,
+		fn,
+		&jsast.ArrayLiteral{Elts: args},
+	)}
+}
+
+// catchStmt pushes the handler of the catch statement onto the frame,
+// with a test of the panic values it handles
+func (c *jsCompiler) catchStmt(n *ast.CatchStmt) jsast.Stmt {
+	const v = "$v"
+	sig := underlying(c.info.Types[n.Fun].Type).(*types.Signature)
+	test := &jsast.FunctionLiteral{Params: []string{v}, Body: []jsast.Stmt{
+		&jsast.ReturnStmt{Result: runtimeCall("is", &jsast.Identifier{Name: v}, c.typeDesc(sig.Params().At(0).Type()))},
+	}}
+	return &jsast.ExprStmt{Exp: runtimeCall("catcher",
+		&jsast.Identifier{Name: frameVar},
+		c.convertExpr(n.Fun),
+		test,
+	)}
+}
+
+// funcLit converts a function literal into a function expression, named
+// for itself if it calls recover
+func (c *jsCompiler) funcLit(n *ast.FuncLit) jsast.Expr {
+	outer, awaits := c.results, c.awaits
+	defer func() { c.results, c.awaits = outer, awaits }()
+	c.results = nil
+	c.awaits = c.async[n]
+	if sig, ok := c.info.Types[n].Type.(*types.Signature); ok {
+		c.results = sig.Results()
+	}
+
+	fun := c.convertFunc(nil, n.Type, n.Body.List, &jsast.Identifier{Name: selfFunc})
+	if _, recovers := c.suspends(n.Body.List); recovers {
+		name := selfFunc
+		fun.Name = &name
+	}
+	return &fun
+}
@@ -3,5 +3,11 @@
 Package jscompiler takes wl AST as input, transpiles it into a javascript AST
 and then outputs Javascript.
 
+Struct types compile to classes, and their methods to the methods of the
+classes. Other named types, such as type celsius float, are represented
+by the javascript value of their underlying type, which has no methods of
+the package: declaring methods on them is not supported, and compiling a
+package that does fails with an error at the method.
+
 */
 package jscompiler
@@ -0,0 +1,136 @@
+package jscompiler
+
+import (
+	"fmt"
+	"strings"
+	"weblang/wl/ast"
+	"weblang/wl/jscompiler/jsast"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// wl compares structs by their fields while === compares javascript
+// objects by identity, so == and != on structs call an equality
+// function generated for the struct type, which compares the fields in
+// order. The type checker only accepts comparisons of comparable
+// types, so every field can be compared. Other comparable values are
+// compared with ===: basic values, and enum members, which are the
+// frozen objects of their enum.
+
+// equalFunc is the equality function generated for a struct type
+type equalFunc struct {
+	typ  types.Type
+	name string
+}
+
+// equality converts the comparison n of two structs or of interface
+// values, or returns nil if n isn't one. Interface values are equal if
+// they are both nil, or hold values of the same type that are equal.
+func (c *jsCompiler) equality(n *ast.BinaryExpr) jsast.Expr {
+	if n.Op != token.EQL && n.Op != token.NEQ {
+		return nil
+	}
+	var eq jsast.Expr
+	tx, ty := c.info.Types[n.X], c.info.Types[n.Y]
+	switch {
+	case tx.IsNil() || ty.IsNil():
+		// nil is null
+		return nil
+	case isInterface(tx.Type) || isInterface(ty.Type):
+		eq = runtimeCall("same", c.box(n.X, c.convertExpr(n.X)), c.box(n.Y, c.convertExpr(n.Y)))
+	case c.structType(n.X) != nil:
+		eq = c.equal(tx.Type, c.convertExpr(n.X), c.convertExpr(n.Y))
+	default:
+		return nil
+	}
+	if n.Op == token.NEQ {
+		return &jsast.UnaryExpression{Op: "!", Exp: eq}
+	}
+	return eq
+}
+
+// equal returns the comparison of the values x and y of type t
+func (c *jsCompiler) equal(t types.Type, x, y jsast.Expr) jsast.Expr {
+	if _, ok := underlying(t).(*types.Struct); ok {
+		return &jsast.CallExpr{Fun: c.equalFunc(t), Args: []jsast.Expr{unparen(x), unparen(y)}}
+	}
+	return &jsast.BinaryExpression{Lhs: x, Op: "===", Rhs: y}
+}
+
+// equalFunc returns the equality function of the struct type t. Named
+// types of wl packages have one next to their class, exported with it;
+// other structs have one numbered by the package.
+func (c *jsCompiler) equalFunc(t types.Type) jsast.Expr {
+	if named, ok := t.(*types.Named); ok && c.compiled(named) && named.Obj().Pkg() != c.pkg {
+		return &jsast.Identifier{Name: equalName(c.className(named))}
+	}
+	for _, fn := range c.equals {
+		if types.Identical(fn.typ, t) {
+			return &jsast.Identifier{Name: fn.name}
+		}
+	}
+	fn := equalFunc{typ: t}
+	if named, ok := t.(*types.Named); ok && c.compiled(named) {
+		fn.name = equalName(c.className(named))
+	} else {
+		// $ can't occur in wl names, so these can't collide with them
+		n := 0
+		for _, fn := range c.equals {
+			if strings.HasPrefix(fn.name, "$") {
+				n++
+			}
+		}
+		fn.name = fmt.Sprintf("$equal%d", n)
+	}
+	c.equals = append(c.equals, fn)
+	c.equalQueue = append(c.equalQueue, fn)
+	return &jsast.Identifier{Name: fn.name}
+}
+
+// equalName returns the name of the equality function of the class
+// named class
+func equalName(class string) string {
+	return class + "$equal"
+}
+
+// equalDecls returns the equality functions used since the last call
+func (c *jsCompiler) equalDecls() []jsast.Decl {
+	var decls []jsast.Decl
+	for len(c.equalQueue) > 0 {
+		fn := c.equalQueue[0]
+		c.equalQueue = c.equalQueue[1:]
+		decls = append(decls, c.equalDecl(fn))
+	}
+	return decls
+}
+
+// equalDecl returns the equality function fn, which compares the
+// fields of its arguments in order
+func (c *jsCompiler) equalDecl(fn equalFunc) jsast.Decl {
+	const x, y = "$a", "$b"
+	fun := jsast.FunctionLiteral{Name: &fn.name, Params: []string{x, y}}
+
+	var eq jsast.Expr
+	st := underlying(fn.typ).(*types.Struct)
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		field := c.equal(f.Type(),
+			&jsast.SelectorExpr{X: &jsast.Identifier{Name: x}, Sel: c.symbols.name(f)},
+			&jsast.SelectorExpr{X: &jsast.Identifier{Name: y}, Sel: c.symbols.name(f)})
+		if eq == nil {
+			eq = field
+		} else {
+			eq = &jsast.BinaryExpression{Lhs: eq, Op: "&&", Rhs: field}
+		}
+	}
+	if eq == nil {
+		eq = &jsast.Identifier{Name: "true"}
+	}
+	fun.Body = []jsast.Stmt{&jsast.ReturnStmt{Result: eq}}
+
+	exported := false
+	if named, ok := fn.typ.(*types.Named); ok {
+		exported = c.exports && named.Obj().Exported()
+	}
+	return &jsast.FuncDecl{IsExported: exported, Func: fun}
+}
@@ -0,0 +1,89 @@
+package jscompiler
+
+import (
+	"weblang/wl/flow"
+	"weblang/wl/jscompiler/jsast"
+	"weblang/wl/types"
+)
+
+// CompileFlow returns the declaration of the runtime object of a checked
+// flow. The object is named after the flow, so the selectors of pages
+// using the flow package refer to its state and events.
+func CompileFlow(finfo *flow.Info) jsast.Decl {
+	return compileFlow(finfo, SafeInts)
+}
+
+// compileFlow is CompileFlow with the ints of the state represented as
+// the model ints says
+func compileFlow(finfo *flow.Info, ints IntModel) jsast.Decl {
+	f := finfo.Flow
+
+	// state variables are named like the selectors of pages refer to
+	// them, as exported names of the flow package
+	names := newSymbolMap()
+	state := &jsast.ObjectLiteral{}
+	for _, fld := range f.State {
+		v := finfo.State[fld]
+		if v == nil {
+			continue
+		}
+		state.Props = append(state.Props, &jsast.Property{Key: names.name(v), Value: flowZero(v.Type(), ints)})
+	}
+
+	events := &jsast.ArrayLiteral{}
+	for _, ev := range finfo.Events {
+		events.Elts = append(events.Elts, stringLit(ev))
+	}
+
+	steps := &jsast.ObjectLiteral{}
+	for _, s := range f.Steps {
+		on := &jsast.ObjectLiteral{}
+		for _, t := range s.Transitions {
+			on.Props = append(on.Props, &jsast.Property{Key: t.Event.Name, Value: stringLit(t.Target.Name)})
+		}
+		steps.Props = append(steps.Props, &jsast.Property{
+			Key: s.Name.Name,
+			Value: &jsast.ObjectLiteral{Props: []*jsast.Property{
+				{Key: "page", Value: stringLit(PageURL(s.PageName()))},
+				{Key: "on", Value: on},
+			}},
+		})
+	}
+
+	def := &jsast.ObjectLiteral{Props: []*jsast.Property{
+		{Key: "name", Value: stringLit(f.Name.Name)},
+		{Key: "start", Value: stringLit(f.Start.Name)},
+		{Key: "state", Value: state},
+		{Key: "events", Value: events},
+		{Key: "steps", Value: steps},
+	}}
+	return &jsast.VarDecl{Kind: "const", Name: f.Name.Name, Value: runtimeCall("flow", def)}
+}
+
+// PageURL returns the site relative URL of the html file a page is
+// compiled to. Flows find their current step by matching it against the
+// whole path of the page shown.
+func PageURL(page string) string {
+	return "/" + page + ".html"
+}
+
+// flowZero returns the zero value of the type of a state field, which
+// flow.Check only accepts to be a basic type or a slice
+func flowZero(t types.Type, ints IntModel) jsast.Expr {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			return &jsast.Identifier{Name: "false"}
+		case u.Info()&types.IsInteger != 0 && ints == BigInts:
+			return &jsast.BasicLiteral{Value: "0n"}
+		case u.Info()&types.IsNumeric != 0:
+			return &jsast.BasicLiteral{Value: "0"}
+		case u.Info()&types.IsString != 0:
+			return stringLit("")
+		}
+	case *types.Slice:
+		return &jsast.ArrayLiteral{}
+	}
+	return &jsast.Identifier{Name: "null"}
+}
@@ -1,5 +1,10 @@
 package jsast
 
+import (
+	"reflect"
+	"weblang/wl/token"
+)
+
 // simplified Javascript AST
 // general structure, but a lot more strings than a typical AST
 // since this structure really only exists to be printed
@@ -11,12 +16,41 @@ type Module struct {
 }
 
 type Import struct {
-	Alias string
-	File  string
+	Alias   string
+	File    string
+	Default bool // binds the default export rather than the module namespace
 }
 
 type Node interface {
 	node()
+	source() *Source
+}
+
+// Source is embedded in every node to record the position of the wl code
+// it was compiled from, which the printer writes to source maps
+type Source struct {
+	Pos token.Pos
+}
+
+func (s *Source) source() *Source { return s }
+
+// SetPos sets the source position of n unless it already has one, so the
+// innermost conversion that knows a position wins
+func SetPos(n Node, pos token.Pos) {
+	if n == nil || reflect.ValueOf(n).IsNil() {
+		return
+	}
+	if s := n.source(); s.Pos == token.NoPos {
+		s.Pos = pos
+	}
+}
+
+// PosOf returns the source position of n, or token.NoPos
+func PosOf(n Node) token.Pos {
+	if n == nil || reflect.ValueOf(n).IsNil() {
+		return token.NoPos
+	}
+	return n.source().Pos
 }
 
 type Expr interface {
@@ -37,45 +71,95 @@ type Decl interface {
 // Expressions
 type (
 	Identifier struct {
+		Source
 		Name string
+		Orig string // the wl name, if the identifier was compiled from one
 	}
 
 	BasicLiteral struct {
+		Source
 		Value string
 	}
 
 	BinaryExpression struct {
+		Source
 		Lhs Expr
 		Op  string //string operator
 		Rhs Expr
 	}
 
 	UnaryExpression struct {
+		Source
 		Op  string // operator
 		Exp Expr
 	}
 
 	FunctionLiteral struct {
+		Source
 		Name   *string
 		Params []string //names of input params
 		Body   []Stmt   // body block content
+		Async  bool     // an async function, which may await
 	}
 
 	DeclExpr struct {
+		Source
 		Decl Decl
 	}
 
 	SelectorExpr struct {
+		Source
 		X   Expr
 		Sel string
 	}
 
 	ClassInstantiate struct {
+		Source
 		ClassName  string
 		CtorParams []Expr
 	}
+
+	CallExpr struct {
+		Source
+		Fun  Expr
+		Args []Expr
+	}
+
+	ParenExpr struct {
+		Source
+		X Expr
+	}
+
+	IndexExpr struct {
+		Source
+		X     Expr
+		Index Expr
+	}
+
+	ConditionalExpr struct {
+		Source
+		Cond Expr
+		Then Expr
+		Else Expr
+	}
+
+	ArrayLiteral struct {
+		Source
+		Elts []Expr
+	}
+
+	ObjectLiteral struct {
+		Source
+		Props []*Property
+	}
 )
 
+// Property is a key: value pair in an object literal
+type Property struct {
+	Key   string // printed as-is, so string keys must be quoted
+	Value Expr
+}
+
 func (*Identifier) nodeExpr()       {}
 func (*BasicLiteral) nodeExpr()     {}
 func (*BinaryExpression) nodeExpr() {}
@@ -84,31 +168,60 @@ func (*FunctionLiteral) nodeExpr()  {}
 func (*DeclExpr) nodeExpr()         {}
 func (*SelectorExpr) nodeExpr()     {}
 func (*ClassInstantiate) nodeExpr() {}
+func (*CallExpr) nodeExpr()         {}
+func (*ParenExpr) nodeExpr()        {}
+func (*IndexExpr) nodeExpr()        {}
+func (*ConditionalExpr) nodeExpr()  {}
+func (*ArrayLiteral) nodeExpr()     {}
+func (*ObjectLiteral) nodeExpr()    {}
 
 // Statements
 type (
 	ExprStmt struct {
+		Source
 		Exp Expr
 	}
 	ReturnStmt struct {
+		Source
 		Result Expr
 	}
 	DeclStmt struct {
+		Source
 		Decl Decl
 	}
 	IfStmt struct {
+		Source
 		Cond Expr
 		Body *BlockStmt
 		Else Stmt
 	}
 	BlockStmt struct {
+		Source
 		Body []Stmt
 	}
 	AssignStmt struct {
+		Source
 		Lhs Expr
 		Op  string
 		Rhs Expr
 	}
+	// TryStmt is a try statement, with a catch block binding Param if
+	// Catch isn't nil and a finally block if Finally isn't nil
+	TryStmt struct {
+		Source
+		Body    *BlockStmt
+		Param   string
+		Catch   *BlockStmt
+		Finally *BlockStmt
+	}
+	// ForOfStmt is a for...of loop over X, binding its elements to the
+	// names of the pattern Lhs declared with let
+	ForOfStmt struct {
+		Source
+		Lhs  string
+		X    Expr
+		Body *BlockStmt
+	}
 )
 
 func (*ExprStmt) nodeStmt()   {}
@@ -117,15 +230,19 @@ func (*DeclStmt) nodeStmt()   {}
 func (*IfStmt) nodeStmt()     {}
 func (*BlockStmt) nodeStmt()  {}
 func (*AssignStmt) nodeStmt() {}
+func (*TryStmt) nodeStmt()    {}
+func (*ForOfStmt) nodeStmt()  {}
 
 // Declarations
 type (
 	FuncDecl struct {
+		Source
 		IsExported bool
 		Func       FunctionLiteral
 	}
 
 	ClassDecl struct {
+		Source
 		IsExported bool
 		Name       string
 		Fields     []*VarDecl
@@ -133,26 +250,56 @@ type (
 	}
 
 	VarDecl struct {
+		Source
 		IsExported bool
 		Kind       string // "let", "const"
 		Name       string
 		Value      Expr
 	}
+
+	// enums are frozen objects of {name, value} members
+	EnumDecl struct {
+		Source
+		IsExported bool
+		Name       string
+		Members    []*EnumMember
+	}
+
+	// exports of local names under other names, for exported names
+	// renamed so they don't collide with reserved names
+	ExportDecl struct {
+		Source
+		Specs []ExportSpec
+	}
 )
 
-func (*FuncDecl) nodeDecl()  {}
-func (*ClassDecl) nodeDecl() {}
-func (*VarDecl) nodeDecl()   {}
+type ExportSpec struct {
+	Local string
+	Name  string
+}
+
+type EnumMember struct {
+	Name  string
+	Value Expr
+}
+
+func (*FuncDecl) nodeDecl()   {}
+func (*ClassDecl) nodeDecl()  {}
+func (*VarDecl) nodeDecl()    {}
+func (*EnumDecl) nodeDecl()   {}
+func (*ExportDecl) nodeDecl() {}
 
 /////
 // Special
 //Raw JS as any node
 type RawJs struct {
+	Source
 	RawJs string
 }
 
 // Placeholder node, transparent collection of child nodes
 type Placeholder struct {
+	Source
 	Children []Node
 }
 
@@ -169,6 +316,8 @@ func (*Placeholder) node()      {}
 func (*FuncDecl) node()         {}
 func (*ClassDecl) node()        {}
 func (*VarDecl) node()          {}
+func (*EnumDecl) node()         {}
+func (*ExportDecl) node()       {}
 func (*ExprStmt) node()         {}
 func (*ReturnStmt) node()       {}
 func (*DeclStmt) node()         {}
@@ -181,5 +330,13 @@ func (*UnaryExpression) node()  {}
 func (*FunctionLiteral) node()  {}
 func (*DeclExpr) node()         {}
 func (*AssignStmt) node()       {}
+func (*TryStmt) node()          {}
+func (*ForOfStmt) node()        {}
 func (*SelectorExpr) node()     {}
 func (*ClassInstantiate) node() {}
+func (*CallExpr) node()         {}
+func (*ParenExpr) node()        {}
+func (*IndexExpr) node()        {}
+func (*ConditionalExpr) node()  {}
+func (*ArrayLiteral) node()     {}
+func (*ObjectLiteral) node()    {}
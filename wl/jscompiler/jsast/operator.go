@@ -4,8 +4,10 @@ package jsast
 const (
 	LowestPrec = 0 // non-operators
 
-	UnaryPrec   = 16
-	HighestPrec = 21
+	ConditionalPrec = 4
+	UnaryPrec       = 16
+	CallPrec        = 20 // member access, calls and new with arguments
+	HighestPrec     = 21
 )
 
 // Precedence returns the operator precedence of the binary
@@ -41,3 +43,25 @@ func Precedence(op string) int {
 	}
 	return LowestPrec
 }
+
+// ExprPrecedence returns the precedence of the operator at the root of
+// x, or HighestPrec if x is a primary expression that never needs
+// parentheses.
+func ExprPrecedence(x Expr) int {
+	switch x := x.(type) {
+	case *BinaryExpression:
+		return Precedence(x.Op)
+	case *UnaryExpression:
+		return UnaryPrec
+	case *ConditionalExpr:
+		return ConditionalPrec
+	case *CallExpr, *SelectorExpr, *IndexExpr, *ClassInstantiate:
+		return CallPrec
+	case *BasicLiteral:
+		if len(x.Value) > 0 && x.Value[0] == '-' {
+			// negative constants are negations
+			return UnaryPrec
+		}
+	}
+	return HighestPrec
+}
@@ -2,14 +2,50 @@ package jscompiler
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"weblang/wl/ast"
+	"weblang/wl/constant"
+	"weblang/wl/flow"
+	"weblang/wl/importer"
 	"weblang/wl/jscompiler/jsast"
 	"weblang/wl/token"
 	"weblang/wl/types"
 )
 
 type jsCompiler struct {
+	info    *types.Info
 	symbols *symbolMap
+	minify  bool      // fold constant expressions
+	exports bool      // export the exported package level names
+	live    *liveness // declarations to compile, or nil for all
+	ints    IntModel  // representation of ints
+
+	// fset, if known, positions the errors of the constructs the
+	// compiler doesn't support at pos, the last node converted
+	fset *token.FileSet
+	pos  token.Pos
+
+	// self holds the objects that are members of the component
+	// instance $self while compiling a component template
+	self map[types.Object]bool
+
+	pkg        *types.Package           // package being compiled
+	clones     map[*types.TypeName]bool // struct types with clone functions
+	cloneQueue []*types.TypeName        // clone functions not generated yet
+	analyzed   map[*types.Func]bool     // functions whose unmodified parameters aren't cloned
+	modified   map[*types.Var]bool      // struct parameters functions modify
+	equals     []equalFunc              // generated equality functions
+	equalQueue []equalFunc              // equality functions not generated yet
+	descs      []typeDescFunc           // generated type descriptors
+	descQueue  []typeDescFunc           // type descriptors not generated yet
+	results    *types.Tuple             // results of the function being compiled
+	deferring  bool                     // whether the function being compiled defers calls
+	async      map[ast.Node]bool        // async function declarations and literals
+	asyncFuncs map[*types.Func]bool     // async functions, of the packages compiled before too
+	dynamic    bool                     // calls of function values are async
+	awaits     bool                     // the function being compiled is async
+	renamed    []jsast.ExportSpec       // exported names renamed in the module
 }
 
 func (c *jsCompiler) Compile(pkg *types.Package, files []*ast.File) (*jsast.Module, error) {
@@ -22,32 +58,51 @@ func (c *jsCompiler) Compile(pkg *types.Package, files []*ast.File) (*jsast.Modu
 		if m.Name != f.Name.Name {
 			return nil, fmt.Errorf("all files must be for the same package.  Expected '%v' but got '%v'", m.Name, f.Name.Name)
 		}
-
-		for _, i := range f.Imports {
-			if i.Name != nil {
-				// TODO: make sure all files have the same aliases
-				// for the same imports...
-				// we dont support having both:
-				// 		file A with import a "fmt" and
-				//		file B with import a "testing"
-			}
-		}
 	}
 
-	// setup our imports
+	// setup our imports: the aliases of the files are replaced by one
+	// binding per package, builtin packages are provided by the runtime
+	// rather than by modules and the modules of flows export their flow
+	// object
+	c.symbols.bindImports(pkg)
 	for _, imp := range pkg.Imports() {
+		if importer.IsBuiltin(imp.Path()) {
+			continue
+		}
 		m.Imports = append(m.Imports, jsast.Import{
-			Alias: imp.Name(),
-			File:  imp.Path(),
+			Alias:   c.symbols.imports[imp],
+			File:    moduleSpecifier(pkg.Path(), imp.Path()),
+			Default: strings.HasPrefix(imp.Path(), flow.PackagePrefix),
 		})
 	}
+	m.Decls = c.packageDecls(pkg)
+	c.pkg = pkg
+	c.analyze(files)
+	c.findAsync(files)
 
 	// iterate the files ASTs and compile them one at a time
+	var decls []jsast.Decl
 	for _, f := range files {
 		for _, d := range f.Decls {
-			m.Decls = append(m.Decls, c.convertDecl(d))
+			if gen, ok := d.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+				// imports are handled at the module level
+				continue
+			}
+			if d, ok := c.live.keepsDecl(d); ok {
+				decls = append(decls, c.convertDecl(d))
+			}
 		}
 	}
+	if c.exports {
+		c.exportHelpers(pkg)
+	}
+	// the package code may use type descriptors while initializing
+	m.Decls = append(m.Decls, c.typeDecls()...)
+	m.Decls = append(m.Decls, decls...)
+	m.Decls = append(m.Decls, c.helperDecls()...)
+	if len(c.renamed) > 0 {
+		m.Decls = append(m.Decls, &jsast.ExportDecl{Specs: c.renamed})
+	}
 
 	return m, nil
 }
@@ -65,10 +120,12 @@ func (c *jsCompiler) convertNode(node ast.Node) jsast.Node {
 	panic(fmt.Sprintf("unexpected node type: %T", node))
 }
 
-func (c *jsCompiler) convertDecl(decl ast.Decl) jsast.Decl {
+func (c *jsCompiler) convertDecl(decl ast.Decl) (d jsast.Decl) {
 	if decl == nil {
 		return nil
 	}
+	c.pos = decl.Pos()
+	defer func() { jsast.SetPos(d, decl.Pos()) }()
 
 	switch n := decl.(type) {
 	case *ast.GenDecl:
@@ -80,15 +137,20 @@ func (c *jsCompiler) convertDecl(decl ast.Decl) jsast.Decl {
 		for _, s := range n.Specs {
 			sub = append(sub, c.convertSpec(s, n.Tok))
 		}
-		return &jsast.Placeholder{sub}
+		return &jsast.Placeholder{Children: sub}
 	case *ast.FuncDecl:
+		if fn, ok := c.info.Defs[n.Name].(*types.Func); ok {
+			c.results = fn.Type().(*types.Signature).Results()
+		}
+		c.awaits = c.async[n]
+		defer func() { c.awaits = false }()
 		if n.Recv != nil {
-			panic("method receivers not yet supported")
+			return c.convertMethod(n)
 		}
 
-		//TODO: isExported
 		return &jsast.FuncDecl{
-			Func: c.convertFunc(n.Name, n.Type, n.Body.List),
+			IsExported: c.exported(n.Name),
+			Func:       c.convertFunc(n.Name, n.Type, n.Body.List, &jsast.Identifier{Name: c.getJsIdent(n.Name)}),
 		}
 
 	}
@@ -96,7 +158,41 @@ func (c *jsCompiler) convertDecl(decl ast.Decl) jsast.Decl {
 	panic(fmt.Sprintf("Unknown decl node type: %T", decl))
 }
 
-func (c *jsCompiler) convertFunc(name *ast.Ident, def *ast.FuncType, body []ast.Stmt) jsast.FunctionLiteral {
+// convertMethod converts a method into a function on the prototype of
+// its receiver's class, with the receiver bound to this. Only structs
+// are classes, so methods of other named types aren't supported.
+func (c *jsCompiler) convertMethod(n *ast.FuncDecl) jsast.Decl {
+	recv := n.Recv.List[0]
+	tName, ok := recv.Type.(*ast.Ident)
+	if !ok {
+		panic(fmt.Sprintf("unsupported receiver type: %T", recv.Type))
+	}
+	if _, ok := underlying(c.info.Types[recv.Type].Type).(*types.Struct); !ok {
+		// only structs are instances of classes
+		panic(fmt.Sprintf("unsupported method on non-struct type %s: only struct types can have methods in compiled code", tName.Name))
+	}
+
+	proto := &jsast.SelectorExpr{X: &jsast.Identifier{Name: c.getJsIdent(tName)}, Sel: "prototype"}
+	method := &jsast.SelectorExpr{X: proto, Sel: c.getJsIdent(n.Name)}
+	fun := c.convertFunc(nil, n.Type, n.Body.List, method)
+	if len(recv.Names) > 0 && recv.Names[0].Name != "_" {
+		self := &jsast.DeclStmt{Decl: &jsast.VarDecl{
+			Kind:  "let",
+			Name:  c.getJsIdent(recv.Names[0]),
+			Value: &jsast.Identifier{Name: "this"},
+		}}
+		fun.Body = append([]jsast.Stmt{self}, fun.Body...)
+	}
+
+	return &jsast.Placeholder{Children: []jsast.Node{&jsast.AssignStmt{
+		Lhs: method,
+		Op:  "=",
+		Rhs: &fun,
+	}}}
+}
+
+// convertFunc converts a function, which self refers to in its body
+func (c *jsCompiler) convertFunc(name *ast.Ident, def *ast.FuncType, body []ast.Stmt, self jsast.Expr) jsast.FunctionLiteral {
 	fun := jsast.FunctionLiteral{}
 	// convert the name
 	if name != nil {
@@ -112,27 +208,43 @@ func (c *jsCompiler) convertFunc(name *ast.Ident, def *ast.FuncType, body []ast.
 	}
 
 	// convert the body
+	deferring := c.deferring
+	defer func() { c.deferring = deferring }()
+	c.deferring, _ = c.suspends(body)
 	for _, s := range body {
 		fun.Body = append(fun.Body, c.convertStmt(s))
 	}
+	fun.Body = append(c.declareResults(), c.frame(fun.Body, body, self)...)
+	fun.Async = c.awaits
 
 	return fun
 }
 
-func (c *jsCompiler) convertStmt(stmt ast.Stmt) jsast.Stmt {
+func (c *jsCompiler) convertStmt(stmt ast.Stmt) (s jsast.Stmt) {
 	if stmt == nil {
 		return nil
 	}
+	c.pos = stmt.Pos()
+	defer func() { jsast.SetPos(s, stmt.Pos()) }()
 
 	switch n := stmt.(type) {
 	case *ast.DeclStmt:
 		return &jsast.DeclStmt{Decl: c.convertDecl(n.Decl)}
 	case *ast.IfStmt:
-		return &jsast.IfStmt{
+		var init jsast.Stmt
+		if n.Init != nil {
+			init = c.convertStmt(n.Init)
+		}
+		s := &jsast.IfStmt{
 			Cond: c.convertExpr(n.Cond),
 			Body: c.convertStmt(n.Body).(*jsast.BlockStmt),
 			Else: c.convertStmt(n.Else),
 		}
+		if init != nil {
+			// the names the statement declares are scoped to the if
+			return &jsast.BlockStmt{Body: []jsast.Stmt{init, s}}
+		}
+		return s
 	case *ast.BlockStmt:
 		var sub []jsast.Stmt
 		for _, s := range n.List {
@@ -140,71 +252,158 @@ func (c *jsCompiler) convertStmt(stmt ast.Stmt) jsast.Stmt {
 		}
 		return &jsast.BlockStmt{Body: sub}
 	case *ast.AssignStmt:
-		//TODO: define token?
-		if n.Tok == token.DEFINE {
-			panic("define assignment not supported")
+		if x := commaOk(len(n.Lhs), n.Rhs); x != nil {
+			return c.convertAssertOk(n, x)
 		}
-
-		if len(n.Lhs) != len(n.Rhs) {
-			//TODO: if RHS is a function call to a function with multiple
-			// return values then we need to de-structure it: {a, b} =
-			panic("function multi-return-value assignment not supported")
+		if len(n.Rhs) == 1 && isTuple(c.info.Types[n.Rhs[0]].Type) {
+			return c.destructure(n, c.convertExpr(n.Rhs[0]))
+		}
+		if n.Tok == token.DEFINE {
+			return c.define(n)
 		}
 
 		var sub []jsast.Node
 		for i := range n.Lhs {
+			if op, ok := arithAssign(n.Tok); ok && c.isInt(n.Lhs[i]) {
+				// x op= y is x = x op y with the integer operation
+				sub = append(sub, &jsast.AssignStmt{
+					Lhs: c.convertExpr(n.Lhs[i]),
+					Op:  "=",
+					Rhs: c.intArith(op, c.convertExpr(n.Lhs[i]), c.convertExpr(n.Rhs[i])),
+				})
+				continue
+			}
+			rhs := c.convertExpr(n.Rhs[i])
+			if n.Tok == token.ASSIGN {
+				rhs = c.assign(n.Rhs[i], c.info.Types[n.Lhs[i]].Type)
+			}
 			sub = append(sub, &jsast.AssignStmt{
 				Lhs: c.convertExpr(n.Lhs[i]),
 				Op:  c.convertOp(n.Tok),
-				Rhs: c.convertExpr(n.Rhs[i]),
+				Rhs: rhs,
 			})
 		}
 		if len(sub) == 1 {
 			return sub[0].(jsast.Stmt)
 		}
 		return &jsast.Placeholder{Children: sub}
+	case *ast.ExprStmt:
+		return &jsast.ExprStmt{Exp: c.convertExpr(n.X)}
 	case *ast.ReturnStmt:
-		if len(n.Results) == 0 {
-			return &jsast.ReturnStmt{}
-		}
-
-		if len(n.Results) > 1 {
-			panic("multi-return not supported yet")
-		}
-		return &jsast.ReturnStmt{
-			Result: c.convertExpr(n.Results[0]),
-		}
+		return c.returnStmt(n)
+	case *ast.TypeSwitchStmt:
+		return c.typeSwitch(n)
+	case *ast.RangeStmt:
+		return c.rangeStmt(n)
+	case *ast.DeferStmt:
+		return c.deferStmt(n)
+	case *ast.CatchStmt:
+		return c.catchStmt(n)
 	}
 
 	panic(fmt.Sprintf("Unknown stmt node type: %T", stmt))
 }
 
-func (c *jsCompiler) convertExpr(expr ast.Expr) jsast.Expr {
+func (c *jsCompiler) convertExpr(expr ast.Expr) (x jsast.Expr) {
 	if expr == nil {
 		return nil
 	}
+	c.pos = expr.Pos()
+	// nodes are positioned inside out, so each keeps the position of
+	// the innermost wl node it was converted from
+	defer func() { jsast.SetPos(x, expr.Pos()) }()
+
+	// enum members stay references to their member objects
+	if tv, ok := c.info.Types[expr]; ok && tv.Value != nil && c.folds(expr) {
+		if _, basic := underlying(tv.Type).(*types.Basic); basic {
+			return c.constant(expr, tv.Value)
+		}
+	}
 
 	switch n := expr.(type) {
 	case *ast.BasicLit:
 		return &jsast.BasicLiteral{Value: n.Value}
 	case *ast.BinaryExpr:
+		if c.isInt(n) {
+			return c.intArith(n.Op, c.convertExpr(n.X), c.convertExpr(n.Y))
+		}
+		if eq := c.equality(n); eq != nil {
+			return eq
+		}
 		return &jsast.BinaryExpression{
 			Lhs: c.convertExpr(n.X),
 			Op:  c.convertOp(n.Op),
 			Rhs: c.convertExpr(n.Y),
 		}
 	case *ast.Ident:
-		return &jsast.Identifier{Name: c.getJsIdent(n)}
+		if _, ok := c.info.Uses[n].(*types.Nil); ok {
+			return &jsast.Identifier{Name: "null"}
+		}
+		if obj := c.info.Uses[n]; obj != nil && c.self[obj] {
+			return &jsast.SelectorExpr{X: &jsast.Identifier{Name: selfParam}, Sel: c.getJsIdent(n)}
+		}
+		return &jsast.Identifier{Name: c.getJsIdent(n), Orig: n.Name}
 	case *ast.StructType:
 		return &jsast.DeclExpr{Decl: &jsast.ClassDecl{
 			Fields: c.convertFields(n.Fields.List),
 		}}
 	case *ast.SelectorExpr:
+		x := c.convertExpr(n.X)
+		if tv, ok := c.info.Types[n.X]; ok && isInterface(tv.Type) {
+			// methods are called on the value in the box
+			x = &jsast.SelectorExpr{X: x, Sel: "$value"}
+		}
 		return &jsast.SelectorExpr{
-			X:   c.convertExpr(n.X),
+			X:   x,
 			Sel: c.getJsIdent(n.Sel),
 		}
-
+	case *ast.ParenExpr:
+		return &jsast.ParenExpr{X: c.convertExpr(n.X)}
+	case *ast.UnaryExpr:
+		if c.isInt(n) {
+			switch n.Op {
+			case token.XOR:
+				return runtimeCall("not", unparen(c.convertExpr(n.X)))
+			case token.SUB:
+				if c.ints == BigInts {
+					return c.intResult(&jsast.UnaryExpression{Op: "-", Exp: c.convertExpr(n.X)})
+				}
+			}
+		}
+		return &jsast.UnaryExpression{
+			Op:  n.Op.String(),
+			Exp: c.convertExpr(n.X),
+		}
+	case *ast.IndexExpr:
+		return &jsast.IndexExpr{
+			X:     c.convertExpr(n.X),
+			Index: c.convertExpr(n.Index),
+		}
+	case *ast.CallExpr:
+		if tv := c.info.Types[n.Fun]; tv.IsType() && isInterface(tv.Type) && len(n.Args) == 1 {
+			return c.assign(n.Args[0], tv.Type)
+		}
+		if conv := c.conversion(n); conv != nil {
+			return conv
+		}
+		if tv := c.info.Types[n.Fun]; tv.IsType() && len(n.Args) == 1 {
+			// other conversions keep the javascript value
+			return c.convertExpr(n.Args[0])
+		}
+		if b := c.builtinCall(n); b != nil {
+			return b
+		}
+		call := &jsast.CallExpr{Fun: c.convertExpr(n.Fun), Args: c.args(n)}
+		if c.awaited(n) {
+			return c.await(n, call)
+		}
+		return call
+	case *ast.CompositeLit:
+		return c.compositeLit(n)
+	case *ast.TypeAssertExpr:
+		return c.typeAssert(n)
+	case *ast.FuncLit:
+		return c.funcLit(n)
 	}
 
 	panic(fmt.Sprintf("Unknown expr node type: %T", expr))
@@ -216,7 +415,8 @@ func (c *jsCompiler) convertFields(fields []*ast.Field) []*jsast.VarDecl {
 		for _, n := range f.Names {
 			//TODO: isExported?
 			vars = append(vars, &jsast.VarDecl{
-				Name: c.getJsIdent(n),
+				Name:  c.getJsIdent(n),
+				Value: c.zeroValue(c.defType(n)),
 			})
 		}
 	}
@@ -239,10 +439,38 @@ func (c *jsCompiler) convertOp(tok token.Token) string {
 func (c *jsCompiler) convertSpec(spec ast.Spec, typ token.Token) jsast.Decl {
 	switch n := spec.(type) {
 	case *ast.ValueSpec:
+		if x := commaOk(len(n.Names), n.Values); x != nil || len(n.Values) == 1 && isTuple(c.info.Types[n.Values[0]].Type) {
+			// comma ok assertions and calls with several results give
+			// arrays
+			var value jsast.Expr
+			if x != nil {
+				value = c.assertOk(x)
+			} else {
+				value = c.convertExpr(n.Values[0])
+			}
+			var names []string
+			exported := false
+			for _, i := range n.Names {
+				if i.Name == "_" {
+					names = append(names, "")
+				} else {
+					names = append(names, c.getJsIdent(i))
+					exported = c.exported(i) || exported
+				}
+			}
+			return &jsast.VarDecl{
+				IsExported: exported,
+				Kind:       "let",
+				Name:       "[" + strings.Join(names, ", ") + "]",
+				Value:      value,
+			}
+		}
 		var sub []jsast.Node
 		for idx, i := range n.Names {
 			varDecl := &jsast.VarDecl{
-				Name: c.getJsIdent(i),
+				Source:     jsast.Source{Pos: i.Pos()},
+				IsExported: c.exported(i),
+				Name:       c.getJsIdent(i),
 			}
 			if typ == token.CONST {
 				varDecl.Kind = "const"
@@ -251,35 +479,38 @@ func (c *jsCompiler) convertSpec(spec ast.Spec, typ token.Token) jsast.Decl {
 			}
 
 			if len(n.Values) > idx {
-				varDecl.Value = c.convertExpr(n.Values[idx])
-			} else if tName, ok := n.Type.(*ast.Ident); ok && tName != nil {
-				// if our type is a named struct then we
-				// need to instantiate it as a class
-				// so our prototype has all the methods and fields
-
-				// TODO: detect struct types
-				varDecl.Value = &jsast.ClassInstantiate{ClassName: tName.Name}
+				varDecl.Value = c.assign(n.Values[idx], c.defType(i))
+			} else if n.Type != nil {
+				varDecl.Value = c.zeroValue(c.defType(i))
 			}
 
-			//TODO: exported
 			sub = append(sub, varDecl)
 		}
 		if len(sub) == 1 {
 			return sub[0].(jsast.Decl)
 		}
-		return &jsast.Placeholder{sub}
+		return &jsast.Placeholder{Children: sub}
 
 	case *ast.TypeSpec:
-		//TODO: other type spec types
-		//- type a int
-		//- type b mod.Thing
-		//- type c = d ....aliases?
-
 		nm := c.getJsIdent(n.Name)
-		typ := c.convertExpr(n.Type).(*jsast.DeclExpr)
+		if enum, ok := n.Type.(*ast.EnumType); ok {
+			decl := c.convertEnum(nm, enum)
+			decl.IsExported = c.exported(n.Name)
+			return decl
+		}
+		if _, ok := underlying(c.defType(n.Name)).(*types.Struct); !ok {
+			// values of other types are javascript values, their types
+			// only exist as type descriptors
+			return &jsast.Placeholder{}
+		}
+		typ, ok := c.convertExpr(n.Type).(*jsast.DeclExpr)
+		if !ok {
+			panic(fmt.Sprintf("unsupported struct type definition: %s", n.Name.Name))
+		}
 		switch t := typ.Decl.(type) {
 		case *jsast.ClassDecl:
 			t.Name = nm
+			t.IsExported = c.exported(n.Name)
 		default:
 			panic(fmt.Sprintf("unsupported decl type: %T", t))
 		}
@@ -289,10 +520,118 @@ func (c *jsCompiler) convertSpec(spec ast.Spec, typ token.Token) jsast.Decl {
 	panic(fmt.Sprintf("Unknown spec node type: %T", spec))
 }
 
+func (c *jsCompiler) convertEnum(name string, n *ast.EnumType) *jsast.EnumDecl {
+	decl := &jsast.EnumDecl{Name: name}
+	for _, s := range n.Specs {
+		for _, i := range s.(*ast.ValueSpec).Names {
+			m := &jsast.EnumMember{Name: c.getJsIdent(i)}
+			if obj, ok := c.info.Defs[i].(*types.Const); ok {
+				m.Value = constValue(obj.Val())
+			} else {
+				m.Value = &jsast.Identifier{Name: "undefined"}
+			}
+			decl.Members = append(decl.Members, m)
+		}
+	}
+	return decl
+}
+
+// constValue returns the javascript literal for a constant value
+func constValue(val constant.Value) jsast.Expr {
+	switch val.Kind() {
+	case constant.String:
+		return stringLit(constant.StringVal(val))
+	case constant.Bool:
+		return &jsast.Identifier{Name: val.String()}
+	case constant.Float:
+		f, _ := constant.Float64Val(val)
+		return &jsast.BasicLiteral{Value: strconv.FormatFloat(f, 'g', -1, 64)}
+	case constant.Unknown:
+		return &jsast.Identifier{Name: "undefined"}
+	}
+	return &jsast.BasicLiteral{Value: val.ExactString()}
+}
+
+// zeroValue returns the initial value of variables of type t
+func (c *jsCompiler) zeroValue(t types.Type) jsast.Expr {
+	switch u := underlying(t).(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			return &jsast.Identifier{Name: "false"}
+		case u.Info()&types.IsInteger != 0 && c.ints == BigInts:
+			return &jsast.BasicLiteral{Value: "0n"}
+		case u.Info()&types.IsNumeric != 0:
+			return &jsast.BasicLiteral{Value: "0"}
+		case u.Info()&types.IsString != 0:
+			return stringLit("")
+		}
+	case *types.Slice:
+		return &jsast.ArrayLiteral{}
+	case *types.Map:
+		return &jsast.ObjectLiteral{}
+	case *types.Enum:
+		// the first member is the zero value
+		if named, ok := t.(*types.Named); ok && u.NumValues() > 0 {
+			return &jsast.SelectorExpr{X: &jsast.Identifier{Name: c.className(named)}, Sel: c.symbols.name(u.Value(0))}
+		}
+	case *types.Struct:
+		// named structs are classes, instantiate them so
+		// our prototype has all the methods and fields
+		if named, ok := t.(*types.Named); ok && c.compiled(named) {
+			return &jsast.ClassInstantiate{ClassName: c.className(named)}
+		}
+		return &jsast.ObjectLiteral{}
+	}
+	return &jsast.Identifier{Name: "null"}
+}
+
+// defType returns the type of the object ident declares, or nil
+func (c *jsCompiler) defType(ident *ast.Ident) types.Type {
+	if obj := c.info.Defs[ident]; obj != nil {
+		return obj.Type()
+	}
+	return nil
+}
+
+func underlying(t types.Type) types.Type {
+	if t == nil {
+		return nil
+	}
+	return t.Underlying()
+}
+
+// exported reports whether the name declared by ident is exported by
+// the module where it is declared: it is an exported package level name
+// and the compiler is writing a module. Names renamed not to collide
+// with reserved names are exported under their own name at the end of
+// the module instead.
+func (c *jsCompiler) exported(ident *ast.Ident) bool {
+	if !c.exports || !ast.IsExported(ident.Name) {
+		return false
+	}
+	obj := c.info.Defs[ident]
+	if obj == nil || obj.Pkg() == nil || obj.Parent() != obj.Pkg().Scope() {
+		return false
+	}
+	if js, name := c.getJsIdent(ident), escapeIdent(ident.Name); js != name {
+		c.renamed = append(c.renamed, jsast.ExportSpec{Local: js, Name: name})
+		return false
+	}
+	return true
+}
+
+// getJsIdent returns the javascript name of the object i denotes, see
+// symbolMap. Identifiers without an object are only escaped.
 func (c *jsCompiler) getJsIdent(i *ast.Ident) string {
-	//TODO: handle escaping idents that aren't valid in JS
-	// look up in our map
-	return i.Name
+	obj := c.info.Defs[i]
+	if obj == nil {
+		obj = c.info.Uses[i]
+	}
+	if obj == nil {
+		return escapeIdent(i.Name)
+	}
+	return c.symbols.name(obj)
 }
 
 /*
@@ -4,13 +4,48 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"unicode/utf8"
 	"weblang/wl/jscompiler/jsast"
+	"weblang/wl/jscompiler/sourcemap"
+	"weblang/wl/token"
+)
+
+// Mode controls the output of a printer
+type Mode uint
+
+const (
+	// Minify leaves out whitespace and redundant parentheses
+	Minify Mode = 1 << iota
 )
 
 type jsPrinter struct {
 	output io.Writer
+	Mode   Mode
 
 	justPrintedEndStmt bool
+
+	// minified output state: the last rune written, and whether
+	// whitespace was left out after it
+	last  rune
+	space bool
+
+	// source map of the output, if any
+	fset      *token.FileSet
+	sourceMap *sourcemap.Map
+	line, col int // output position, col in UTF-16 units
+}
+
+// Printer prints nodes to one output, recording the position of each
+// node compiled from wl code in a source map. Unlike Fprint, it keeps
+// track of the output position across calls, and its Mode can be set.
+type Printer struct {
+	jsPrinter
+}
+
+// NewPrinter returns a printer writing to out. The positions of the
+// printed nodes are resolved with fset and added to m.
+func NewPrinter(out io.Writer, fset *token.FileSet, m *sourcemap.Map) *Printer {
+	return &Printer{jsPrinter{output: out, fset: fset, sourceMap: m}}
 }
 
 // Fprint writes the javascript into the out writer.
@@ -44,21 +79,45 @@ func (p *jsPrinter) Fprint(node interface{}) error {
 }
 
 func (p *jsPrinter) expr(expr jsast.Expr) {
+	p.expr1(expr, jsast.LowestPrec)
+}
+
+// expr1 prints expr where an operator of at least precedence prec is
+// expected, adding parentheses if expr binds less tightly. Minified
+// output leaves out parentheses that aren't needed.
+func (p *jsPrinter) expr1(expr jsast.Expr, prec int) {
+	if paren, ok := expr.(*jsast.ParenExpr); ok && p.Mode&Minify != 0 && jsast.ExprPrecedence(paren.X) >= prec {
+		p.mark(expr)
+		p.expr1(paren.X, prec)
+		return
+	}
+	if jsast.ExprPrecedence(expr) < prec {
+		p.print("(")
+		p.expr1(expr, jsast.LowestPrec)
+		p.print(")")
+		return
+	}
+
+	p.mark(expr)
 	switch x := expr.(type) {
 	case *jsast.Placeholder:
 		p.placeholder(x)
 	case *jsast.RawJs:
-		p.print(x.RawJs)
+		p.printRaw(x.RawJs)
 	case *jsast.Identifier:
 		p.print(x.Name)
 	case *jsast.BinaryExpression:
-		p.expr(x.Lhs)
+		prec := jsast.Precedence(x.Op)
+		p.expr1(x.Lhs, prec)
 		p.print(" ", x.Op, " ")
-		p.expr(x.Rhs)
+		p.expr1(x.Rhs, prec+1)
 	case *jsast.UnaryExpression:
 		p.print(x.Op)
-		p.expr(x.Exp)
+		p.expr1(x.Exp, jsast.UnaryPrec)
 	case *jsast.FunctionLiteral:
+		if x.Async {
+			p.print("async ")
+		}
 		p.print("function ")
 		if x.Name != nil {
 			p.print(*x.Name)
@@ -75,9 +134,9 @@ func (p *jsPrinter) expr(expr jsast.Expr) {
 		p.stmtList(x.Body)
 		p.print("}")
 	case *jsast.BasicLiteral:
-		p.print(x.Value)
+		p.printRaw(x.Value)
 	case *jsast.SelectorExpr:
-		p.expr(x.X)
+		p.expr1(x.X, jsast.CallPrec)
 		p.print(".", x.Sel)
 	case *jsast.ClassInstantiate:
 		p.print("new ", x.ClassName, "(")
@@ -88,11 +147,55 @@ func (p *jsPrinter) expr(expr jsast.Expr) {
 			p.expr(param)
 		}
 		p.print(")")
+	case *jsast.CallExpr:
+		p.expr1(x.Fun, jsast.CallPrec)
+		p.print("(")
+		p.exprList(x.Args)
+		p.print(")")
+	case *jsast.ParenExpr:
+		p.print("(")
+		p.expr(x.X)
+		p.print(")")
+	case *jsast.IndexExpr:
+		p.expr1(x.X, jsast.CallPrec)
+		p.print("[")
+		p.expr(x.Index)
+		p.print("]")
+	case *jsast.ConditionalExpr:
+		p.expr1(x.Cond, jsast.ConditionalPrec+1)
+		p.print(" ? ")
+		p.expr1(x.Then, jsast.ConditionalPrec)
+		p.print(" : ")
+		p.expr1(x.Else, jsast.ConditionalPrec)
+	case *jsast.ArrayLiteral:
+		p.print("[")
+		p.exprList(x.Elts)
+		p.print("]")
+	case *jsast.ObjectLiteral:
+		p.print("{")
+		for i, prop := range x.Props {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.printRaw(prop.Key)
+			p.print(": ")
+			p.expr(prop.Value)
+		}
+		p.print("}")
 	default:
 		panic(fmt.Sprintf("jsprinter: unsupported node type: %T", expr))
 	}
 }
 
+func (p *jsPrinter) exprList(list []jsast.Expr) {
+	for i, x := range list {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.expr(x)
+	}
+}
+
 func (p *jsPrinter) stmtList(list []jsast.Stmt) {
 	for _, stmt := range list {
 		p.stmt(stmt)
@@ -100,14 +203,19 @@ func (p *jsPrinter) stmtList(list []jsast.Stmt) {
 }
 
 func (p *jsPrinter) stmt(stmt jsast.Stmt) {
+	p.mark(stmt)
 	switch x := stmt.(type) {
 	case *jsast.Placeholder:
 		p.placeholder(x)
 	case *jsast.RawJs:
-		p.print(x.RawJs)
+		p.printRaw(x.RawJs)
 	case *jsast.ExprStmt:
 		p.expr(x.Exp)
 	case *jsast.ReturnStmt:
+		if x.Result == nil {
+			p.print("return")
+			break
+		}
 		p.print("return ")
 		p.expr(x.Result)
 	case *jsast.BlockStmt:
@@ -118,11 +226,31 @@ func (p *jsPrinter) stmt(stmt jsast.Stmt) {
 		p.print("if (")
 		p.expr(x.Cond)
 		p.print(") ")
-		p.stmt(x.Body)
-		if x.Else != nil {
-			p.print("else ")
-			p.stmt(x.Else)
+		if x.Else == nil {
+			p.stmt(x.Body)
+			break
 		}
+		// no end of statement may come between the body and else
+		p.block(x.Body)
+		p.print(" else ")
+		p.stmt(x.Else)
+	case *jsast.TryStmt:
+		// no end of statement may come between the blocks
+		p.print("try ")
+		p.block(x.Body)
+		if x.Catch != nil {
+			p.print(" catch (", x.Param, ") ")
+			p.block(x.Catch)
+		}
+		if x.Finally != nil {
+			p.print(" finally ")
+			p.block(x.Finally)
+		}
+	case *jsast.ForOfStmt:
+		p.print("for (let ", x.Lhs, " of ")
+		p.expr(x.X)
+		p.print(") ")
+		p.block(x.Body)
 	case *jsast.DeclStmt:
 		p.decl(x.Decl)
 	case *jsast.AssignStmt:
@@ -136,6 +264,14 @@ func (p *jsPrinter) stmt(stmt jsast.Stmt) {
 	p.printEndStatement()
 }
 
+// block prints the block b without ending the statement
+func (p *jsPrinter) block(b *jsast.BlockStmt) {
+	p.mark(b)
+	p.print("{\n")
+	p.stmtList(b.Body)
+	p.print("}")
+}
+
 func (p *jsPrinter) declList(list []jsast.Decl) {
 	for _, decl := range list {
 		p.decl(decl)
@@ -143,6 +279,7 @@ func (p *jsPrinter) declList(list []jsast.Decl) {
 }
 
 func (p *jsPrinter) decl(decl jsast.Decl) {
+	p.mark(decl)
 	switch x := decl.(type) {
 	case *jsast.Placeholder:
 		p.placeholder(x)
@@ -177,6 +314,30 @@ func (p *jsPrinter) decl(decl jsast.Decl) {
 			p.expr(x.Value)
 		}
 		p.printEndStatement()
+	case *jsast.ExportDecl:
+		p.print("export { ")
+		for i, spec := range x.Specs {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.print(spec.Local, " as ", spec.Name)
+		}
+		p.print(" }")
+		p.printEndStatement()
+	case *jsast.EnumDecl:
+		if x.IsExported {
+			p.print("export ")
+		}
+		p.print("const ", x.Name, " = Object.freeze({")
+		sep := "\n"
+		for _, m := range x.Members {
+			p.print(sep, m.Name, ": { name: \"", m.Name, "\", value: ")
+			p.expr(m.Value)
+			p.print(" }")
+			sep = ",\n"
+		}
+		p.print("\n})")
+		p.printEndStatement()
 	default:
 		panic(fmt.Sprintf("jsprinter: unsupported node type: %T", decl))
 	}
@@ -184,7 +345,13 @@ func (p *jsPrinter) decl(decl jsast.Decl) {
 
 func (p *jsPrinter) module(mod *jsast.Module) {
 	for _, i := range mod.Imports {
-		p.print("import * as ", i.Alias, " from \"", i.File, "\";\n")
+		if i.Default {
+			p.print("import ", i.Alias, " from ")
+		} else {
+			p.print("import * as ", i.Alias, " from ")
+		}
+		p.printRaw(`"` + i.File + `"`)
+		p.print(";\n")
 	}
 
 	// add spaces after imports
@@ -208,9 +375,30 @@ func (p *jsPrinter) printEndStatement() {
 	p.print(";\n")
 }
 
+// mark maps the current output position to the source position of n
+func (p *jsPrinter) mark(n jsast.Node) {
+	if p.sourceMap == nil {
+		return
+	}
+	pos := jsast.PosOf(n)
+	if !pos.IsValid() {
+		return
+	}
+	name := ""
+	if id, ok := n.(*jsast.Identifier); ok {
+		name = id.Orig
+	}
+	p.sourceMap.Add(p.line, p.col, p.fset.Position(pos), name)
+}
+
+// print prints syntax, which loses its whitespace when minified
 func (p *jsPrinter) print(s ...string) {
 	for i := range s {
-		io.WriteString(p.output, s[i])
+		if p.Mode&Minify != 0 {
+			p.write(p.minify(s[i]))
+		} else {
+			p.write(s[i])
+		}
 	}
 	p.justPrintedEndStmt = false
 
@@ -218,3 +406,75 @@ func (p *jsPrinter) print(s ...string) {
 		p.justPrintedEndStmt = true
 	}
 }
+
+// printRaw prints literals and raw javascript as they are
+func (p *jsPrinter) printRaw(s string) {
+	if p.Mode&Minify != 0 && s != "" {
+		r, _ := utf8.DecodeRuneInString(s)
+		if p.space && needsSpace(p.last, r) || sameSign(p.last, r) {
+			p.write(" ")
+		}
+		p.last, _ = utf8.DecodeLastRuneInString(s)
+		p.space = false
+	}
+	p.write(s)
+	p.justPrintedEndStmt = strings.HasSuffix(s, ";\n")
+}
+
+func (p *jsPrinter) write(s string) {
+	io.WriteString(p.output, s)
+	if p.sourceMap != nil {
+		p.advance(s)
+	}
+}
+
+// minify returns s without whitespace, except for single blanks
+// between tokens that would otherwise run together. s is one piece of
+// syntax, so a sign starting it is a token of its own even without
+// whitespace before it: the - of -(-a) printed after the first.
+func (p *jsPrinter) minify(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if r == ' ' || r == '\n' || r == '\t' {
+			p.space = true
+			continue
+		}
+		if p.space && needsSpace(p.last, r) || i == 0 && sameSign(p.last, r) {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(r)
+		p.last, p.space = r, false
+	}
+	return b.String()
+}
+
+// needsSpace reports whether the runes a and b must be separated to
+// not form a different token, like two words or a - -b
+func needsSpace(a, b rune) bool {
+	return isWord(a) && isWord(b) || (a == '+' || a == '-') && a == b
+}
+
+// sameSign reports whether a and b are both + or both -, which run
+// together into an increment or decrement
+func sameSign(a, b rune) bool {
+	return (a == '+' || a == '-') && a == b
+}
+
+func isWord(r rune) bool {
+	return r == '_' || r == '$' || '0' <= r && r <= '9' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r >= utf8.RuneSelf
+}
+
+// advance moves the output position past s
+func (p *jsPrinter) advance(s string) {
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		p.line += strings.Count(s, "\n")
+		p.col = 0
+		s = s[i+1:]
+	}
+	for _, r := range s {
+		p.col++
+		if r >= 0x10000 && r != utf8.RuneError {
+			p.col++ // surrogate pair
+		}
+	}
+}
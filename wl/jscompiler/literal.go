@@ -0,0 +1,110 @@
+package jscompiler
+
+import (
+	"fmt"
+	"strings"
+	"weblang/wl/ast"
+	"weblang/wl/constant"
+	"weblang/wl/jscompiler/jsast"
+	"weblang/wl/types"
+)
+
+// jsString returns s as a double quoted javascript string literal.
+// "<" is escaped so the literal is safe inside an inline <script>.
+func jsString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '<':
+			b.WriteString(`\u003c`)
+		case '\u2028', '\u2029':
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// stringLit returns a javascript string literal node for s
+func stringLit(s string) *jsast.BasicLiteral {
+	return &jsast.BasicLiteral{Value: jsString(s)}
+}
+
+// compositeLit converts a composite literal. Named structs are
+// instances of their class with the fields given assigned, so the
+// others keep their zero values; other structs and maps are objects
+// and slices are arrays. Elements are assigned to their field or
+// element type, boxing and copying them as needed.
+func (c *jsCompiler) compositeLit(n *ast.CompositeLit) jsast.Expr {
+	t := c.info.Types[n].Type
+	switch u := underlying(t).(type) {
+	case *types.Struct:
+		obj := &jsast.ObjectLiteral{}
+		for i, e := range n.Elts {
+			f := u.Field(i)
+			if kv, ok := e.(*ast.KeyValueExpr); ok {
+				f = c.info.Uses[kv.Key.(*ast.Ident)].(*types.Var)
+				e = kv.Value
+			}
+			obj.Props = append(obj.Props, &jsast.Property{Key: c.symbols.name(f), Value: c.assign(e, f.Type())})
+		}
+		named, ok := t.(*types.Named)
+		if !ok || !c.compiled(named) {
+			return obj
+		}
+		inst := &jsast.ClassInstantiate{ClassName: c.className(named)}
+		if len(obj.Props) == 0 {
+			return inst
+		}
+		return &jsast.CallExpr{
+			Fun:  &jsast.SelectorExpr{X: &jsast.Identifier{Name: "Object"}, Sel: "assign"},
+			Args: []jsast.Expr{inst, obj},
+		}
+	case *types.Slice:
+		arr := &jsast.ArrayLiteral{}
+		for _, e := range n.Elts {
+			if _, ok := e.(*ast.KeyValueExpr); ok {
+				panic("indexed slice literals not supported")
+			}
+			arr.Elts = append(arr.Elts, c.assign(e, u.Elem()))
+		}
+		return arr
+	case *types.Map:
+		obj := &jsast.ObjectLiteral{}
+		for _, e := range n.Elts {
+			kv := e.(*ast.KeyValueExpr)
+			key := c.info.Types[kv.Key].Value
+			if key == nil {
+				panic("map literals with non-constant keys not supported")
+			}
+			obj.Props = append(obj.Props, &jsast.Property{Key: constKey(key), Value: c.assign(kv.Value, u.Elem())})
+		}
+		return obj
+	}
+	panic(fmt.Sprintf("unsupported composite literal type: %v", t))
+}
+
+// constKey returns the object key of the constant map key val
+func constKey(val constant.Value) string {
+	if val.Kind() == constant.String {
+		return jsString(constant.StringVal(val))
+	}
+	return jsString(val.ExactString())
+}
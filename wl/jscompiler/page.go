@@ -0,0 +1,676 @@
+package jscompiler
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+	"weblang/wl/ast"
+	"weblang/wl/flow"
+	"weblang/wl/importer"
+	"weblang/wl/jscompiler/jsast"
+	"weblang/wl/page"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// CompilePage compiles a page template and the package backing it into
+// a single html document written to w. The package must have been
+// type-checked with info, and the template checked against it with
+// page.Check.
+//
+// Markup outside of <body> is copied to the output as-is. The content
+// of <body> is compiled into a render function that the page runtime
+// re-runs after every event handler.
+//
+// flows are the checked flows of the site; the runtime objects of those
+// whose package the page imports are declared before the page code.
+//
+// The page script of a package importing other packages of the site is
+// a module script instead, importing their modules as written by
+// Compile, the runtime module written by WriteRuntime and the modules of
+// the flows written by CompileFlowModule, all from the root of the site.
+func CompilePage(w io.Writer, fset *token.FileSet, pkg *types.Package, info *types.Info, files []*ast.File, tmpl *page.Template, pinfo *page.Info, flows ...*flow.Info) error {
+	return (&Config{}).CompilePage(w, fset, pkg, info, files, tmpl, pinfo, flows...)
+}
+
+// CompilePage is like the package level CompilePage, with the output
+// controlled by cfg.
+//
+// If cfg.SourceMap is set, it is filled in with the source map of the
+// page script, mapping it back to the .wl files of the package and to
+// the template. The script ends in a comment linking it to the map,
+// which the caller writes next to the page as SourceMap.File + ".map".
+// Generated positions are relative to the start of the script, as
+// browsers expect for inline scripts.
+func (cfg *Config) CompilePage(w io.Writer, fset *token.FileSet, pkg *types.Package, info *types.Info, files []*ast.File, tmpl *page.Template, pinfo *page.Info, flows ...*flow.Info) (err error) {
+	c := cfg.newCompiler(info)
+	c.fset = fset
+	defer c.catch(&err)
+	if cfg.Prune {
+		c.live = reach(fset, info, files, tmpl, pinfo)
+	}
+	mod, err := c.Compile(pkg, files)
+	if err != nil {
+		return err
+	}
+	if cfg.Prune && cfg.Report != nil {
+		var pkgs []*types.Package
+		for _, imp := range pkg.Imports() {
+			if runtimePackages[imp.Path()] || flowOf(imp, flows) {
+				pkgs = append(pkgs, imp)
+			}
+		}
+		c.live.report(cfg.Report, pkgs)
+	}
+	modules := pageImports(pkg, flows, c.symbols)
+	for i := len(flows) - 1; i >= 0 && modules == nil; i-- {
+		if imports(pkg, flows[i].Package) && c.live.keepsPackage(flows[i].Package) {
+			// the flow object is the binding of the flow package
+			decl := compileFlow(flows[i], cfg.Ints).(*jsast.VarDecl)
+			decl.Name = c.symbols.imports[flows[i].Package]
+			mod.Decls = append([]jsast.Decl{decl}, mod.Decls...)
+		}
+	}
+
+	pc := &pageCompiler{
+		jsCompiler: c,
+		fset:       fset,
+		info:       pinfo,
+		out:        w,
+		cfg:        cfg,
+		modules:    modules,
+	}
+
+	if !pc.hasBody(tmpl.Nodes) {
+		// a fragment, give it a document to live in
+		pc.print("<!doctype html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n</head>\n")
+		pc.body(&page.Element{Name: "body", Children: tmpl.Nodes}, mod)
+		pc.print("\n</html>\n")
+		return pc.err
+	}
+
+	pc.static(tmpl.Nodes, mod)
+	return pc.err
+}
+
+type pageCompiler struct {
+	*jsCompiler
+	fset *token.FileSet
+	info *page.Info
+	out  io.Writer
+	err  error
+
+	cfg *Config
+
+	// modules are the imports of the script of a page importing site
+	// packages, which is a module script sharing the runtime module
+	modules []jsast.Import
+
+	sites  int      // component use sites seen, numbering their keys
+	loops  []string // key parameters of the enclosing {{for}} blocks
+	inComp bool     // compiling a component template
+}
+
+// flowOf reports whether pkg is the package of one of flows
+func flowOf(pkg *types.Package, flows []*flow.Info) bool {
+	for _, f := range flows {
+		if f.Package == pkg {
+			return true
+		}
+	}
+	return false
+}
+
+// pageImports returns the imports of the script of a page backed by
+// pkg, or nil if pkg imports no site package and the script is a
+// classic script with the runtime inlined. Otherwise the script imports
+// the runtime module, the modules of the site packages and the modules
+// of the flows pkg imports, by their site relative URLs like PageURL.
+func pageImports(pkg *types.Package, flows []*flow.Info, symbols *symbolMap) []jsast.Import {
+	var mods []jsast.Import
+	site := false
+	for _, imp := range pkg.Imports() {
+		if importer.IsBuiltin(imp.Path()) {
+			continue
+		}
+		isFlow := flowOf(imp, flows)
+		site = site || !isFlow
+		mods = append(mods, jsast.Import{
+			Alias:   symbols.imports[imp],
+			File:    "/" + ModuleFile(imp.Path()),
+			Default: isFlow,
+		})
+	}
+	if !site {
+		return nil
+	}
+	runtime := jsast.Import{Alias: "wl", File: "/" + ModuleFile(RuntimeModule), Default: true}
+	return append([]jsast.Import{runtime}, mods...)
+}
+
+// imports reports whether pkg imports dep
+func imports(pkg, dep *types.Package) bool {
+	for _, imp := range pkg.Imports() {
+		if imp == dep {
+			return true
+		}
+	}
+	return false
+}
+
+func (pc *pageCompiler) print(s ...string) {
+	for _, str := range s {
+		if pc.err != nil {
+			return
+		}
+		_, pc.err = io.WriteString(pc.out, str)
+	}
+}
+
+func (pc *pageCompiler) errorf(pos token.Pos, format string, args ...interface{}) {
+	if pc.err == nil {
+		pc.err = fmt.Errorf("%s: %s", pc.fset.Position(pos), fmt.Sprintf(format, args...))
+	}
+}
+
+func (pc *pageCompiler) hasBody(nodes []page.Node) bool {
+	for _, n := range nodes {
+		if el, ok := n.(*page.Element); ok {
+			if strings.EqualFold(el.Name, "body") || pc.hasBody(el.Children) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// static writes the markup of nodes, which are outside of <body>
+func (pc *pageCompiler) static(nodes []page.Node, mod *jsast.Module) {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *page.Text:
+			pc.print(n.Value)
+		case *page.Raw:
+			pc.print(n.Value)
+		case *page.Element:
+			if strings.EqualFold(n.Name, "body") {
+				pc.body(n, mod)
+				continue
+			}
+			pc.print("<", n.Name)
+			for _, a := range n.Attrs {
+				attr, ok := a.(*page.Attr)
+				if !ok {
+					pc.errorf(a.Pos(), "actions and events are only supported inside <body>")
+					continue
+				}
+				pc.print(" ", attr.Name)
+				if attr.HasValue {
+					pc.print(`="`, html.EscapeString(pc.staticValue(attr.Value)), `"`)
+				}
+			}
+			if n.SelfClosing {
+				pc.print(" />")
+				continue
+			}
+			pc.print(">")
+			if n.IsVoid() {
+				continue
+			}
+			pc.static(n.Children, mod)
+			pc.print("</", n.Name, ">")
+		default:
+			pc.errorf(n.Pos(), "actions are only supported inside <body>")
+		}
+	}
+}
+
+func (pc *pageCompiler) staticValue(nodes []page.Node) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		if t, ok := n.(*page.Text); ok {
+			b.WriteString(html.UnescapeString(t.Value))
+			continue
+		}
+		pc.errorf(n.Pos(), "actions are only supported inside <body>")
+	}
+	return b.String()
+}
+
+// body writes the body element with the page script in place of its
+// content
+func (pc *pageCompiler) body(n *page.Element, mod *jsast.Module) {
+	pc.print("<body")
+	for _, a := range n.Attrs {
+		attr, ok := a.(*page.Attr)
+		if !ok {
+			pc.errorf(a.Pos(), "actions and events are not supported on <body>")
+			continue
+		}
+		pc.print(" ", attr.Name)
+		if attr.HasValue {
+			pc.print(`="`, html.EscapeString(pc.staticValue(attr.Value)), `"`)
+		}
+	}
+	// the script is written first, so the runtime can leave out the
+	// helpers it doesn't use; the newline starting the script goes
+	// through the printer, so the source map counts it
+	var script bytes.Buffer
+	js := pc.cfg.newPrinter(&script, pc.fset, pc.cfg.SourceMap)
+	if pc.err == nil {
+		pc.err = js.Fprint(&jsast.RawJs{RawJs: "\n"})
+	}
+	if pc.modules != nil && pc.err == nil {
+		pc.err = js.Fprint(&jsast.Module{Imports: pc.modules})
+	}
+
+	render := &jsast.FunctionLiteral{
+		Body: []jsast.Stmt{
+			&jsast.ReturnStmt{Result: &jsast.ArrayLiteral{Elts: pc.nodes(n.Children)}},
+		},
+	}
+	args := []jsast.Expr{
+		&jsast.SelectorExpr{X: &jsast.Identifier{Name: "document"}, Sel: "body"},
+		render,
+	}
+	if reset := pc.resetRefs(); reset != nil {
+		args = append(args, reset)
+	}
+	mount := &jsast.ExprStmt{Exp: runtimeCall("mount", args...)}
+
+	comps := pc.components()
+
+	if pc.ints == BigInts && pc.err == nil {
+		// the runtime hands ints to the page as BigInts
+		pc.err = js.Fprint(&jsast.ExprStmt{Exp: runtimeCall("bigints")})
+	}
+	if pc.err == nil {
+		pc.err = js.Fprint(mod.Decls)
+	}
+	for _, fn := range comps {
+		if pc.err == nil {
+			pc.err = js.Fprint(fn)
+		}
+	}
+	// the templates may copy and compare structs the package code
+	// doesn't
+	for _, fn := range pc.helperDecls() {
+		if pc.err == nil {
+			pc.err = js.Fprint(fn)
+		}
+	}
+	if routes, router := pc.routes(); routes != nil {
+		for _, n := range []jsast.Node{routes, router} {
+			if pc.err == nil {
+				pc.err = js.Fprint(n)
+			}
+		}
+	}
+	if pc.err == nil {
+		pc.err = js.Fprint(mount)
+	}
+
+	if pc.modules != nil {
+		// the runtime module is shared with the modules imported
+		pc.print(">\n<script type=\"module\">", script.String())
+	} else {
+		var used map[string]bool
+		var report *Report
+		if pc.cfg.Prune {
+			used = usedHelpers(script.String())
+			report = pc.cfg.Report
+		}
+		runtime := runtimeFor(used, report)
+		if pc.cfg.Minify {
+			runtime = minifyRuntime(runtime)
+		}
+		pc.print(">\n<script>\n", runtime, "</script>\n<script>", script.String())
+	}
+	if pc.cfg.SourceMap != nil {
+		pc.print(pc.cfg.SourceMap.Comment())
+	}
+	pc.print("</script>\n</body>")
+}
+
+// runtimeCall returns a call to the page runtime function name
+func runtimeCall(name string, args ...jsast.Expr) *jsast.CallExpr {
+	return &jsast.CallExpr{
+		Fun:  &jsast.SelectorExpr{X: &jsast.Identifier{Name: "wl"}, Sel: name},
+		Args: args,
+	}
+}
+
+// nodes converts template content into virtual node expressions
+func (pc *pageCompiler) nodes(nodes []page.Node) []jsast.Expr {
+	var list []jsast.Expr
+	for _, n := range nodes {
+		before := len(list)
+		switch n := n.(type) {
+		case *page.Text:
+			list = append(list, runtimeCall("text", stringLit(html.UnescapeString(n.Value))))
+		case *page.Raw:
+			// comments and declarations aren't rendered
+		case *page.Element:
+			list = append(list, pc.element(n))
+		case *page.Action:
+			if esc := pc.info.Escapes[n]; esc.Safe && esc.Context == page.ContextText {
+				list = append(list, runtimeCall("raw", pc.escape(n)))
+			} else {
+				list = append(list, runtimeCall("text", pc.escape(n)))
+			}
+		case *page.IfBlock:
+			list = append(list, &jsast.ConditionalExpr{
+				Cond: pc.convertExpr(n.Cond),
+				Then: &jsast.ArrayLiteral{Elts: pc.nodes(n.Then)},
+				Else: &jsast.ArrayLiteral{Elts: pc.nodes(n.Else)},
+			})
+		case *page.ForBlock:
+			list = append(list, pc.forBlock(n))
+		default:
+			pc.errorf(n.Pos(), "unexpected %T in content", n)
+		}
+		// map the generated node back to the template
+		if len(list) > before {
+			jsast.SetPos(list[before], n.Pos())
+		}
+	}
+	return list
+}
+
+func (pc *pageCompiler) forBlock(n *page.ForBlock) jsast.Expr {
+	pc.loops = append(pc.loops, pc.loopParam(n.Key, "_k"))
+	fn := &jsast.FunctionLiteral{
+		Params: []string{pc.loopParam(n.Key, "_k")},
+		Body: []jsast.Stmt{
+			&jsast.ReturnStmt{Result: &jsast.ArrayLiteral{Elts: pc.nodes(n.Body)}},
+		},
+	}
+	if n.Value != nil {
+		fn.Params = append(fn.Params, pc.loopParam(n.Value, "_v"))
+	}
+	pc.loops = pc.loops[:len(pc.loops)-1]
+	return runtimeCall("each", pc.convertExpr(n.X), fn)
+}
+
+func (pc *pageCompiler) loopParam(ident *ast.Ident, blank string) string {
+	if ident.Name == "_" {
+		return blank
+	}
+	return pc.getJsIdent(ident)
+}
+
+// element converts an element into a wl.h call
+func (pc *pageCompiler) element(n *page.Element) jsast.Expr {
+	if inst := pc.info.Instances[n]; inst != nil {
+		return pc.instance(n, inst)
+	}
+	if slot := pc.info.Slots[n]; slot != nil {
+		// the content filling the slot, or the fallback
+		return &jsast.ParenExpr{X: &jsast.BinaryExpression{
+			Lhs: &jsast.IndexExpr{X: &jsast.Identifier{Name: slotsParam}, Index: stringLit(slot.Name)},
+			Op:  "||",
+			Rhs: &jsast.ArrayLiteral{Elts: pc.nodes(n.Children)},
+		}}
+	}
+	attrs, handlers := pc.attrs(n.Attrs)
+	call := runtimeCall("h",
+		stringLit(n.Name),
+		attrs,
+		&jsast.ArrayLiteral{Elts: handlers},
+		&jsast.ArrayLiteral{Elts: pc.nodes(n.Children)},
+	)
+	if ref := pc.info.Refs[n]; ref != nil {
+		call.Args = append(call.Args, pc.ref(ref))
+	}
+	return call
+}
+
+// ref returns the function the runtime calls with the rendered element
+// to assign it to the variable referencing it
+func (pc *pageCompiler) ref(ref *page.Ref) jsast.Expr {
+	var lhs jsast.Expr = pc.objectRef(ref.Var)
+	if ref.Loop != nil {
+		lhs = &jsast.IndexExpr{X: lhs, Index: &jsast.Identifier{Name: pc.loopParam(ref.Loop.Key, "_k")}}
+	}
+	return &jsast.FunctionLiteral{
+		Params: []string{"el"},
+		Body:   []jsast.Stmt{&jsast.AssignStmt{Lhs: lhs, Op: "=", Rhs: &jsast.Identifier{Name: "el"}}},
+	}
+}
+
+// resetRefs returns a function clearing the variables referencing
+// elements inside {{for}} blocks before they are rebound, or nil if
+// there are none
+func (pc *pageCompiler) resetRefs() jsast.Expr {
+	var vars []*types.Var
+	seen := make(map[*types.Var]bool)
+	for _, ref := range pc.info.Refs {
+		if ref.Loop != nil && !seen[ref.Var] {
+			seen[ref.Var] = true
+			vars = append(vars, ref.Var)
+		}
+	}
+	if len(vars) == 0 {
+		return nil
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Pos() < vars[j].Pos() })
+
+	fn := &jsast.FunctionLiteral{}
+	for _, v := range vars {
+		var empty jsast.Expr = &jsast.ArrayLiteral{}
+		if _, ok := v.Type().Underlying().(*types.Map); ok {
+			empty = &jsast.ObjectLiteral{}
+		}
+		fn.Body = append(fn.Body, &jsast.AssignStmt{Lhs: pc.objectRef(v), Op: "=", Rhs: empty})
+	}
+	return fn
+}
+
+// attrs converts the attributes of an element into an attribute object
+// and a list of event handlers
+func (pc *pageCompiler) attrs(nodes []page.Node) (jsast.Expr, []jsast.Expr) {
+	var parts []jsast.Expr
+	var handlers []jsast.Expr
+	obj := &jsast.ObjectLiteral{}
+
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *page.Attr:
+			obj.Props = append(obj.Props, &jsast.Property{
+				Key:   jsString(n.Name),
+				Value: pc.attrValue(n.Value),
+			})
+		case *page.EventAttr:
+			if b := pc.info.Bindings[n]; b != nil {
+				handlers = append(handlers, pc.binding(n, b))
+				continue
+			}
+			handlers = append(handlers, pc.handler(n))
+		case *page.IfBlock:
+			if len(obj.Props) > 0 {
+				parts = append(parts, obj)
+				obj = &jsast.ObjectLiteral{}
+			}
+			thenAttrs, thenHandlers := pc.attrs(n.Then)
+			elseAttrs, elseHandlers := pc.attrs(n.Else)
+			cond := pc.convertExpr(n.Cond)
+			parts = append(parts, &jsast.ConditionalExpr{Cond: cond, Then: thenAttrs, Else: elseAttrs})
+			if len(thenHandlers)+len(elseHandlers) > 0 {
+				handlers = append(handlers, &jsast.ConditionalExpr{
+					Cond: cond,
+					Then: &jsast.ArrayLiteral{Elts: thenHandlers},
+					Else: &jsast.ArrayLiteral{Elts: elseHandlers},
+				})
+			}
+		default:
+			pc.errorf(n.Pos(), "unexpected %T in attributes", n)
+		}
+	}
+
+	if len(parts) == 0 {
+		return obj, handlers
+	}
+	if len(obj.Props) > 0 {
+		parts = append(parts, obj)
+	}
+	return runtimeCall("attrs", parts...), handlers
+}
+
+// attrValue converts an attribute value into a string expression
+func (pc *pageCompiler) attrValue(nodes []page.Node) jsast.Expr {
+	var x jsast.Expr
+	for _, n := range nodes {
+		var part jsast.Expr
+		switch n := n.(type) {
+		case *page.Text:
+			part = stringLit(html.UnescapeString(n.Value))
+		case *page.Action:
+			part = pc.escape(n)
+		case *page.IfBlock:
+			part = &jsast.ParenExpr{X: &jsast.ConditionalExpr{
+				Cond: pc.convertExpr(n.Cond),
+				Then: pc.attrValue(n.Then),
+				Else: pc.attrValue(n.Else),
+			}}
+		default:
+			pc.errorf(n.Pos(), "unexpected %T in attribute value", n)
+			continue
+		}
+		if x == nil {
+			x = part
+		} else {
+			x = &jsast.BinaryExpression{Lhs: x, Op: "+", Rhs: part}
+		}
+	}
+	if x == nil {
+		return stringLit("")
+	}
+	return x
+}
+
+// escapers are the runtime functions escaping output by context
+var escapers = map[page.Context]string{
+	page.ContextText:    "str",
+	page.ContextAttr:    "str",
+	page.ContextURL:     "url",
+	page.ContextURLPart: "urlPart",
+	page.ContextCSS:     "css",
+	page.ContextScript:  "js",
+	page.ContextSrcset:  "srcset",
+}
+
+// escape converts the expression of an action into a string escaped
+// for the context it is output in
+func (pc *pageCompiler) escape(n *page.Action) jsast.Expr {
+	esc, ok := pc.info.Escapes[n]
+	if !ok {
+		pc.errorf(n.Pos(), "action was not type-checked")
+	}
+	fn := escapers[esc.Context]
+	if esc.Safe {
+		fn = "str"
+	}
+	return runtimeCall(fn, pc.convertExpr(n.X))
+}
+
+// handler converts an event binding into a wl.on call
+func (pc *pageCompiler) handler(n *page.EventAttr) jsast.Expr {
+	h := pc.info.Handlers[n]
+	if h == nil {
+		pc.errorf(n.Pos(), "event @%s was not type-checked", n.Name)
+		return &jsast.Identifier{Name: "null"}
+	}
+
+	opts := &jsast.ObjectLiteral{}
+	if len(h.Keys) > 0 {
+		keys := &jsast.ArrayLiteral{}
+		for _, k := range h.Keys {
+			keys.Elts = append(keys.Elts, stringLit(k))
+		}
+		opts.Props = append(opts.Props, &jsast.Property{Key: "keys", Value: keys})
+	}
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{{"prevent", h.Prevent}, {"stop", h.Stop}, {"once", h.Once}} {
+		if flag.set {
+			opts.Props = append(opts.Props, &jsast.Property{Key: flag.name, Value: &jsast.Identifier{Name: "true"}})
+		}
+	}
+
+	// only handlers taking the event get a parameter, so it can't
+	// shadow names used by call handlers. Async handlers return their
+	// promise, so the runtime updates the page when they are done;
+	// handlers bound to func props may be async.
+	fn := &jsast.FunctionLiteral{}
+	if h.Func != nil {
+		call := &jsast.CallExpr{Fun: pc.convertExpr(n.Handler)}
+		if h.TakesEvent {
+			fn.Params = []string{"e"}
+			call.Args = []jsast.Expr{&jsast.Identifier{Name: "e"}}
+		}
+		if f, ok := h.Func.(*types.Func); ok && !pc.isAsync(f) {
+			fn.Body = []jsast.Stmt{&jsast.ExprStmt{Exp: call}}
+		} else {
+			fn.Body = []jsast.Stmt{&jsast.ReturnStmt{Result: call}}
+		}
+	} else {
+		fn = pc.callHandler(n.Handler)
+	}
+
+	on := runtimeCall("on", stringLit(h.DOMEvent), stringLit(h.EventType), opts, fn)
+	on.Pos = n.Pos()
+	return on
+}
+
+// callHandler converts a handler calling x into a function, which is
+// async if x calls async functions
+func (pc *pageCompiler) callHandler(x ast.Expr) *jsast.FunctionLiteral {
+	pc.awaits = pc.awaitsIn(x)
+	defer func() { pc.awaits = false }()
+	return &jsast.FunctionLiteral{
+		Async: pc.awaits,
+		Body:  []jsast.Stmt{&jsast.ExprStmt{Exp: pc.convertExpr(x)}},
+	}
+}
+
+// binding converts a @bind into a wl.bind call
+func (pc *pageCompiler) binding(n *page.EventAttr, b *page.Binding) jsast.Expr {
+	var conv jsast.Expr = &jsast.SelectorExpr{
+		X:   &jsast.SelectorExpr{X: &jsast.Identifier{Name: "wl"}, Sel: "conv"},
+		Sel: b.Convert,
+	}
+	if b.Convert == "enum" {
+		// enum conversions look members up by name in the enum object
+		enum := b.Type.(*types.Named).Obj()
+		conv = &jsast.CallExpr{Fun: conv, Args: []jsast.Expr{pc.objectRef(enum)}}
+	}
+
+	// $v can't collide with wl identifiers in the bound expression
+	const param = "$v"
+	return runtimeCall("bind",
+		stringLit(b.Prop),
+		stringLit(b.DOMEvent),
+		conv,
+		&jsast.FunctionLiteral{
+			Body: []jsast.Stmt{&jsast.ReturnStmt{Result: pc.convertExpr(n.Handler)}},
+		},
+		&jsast.FunctionLiteral{
+			Params: []string{param},
+			Body: []jsast.Stmt{&jsast.AssignStmt{
+				Lhs: pc.convertExpr(n.Handler),
+				Op:  "=",
+				Rhs: &jsast.Identifier{Name: param},
+			}},
+		},
+	)
+}
+
+// objectRef returns an expression referring to the package level
+// object obj
+func (pc *pageCompiler) objectRef(obj types.Object) jsast.Expr {
+	return &jsast.Identifier{Name: pc.symbols.name(obj)}
+}
@@ -0,0 +1,995 @@
+package jscompiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"weblang/wl/ast"
+	"weblang/wl/flow"
+	"weblang/wl/importer"
+	"weblang/wl/jscompiler/sourcemap"
+	"weblang/wl/page"
+	"weblang/wl/parser"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+func TestPageEvents(t *testing.T) {
+	output := compilePage(t, `
+package p
+
+import "events"
+
+var count int
+
+func add(e events.KeyUp) {
+	count = count + 1
+}
+
+func reset() {
+	count = 0
+}
+
+func set(v int) {
+	count = v
+}
+`, `<body>
+<input @keyup.enter.prevent="add">
+<button @click="reset" @dblclick.once="set(10)">{{count}}</button>
+</body>`)
+
+	expected := `let count = 0;
+function add(e) {
+count = wl.int(count + 1);
+};
+function reset() {
+count = 0;
+};
+function set(v) {
+count = v;
+};
+wl.mount(document.body, function () {
+return [wl.text("\n"), wl.h("input", {}, [wl.on("keyup", "KeyUp", {keys: ["Enter"], prevent: true}, function (e) {
+add(e);
+})], []), wl.text("\n"), wl.h("button", {}, [wl.on("click", "Click", {}, function () {
+reset();
+}), wl.on("dblclick", "DblClick", {once: true}, function () {
+set(10);
+})], [wl.text(wl.str(count))]), wl.text("\n")];
+});
+`
+	if got := pageScript(t, output); got != expected {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, got)
+	}
+}
+
+func TestPageAsyncEvents(t *testing.T) {
+	output := compilePage(t, `
+package p
+
+import "http"
+
+var body string
+
+func load() {
+	body = http.Get("/data").Body
+}
+
+func status(url string) int {
+	return http.Get(url).Status
+}
+
+func show(s int) {
+}
+`, `<body>
+<button @click="load" @dblclick="show(status(body))">{{body}}</button>
+</body>`)
+
+	expected := `const http = wl.pkgs.http;
+let body = "";
+async function load() {
+body = (await http.Get("/data")).Body;
+};
+async function status(url) {
+return (await http.Get(url)).Status;
+};
+function show(s) {
+};
+wl.mount(document.body, function () {
+return [wl.text("\n"), wl.h("button", {}, [wl.on("click", "Click", {}, function () {
+return load();
+}), wl.on("dblclick", "DblClick", {}, async function () {
+show(await status(body));
+})], [wl.text(wl.str(body))]), wl.text("\n")];
+});
+`
+	if got := pageScript(t, output); got != expected {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, got)
+	}
+}
+
+func TestPageFragment(t *testing.T) {
+	output := compilePage(t, `
+package p
+
+var names []string
+`, `<ul>{{for i, name := range names}}<li class="{{if i == 0}}first{{/if}}">{{name}}</li>{{/for}}</ul>`)
+
+	if !strings.HasPrefix(output, "<!doctype html>\n<html>\n<head>") {
+		t.Errorf("fragment should be wrapped in a document, got:\n%v", output)
+	}
+
+	expected := `let names = [];
+wl.mount(document.body, function () {
+return [wl.h("ul", {}, [], [wl.each(names, function (i, name) {
+return [wl.h("li", {"class": (i === 0 ? "first" : "")}, [], [wl.text(wl.str(name))])];
+})])];
+});
+`
+	if got := pageScript(t, output); got != expected {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, got)
+	}
+}
+
+func TestPageRefs(t *testing.T) {
+	output := compilePage(t, `
+package p
+
+import "html"
+
+var names []string
+var newName html.Input
+var edits []html.Input
+
+func add() {
+	names = append(names, newName.Value)
+	newName.Value = ""
+}
+`, `<input id="newName" @keyup.enter="add">
+{{for i := range names}}<input id="edits">{{/for}}`)
+
+	expected := `let names = [];
+let newName = {};
+let edits = [];
+function add() {
+names = wl.append(null, names, [newName.Value]);
+newName.Value = "";
+};
+wl.mount(document.body, function () {
+return [wl.h("input", {"id": "newName"}, [wl.on("keyup", "KeyUp", {keys: ["Enter"]}, function () {
+add();
+})], [], function (el) {
+newName = el;
+}), wl.text("\n"), wl.each(names, function (i) {
+return [wl.h("input", {"id": "edits"}, [], [], function (el) {
+edits[i] = el;
+})];
+})];
+}, function () {
+edits = [];
+});
+`
+	if got := pageScript(t, output); got != expected {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, got)
+	}
+}
+
+func TestPageBind(t *testing.T) {
+	output := compilePage(t, `
+package p
+
+type color enum {
+	Red = iota
+	Green
+}
+
+type todo struct {
+	Title string
+}
+
+var name string
+var age int
+var done bool
+var c color
+var todos []todo
+`, `<input @bind="name"><input type="number" @bind="age"><input type=checkbox @bind="done">
+<select @bind="c"><option>Red</option><option>Green</option></select>
+{{for _, t := range todos}}<textarea @bind="t.Title"></textarea>{{/for}}`)
+
+	expected := `const color = Object.freeze({
+Red: { name: "Red", value: 0 },
+Green: { name: "Green", value: 1 }
+});
+class todo {
+ Title = "";
+};
+let name = "";
+let age = 0;
+let done = false;
+let c = color.Red;
+let todos = [];
+wl.mount(document.body, function () {
+return [wl.h("input", {}, [wl.bind("value", "input", wl.conv.string, function () {
+return name;
+}, function ($v) {
+name = $v;
+})], []), wl.h("input", {"type": "number"}, [wl.bind("value", "input", wl.conv.int, function () {
+return age;
+}, function ($v) {
+age = $v;
+})], []), wl.h("input", {"type": "checkbox"}, [wl.bind("checked", "change", wl.conv.checked, function () {
+return done;
+}, function ($v) {
+done = $v;
+})], []), wl.text("\n"), wl.h("select", {}, [wl.bind("value", "change", wl.conv.enum(color), function () {
+return c;
+}, function ($v) {
+c = $v;
+})], [wl.h("option", {}, [], [wl.text("Red")]), wl.h("option", {}, [], [wl.text("Green")])]), wl.text("\n"), wl.each(todos, function (_k, t) {
+return [wl.h("textarea", {}, [wl.bind("value", "input", wl.conv.string, function () {
+return t.Title;
+}, function ($v) {
+t.Title = $v;
+})], [])];
+})];
+});
+`
+	if got := pageScript(t, output); got != expected {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, got)
+	}
+}
+
+func TestPageEscaping(t *testing.T) {
+	output := compilePage(t, `
+package p
+
+import "html"
+
+var name string
+var id int
+var markup html.Safe
+`, `<a href="{{name}}/users/{{id}}" style="width: {{id}}px">{{name}}{{markup}}</a><script>var id = {{id}};</script>`)
+
+	expected := `let name = "";
+let id = 0;
+let markup = "";
+wl.mount(document.body, function () {
+return [wl.h("a", {"href": wl.url(name) + "/users/" + wl.urlPart(id), "style": "width: " + wl.css(id) + "px"}, [], [wl.text(wl.str(name)), wl.raw(wl.str(markup))]), wl.h("script", {}, [], [wl.text("var id = "), wl.text(wl.js(id)), wl.text(";")])];
+});
+`
+	if got := pageScript(t, output); got != expected {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, got)
+	}
+}
+
+// pageScript returns the page script following the runtime
+func pageScript(t *testing.T, output string) string {
+	const start, end = "</script>\n<script>\n", "</script>\n</body>"
+	i, j := strings.Index(output, start), strings.Index(output, end)
+	if i < 0 || j < i {
+		t.Fatalf("page script not found in:\n%v", output)
+	}
+	return output[i+len(start) : j]
+}
+
+func TestPageComponents(t *testing.T) {
+	output := compilePage(t, `
+package p
+
+type Todo struct {
+	Title string
+}
+
+type TodoItem struct {
+	todo Todo
+	remove func()
+	editing bool
+}
+
+func (t TodoItem) edit() {
+	t.editing = true
+}
+
+type Card struct {
+	title string
+}
+
+var todos []Todo
+
+func removeTodo(todo Todo) {
+}
+`, `<body><Card title="Todos">{{for i, todo := range todos}}<TodoItem todo="{{todo}}" @remove="removeTodo(todo)"/>{{/for}}<placeholder id="footer">done</placeholder></Card></body>`,
+		component{"TodoItem", `<li @dblclick="edit">{{if editing}}<input>{{else}}{{todo.Title}}{{/if}}<button @click="remove">x</button></li>`},
+		component{"Card", `<h2>{{title}}</h2><placeholder></placeholder><placeholder id="footer">-</placeholder>`},
+	)
+
+	expected := `function Card$render($self, $slots, $key) {
+return [wl.h("h2", {}, [], [wl.text(wl.str($self.title))]), ($slots[""] || []), ($slots["footer"] || [wl.text("-")])];
+};
+function TodoItem$render($self, $slots, $key) {
+return [wl.h("li", {}, [wl.on("dblclick", "DblClick", {}, function () {
+$self.edit();
+})], [$self.editing ? [wl.h("input", {}, [], [])] : [wl.text(wl.str($self.todo.Title))], wl.h("button", {}, [wl.on("click", "Click", {}, function () {
+return $self.remove();
+})], [wl.text("x")])])];
+};
+function Todo$clone($v) {
+let $c = new Todo();
+$c.Title = $v.Title;
+return $c;
+};
+wl.mount(document.body, function () {
+return [wl.component("c1", Card, function ($c) {
+$c.title = "Todos";
+}, {"": [wl.each(todos, function (i, todo) {
+return [wl.component("c2" + ":" + i, TodoItem, function ($c) {
+$c.todo = Todo$clone(todo);
+$c.remove = function () {
+removeTodo(todo);
+};
+}, {}, TodoItem$render)];
+})], "footer": [wl.text("done")]}, Card$render)];
+});
+`
+	got := pageScript(t, output)
+	if i := strings.Index(got, "function Card$render"); i < 0 || got[i:] != expected {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, got)
+	}
+}
+
+// TestPageComponentKeys checks the key attribute of a component use in
+// a loop replaces the loop key in the key of its instances
+func TestPageComponentKeys(t *testing.T) {
+	output := compilePage(t, `
+package p
+
+type Todo struct {
+	ID int
+}
+
+type TodoItem struct {
+	todo Todo
+}
+
+var lists [][]Todo
+`, `<body>{{for i, todos := range lists}}{{for _, todo := range todos}}<TodoItem key="{{todo.ID}}" todo="{{todo}}"/>{{/for}}{{/for}}</body>`,
+		component{"TodoItem", `<li>{{todo.ID}}</li>`},
+	)
+
+	expected := `return [wl.component("c1" + ":" + i + ":" + todo.ID, TodoItem, function ($c) {`
+	if got := pageScript(t, output); !strings.Contains(got, expected) {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, got)
+	}
+}
+
+func TestPageFlow(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := flow.ParseFile(fset, "login.flow", `flow login
+
+state {
+	Email string
+	Tries int
+}
+
+start email
+
+step email "login/email" {
+	Next -> done
+}
+
+step done
+`)
+	if err != nil {
+		t.Fatalf("Error during flow parse: %v", err)
+	}
+	finfo, err := flow.Check(fset, f, map[string]bool{"login/email": true, "done": true})
+	if err != nil {
+		t.Fatalf("Error during flow check: %v", err)
+	}
+
+	output := compileSite(t, fset, []*flow.Info{finfo}, `
+package p
+
+import "flows/login"
+
+func next() {
+	login.Tries = login.Tries + 1
+	login.Next()
+}
+`, `<body><input @bind="login.Email"><button @click="next">next</button><button @click="login.Back">back</button></body>`)
+
+	expected := `const login = wl.flow({name: "login", start: "email", state: {Email: "", Tries: 0}, events: ["Next"], steps: {email: {page: "/login/email.html", on: {Next: "done"}}, done: {page: "/done.html", on: {}}}});
+function next() {
+login.Tries = wl.int(login.Tries + 1);
+login.Next();
+};
+`
+	if got := pageScript(t, output); !strings.HasPrefix(got, expected) {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, got)
+	}
+}
+
+// TestPageModules checks the script of a page importing a site package
+// is a module script importing the modules of the packages and flows
+// and the runtime module, rather than inlining them
+func TestPageModules(t *testing.T) {
+	fset := token.NewFileSet()
+	ff, err := flow.ParseFile(fset, "cart.flow", `flow cart
+
+state {
+	Count int
+}
+
+start items
+
+step items "index" {
+	Next -> items
+}
+`)
+	if err != nil {
+		t.Fatalf("Error during flow parse: %v", err)
+	}
+	finfo, err := flow.Check(fset, ff, map[string]bool{"index": true})
+	if err != nil {
+		t.Fatalf("Error during flow check: %v", err)
+	}
+	check := func(path, src string, imp types.Importer) (*types.Package, *types.Info, []*ast.File) {
+		f, err := parser.ParseFile(fset, path+".wl", src, 0)
+		if err != nil {
+			t.Fatalf("Error during parse: %v", err)
+		}
+		info := &types.Info{
+			Types:     make(map[ast.Expr]types.TypeAndValue),
+			Defs:      make(map[*ast.Ident]types.Object),
+			Uses:      make(map[*ast.Ident]types.Object),
+			Implicits: make(map[ast.Node]types.Object),
+		}
+		pkg, err := (&types.Config{Importer: imp}).Check(path, fset, []*ast.File{f}, info)
+		if err != nil {
+			t.Fatalf("Error During Type Check: %v", err)
+		}
+		return pkg, info, []*ast.File{f}
+	}
+	lib, _, _ := check("lib", `package lib
+
+func Double(n int) int {
+	return n * 2
+}`, importer.Default())
+	pkg, info, files := check("main", `package main
+
+import (
+	"flows/cart"
+	"lib"
+)
+
+func add() {
+	cart.Count = lib.Double(cart.Count)
+}`, importer.With(lib, finfo.Package))
+	tmpl, err := page.ParseFile(fset, "index.wlpage", `<body><button @click="add">{{cart.Count}}</button></body>`)
+	if err != nil {
+		t.Fatalf("Error during template parse: %v", err)
+	}
+	pinfo, err := page.Check(fset, pkg, info, tmpl)
+	if err != nil {
+		t.Fatalf("Error during template check: %v", err)
+	}
+	var out strings.Builder
+	if err := CompilePage(&out, fset, pkg, info, files, tmpl, pinfo, finfo); err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+
+	expected := `<body>
+<script type="module">
+import wl from "/wl.runtime.js";
+import cart from "/flows/cart.js";
+import * as lib from "/lib.js";
+
+
+function add() {
+cart.Count = lib.Double(cart.Count);
+};
+`
+	got := out.String()
+	if i := strings.Index(got, "<body>"); i < 0 || !strings.HasPrefix(got[i:], expected) {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, got)
+	}
+	if strings.Contains(got, "var wl =") || strings.Contains(got, "wl.flow(") {
+		t.Errorf("runtime or flow inlined in module script:\n%v", got)
+	}
+}
+
+func TestPageRouter(t *testing.T) {
+	output := compilePage(t, `
+package p
+
+import "router"
+
+type filter enum {
+	All = iota
+	Active
+}
+
+var curFilter = filter.All
+var page int
+
+var filters = router.Path("#/{curFilter}")
+var pages = router.Path("#/page/{page}")
+`, `<body><a href="#/active">Active</a><a href="{{routes.Pages(page + 1)}}">next</a></body>`)
+
+	expected := `const router = wl.pkgs.router;
+const filter = Object.freeze({
+All: { name: "All", value: 0 },
+Active: { name: "Active", value: 1 }
+});
+let curFilter = filter.All;
+let page = 0;
+let filters = router.Path("#/{curFilter}");
+let pages = router.Path("#/page/{page}");
+const routes = {Filters: function (curFilter) {
+return "#/" + wl.segment(curFilter);
+}, Pages: function (page) {
+return "#/page/" + wl.segment(page);
+}};
+wl.router([wl.route(true, [wl.param("enum", function ($v) {
+curFilter = $v;
+}, filter)]), wl.route(true, ["page", wl.param("int", function ($v) {
+page = $v;
+})])]);
+wl.mount(document.body, function () {
+return [wl.h("a", {"href": "#/active"}, [], [wl.text("Active")]), wl.h("a", {"href": wl.url(routes.Pages(wl.int(page + 1)))}, [], [wl.text("next")])];
+});
+`
+	if got := pageScript(t, output); got != expected {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, got)
+	}
+}
+
+// component is the name and template source of a component
+type component struct {
+	name, src string
+}
+
+func TestPageSourceMap(t *testing.T) {
+	m := sourcemap.New("index.html")
+	output := compileSiteConfig(t, token.NewFileSet(), &Config{SourceMap: m}, nil, `
+package p
+
+var count int
+
+func add() {
+	count = count + 1
+}
+`, `<body>
+<p>{{count}}</p>
+<button @click="add">+</button>
+</body>`)
+
+	script := pageScript(t, output)
+	if !strings.HasSuffix(script, "//# sourceMappingURL=index.html.map\n") {
+		t.Errorf("script should link to its map, got:\n%v", script)
+	}
+
+	// the script starts after <script>, with the newline
+	lines := strings.Split("\n"+script, "\n")
+	segs := decodeMappings(t, m.Mappings())
+	sources := m.Sources()
+	lookup := func(code string) string {
+		for i, line := range lines {
+			if col := strings.Index(line, code); col >= 0 && i < len(segs) {
+				for _, s := range segs[i] {
+					if s[0] == col {
+						return fmt.Sprintf("%s:%d:%d", sources[s[1]], s[2]+1, s[3]+1)
+					}
+				}
+				t.Errorf("no mapping at %q, line %d column %d", code, i, col)
+				return ""
+			}
+		}
+		t.Errorf("%q not found in script:\n%v", code, script)
+		return ""
+	}
+
+	for _, test := range []struct{ code, pos string }{
+		{"function add", "test.wl:6:1"},
+		{"count = wl.int(count + 1)", "test.wl:7:2"},
+		{"count + 1", "test.wl:7:10"},
+		{`wl.h("p"`, "test.wlpage:2:1"},
+		{`wl.text(wl.str(count))`, "test.wlpage:2:4"},
+		{`wl.on("click"`, "test.wlpage:3:9"},
+	} {
+		if got := lookup(test.code); got != test.pos {
+			t.Errorf("%q maps to %s, want %s", test.code, got, test.pos)
+		}
+	}
+}
+
+func TestPageMinifySourceMap(t *testing.T) {
+	m := sourcemap.New("index.html")
+	output := compileSiteConfig(t, token.NewFileSet(), &Config{Minify: true, SourceMap: m}, nil, `
+package p
+
+var count int
+
+func add(step int) {
+	count = count + step
+}
+`, `<body><button @click="add(2)">{{count}}</button></body>`)
+
+	script := pageScript(t, output)
+	want := `let count=0;function add(a){count=wl.int(count+a);};wl.mount(document.body,function(){return[wl.h("button",{},[wl.on("click","Click",{},function(){add(2);})],[wl.text(wl.str(count))])];});//# sourceMappingURL=index.html.map
+`
+	if script != want {
+		t.Fatalf("script wanted:\n%v\ngot:\n%v", want, script)
+	}
+
+	// the minified parameter maps back to its wl name
+	segs := decodeMappings(t, m.Mappings())
+	// the script is the second line, after the newline following <script>
+	col := strings.Index(script, "+a") + 1
+	found := false
+	for _, s := range segs[1] {
+		if s[0] == col {
+			found = true
+			if s[2] != 6 || s[3] != 17 {
+				t.Errorf("a maps to %d:%d, want 7:18", s[2]+1, s[3]+1)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no mapping for a at column %d in %s", col, m.Mappings())
+	}
+	for _, name := range mapNames(t, m) {
+		if name == "a" {
+			t.Errorf("names should be wl names, got %v", mapNames(t, m))
+		}
+	}
+}
+
+// mapNames returns the names of the source map m
+func TestPageMinifyRuntime(t *testing.T) {
+	output := compileSiteConfig(t, token.NewFileSet(), &Config{Minify: true}, nil, `
+package p
+
+var count int
+`, `<body>{{count}}</body>`)
+
+	i, j := strings.Index(output, "<script>\n"), strings.Index(output, "</script>\n<script>")
+	if i < 0 || j < i {
+		t.Fatalf("runtime not found in:\n%v", output)
+	}
+	runtime := output[i+len("<script>\n") : j]
+	if len(runtime) > len(pageRuntime)*3/4 {
+		t.Errorf("runtime of %d bytes not minified, %d bytes unminified", len(runtime), len(pageRuntime))
+	}
+	for _, line := range strings.Split(runtime, "\n") {
+		if strings.HasPrefix(line, "//") || strings.HasPrefix(line, "\t") {
+			t.Errorf("line %q left in minified runtime", line)
+		}
+	}
+}
+
+func TestMinifyRuntime(t *testing.T) {
+	tests := []struct{ src, want string }{
+		{"var a = 1; // one\nvar b = 2;\n", "var a=1;var b=2;\n"},
+		{"function f(x) {\n\t/* x */ return x - -1;\n}\n", "function f(x){return x- -1;}\n"},
+		{"x = \"a // b\" + 'c /* d */';\n", "x=\"a // b\"+'c /* d */';\n"},
+		{"return /[/\"]\\/|\\*\\//gi.test(s) ? a / b : c;\n", "return/[/\"]\\/|\\*\\//gi.test(s)?a/b:c;\n"},
+		{"if (a) {\n\tf()\n\tg()\n}\n", "if(a){f()\ng()}\n"},
+		{"var x = typeof y\nz++\n", "var x=typeof y\nz++\n"},
+	}
+	for _, test := range tests {
+		if got := minifyRuntime(test.src); got != test.want {
+			t.Errorf("minifyRuntime(%q) = %q, want %q", test.src, got, test.want)
+		}
+	}
+}
+
+// runJS runs script after the page runtime in node, returning what it
+// logs; the test is skipped where node isn't installed
+func runJS(t *testing.T, script string) string {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not found")
+	}
+	src := "var document = {}, window = {};\n" + runtimeFor(nil, nil) + script
+	out, err := exec.Command(node, "-e", src).CombinedOutput()
+	if err != nil {
+		t.Fatalf("node: %v\n%s", err, out)
+	}
+	return string(out)
+}
+
+func TestRuntimeURL(t *testing.T) {
+	tests := []struct{ url, want string }{
+		{"https://example.com/a?b#c", "https://example.com/a?b#c"},
+		{" /todos?done=1 ", "/todos?done=1"},
+		{"mailto:me@example.com", "mailto:me@example.com"},
+		{"page#x:y", "page#x:y"},
+		{"javascript:alert(1)", "#ZwlUnsafe"},
+		{"JavaScript:alert(1)", "#ZwlUnsafe"},
+		{"java\tscript:alert(1)", "#ZwlUnsafe"},
+		{"java\nscript:alert(1)", "#ZwlUnsafe"},
+		{"\x01javascript:alert(1)", "#ZwlUnsafe"},
+		{"java script:alert(1)", "#ZwlUnsafe"},
+		{"data:text/html,<p>", "#ZwlUnsafe"},
+	}
+	var script strings.Builder
+	for _, test := range tests {
+		data, _ := json.Marshal(test.url)
+		fmt.Fprintf(&script, "console.log(JSON.stringify(wl.url(%s)));\n", data)
+	}
+	got := strings.Split(strings.TrimSpace(runJS(t, script.String())), "\n")
+	if len(got) != len(tests) {
+		t.Fatalf("want %d results, got %q", len(tests), got)
+	}
+	for i, test := range tests {
+		if data, _ := json.Marshal(test.want); got[i] != string(data) {
+			t.Errorf("url(%q): want %s, got %s", test.url, data, got[i])
+		}
+	}
+}
+
+// TestRuntimeFlowStep checks flows find their current step by the full
+// path of the page
+func TestRuntimeFlowStep(t *testing.T) {
+	tests := []struct{ path, want string }{
+		{"/shop/cart.html", "/done.html"},
+		{"/shop/cart", "/done.html"},
+		{"/", "/shop/cart.html"},
+		{"/index.html", "/shop/cart.html"},
+		{"/old/shop/cart.html", "none"},
+		{"/shop/index.html", "none"},
+	}
+	script := `globalThis.sessionStorage = {getItem: function () { return null; }, setItem: function () {}};
+window.addEventListener = function () {};
+function next(path) {
+	globalThis.location = {pathname: path, replace: function () {}, assign: function (url) { console.log(url); }};
+	var f = wl.flow({name: "shop", start: "start", state: {}, events: ["Next"], steps: {
+		start: {page: "/index.html", on: {Next: "cart"}},
+		cart: {page: "/shop/cart.html", on: {Next: "done"}},
+		done: {page: "/done.html", on: {}}
+	}});
+	try {
+		f.Next();
+	} catch (e) {
+		console.log("none");
+	}
+}
+`
+	for _, test := range tests {
+		script += fmt.Sprintf("next(%q);\n", test.path)
+	}
+	got := strings.Split(strings.TrimSpace(runJS(t, script)), "\n")
+	if len(got) != len(tests) {
+		t.Fatalf("want %d results, got %q", len(tests), got)
+	}
+	for i, test := range tests {
+		if got[i] != test.want {
+			t.Errorf("Next at %s: want %s, got %s", test.path, test.want, got[i])
+		}
+	}
+}
+
+func TestRuntimeSrcset(t *testing.T) {
+	got := runJS(t, `console.log(wl.srcset("a.png 1x, javascript:alert(1) 2x,\t\x01javascript:x, /b.png"));`)
+	if want := "a.png 1x, #ZwlUnsafe 2x,\t#ZwlUnsafe, /b.png\n"; got != want {
+		t.Errorf("srcset: want %q, got %q", want, got)
+	}
+}
+
+func TestPageBigInts(t *testing.T) {
+	output := compileSiteConfig(t, token.NewFileSet(), &Config{Ints: BigInts}, nil, `
+package p
+
+var count int
+
+func add(by int) {
+	count += by * 2
+}
+`, `<body><button @click="add(1)">{{count / 3}}</button></body>`)
+
+	script := pageScript(t, output)
+	for _, want := range []string{
+		"wl.bigints();\nlet count = 0n;\n",
+		"count = wl.i64(count + wl.i64(by * 2n));\n",
+		"add(1n);",
+		"wl.str(wl.div(count, 3n))",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("want %s in script:\n%s", want, script)
+		}
+	}
+}
+
+func TestPagePrune(t *testing.T) {
+	report := &Report{}
+	output := compileSiteConfig(t, token.NewFileSet(), &Config{Prune: true, Report: report}, nil, `
+package p
+
+type square struct {
+	side int
+}
+
+func (s square) area() int {
+	return s.side * s.side
+}
+
+func (s square) name() string {
+	return "square"
+}
+
+var count int
+var unused int
+var link = "/about"
+var start = initial()
+
+func initial() int {
+	return 1
+}
+
+func total(s square) int {
+	return s.area() + count
+}
+
+func add() {
+	var sq square
+	count = total(sq)
+}
+
+func helper() int {
+	return unused
+}
+`, `<body><button @click="add">{{count}}</button><a href="{{link}}">x</a></body>`)
+
+	script := pageScript(t, output)
+	for _, want := range []string{"class square", "square.prototype.area", "function total", "function add", "let start = initial()", "function initial"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("want %s in script:\n%s", want, script)
+		}
+	}
+	for _, dropped := range []string{"square.prototype.name", "unused", "helper"} {
+		if strings.Contains(script, dropped) {
+			t.Errorf("%s should be dropped from script:\n%s", dropped, script)
+		}
+	}
+	for _, dropped := range []string{"function flow(", "function router(", "function each(", "flow: flow"} {
+		if strings.Contains(output, dropped) {
+			t.Errorf("runtime helper %s should be dropped", dropped)
+		}
+	}
+	if !strings.Contains(output, "function mount(") {
+		t.Errorf("runtime core was dropped")
+	}
+
+	var b strings.Builder
+	report.WriteTo(&b)
+	for _, want := range []string{
+		"kept type square: used by func add\n",
+		"kept method square.area: used by func total\n",
+		"kept var count: template binding at test.wlpage:1:28\n",
+		"kept var start: package init\n",
+		"kept func initial: used by var start\n",
+		"kept func add: event handler at test.wlpage:1:15\n",
+		"dropped method square.name\n",
+		"dropped var unused\n",
+		"dropped func helper\n",
+		"kept runtime url: used by the page script\n",
+		"dropped runtime flow\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("want %q in report:\n%s", want, b.String())
+		}
+	}
+}
+
+func mapNames(t *testing.T, m *sourcemap.Map) []string {
+	data, err := m.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct{ Names []string }
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v.Names
+}
+
+// decodeMappings decodes source map mappings into absolute segments of
+// generated column, source, line and column per generated line
+func decodeMappings(t *testing.T, mappings string) [][][4]int {
+	const digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+	var lines [][][4]int
+	var prev [4]int
+	for _, line := range strings.Split(mappings, ";") {
+		var segs [][4]int
+		prev[0] = 0
+		for _, seg := range strings.Split(line, ",") {
+			if seg == "" {
+				continue
+			}
+			var fields []int
+			v, shift := 0, uint(0)
+			for _, c := range seg {
+				d := strings.IndexRune(digits, c)
+				if d < 0 {
+					t.Fatalf("invalid mapping %q", seg)
+				}
+				v += (d & 31) << shift
+				shift += 5
+				if d&32 == 0 {
+					if v&1 != 0 {
+						fields = append(fields, -(v >> 1))
+					} else {
+						fields = append(fields, v>>1)
+					}
+					v, shift = 0, 0
+				}
+			}
+			for i := 0; i < 4 && i < len(fields); i++ {
+				prev[i] += fields[i]
+			}
+			segs = append(segs, prev)
+		}
+		lines = append(lines, segs)
+	}
+	return lines
+}
+
+func compilePage(t *testing.T, src, tmplSrc string, comps ...component) string {
+	return compileSite(t, token.NewFileSet(), nil, src, tmplSrc, comps...)
+}
+
+// compileSite compiles a page of a site with flows
+func compileSite(t *testing.T, fset *token.FileSet, flows []*flow.Info, src, tmplSrc string, comps ...component) string {
+	return compileSiteConfig(t, fset, &Config{}, flows, src, tmplSrc, comps...)
+}
+
+// compileSiteConfig compiles a page of a site with the configuration cfg
+func compileSiteConfig(t *testing.T, fset *token.FileSet, cfg *Config, flows []*flow.Info, src, tmplSrc string, comps ...component) string {
+	f, err := parser.ParseFile(fset, "test.wl", src, 0)
+	if err != nil {
+		t.Fatalf("Error during parse: %v", err)
+	}
+	files := []*ast.File{f}
+
+	var pkgs []*types.Package
+	for _, finfo := range flows {
+		pkgs = append(pkgs, finfo.Package)
+	}
+	conf := types.Config{Importer: importer.With(pkgs...)}
+	info := &types.Info{
+		Types:     make(map[ast.Expr]types.TypeAndValue),
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Implicits: make(map[ast.Node]types.Object),
+	}
+	pkg, err := conf.Check(f.Name.Name, fset, files, info)
+	if err != nil {
+		t.Fatalf("Error During Type Check: %v", err)
+	}
+
+	tmpl, err := page.ParseFile(fset, "test.wlpage", tmplSrc)
+	if err != nil {
+		t.Fatalf("Error during template parse: %v", err)
+	}
+	var pcomps []*page.Component
+	for _, comp := range comps {
+		ctmpl, err := page.ParseFile(fset, comp.name+".wlcomp", comp.src)
+		if err != nil {
+			t.Fatalf("Error during parse of %s: %v", comp.name, err)
+		}
+		pcomps = append(pcomps, &page.Component{Name: comp.name, Template: ctmpl})
+	}
+	pinfo, err := page.Check(fset, pkg, info, tmpl, pcomps...)
+	if err != nil {
+		t.Fatalf("Error during template check: %v", err)
+	}
+
+	var out strings.Builder
+	if err := cfg.CompilePage(&out, fset, pkg, info, files, tmpl, pinfo, flows...); err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	return out.String()
+}
@@ -0,0 +1,113 @@
+package jscompiler
+
+import (
+	"fmt"
+	"weblang/wl/ast"
+	"weblang/wl/jscompiler/jsast"
+	"weblang/wl/types"
+)
+
+// Functions with several results return them in an array, which the
+// assignments and declarations of the results destructure and calls
+// passing them on spread. Named results are variables declared on entry
+// to the function, which bare returns return. Functions deferring calls
+// assign the results of their return statements to their named results
+// and the finally block of their frame returns them, after the deferred
+// calls, which may change them, ran.
+
+// resultVars returns the javascript names of the named results of the
+// function being compiled, or nil if its results are unnamed. Blank
+// results are named by their index; $ can't occur in wl names.
+func (c *jsCompiler) resultVars() []string {
+	if c.results == nil || c.results.Len() == 0 || c.results.At(0).Name() == "" {
+		return nil
+	}
+	var names []string
+	for i := 0; i < c.results.Len(); i++ {
+		v := c.results.At(i)
+		if v.Name() == "_" {
+			names = append(names, fmt.Sprintf("$%d", i))
+		} else {
+			names = append(names, c.symbols.name(v))
+		}
+	}
+	return names
+}
+
+// declareResults returns the declarations of the named results of the
+// function being compiled, initialized to their zero values
+func (c *jsCompiler) declareResults() []jsast.Stmt {
+	var decls []jsast.Stmt
+	for i, name := range c.resultVars() {
+		decls = append(decls, &jsast.DeclStmt{Decl: &jsast.VarDecl{
+			Kind:  "let",
+			Name:  name,
+			Value: c.zeroValue(c.results.At(i).Type()),
+		}})
+	}
+	return decls
+}
+
+// resultsExpr returns the value a function returns results in: the one
+// result, or an array of them
+func resultsExpr(results []jsast.Expr) jsast.Expr {
+	if len(results) == 1 {
+		return results[0]
+	}
+	return &jsast.ArrayLiteral{Elts: results}
+}
+
+// namedResults returns the value returning the named results names
+func namedResults(names []string) jsast.Expr {
+	var results []jsast.Expr
+	for _, name := range names {
+		results = append(results, &jsast.Identifier{Name: name})
+	}
+	return resultsExpr(results)
+}
+
+// returnStmt converts the return statement n of the function being
+// compiled
+func (c *jsCompiler) returnStmt(n *ast.ReturnStmt) jsast.Stmt {
+	var value jsast.Expr // nil for bare returns
+	switch {
+	case len(n.Results) == 1 && isTuple(c.info.Types[n.Results[0]].Type):
+		// the array of results of a call
+		value = c.convertExpr(n.Results[0])
+	case len(n.Results) > 0:
+		var results []jsast.Expr
+		for i, x := range n.Results {
+			var to types.Type
+			if c.results != nil && i < c.results.Len() {
+				to = c.results.At(i).Type()
+			}
+			results = append(results, c.assign(x, to))
+		}
+		value = resultsExpr(results)
+	}
+
+	names := c.resultVars()
+	switch {
+	case names == nil:
+		return &jsast.ReturnStmt{Result: value}
+	case value == nil:
+		if c.deferring {
+			return &jsast.ReturnStmt{}
+		}
+		return &jsast.ReturnStmt{Result: namedResults(names)}
+	case !c.deferring:
+		return &jsast.ReturnStmt{Result: value}
+	}
+	// the frame returns the named results after the deferred calls
+	return &jsast.Placeholder{Children: []jsast.Node{
+		&jsast.AssignStmt{Lhs: namedResults(names), Op: "=", Rhs: value},
+		&jsast.ReturnStmt{},
+	}}
+}
+
+// isTuple reports whether t is the type of the results of a call with
+// several results
+func isTuple(t types.Type) bool {
+	_, ok := t.(*types.Tuple)
+	return ok
+}
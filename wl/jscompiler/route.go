@@ -0,0 +1,113 @@
+package jscompiler
+
+import (
+	"weblang/wl/jscompiler/jsast"
+	"weblang/wl/page"
+	"weblang/wl/types"
+)
+
+// runtimePackages are the builtin packages with a runtime part, which
+// pages importing them declare as wl.pkgs.name
+var runtimePackages = map[string]bool{
+	"http":             true,
+	page.RouterPackage: true,
+}
+
+// packageDecls declares the runtime parts of the builtin packages pkg
+// imports under their bindings
+func (c *jsCompiler) packageDecls(pkg *types.Package) []jsast.Decl {
+	var decls []jsast.Decl
+	for _, imp := range pkg.Imports() {
+		if runtimePackages[imp.Path()] && c.live.keepsPackage(imp) {
+			decls = append(decls, &jsast.VarDecl{
+				Kind: "const",
+				Name: c.symbols.imports[imp],
+				Value: &jsast.SelectorExpr{
+					X:   &jsast.SelectorExpr{X: &jsast.Identifier{Name: "wl"}, Sel: "pkgs"},
+					Sel: imp.Path(),
+				},
+			})
+		}
+	}
+	return decls
+}
+
+// routes returns the routes object whose functions build the URLs of
+// the page's routes, and the statement registering the routes with the
+// runtime, or nils if the page has no routes
+func (pc *pageCompiler) routes() (jsast.Decl, jsast.Stmt) {
+	if len(pc.info.Routes) == 0 {
+		return nil, nil
+	}
+
+	urls := &jsast.ObjectLiteral{}
+	list := &jsast.ArrayLiteral{}
+	for _, r := range pc.info.Routes {
+		prefix := "/"
+		if r.Hash {
+			prefix = "#/"
+		}
+
+		// literal text of the URL is joined into single strings
+		var url jsast.Expr
+		lit := prefix
+		fn := &jsast.FunctionLiteral{}
+		segs := &jsast.ArrayLiteral{}
+		for i, s := range r.Segments {
+			if i > 0 {
+				lit += "/"
+			}
+			if s.Param == nil {
+				lit += s.Literal
+				segs.Elts = append(segs.Elts, stringLit(s.Literal))
+				continue
+			}
+
+			name := pc.symbols.name(s.Param)
+			fn.Params = append(fn.Params, name)
+			url = concat(url, stringLit(lit))
+			url = concat(url, runtimeCall("segment", &jsast.Identifier{Name: name}))
+			lit = ""
+
+			// $v can't collide with wl identifiers
+			set := &jsast.FunctionLiteral{
+				Params: []string{"$v"},
+				Body: []jsast.Stmt{&jsast.AssignStmt{
+					Lhs: pc.objectRef(s.Param),
+					Op:  "=",
+					Rhs: &jsast.Identifier{Name: "$v"},
+				}},
+			}
+			args := []jsast.Expr{stringLit(s.Convert), set}
+			if s.Convert == "enum" {
+				args = append(args, pc.objectRef(s.Param.Type().(*types.Named).Obj()))
+			}
+			segs.Elts = append(segs.Elts, runtimeCall("param", args...))
+		}
+		if lit != "" || url == nil {
+			url = concat(url, stringLit(lit))
+		}
+		fn.Body = []jsast.Stmt{&jsast.ReturnStmt{Result: url}}
+
+		urls.Props = append(urls.Props, &jsast.Property{Key: pc.symbols.name(r.URL), Value: fn})
+		list.Elts = append(list.Elts, runtimeCall("route", &jsast.Identifier{Name: jsBool(r.Hash)}, segs))
+	}
+
+	decl := &jsast.VarDecl{Kind: "const", Name: page.RoutesName, Value: urls}
+	return decl, &jsast.ExprStmt{Exp: runtimeCall("router", list)}
+}
+
+// concat returns x + y, or y if x is nil
+func concat(x, y jsast.Expr) jsast.Expr {
+	if x == nil {
+		return y
+	}
+	return &jsast.BinaryExpression{Lhs: x, Op: "+", Rhs: y}
+}
+
+func jsBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
@@ -0,0 +1,1146 @@
+package jscompiler
+
+import "strings"
+
+// pageRuntime is the javascript support library included in every
+// compiled page. Render functions generated by CompilePage return a
+// tree of virtual nodes built with wl.h and wl.text; the runtime
+// patches the document to match after every event handler runs.
+//
+// The helpers between a "//wl:helper names" line and a "//wl:end" line
+// are only needed by pages using one of the exports named; runtimeFor
+// leaves out those a page doesn't use.
+const pageRuntime = `var wl = (function () {
+"use strict";
+var root = null, render = null, reset = null, current = [], updating = false;
+
+// toInt converts the ints the runtime hands to compiled code, which are
+// numbers unless the page represents ints as BigInts
+var intType = Number;
+
+function toInt(v) {
+	return intType(Math.trunc(Number(v)));
+}
+
+//wl:helper bigints
+function bigints() {
+	intType = BigInt;
+}
+//wl:end
+
+// integer arithmetic of compiled code: division and remainder truncate
+// and panic on zero, other results are checked to be exact numbers, or
+// wrapped to 64 bits for BigInts
+//wl:helper div
+function div(a, b) {
+	if (b == 0) {
+		throw new Error("integer divide by zero");
+	}
+	return typeof a === "bigint" ? BigInt.asIntN(64, a / b) : Math.trunc(a / b) + 0;
+}
+//wl:end
+//wl:helper rem
+function rem(a, b) {
+	if (b == 0) {
+		throw new Error("integer divide by zero");
+	}
+	return typeof a === "bigint" ? a % b : a % b + 0;
+}
+//wl:end
+//wl:helper int
+function int(v) {
+	if (!Number.isSafeInteger(v)) {
+		throw new Error("integer overflow");
+	}
+	return v;
+}
+//wl:end
+//wl:helper i64
+function i64(v) {
+	return BigInt.asIntN(64, v);
+}
+//wl:end
+
+// bitwise operations of compiled code work on 64 bit two's complement
+// ints like wl's, through BigInts as javascript's operators truncate
+// numbers to 32 bits. Shift counts are constants the checker keeps from
+// being negative.
+//wl:helper shl shr and or xor not
+function bitwise(a, r) {
+	r = BigInt.asIntN(64, r);
+	if (typeof a === "bigint") {
+		return r;
+	}
+	var v = Number(r);
+	if (!Number.isSafeInteger(v)) {
+		throw new Error("integer overflow");
+	}
+	return v;
+}
+function shift(b) {
+	return BigInt(b < 64 ? b : 64);
+}
+function shl(a, b) {
+	return bitwise(a, BigInt(a) << shift(b));
+}
+function shr(a, b) {
+	return bitwise(a, BigInt(a) >> shift(b));
+}
+function and(a, b) {
+	return bitwise(a, BigInt(a) & BigInt(b));
+}
+function or(a, b) {
+	return bitwise(a, BigInt(a) | BigInt(b));
+}
+function xor(a, b) {
+	return bitwise(a, BigInt(a) ^ BigInt(b));
+}
+function not(a) {
+	return bitwise(a, ~BigInt(a));
+}
+//wl:end
+
+// the builtins working on slices, which are arrays. append returns a
+// new array of the elements of s and xs, copied by copy if they are
+// structs.
+//wl:helper append make
+function append(copy, s, xs) {
+	var out = s == null ? [] : s.slice();
+	if (xs != null) {
+		out.push.apply(out, xs);
+	}
+	return copy ? out.map(copy) : out;
+}
+
+function make(zero, n, c) {
+	n = Number(n);
+	if (n < 0) {
+		throw new Error("makeslice: len out of range");
+	}
+	if (c !== undefined && Number(c) < n) {
+		throw new Error("makeslice: cap out of range");
+	}
+	var out = [];
+	for (var i = 0; i < n; i++) {
+		out.push(zero());
+	}
+	return out;
+}
+//wl:end
+
+// print and println write to the console, which ends every line
+//wl:helper print println
+function print() {
+	console.log(Array.prototype.map.call(arguments, str).join(""));
+}
+
+function println() {
+	console.log(Array.prototype.map.call(arguments, str).join(" "));
+}
+//wl:end
+
+// interface values are null for nil, or boxes holding a value and the
+// descriptor of its dynamic type; assertions panic like Go's
+//wl:helper box
+function box(t, v) {
+	return {$type: t, $value: v};
+}
+//wl:end
+//wl:helper is assert assertOk
+function missingMethod(t, iface) {
+	for (var i = 0; i < iface.methods.length; i++) {
+		if (t.methods.indexOf(iface.methods[i]) < 0) {
+			return iface.methods[i];
+		}
+	}
+	return "";
+}
+
+function is(x, t) {
+	if (x === null) {
+		return false;
+	}
+	return t.kind === "interface" ? missingMethod(x.$type, t) === "" : x.$type.id === t.id;
+}
+
+function assert(x, t, from) {
+	if (is(x, t)) {
+		return t.kind === "interface" ? x : x.$value;
+	}
+	if (x === null) {
+		throw new Error("interface conversion: " + from + " is nil, not " + t.id);
+	}
+	if (t.kind === "interface") {
+		throw new Error("interface conversion: " + x.$type.id + " is not " + t.id + ": missing method " + missingMethod(x.$type, t));
+	}
+	throw new Error("interface conversion: " + from + " is " + x.$type.id + ", not " + t.id);
+}
+
+function assertOk(x, t, zero) {
+	if (is(x, t)) {
+		return [t.kind === "interface" ? x : x.$value, true];
+	}
+	return [zero, false];
+}
+//wl:end
+//wl:helper same
+function same(x, y) {
+	if (x === null || y === null) {
+		return x === y;
+	}
+	if (x.$type.id !== y.$type.id) {
+		return false;
+	}
+	if (!x.$type.comparable) {
+		throw new Error("runtime error: comparing uncomparable type " + x.$type.id);
+	}
+	return x.$type.equal ? x.$type.equal(x.$value, y.$value) : x.$value === y.$value;
+}
+//wl:end
+
+// panics are errors holding the boxed value passed to panic, with the
+// stack of the functions they unwind. Functions deferring calls run
+// them from their frame when they return or panic; a deferred call
+// recovers the panic through the frame unwind hands it.
+//wl:helper panic recover frame defer catcher panicked unwind unwindAsync recoverable
+var runtimeError = {id: "runtime.Error", name: "Error", pkg: "runtime", kind: "struct", comparable: true, fields: [], methods: ["Error"]};
+var deferred = null;
+
+// panicText formats the panic value v like Go prints it
+function panicText(v) {
+	if (v === null) {
+		return "nil";
+	}
+	var t = v.$type, x = v.$value;
+	if (t.methods.indexOf("Error") >= 0) {
+		return x.Error();
+	}
+	if (t.methods.indexOf("String") >= 0) {
+		return x.String();
+	}
+	switch (t.kind) {
+	case "struct": case "interface": case "slice": case "map": case "func":
+		return "(" + t.id + ")";
+	case "enum":
+		return t.id + "(" + x.name + ")";
+	}
+	if (t.name === "") {
+		return String(x);
+	}
+	return t.id + "(" + (t.kind === "string" ? JSON.stringify(x) : String(x)) + ")";
+}
+
+// stack returns the frames of the javascript stack s, which source
+// maps resolve to the wl functions, leaving out the first skip
+function stack(s, skip) {
+	var frames = String(s || "").split("\n").filter(function (line) {
+		return /^\s+at |@/.test(line);
+	});
+	return frames.slice(skip).map(function (line) {
+		return "\t" + line.trim();
+	}).join("\n");
+}
+
+function newPanic(value, s, skip) {
+	var e = new Error("panic: " + panicText(value));
+	e.wlPanic = true;
+	e.value = value;
+	e.stack = e.message + "\n\n" + stack(s, skip);
+	return e;
+}
+
+// toPanic returns the panic of the exception e; errors thrown by
+// javascript and the runtime panic with an error holding their message
+function toPanic(e) {
+	if (e && e.wlPanic) {
+		return e;
+	}
+	var msg = e instanceof Error ? e.message : String(e);
+	var err = {Error: function () { return msg; }};
+	return newPanic({$type: runtimeError, $value: err}, e && e.stack, 0);
+}
+
+function panic(v) {
+	// the first frame is this function
+	throw newPanic(v, new Error().stack, 1);
+}
+
+function frame() {
+	return {defers: [], panic: null};
+}
+
+function defer(f, recv, fn, args) {
+	f.defers.push({recv: recv, fn: typeof fn === "string" ? recv[fn] : fn, args: args});
+}
+
+// catcher pushes the handler fn of a catch statement onto f, recovering
+// the panics whose value handles reports true for
+function catcher(f, fn, handles) {
+	f.defers.push({recv: null, fn: function () {
+		if (f.panic !== null && handles(f.panic.value)) {
+			var v = f.panic.value;
+			f.panic = null;
+			return fn(v);
+		}
+	}, args: []});
+}
+
+function panicked(f, e) {
+	f.panic = toPanic(e);
+}
+
+// unwind runs the deferred calls of f, then throws its panic if none
+// recovered it. A panic in a deferred call replaces the one unwinding.
+function unwind(f) {
+	var saved = deferred;
+	while (f.defers.length > 0) {
+		var d = f.defers.pop();
+		deferred = {frame: f, fn: d.fn};
+		try {
+			d.fn.apply(d.recv, d.args);
+		} catch (e) {
+			f.panic = toPanic(e);
+		}
+	}
+	deferred = saved;
+	if (f.panic !== null) {
+		throw f.panic;
+	}
+}
+
+// unwindAsync is unwind for async functions, waiting for each deferred
+// call, which may be async
+async function unwindAsync(f) {
+	while (f.defers.length > 0) {
+		var d = f.defers.pop();
+		var saved = deferred;
+		deferred = {frame: f, fn: d.fn};
+		try {
+			var done = d.fn.apply(d.recv, d.args);
+			// other calls may start while waiting
+			deferred = saved;
+			await done;
+		} catch (e) {
+			f.panic = toPanic(e);
+		}
+		deferred = saved;
+	}
+	if (f.panic !== null) {
+		throw f.panic;
+	}
+}
+
+// recoverable returns the frame of the deferred call of fn starting,
+// or null if fn wasn't called as one
+function recoverable(fn) {
+	var d = deferred;
+	deferred = null;
+	return d !== null && d.fn === fn ? d.frame : null;
+}
+
+function recover(f) {
+	if (f === null || f.panic === null) {
+		return null;
+	}
+	var v = f.panic.value;
+	f.panic = null;
+	return v;
+}
+//wl:end
+
+function flatten(list, out) {
+	for (var i = 0; i < list.length; i++) {
+		if (Array.isArray(list[i])) {
+			flatten(list[i], out);
+		} else if (list[i] != null) {
+			out.push(list[i]);
+		}
+	}
+	return out;
+}
+
+function h(tag, attrs, on, children, ref) {
+	return {tag: tag, attrs: attrs, on: flatten(on, []), children: flatten(children, []), ref: ref || null};
+}
+
+function text(s) {
+	return {text: s};
+}
+
+function str(v) {
+	return v == null ? "" : String(v);
+}
+
+//wl:helper raw
+function raw(s) {
+	return {raw: s};
+}
+//wl:end
+
+// escapers for the contexts actions are output in; text and attribute
+// values are safe as the DOM is built without parsing markup
+//wl:helper url srcset
+function url(v) {
+	var s = str(v).trim();
+	// the URL parser drops tabs, newlines and leading controls, so the
+	// scheme is what comes before the first : of s without them, unless
+	// a /, ? or # comes first
+	var scheme = /^([^\/?#]*):/.exec(s.replace(/[\u0000-\u0020]/g, ""));
+	if (scheme && ["http", "https", "mailto", "tel"].indexOf(scheme[1].toLowerCase()) < 0) {
+		return "#ZwlUnsafe";
+	}
+	return s;
+}
+
+// srcset filters the URL of each of the comma separated image
+// candidates of v, keeping their descriptors
+function srcset(v) {
+	return str(v).split(",").map(function (c) {
+		var m = /^(\s*)(\S*)([^]*)$/.exec(c);
+		return m[1] + (m[2] && url(m[2])) + m[3];
+	}).join(",");
+}
+//wl:end
+
+//wl:helper urlPart
+function urlPart(v) {
+	return encodeURIComponent(str(v));
+}
+//wl:end
+
+//wl:helper css
+function css(v) {
+	var s = str(v);
+	if (/[<>"'\\;{}]|\/\*|\*\/|expression|url\(|javascript/i.test(s)) {
+		return "ZwlUnsafe";
+	}
+	return s;
+}
+//wl:end
+
+//wl:helper js
+function js(v) {
+	var s = JSON.stringify(v === undefined ? null : v, function (k, x) {
+		return typeof x === "bigint" ? Number(x) : x;
+	});
+	return s.replace(/</g, "\\u003c").replace(/\u2028/g, "\\u2028").replace(/\u2029/g, "\\u2029");
+}
+//wl:end
+
+//wl:helper attrs
+function attrs() {
+	var out = {};
+	for (var i = 0; i < arguments.length; i++) {
+		for (var k in arguments[i]) {
+			out[k] = arguments[i][k];
+		}
+	}
+	return out;
+}
+//wl:end
+
+//wl:helper each
+function each(list, fn) {
+	var out = [];
+	if (list == null) {
+		return out;
+	}
+	if (Array.isArray(list)) {
+		for (var i = 0; i < list.length; i++) {
+			out.push(fn(toInt(i), list[i]));
+		}
+	} else {
+		for (var k in list) {
+			out.push(fn(k, list[k]));
+		}
+	}
+	return out;
+}
+//wl:end
+
+// range lists the key and value pairs range loops iterate over: the
+// indices and elements of arrays, the byte offsets and characters of
+// strings, and the entries of maps, whose keys are strings unless
+// intKeys converts them back to ints
+//wl:helper range
+function range(x, intKeys) {
+	var out = [];
+	if (x == null) {
+		return out;
+	}
+	if (typeof x === "string") {
+		var offset = 0;
+		for (var ch of x) {
+			out.push([toInt(offset), ch]);
+			var c = ch.codePointAt(0);
+			offset += c < 0x80 ? 1 : c < 0x800 ? 2 : c < 0x10000 ? 3 : 4;
+		}
+	} else if (Array.isArray(x)) {
+		for (var i = 0; i < x.length; i++) {
+			out.push([toInt(i), x[i]]);
+		}
+	} else {
+		for (var k in x) {
+			out.push([intKeys ? toInt(k) : k, x[k]]);
+		}
+	}
+	return out;
+}
+//wl:end
+
+// event objects passed to handlers, keyed by events type name
+function mouse(e) {
+	return {X: toInt(e.clientX), Y: toInt(e.clientY), Button: toInt(e.button), AltKey: e.altKey, CtrlKey: e.ctrlKey, ShiftKey: e.shiftKey, MetaKey: e.metaKey};
+}
+function key(e) {
+	return {Key: e.key, Code: e.code, AltKey: e.altKey, CtrlKey: e.ctrlKey, ShiftKey: e.shiftKey, MetaKey: e.metaKey, Repeat: e.repeat};
+}
+function value(e) {
+	return {Value: e.target.value};
+}
+function empty(e) {
+	return {};
+}
+var eventTypes = {
+	Click: mouse, DblClick: mouse, MouseEnter: mouse, MouseLeave: mouse,
+	KeyUp: key, KeyDown: key, KeyPress: key,
+	Input: value, Change: value,
+	Checked: function (e) { return {Checked: !!e.target.checked}; },
+	Focus: empty, Blur: empty, Submit: empty
+};
+
+function on(type, kind, opts, fn) {
+	return {type: type, kind: kind, keys: opts.keys || null, prevent: !!opts.prevent, stop: !!opts.stop, once: !!opts.once, fn: fn};
+}
+
+//wl:helper conv
+// conversions between element properties and bound values; parse
+// returns undefined for input that doesn't convert, leaving the bound
+// value unchanged
+var conv = {
+	string: {parse: function (s) { return s; }, format: function (v) { return v; }},
+	int: {
+		parse: function (s) { return /^\s*[+-]?\d+\s*$/.test(s) ? toInt(s) : undefined; },
+		format: String
+	},
+	float: {
+		parse: function (s) { return s.trim() !== "" && isFinite(Number(s)) ? Number(s) : undefined; },
+		format: String
+	},
+	bool: {
+		parse: function (s) { return s === "true" ? true : s === "false" ? false : undefined; },
+		format: String
+	},
+	checked: {parse: function (b) { return !!b; }, format: function (v) { return !!v; }},
+	enum: function (e) {
+		return {
+			parse: function (s) { return Object.prototype.hasOwnProperty.call(e, s) ? e[s] : undefined; },
+			format: function (v) { return v.name; }
+		};
+	}
+};
+//wl:end
+
+//wl:helper bind
+// bind is a two-way binding between the element property prop and a
+// value read with get and written with set
+function bind(prop, type, c, get, set) {
+	return {type: type, bind: true, prop: prop, conv: c, get: get, set: set};
+}
+//wl:end
+
+// setBindings writes bound values to el where they differ from what
+// the element holds
+function setBindings(el, handlers) {
+	for (var i = 0; i < handlers.length; i++) {
+		var hd = handlers[i];
+		if (hd.bind) {
+			var v = hd.get();
+			if (hd.conv.parse(el[hd.prop]) !== v) {
+				el[hd.prop] = hd.conv.format(v);
+			}
+		}
+	}
+}
+
+// dispatch runs the handlers bound on el for the DOM event e
+function dispatch(el, e) {
+	var handlers = el.__wlOn;
+	for (var i = 0; i < handlers.length; i++) {
+		var hd = handlers[i];
+		if (hd.type !== e.type || (hd.keys && hd.keys.indexOf(e.key) < 0)) {
+			continue;
+		}
+		if (hd.bind) {
+			var v = hd.conv.parse(el[hd.prop]);
+			if (v !== undefined) {
+				hd.set(v);
+			}
+			continue;
+		}
+		if (hd.once) {
+			var id = hd.type + ":" + i;
+			if (el.__wlFired[id]) {
+				continue;
+			}
+			el.__wlFired[id] = true;
+		}
+		if (hd.prevent) {
+			e.preventDefault();
+		}
+		if (hd.stop) {
+			e.stopPropagation();
+		}
+		var done = hd.fn(eventTypes[hd.kind](e));
+		if (done && typeof done.then === "function") {
+			// an async handler, the page changes again when it is done
+			done.then(update, function (err) {
+				update();
+				throw err;
+			});
+		}
+	}
+	update();
+}
+
+function setHandlers(el, handlers) {
+	if (!el.__wlOn) {
+		el.__wlOn = [];
+		el.__wlFired = {};
+		el.__wlTypes = {};
+	}
+	el.__wlOn = handlers;
+	for (var i = 0; i < handlers.length; i++) {
+		var type = handlers[i].type;
+		if (!el.__wlTypes[type]) {
+			el.__wlTypes[type] = true;
+			el.addEventListener(type, function (e) { dispatch(el, e); });
+		}
+	}
+}
+
+// element references handed to page variables, keyed by html field name
+var elementProps = {
+	Hidden: "hidden", Value: "value", Checked: "checked", Disabled: "disabled",
+	Placeholder: "placeholder", Href: "href"
+};
+
+function wrap(el) {
+	if (!el.__wlRef) {
+		var r = {};
+		Object.keys(elementProps).forEach(function (f) {
+			Object.defineProperty(r, f, {
+				get: function () { return el[elementProps[f]]; },
+				set: function (v) { el[elementProps[f]] = v; }
+			});
+		});
+		el.__wlRef = r;
+	}
+	return el.__wlRef;
+}
+
+// bindRefs hands the rendered elements to the variables referencing them
+function bindRefs(list) {
+	for (var i = 0; i < list.length; i++) {
+		var v = list[i];
+		if (v.tag === undefined) {
+			continue;
+		}
+		if (v.ref) {
+			v.ref(wrap(v.el));
+		}
+		bindRefs(v.children);
+	}
+}
+
+function setAttrs(el, old, attrs) {
+	for (var k in old) {
+		if (!(k in attrs)) {
+			el.removeAttribute(k);
+		}
+	}
+	for (var k in attrs) {
+		if (old[k] !== attrs[k]) {
+			el.setAttribute(k, attrs[k]);
+		}
+	}
+}
+
+function create(v) {
+	if (v.raw !== undefined) {
+		// trusted markup, kept as the list of nodes it parses to
+		var t = document.createElement("template");
+		t.innerHTML = v.raw;
+		if (!t.content.firstChild) {
+			t.content.appendChild(document.createTextNode(""));
+		}
+		v.nodes = Array.prototype.slice.call(t.content.childNodes);
+		return t.content;
+	}
+	if (v.tag === undefined) {
+		return v.el = document.createTextNode(v.text);
+	}
+	var el = v.el = document.createElement(v.tag);
+	setAttrs(el, {}, v.attrs);
+	setHandlers(el, v.on);
+	for (var i = 0; i < v.children.length; i++) {
+		el.appendChild(create(v.children[i]));
+	}
+	setBindings(el, v.on);
+	return el;
+}
+
+// domNodes returns the document nodes rendered for v
+function domNodes(v) {
+	return v.nodes || [v.el];
+}
+
+function remove(parent, v) {
+	var nodes = domNodes(v);
+	for (var i = 0; i < nodes.length; i++) {
+		parent.removeChild(nodes[i]);
+	}
+}
+
+function patch(parent, olds, news) {
+	var last = null, i;
+	for (i = 0; i < news.length; i++) {
+		var o = olds[i], n = news[i];
+		if (!o) {
+			parent.insertBefore(create(n), last ? last.nextSibling : null);
+		} else if (o.tag !== n.tag || (o.raw !== undefined) !== (n.raw !== undefined)) {
+			parent.insertBefore(create(n), domNodes(o)[0]);
+			remove(parent, o);
+		} else if (n.raw !== undefined) {
+			if (o.raw === n.raw) {
+				n.nodes = o.nodes;
+			} else {
+				parent.insertBefore(create(n), o.nodes[0]);
+				remove(parent, o);
+			}
+		} else if (n.tag === undefined) {
+			n.el = o.el;
+			if (o.text !== n.text) {
+				n.el.nodeValue = n.text;
+			}
+		} else {
+			n.el = o.el;
+			setAttrs(n.el, o.attrs, n.attrs);
+			setHandlers(n.el, n.on);
+			patch(n.el, o.children, n.children);
+			setBindings(n.el, n.on);
+		}
+		var nodes = domNodes(n);
+		last = nodes[nodes.length - 1];
+	}
+	for (; i < olds.length; i++) {
+		remove(parent, olds[i]);
+	}
+}
+
+//wl:helper flow
+// flow returns the object of a multi-page flow, holding its state and a
+// function for each event. The state is kept in session storage while
+// the flow moves between the pages of its steps, so the browser's own
+// history moves back and forward through the steps visited.
+function flow(def) {
+	var storeKey = "wl.flow." + def.name;
+	var saved = null;
+	try {
+		saved = JSON.parse(sessionStorage.getItem(storeKey));
+	} catch (e) {
+	}
+
+	var f = {};
+	Object.keys(def.state).forEach(function (k) {
+		f[k] = saved && Object.prototype.hasOwnProperty.call(saved, k) ? saved[k] : def.state[k];
+		if (typeof def.state[k] === "bigint") {
+			// BigInts are saved as strings
+			f[k] = BigInt(f[k]);
+		}
+	});
+	function save() {
+		var s = {};
+		Object.keys(def.state).forEach(function (k) {
+			s[k] = f[k];
+		});
+		sessionStorage.setItem(storeKey, JSON.stringify(s, function (k, x) {
+			return typeof x === "bigint" ? String(x) : x;
+		}));
+	}
+
+	// the current step is the one whose page is at the path, which the
+	// server may serve without .html, or index pages at their directory
+	var step = null, path = location.pathname;
+	Object.keys(def.steps).forEach(function (name) {
+		var page = def.steps[name].page;
+		if (page === path || page === path + ".html" || page === path + "index.html") {
+			step = name;
+		}
+	});
+	if (step !== null && step !== def.start && !saved) {
+		// entered the middle of the flow without its state
+		location.replace(def.steps[def.start].page);
+	}
+
+	def.events.forEach(function (ev) {
+		f[ev] = function () {
+			var to = step !== null && def.steps[step].on[ev];
+			if (!to) {
+				throw new Error("flow " + def.name + ": no transition for " + ev + " from step " + step);
+			}
+			save();
+			location.assign(def.steps[to].page);
+		};
+	});
+	f.Back = function () {
+		save();
+		history.back();
+	};
+	f.Forward = function () {
+		save();
+		history.forward();
+	};
+	window.addEventListener("pagehide", save);
+	return f;
+}
+//wl:end
+
+//wl:helper route param router
+// routes bind page variables to the segments of location.hash, for
+// "#/" patterns, or of location.pathname
+var routes = [];
+
+function route(hash, segments) {
+	return {hash: hash, segments: segments};
+}
+
+function param(kind, set, e) {
+	return {kind: kind, set: set, e: e || null};
+}
+
+// segment parsers return undefined for segments that don't convert
+var segments = {
+	int: function (s) { return /^[+-]?\d+$/.test(s) ? toInt(s) : undefined; },
+	string: function (s) { return s === "" ? undefined : s; },
+	enum: function (s, e) {
+		var found;
+		Object.keys(e).forEach(function (k) {
+			if (k.toLowerCase() === s.toLowerCase()) {
+				found = e[k];
+			}
+		});
+		return found;
+	}
+};
+
+// matchRoutes sets the variables of the first route matching the
+// location, reporting whether there was one
+function matchRoutes() {
+	for (var i = 0; i < routes.length; i++) {
+		var r = routes[i];
+		var path = r.hash ? location.hash.replace(/^#\/?/, "") : location.pathname.replace(/^\//, "");
+		var parts = path === "" ? [] : path.split("/");
+		if (parts.length !== r.segments.length) {
+			continue;
+		}
+		var values = [], ok = true;
+		for (var j = 0; j < parts.length && ok; j++) {
+			var s = r.segments[j], part;
+			try {
+				part = decodeURIComponent(parts[j]);
+			} catch (e) {
+				ok = false;
+				break;
+			}
+			if (typeof s === "string") {
+				ok = part === s;
+				continue;
+			}
+			var v = segments[s.kind](part, s.e);
+			if (v === undefined) {
+				ok = false;
+			} else {
+				values.push([s, v]);
+			}
+		}
+		if (ok) {
+			values.forEach(function (p) {
+				p[0].set(p[1]);
+			});
+			return true;
+		}
+	}
+	return false;
+}
+//wl:end
+
+//wl:helper segment
+// segment formats a value for a URL built by a route; enum members use
+// their lower case name
+function segment(v) {
+	if (v !== null && typeof v === "object" && typeof v.name === "string") {
+		return v.name.toLowerCase();
+	}
+	return encodeURIComponent(String(v));
+}
+//wl:end
+
+//wl:helper pkgs
+// pkgs are the runtime parts of the builtin packages, declared by pages
+// importing them. Requests are async: they return a promise of the
+// response, rejected if the server can't be reached.
+function request(url, init) {
+	return fetch(url, init).then(function (r) {
+		return r.text().then(function (body) {
+			return {Status: toInt(r.status), Body: body};
+		});
+	}, function (e) {
+		throw new Error("http: " + e.message);
+	});
+}
+
+var pkgs = {
+	http: {
+		Get: function (url) { return request(url, {}); },
+		Post: function (url, contentType, body) {
+			return request(url, {method: "POST", headers: {"Content-Type": contentType}, body: body});
+		}
+	},
+	router: {Path: function (pattern) { return {Pattern: pattern}; }}
+};
+//wl:end
+
+//wl:helper router
+function router(list) {
+	routes = list;
+	matchRoutes();
+	function changed() {
+		if (matchRoutes()) {
+			update();
+		}
+	}
+	window.addEventListener("hashchange", changed);
+	window.addEventListener("popstate", changed);
+}
+//wl:end
+
+// component instances by key; each render keeps the instances it uses,
+// so an instance and its state live as long as its use site renders
+var instances = {}, nextInstances = {};
+
+//wl:helper component
+function component(key, ctor, props, slots, fn) {
+	var self = Object.prototype.hasOwnProperty.call(instances, key) ? instances[key] : new ctor();
+	nextInstances[key] = self;
+	props(self);
+	return fn(self, slots, key);
+}
+//wl:end
+
+// update re-renders the page and patches the document to match
+function update() {
+	if (updating || !render) {
+		return;
+	}
+	updating = true;
+	try {
+		nextInstances = {};
+		var next = flatten(render(), []);
+		instances = nextInstances;
+		patch(root, current, next);
+		current = next;
+		if (reset) {
+			reset();
+		}
+		bindRefs(current);
+	} finally {
+		updating = false;
+	}
+}
+
+function mount(el, fn, resetRefs) {
+	root = el;
+	render = fn;
+	reset = resetRefs || null;
+	update();
+}
+
+return {h: h, text: text, str: str, bigints: bigints, div: div, rem: rem, int: int, i64: i64, append: append, make: make, print: print, println: println, shl: shl, shr: shr, and: and, or: or, xor: xor, not: not, box: box, is: is, assert: assert, assertOk: assertOk, same: same, panic: panic, recover: recover, frame: frame, defer: defer, catcher: catcher, panicked: panicked, unwind: unwind, unwindAsync: unwindAsync, recoverable: recoverable, raw: raw, url: url, srcset: srcset, urlPart: urlPart, css: css, js: js, attrs: attrs, each: each, range: range, component: component, flow: flow, route: route, param: param, segment: segment, router: router, pkgs: pkgs, on: on, bind: bind, conv: conv, update: update, mount: mount};
+})();
+`
+
+// runtimeFor returns the page runtime without the helpers used doesn't
+// name, reporting the helpers kept and dropped to r if it isn't nil.
+// All helpers are kept if used is nil.
+func runtimeFor(used map[string]bool, r *Report) string {
+	var b strings.Builder
+	optional := make(map[string]bool)
+	skip := false
+	for _, line := range strings.SplitAfter(pageRuntime, "\n") {
+		switch {
+		case strings.HasPrefix(line, "//wl:helper "):
+			names := strings.Fields(line)[1:]
+			skip = used != nil
+			for _, name := range names {
+				optional[name] = true
+				skip = skip && !used[name]
+			}
+			continue
+		case strings.HasPrefix(line, "//wl:end"):
+			skip = false
+			continue
+		case skip:
+			continue
+		case strings.HasPrefix(line, "return {"):
+			line = runtimeExports(line, optional, used, r)
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// runtimeExports returns the line returning the exports of the runtime
+// without the optional ones used doesn't name
+func runtimeExports(line string, optional, used map[string]bool, r *Report) string {
+	inner := strings.TrimSuffix(strings.TrimPrefix(line, "return {"), "};\n")
+	var kept []string
+	for _, export := range strings.Split(inner, ", ") {
+		name := strings.SplitN(export, ":", 2)[0]
+		if !optional[name] {
+			kept = append(kept, export)
+			continue
+		}
+		if used != nil && !used[name] {
+			if r != nil {
+				r.Dropped = append(r.Dropped, "runtime "+name)
+			}
+			continue
+		}
+		if r != nil {
+			r.Kept = append(r.Kept, Kept{Name: "runtime " + name, Reason: "used by the page script"})
+		}
+		kept = append(kept, export)
+	}
+	return "return {" + strings.Join(kept, ", ") + "};\n"
+}
+
+// minifyRuntime returns the javascript src of the runtime without its
+// comments and the whitespace not needed to separate its tokens. Line
+// breaks are kept after the tokens that may end a statement without a
+// semicolon; strings and regular expressions are copied as they are.
+func minifyRuntime(src string) string {
+	var b strings.Builder
+	var last byte   // last byte written
+	var word string // identifier or keyword last written
+	space, newline := false, false
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			space = true
+			i++
+			continue
+		case c == '\n':
+			newline = true
+			i++
+			continue
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 4
+			}
+			i += end + 4
+			space = true
+			continue
+		}
+
+		// separate the token starting at i from the last one if needed
+		switch {
+		case newline && last != 0 && strings.IndexByte("{;,(", last) < 0 && c != '}':
+			b.WriteByte('\n')
+		case (space || newline) && (isWordByte(last) && isWordByte(c) || last == c && (c == '+' || c == '-')):
+			b.WriteByte(' ')
+		}
+		space, newline = false, false
+
+		start := i
+		switch {
+		case isWordByte(c):
+			for i < len(src) && isWordByte(src[i]) {
+				i++
+			}
+			word = src[start:i]
+		case c == '"' || c == '\'' || c == '`':
+			i = skipQuoted(src, i)
+			word = ""
+		case c == '/' && regexpAllowed(last, word):
+			i = skipRegexp(src, i)
+			word = ""
+		default:
+			i++
+			word = ""
+		}
+		b.WriteString(src[start:i])
+		last = src[i-1]
+	}
+	if newline {
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c >= 0x80
+}
+
+// regexpAllowed reports whether a slash after the byte last, ending the
+// identifier or keyword word if there is one, starts a regular
+// expression rather than being a division
+func regexpAllowed(last byte, word string) bool {
+	switch word {
+	case "":
+	case "return", "typeof", "case", "in", "of", "new", "delete", "void", "throw":
+		return true
+	default:
+		return false
+	}
+	return last == 0 || strings.IndexByte("(,=:[!&|?{};+-*%<>~^", last) >= 0
+}
+
+// skipQuoted returns the end of the string starting at i in src
+func skipQuoted(src string, i int) int {
+	quote := src[i]
+	for i++; i < len(src) && src[i] != quote; i++ {
+		if src[i] == '\\' {
+			i++
+		}
+	}
+	return i + 1
+}
+
+// skipRegexp returns the end of the regular expression starting at i in
+// src, with its flags
+func skipRegexp(src string, i int) int {
+	class := false
+	for i++; i < len(src); i++ {
+		switch c := src[i]; {
+		case c == '\\':
+			i++
+		case c == '[':
+			class = true
+		case c == ']':
+			class = false
+		case c == '/' && !class:
+			for i++; i < len(src) && isWordByte(src[i]); i++ {
+			}
+			return i
+		}
+	}
+	return i
+}
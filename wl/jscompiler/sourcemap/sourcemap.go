@@ -0,0 +1,221 @@
+// Package sourcemap builds version 3 source maps, which map positions in
+// generated javascript back to the wl sources it was compiled from.
+//
+// The format is described in the Source Map Revision 3 Proposal:
+// https://sourcemaps.info/spec.html
+package sourcemap
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"weblang/wl/token"
+)
+
+// Map is a source map under construction. Segments are added with Add in
+// the order the generated code is written.
+type Map struct {
+	// File is the name of the generated file the map belongs to
+	File string
+
+	// Content, if set, returns the content of a source file for the
+	// sourcesContent of the map; sources it fails for get null
+	Content func(source string) ([]byte, error)
+
+	// SourceName, if set, returns the name a source file is listed with
+	// in the map. Browsers resolve the names against the URL of the
+	// map, so they should be relative to its directory, rather than to
+	// the working directory or absolute like the file names of the file
+	// set.
+	SourceName func(source string) string
+
+	sources  []string
+	srcIndex map[string]int
+	names    []string
+	nameIdx  map[string]int
+	segments []segment
+}
+
+// segment maps a generated line and column to a source position
+type segment struct {
+	genLine, genCol int
+	source          int
+	line, col       int // zero based
+	name            int // -1 if none
+}
+
+// New returns an empty map for the generated file
+func New(file string) *Map {
+	return &Map{
+		File:     file,
+		srcIndex: make(map[string]int),
+		nameIdx:  make(map[string]int),
+	}
+}
+
+// Add maps the zero based generated line and column to pos. name is the
+// original name of the identifier at pos, or "". Positions without a
+// file name are ignored. A later segment at the same generated position
+// replaces an earlier one, so the innermost node starting there wins.
+func (m *Map) Add(genLine, genCol int, pos token.Position, name string) {
+	if pos.Filename == "" || pos.Line < 1 {
+		return
+	}
+	s := segment{genLine: genLine, genCol: genCol, line: pos.Line - 1, col: pos.Column - 1, name: -1}
+	if s.col < 0 {
+		s.col = 0
+	}
+
+	i, ok := m.srcIndex[pos.Filename]
+	if !ok {
+		i = len(m.sources)
+		m.srcIndex[pos.Filename] = i
+		m.sources = append(m.sources, pos.Filename)
+	}
+	s.source = i
+
+	if name != "" {
+		j, ok := m.nameIdx[name]
+		if !ok {
+			j = len(m.names)
+			m.nameIdx[name] = j
+			m.names = append(m.names, name)
+		}
+		s.name = j
+	}
+
+	if n := len(m.segments); n > 0 {
+		last := &m.segments[n-1]
+		if last.genLine == genLine && last.genCol == genCol {
+			*last = s
+			return
+		}
+	}
+	m.segments = append(m.segments, s)
+}
+
+// Sources returns the file names of the source files of the map
+func (m *Map) Sources() []string { return m.sources }
+
+// Mappings returns the encoded mappings of the map
+func (m *Map) Mappings() string {
+	segs := make([]segment, len(m.segments))
+	copy(segs, m.segments)
+	sort.SliceStable(segs, func(i, j int) bool {
+		if segs[i].genLine != segs[j].genLine {
+			return segs[i].genLine < segs[j].genLine
+		}
+		return segs[i].genCol < segs[j].genCol
+	})
+
+	var buf bytes.Buffer
+	var line, prevCol, prevSource, prevLine, prevSrcCol, prevName int
+	for i, s := range segs {
+		for line < s.genLine {
+			buf.WriteByte(';')
+			line++
+			prevCol = 0
+		}
+		if i > 0 && segs[i-1].genLine == s.genLine {
+			buf.WriteByte(',')
+		}
+		writeVLQ(&buf, s.genCol-prevCol)
+		writeVLQ(&buf, s.source-prevSource)
+		writeVLQ(&buf, s.line-prevLine)
+		writeVLQ(&buf, s.col-prevSrcCol)
+		if s.name >= 0 {
+			writeVLQ(&buf, s.name-prevName)
+			prevName = s.name
+		}
+		prevCol, prevSource, prevLine, prevSrcCol = s.genCol, s.source, s.line, s.col
+	}
+	return buf.String()
+}
+
+// mapJSON is the json encoding of a map
+type mapJSON struct {
+	Version        int       `json:"version"`
+	File           string    `json:"file,omitempty"`
+	Sources        []string  `json:"sources"`
+	SourcesContent []*string `json:"sourcesContent,omitempty"`
+	Names          []string  `json:"names"`
+	Mappings       string    `json:"mappings"`
+}
+
+// MarshalJSON returns the map in the source map v3 format
+func (m *Map) MarshalJSON() ([]byte, error) {
+	j := mapJSON{
+		Version:  3,
+		File:     m.File,
+		Sources:  []string{},
+		Names:    m.names,
+		Mappings: m.Mappings(),
+	}
+	for _, src := range m.sources {
+		if m.SourceName != nil {
+			src = m.SourceName(src)
+		}
+		j.Sources = append(j.Sources, src)
+	}
+	if j.Names == nil {
+		j.Names = []string{}
+	}
+	if m.Content != nil {
+		for _, src := range m.sources {
+			var content *string
+			if data, err := m.Content(src); err == nil {
+				s := string(data)
+				content = &s
+			}
+			j.SourcesContent = append(j.SourcesContent, content)
+		}
+	}
+	return json.Marshal(j)
+}
+
+// WriteTo writes the map as json to w
+func (m *Map) WriteTo(w io.Writer) (int64, error) {
+	data, err := m.MarshalJSON()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// Comment returns the comment linking generated code to the map, which
+// is expected to be written next to the generated file as File + ".map"
+func (m *Map) Comment() string {
+	name := m.File
+	for i := len(name) - 1; i >= 0; i-- {
+		if name[i] == '/' {
+			name = name[i+1:]
+			break
+		}
+	}
+	return "//# sourceMappingURL=" + name + ".map\n"
+}
+
+const base64Digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// writeVLQ writes v as a base 64 variable length quantity: the sign is
+// the lowest bit of the first digit, and each digit holds 5 bits with
+// the 6th set if more digits follow
+func writeVLQ(buf *bytes.Buffer, v int) {
+	u := v << 1
+	if v < 0 {
+		u = (-v << 1) | 1
+	}
+	for {
+		digit := u & 31
+		u >>= 5
+		if u > 0 {
+			digit |= 32
+		}
+		buf.WriteByte(base64Digits[digit])
+		if u == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package sourcemap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"weblang/wl/token"
+)
+
+func TestVLQ(t *testing.T) {
+	for _, test := range []struct {
+		v    int
+		want string
+	}{
+		{0, "A"},
+		{1, "C"},
+		{-1, "D"},
+		{15, "e"},
+		{16, "gB"},
+		{-16, "hB"},
+		{123, "2H"},
+		{1000, "w+B"},
+	} {
+		var buf bytes.Buffer
+		writeVLQ(&buf, test.v)
+		if got := buf.String(); got != test.want {
+			t.Errorf("vlq(%d), want %s got %s", test.v, test.want, got)
+		}
+	}
+}
+
+func TestMap(t *testing.T) {
+	m := New("index.html")
+	m.Content = func(src string) ([]byte, error) {
+		if src == "index.wl" {
+			return []byte("package main\n"), nil
+		}
+		return nil, errors.New("no such file")
+	}
+	pos := func(file string, line, col int) token.Position {
+		return token.Position{Filename: file, Line: line, Column: col}
+	}
+	m.Add(0, 0, pos("index.wl", 3, 1), "")
+	m.Add(0, 4, pos("index.wl", 3, 5), "count")
+	m.Add(0, 4, pos("index.wl", 3, 6), "count") // replaces the previous segment
+	m.Add(2, 2, pos("index.wlpage", 1, 3), "")
+	m.Add(2, 10, pos("index.wl", 4, 1), "count")
+	m.Add(3, 0, token.Position{}, "") // ignored
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Version        int
+		File           string
+		Sources        []string
+		SourcesContent []*string
+		Names          []string
+		Mappings       string
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Version != 3 || got.File != "index.html" {
+		t.Errorf("version and file, got %d %s", got.Version, got.File)
+	}
+	if want := []string{"index.wl", "index.wlpage"}; len(got.Sources) != 2 || got.Sources[0] != want[0] || got.Sources[1] != want[1] {
+		t.Errorf("sources, want %v got %v", want, got.Sources)
+	}
+	if len(got.SourcesContent) != 2 || got.SourcesContent[0] == nil || *got.SourcesContent[0] != "package main\n" || got.SourcesContent[1] != nil {
+		t.Errorf("sourcesContent, got %s", data)
+	}
+	if len(got.Names) != 1 || got.Names[0] != "count" {
+		t.Errorf("names, want [count] got %v", got.Names)
+	}
+	// line 0: [0,0,2,0] [4,0,0,5,0]; line 2: [2,1,-2,-3] [8,-1,3,-2,0]
+	if want := "AAEA,IAAKA;;ECFH,QDGFA"; got.Mappings != want {
+		t.Errorf("mappings, want %s got %s", want, got.Mappings)
+	}
+	if want := "//# sourceMappingURL=index.html.map\n"; m.Comment() != want {
+		t.Errorf("comment, want %q got %q", want, m.Comment())
+	}
+}
+
+func TestSourceName(t *testing.T) {
+	m := New("index.html")
+	m.SourceName = func(src string) string {
+		return strings.TrimPrefix(src, "/tmp/site/")
+	}
+	m.Add(0, 0, token.Position{Filename: "/tmp/site/about/about.wl", Line: 1, Column: 1}, "")
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"sources":["about/about.wl"]`; !strings.Contains(string(data), want) {
+		t.Errorf("want %s in %s", want, data)
+	}
+}
@@ -1,28 +1,232 @@
 package jscompiler
 
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"weblang/wl/types"
+)
+
+// symbolMap maps the wl objects declared in a scope to the javascript
+// names they compile to. Each wl scope has its own map, whose parent is
+// the map of the enclosing scope; the root map holds the names reserved
+// by javascript and the page runtime, and the maps of all scopes.
+//
+// A name is escaped to a valid javascript identifier. If it is reserved,
+// collides with a name declared in the same scope or hides one an
+// enclosing scope declares, it gets a $ suffix, which wl names can't
+// contain, and a numbered suffix if it still collides. Even a wl name
+// shadowing the same name gets a name of its own: the scope of a let
+// declaration starts with its block, so x := x + 1 and the uses of the
+// outer x before an inner one is declared would read the inner one
+// before it is initialized. Exported package level names never get a
+// numbered suffix, and the ones with a $ suffix are exported under their
+// own name, which other modules refer to them by.
+//
+// For minified output, local names are shortened to the first of a, b,
+// ..., aa, ab, ... that doesn't conflict.
 type symbolMap struct {
-	parent *symbolMap
-	store          map[string]string
+	parent  *symbolMap
+	short   bool                    // shorten local names
+	store   map[string]string       // wl name of each js name declared in the scope
+	objects map[types.Object]string // js name of each object of the scope
+
+	// in the root: the maps of the wl scopes, and the module level
+	// bindings of imported packages
+	scopes  map[*types.Scope]*symbolMap
+	imports map[*types.Package]string
+}
+
+// reservedNames can't be declared by compiled code: javascript keywords
+// and literals, names strict mode code can't bind, and the globals the
+// compiled code and the page runtime rely on
+var reservedNames = []string{
+	"arguments", "await", "break", "case", "catch", "class", "const",
+	"continue", "debugger", "default", "delete", "do", "else", "enum",
+	"eval", "export", "extends", "false", "finally", "for", "function",
+	"if", "implements", "import", "in", "instanceof", "interface", "let",
+	"new", "null", "package", "private", "protected", "public", "return",
+	"static", "super", "switch", "this", "throw", "true", "try", "typeof",
+	"var", "void", "while", "with", "yield",
+	"Infinity", "NaN", "undefined",
+	"Array", "BigInt", "Error", "JSON", "Math", "Number", "Object",
+	"String", "console", "decodeURIComponent", "document",
+	"encodeURIComponent",
+	"fetch", "history", "isFinite", "location", "sessionStorage", "window",
+	"wl",
+}
+
+// newSymbolMap returns a root map holding the reserved names
+func newSymbolMap() *symbolMap {
+	s := &symbolMap{
+		store:   make(map[string]string),
+		scopes:  make(map[*types.Scope]*symbolMap),
+		imports: make(map[*types.Package]string),
+	}
+	for _, name := range reservedNames {
+		s.store[name] = ""
+	}
+	return s
 }
 
 func (s *symbolMap) newChildSymbolMap() *symbolMap {
 	return &symbolMap{
-		parent: s,
-		store: make(map[string]string),
+		parent:  s,
+		short:   s.short,
+		store:   make(map[string]string),
+		objects: make(map[types.Object]string),
+	}
+}
+
+// name returns the javascript name of obj. Package names refer to the
+// binding of their package, see bindImports. Objects outside of scopes,
+// like fields, methods and enum members, are properties and only need
+// escaping, as do predeclared objects and the package level objects of
+// imported packages, which their modules export under these names.
+func (s *symbolMap) name(obj types.Object) string {
+	if pkgName, ok := obj.(*types.PkgName); ok {
+		if js, ok := s.imports[pkgName.Imported()]; ok {
+			return js
+		}
+		return escapeIdent(obj.Name())
+	}
+	scope := obj.Parent()
+	if scope == nil || scope == types.Universe {
+		return escapeIdent(obj.Name())
+	}
+	if _, ok := s.imports[obj.Pkg()]; ok && scope == obj.Pkg().Scope() {
+		return escapeIdent(obj.Name())
+	}
+	m := s.scopeMap(scope)
+	if js, ok := m.objects[obj]; ok {
+		return js
+	}
+	return m.defineSymbol(obj, false)
+}
+
+// scopeMap returns the map of scope, declaring the objects of scope and
+// its enclosing scopes first, so that outer names are picked before
+// inner ones can collide with them
+func (s *symbolMap) scopeMap(scope *types.Scope) *symbolMap {
+	if m, ok := s.scopes[scope]; ok {
+		return m
+	}
+	parent := s
+	if scope.Parent() != nil && scope.Parent() != types.Universe {
+		parent = s.scopeMap(scope.Parent())
+	}
+	m := parent.newChildSymbolMap()
+	s.scopes[scope] = m
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		_, pkgName := obj.(*types.PkgName)
+		global := pkgName || obj.Pkg() != nil && obj.Pkg().Scope() == scope
+		m.defineSymbol(obj, global)
 	}
+	return m
 }
 
-func (s *symbolMap) defineSymbol(orig, jsName string) {
-	if _, ok := s.store[orig]; ok {
-		panic("unexpected redefined symbol in scope")
+// generatedNames are the parameters the page compiler declares around
+// compiled wl expressions, which short names must not hide
+var generatedNames = map[string]bool{"e": true, "el": true}
+
+// defineSymbol picks the javascript name of obj and declares it in s.
+// Names of global objects, declared at package level or naming
+// packages, aren't shortened, and exported ones get no numbered suffix.
+func (s *symbolMap) defineSymbol(obj types.Object, global bool) string {
+	orig := obj.Name()
+	var js string
+	if s.short && !global {
+		for i := 0; js == "" || generatedNames[js] || s.conflicts(js); i++ {
+			js = shortName(i)
+		}
+	} else {
+		js = s.unique(escapeIdent(orig), !(global && obj.Exported()))
+	}
+	s.store[js] = orig
+	s.objects[obj] = js
+	return js
+}
+
+// unique returns base, with a $ suffix if it conflicts, and then with a
+// numbered suffix if it still conflicts and numbered is set
+func (s *symbolMap) unique(base string, numbered bool) string {
+	js := base
+	if s.conflicts(js) {
+		js = base + "$"
+	}
+	for i := 1; numbered && s.conflicts(js); i++ {
+		js = fmt.Sprintf("%s$%d", base, i)
 	}
-	s.store[orig] = jsName
+	return js
 }
 
-func (s *symbolMap) getSymbol(orig string) string {
-	if val, ok := s.store[orig]; ok {
-		return val
+// bindImports names the module level bindings of the packages pkg
+// imports. Files may import a package under different names, or use one
+// name for different packages, so each package gets one binding named
+// after it, unique among the package level names. Bindings are declared
+// for their quoted import path, which no wl name can equal, so no local
+// name can hide them.
+func (s *symbolMap) bindImports(pkg *types.Package) {
+	m := s.scopeMap(pkg.Scope())
+	imps := append([]*types.Package(nil), pkg.Imports()...)
+	sort.Slice(imps, func(i, j int) bool { return imps[i].Path() < imps[j].Path() })
+	for _, imp := range imps {
+		orig := strconv.Quote(imp.Path())
+		js := m.unique(escapeIdent(imp.Name()), true)
+		m.store[js] = orig
+		s.imports[imp] = js
 	}
+}
 
-	panic("unknown symbol " + orig)
-}
\ No newline at end of file
+// shortName returns the i'th of the names a, ..., z, A, ..., Z, aa, ab, ...
+func shortName(i int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	name := string(letters[i%len(letters)])
+	for i /= len(letters); i > 0; i /= len(letters) {
+		i--
+		name = string(letters[i%len(letters)]) + name
+	}
+	return name
+}
+
+// conflicts reports whether declaring js collides with a name of s or
+// hides a name an enclosing scope declares
+func (s *symbolMap) conflicts(js string) bool {
+	for p := s; p != nil; p = p.parent {
+		if _, ok := p.store[js]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeIdent returns name with the characters that aren't valid in a
+// javascript identifier replaced by $ and their code point
+func escapeIdent(name string) string {
+	valid := func(i int, r rune) bool {
+		return r == '_' || r == '$' || unicode.IsLetter(r) || i > 0 && unicode.IsDigit(r)
+	}
+	ok := name != ""
+	for i, r := range name {
+		ok = ok && valid(i, r)
+	}
+	if ok {
+		return name
+	}
+
+	var b strings.Builder
+	for i, r := range name {
+		if valid(i, r) {
+			b.WriteRune(r)
+		} else {
+			fmt.Fprintf(&b, "$%x", r)
+		}
+	}
+	if b.Len() == 0 {
+		return "$"
+	}
+	return b.String()
+}
@@ -0,0 +1,56 @@
+package jscompiler
+
+import (
+	"testing"
+	"weblang/wl/types"
+)
+
+func TestEscapeIdent(t *testing.T) {
+	for _, test := range []struct{ name, want string }{
+		{"count", "count"},
+		{"größe", "größe"},
+		{"toggle-all", "toggle$2dall"},
+		{"1st", "$31st"},
+		{"", "$"},
+	} {
+		if got := escapeIdent(test.name); got != test.want {
+			t.Errorf("escapeIdent(%q), want %s got %s", test.name, test.want, got)
+		}
+	}
+}
+
+func TestSymbolMapCollisions(t *testing.T) {
+	pkg := types.NewPackage("p", "p")
+	scope := pkg.Scope()
+	newVar := func(s *types.Scope, name string) types.Object {
+		v := types.NewVar(0, pkg, name, types.Typ[types.Int])
+		s.Insert(v)
+		return v
+	}
+	hyphen := newVar(scope, "a-b")
+	escaped := newVar(scope, "a$2db")
+	exported := newVar(scope, "Object")
+
+	inner := types.NewScope(scope, 0, 0, "inner")
+	shadow := newVar(inner, "a-b")
+	other := newVar(inner, "delete$")
+	reserved := newVar(inner, "delete")
+
+	s := newSymbolMap()
+	for _, test := range []struct {
+		obj  types.Object
+		want string
+	}{
+		// names are declared in sorted order
+		{escaped, "a$2db"},
+		{hyphen, "a$2db$"},
+		{exported, "Object$"},
+		{shadow, "a$2db$1"},
+		{reserved, "delete$"},
+		{other, "delete$$"},
+	} {
+		if got := s.name(test.obj); got != test.want {
+			t.Errorf("name of %s, want %s got %s", test.obj.Name(), test.want, got)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package jscompiler
+
+import (
+	"fmt"
+	"strings"
+	"weblang/wl/ast"
+	"weblang/wl/jscompiler/jsast"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// Interface values carry their dynamic type: they are null for nil, or
+// boxes made by wl.box holding a value and the runtime descriptor of
+// its type. Values are boxed where they are stored in or passed as an
+// interface, and unboxed by type assertions and type switches, which
+// check the descriptors. Methods of interfaces are called on the boxed
+// value.
+//
+// Descriptors are objects holding the identity of the type, its name,
+// package path and kind, the names of its fields and its method set.
+// Named types of wl packages have a descriptor named after the type,
+// exported with it; other types get one numbered by the package.
+// Descriptors are constants, so they come before the code of the
+// package, which may box values while initializing it.
+
+// typeDescFunc is the descriptor generated for a type
+type typeDescFunc struct {
+	typ  types.Type
+	name string
+}
+
+// isInterface reports whether t is an interface type
+func isInterface(t types.Type) bool {
+	_, ok := underlying(t).(*types.Interface)
+	return ok
+}
+
+// assign converts x where it is stored in or passed as a value of type
+// to: values are boxed into interfaces and struct values copied. A nil
+// to means the value keeps its type.
+func (c *jsCompiler) assign(x ast.Expr, to types.Type) jsast.Expr {
+	if !isInterface(to) {
+		return c.value(x)
+	}
+	return c.box(x, c.value(x))
+}
+
+// box returns x, converted as js, as an interface value: boxed, unless
+// it is nil or an interface value already
+func (c *jsCompiler) box(x ast.Expr, js jsast.Expr) jsast.Expr {
+	tv := c.info.Types[x]
+	if tv.IsNil() || isInterface(tv.Type) {
+		return js
+	}
+	return runtimeCall("box", c.typeDesc(tv.Type), unparen(js))
+}
+
+// typeID returns the identity of t at runtime: its type string with
+// the types of packages qualified by their path
+func typeID(t types.Type) string {
+	return types.TypeString(t, func(pkg *types.Package) string { return pkg.Path() })
+}
+
+// typeDesc returns the descriptor of t
+func (c *jsCompiler) typeDesc(t types.Type) jsast.Expr {
+	named, isNamed := t.(*types.Named)
+	if isNamed && c.compiled(named) && named.Obj().Pkg() != c.pkg {
+		return &jsast.Identifier{Name: typeName(c.className(named))}
+	}
+	for _, d := range c.descs {
+		if types.Identical(d.typ, t) {
+			return &jsast.Identifier{Name: d.name}
+		}
+	}
+	d := typeDescFunc{typ: t}
+	if isNamed && c.compiled(named) {
+		d.name = typeName(c.className(named))
+	} else {
+		// $ can't occur in wl names, so these can't collide with them
+		n := 0
+		for _, d := range c.descs {
+			if strings.HasPrefix(d.name, "$") {
+				n++
+			}
+		}
+		d.name = fmt.Sprintf("$type%d", n)
+	}
+	c.descs = append(c.descs, d)
+	c.descQueue = append(c.descQueue, d)
+	return &jsast.Identifier{Name: d.name}
+}
+
+// typeName returns the name of the descriptor of the type named name
+func typeName(name string) string {
+	return name + "$type"
+}
+
+// typeDecls returns the descriptors used since the last call
+func (c *jsCompiler) typeDecls() []jsast.Decl {
+	var decls []jsast.Decl
+	for len(c.descQueue) > 0 {
+		d := c.descQueue[0]
+		c.descQueue = c.descQueue[1:]
+		decls = append(decls, c.typeDecl(d))
+	}
+	return decls
+}
+
+// typeDecl returns the descriptor d. Comparable structs refer to their
+// equality function, which compares boxed structs.
+func (c *jsCompiler) typeDecl(d typeDescFunc) jsast.Decl {
+	name, pkg := "", ""
+	exported := false
+	if named, ok := d.typ.(*types.Named); ok {
+		name = named.Obj().Name()
+		if p := named.Obj().Pkg(); p != nil {
+			pkg = p.Path()
+		}
+		exported = c.exports && named.Obj().Exported() && named.Obj().Pkg() == c.pkg
+	}
+	names := func(list []string) jsast.Expr {
+		arr := &jsast.ArrayLiteral{}
+		for _, s := range list {
+			arr.Elts = append(arr.Elts, stringLit(s))
+		}
+		return arr
+	}
+
+	var fields, methods []string
+	st, isStruct := underlying(d.typ).(*types.Struct)
+	if isStruct {
+		for i := 0; i < st.NumFields(); i++ {
+			fields = append(fields, c.symbols.name(st.Field(i)))
+		}
+	}
+	mset := types.NewMethodSet(d.typ)
+	for i := 0; i < mset.Len(); i++ {
+		methods = append(methods, c.symbols.name(mset.At(i).Obj()))
+	}
+	comparable := types.Comparable(d.typ)
+
+	obj := &jsast.ObjectLiteral{Props: []*jsast.Property{
+		{Key: "id", Value: stringLit(typeID(d.typ))},
+		{Key: "name", Value: stringLit(name)},
+		{Key: "pkg", Value: stringLit(pkg)},
+		{Key: "kind", Value: stringLit(typeKind(d.typ))},
+		{Key: "comparable", Value: &jsast.Identifier{Name: fmt.Sprint(comparable)}},
+		{Key: "fields", Value: names(fields)},
+		{Key: "methods", Value: names(methods)},
+	}}
+	if isStruct && comparable {
+		obj.Props = append(obj.Props, &jsast.Property{Key: "equal", Value: c.equalFunc(d.typ)})
+	}
+	return &jsast.VarDecl{IsExported: exported, Kind: "const", Name: d.name, Value: obj}
+}
+
+// typeKind returns the kind of t in its descriptor: the name of a basic
+// type, or the kind of type constructor
+func typeKind(t types.Type) string {
+	switch u := underlying(t).(type) {
+	case *types.Basic:
+		return u.Name()
+	case *types.Struct:
+		return "struct"
+	case *types.Interface:
+		return "interface"
+	case *types.Enum:
+		return "enum"
+	case *types.Slice:
+		return "slice"
+	case *types.Map:
+		return "map"
+	case *types.Signature:
+		return "func"
+	}
+	panic(fmt.Sprintf("unsupported type for descriptor: %v", t))
+}
+
+// typeAssert converts the type assertion x.(T), which panics like Go
+// if x doesn't hold a T. The type of x names the interface in the
+// message.
+func (c *jsCompiler) typeAssert(n *ast.TypeAssertExpr) jsast.Expr {
+	return runtimeCall("assert",
+		c.convertExpr(n.X),
+		c.typeDesc(c.info.Types[n.Type].Type),
+		stringLit(typeID(c.info.Types[n.X].Type)),
+	)
+}
+
+// assertOk converts the type assertion x.(T) assigned to v, ok, which
+// results in both as an array
+func (c *jsCompiler) assertOk(n *ast.TypeAssertExpr) jsast.Expr {
+	t := c.info.Types[n.Type].Type
+	return runtimeCall("assertOk", c.convertExpr(n.X), c.typeDesc(t), c.zeroValue(t))
+}
+
+// commaOk returns the type assertion the values of an assignment or
+// declaration of two names are, or nil
+func commaOk(lhs int, rhs []ast.Expr) *ast.TypeAssertExpr {
+	if lhs != 2 || len(rhs) != 1 {
+		return nil
+	}
+	x, _ := ast.Unparen(rhs[0]).(*ast.TypeAssertExpr)
+	return x
+}
+
+// convertAssertOk converts v, ok = x.(T) and v, ok := x.(T) into a
+// destructuring assignment
+func (c *jsCompiler) convertAssertOk(n *ast.AssignStmt, x *ast.TypeAssertExpr) jsast.Stmt {
+	return c.destructure(n, c.assertOk(x))
+}
+
+// destructure converts the assignment or short variable declaration n
+// of the elements of the array rhs. Names := redeclares are assigned,
+// new ones declared.
+func (c *jsCompiler) destructure(n *ast.AssignStmt, rhs jsast.Expr) jsast.Stmt {
+	if n.Tok != token.DEFINE {
+		lhs := &jsast.ArrayLiteral{}
+		for _, l := range n.Lhs {
+			if isBlank(l) {
+				lhs.Elts = append(lhs.Elts, &jsast.Identifier{})
+			} else {
+				lhs.Elts = append(lhs.Elts, c.convertExpr(l))
+			}
+		}
+		return &jsast.AssignStmt{Lhs: lhs, Op: "=", Rhs: rhs}
+	}
+
+	var names []string
+	var decls []jsast.Node
+	for _, l := range n.Lhs {
+		ident := l.(*ast.Ident)
+		switch {
+		case isBlank(ident):
+			names = append(names, "")
+		case c.info.Defs[ident] != nil:
+			names = append(names, c.getJsIdent(ident))
+			decls = append(decls, &jsast.DeclStmt{Decl: &jsast.VarDecl{Kind: "let", Name: c.getJsIdent(ident)}})
+		default:
+			names = append(names, c.getJsIdent(ident))
+		}
+	}
+	pattern := "[" + strings.Join(names, ", ") + "]"
+	if len(decls) == len(n.Lhs)-countBlank(n.Lhs) {
+		return &jsast.DeclStmt{Decl: &jsast.VarDecl{Kind: "let", Name: pattern, Value: rhs}}
+	}
+	decls = append(decls, &jsast.AssignStmt{Lhs: &jsast.Identifier{Name: pattern}, Op: "=", Rhs: rhs})
+	return &jsast.Placeholder{Children: decls}
+}
+
+// define converts the short variable declaration n of a value for each
+// name. Names it redeclares are assigned, new ones declared.
+func (c *jsCompiler) define(n *ast.AssignStmt) jsast.Stmt {
+	var sub []jsast.Node
+	for i, lhs := range n.Lhs {
+		ident := lhs.(*ast.Ident)
+		if isBlank(ident) {
+			sub = append(sub, &jsast.ExprStmt{Exp: c.convertExpr(n.Rhs[i])})
+			continue
+		}
+		value := c.assign(n.Rhs[i], c.info.ObjectOf(ident).Type())
+		if c.info.Defs[ident] != nil {
+			sub = append(sub, &jsast.DeclStmt{Decl: &jsast.VarDecl{Kind: "let", Name: c.getJsIdent(ident), Value: value}})
+		} else {
+			sub = append(sub, &jsast.AssignStmt{Lhs: c.convertExpr(ident), Op: "=", Rhs: value})
+		}
+	}
+	if len(sub) == 1 {
+		return sub[0].(jsast.Stmt)
+	}
+	return &jsast.Placeholder{Children: sub}
+}
+
+func isBlank(x ast.Expr) bool {
+	ident, ok := x.(*ast.Ident)
+	return ok && ident.Name == "_"
+}
+
+func countBlank(list []ast.Expr) int {
+	n := 0
+	for _, x := range list {
+		if isBlank(x) {
+			n++
+		}
+	}
+	return n
+}
+
+// typeSwitch converts a type switch into a chain of ifs testing the
+// descriptor of the value switched on, the default clause last. Each
+// clause binds the symbolic variable to the unboxed value if the
+// clause names one type that isn't an interface, and to the value
+// switched on otherwise.
+func (c *jsCompiler) typeSwitch(n *ast.TypeSwitchStmt) jsast.Stmt {
+	var assert *ast.TypeAssertExpr
+	switch a := n.Assign.(type) {
+	case *ast.AssignStmt:
+		assert = a.Rhs[0].(*ast.TypeAssertExpr)
+	case *ast.ExprStmt:
+		assert = a.X.(*ast.TypeAssertExpr)
+	}
+
+	var stmts []jsast.Stmt
+	if n.Init != nil {
+		stmts = append(stmts, c.convertStmt(n.Init))
+	}
+	var x jsast.Expr
+	if ident, ok := ast.Unparen(assert.X).(*ast.Ident); ok {
+		x = c.convertExpr(ident)
+	} else {
+		// evaluated once; $ can't occur in wl names
+		const tmp = "$x"
+		stmts = append(stmts, &jsast.DeclStmt{Decl: &jsast.VarDecl{Kind: "let", Name: tmp, Value: c.convertExpr(assert.X)}})
+		x = &jsast.Identifier{Name: tmp}
+	}
+
+	var chain jsast.Stmt
+	var ifs []*jsast.IfStmt
+	for _, s := range n.Body.List {
+		cc := s.(*ast.CaseClause)
+		if cc.List == nil {
+			chain = c.caseBody(cc, x)
+			continue
+		}
+		var cond jsast.Expr
+		for _, t := range cc.List {
+			var test jsast.Expr
+			if tv := c.info.Types[t]; tv.IsNil() {
+				test = &jsast.BinaryExpression{Lhs: x, Op: "===", Rhs: &jsast.Identifier{Name: "null"}}
+			} else {
+				test = runtimeCall("is", x, c.typeDesc(tv.Type))
+			}
+			if cond == nil {
+				cond = test
+			} else {
+				cond = &jsast.BinaryExpression{Lhs: cond, Op: "||", Rhs: test}
+			}
+		}
+		ifs = append(ifs, &jsast.IfStmt{Cond: cond, Body: c.caseBody(cc, x)})
+	}
+	for i := len(ifs) - 1; i >= 0; i-- {
+		ifs[i].Else = chain
+		chain = ifs[i]
+	}
+
+	if len(stmts) == 0 && chain != nil {
+		return chain
+	}
+	if chain != nil {
+		stmts = append(stmts, chain)
+	}
+	return &jsast.BlockStmt{Body: stmts}
+}
+
+// caseBody converts the body of a type switch clause on x, declaring
+// the symbolic variable of the clause first
+func (c *jsCompiler) caseBody(cc *ast.CaseClause, x jsast.Expr) *jsast.BlockStmt {
+	body := &jsast.BlockStmt{}
+	if obj := c.info.Implicits[cc]; obj != nil {
+		var value jsast.Expr = x
+		if !isInterface(obj.Type()) {
+			value = &jsast.SelectorExpr{X: x, Sel: "$value"}
+			if _, ok := underlying(obj.Type()).(*types.Struct); ok {
+				value = c.clone(obj.Type(), value)
+			}
+		}
+		body.Body = append(body.Body, &jsast.DeclStmt{Decl: &jsast.VarDecl{Kind: "let", Name: c.symbols.name(obj), Value: value}})
+	}
+	for _, s := range cc.Body {
+		body.Body = append(body.Body, c.convertStmt(s))
+	}
+	return body
+}
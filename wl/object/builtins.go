@@ -2,6 +2,7 @@ package object
 
 type Builtin struct {
 	Name string
+	Fn   BuiltinFunction
 }
 
 var Builtins = []Builtin{
@@ -1,5 +1,14 @@
 package object
 
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"weblang/wl/ast"
+	"weblang/wl/types"
+)
+
 type BuiltinFunction func(args ...Object) Object
 
 type ObjectType string
@@ -9,16 +18,21 @@ const (
 	ERROR_OBJ = "ERROR"
 
 	INTEGER_OBJ = "INTEGER"
+	FLOAT_OBJ   = "FLOAT"
 	BOOLEAN_OBJ = "BOOLEAN"
 	STRING_OBJ  = "STRING"
 
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
 
 	FUNCTION_OBJ = "FUNCTION"
+	METHOD_OBJ   = "METHOD"
 	BUILTIN_OBJ  = "BUILTIN"
 
-	ARRAY_OBJ = "ARRAY"
-	HASH_OBJ  = "HASH"
+	ARRAY_OBJ     = "ARRAY"
+	HASH_OBJ      = "HASH"
+	STRUCT_OBJ    = "STRUCT"
+	ENUM_OBJ      = "ENUM"
+	INTERFACE_OBJ = "INTERFACE"
 
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
 
@@ -29,3 +43,339 @@ type Object interface {
 	Type() ObjectType
 	Inspect() string
 }
+
+// Values shared by all uses: nil and the booleans
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+// NativeBool returns the boolean object of b
+func NativeBool(b bool) *Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
+
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Inspect() string  { return strconv.FormatInt(i.Value, 10) }
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string  { return strconv.FormatFloat(f.Value, 'g', -1, 64) }
+
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return strconv.FormatBool(b.Value) }
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+// Null is nil: the value of nil interfaces and functions
+type Null struct{}
+
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Inspect() string  { return "<nil>" }
+
+// Error is the value of the errors the runtime panics with
+type Error struct {
+	Message string
+}
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+func (e *Error) Inspect() string  { return e.Message }
+
+// Array is a slice. Slicing shares the elements and append reuses them
+// while they have room, like Go slices.
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	var out bytes.Buffer
+	out.WriteString("[")
+	for i, e := range a.Elements {
+		if i > 0 {
+			out.WriteString(" ")
+		}
+		out.WriteString(e.Inspect())
+	}
+	out.WriteString("]")
+	return out.String()
+}
+
+// HashKey identifies the value of a map key
+type HashKey struct {
+	Type  ObjectType
+	Value interface{}
+}
+
+// Hashable is implemented by the objects usable as map keys
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey { return HashKey{Type: i.Type(), Value: i.Value} }
+func (f *Float) HashKey() HashKey   { return HashKey{Type: f.Type(), Value: f.Value} }
+func (b *Boolean) HashKey() HashKey { return HashKey{Type: b.Type(), Value: b.Value} }
+func (s *String) HashKey() HashKey  { return HashKey{Type: s.Type(), Value: s.Value} }
+func (n *Null) HashKey() HashKey    { return HashKey{Type: n.Type()} }
+func (e *Enum) HashKey() HashKey    { return HashKey{Type: e.Type(), Value: e.Member} }
+
+func (s *Struct) HashKey() HashKey {
+	keys := make([]string, len(s.Fields))
+	for i, f := range s.Fields {
+		keys[i] = fmt.Sprint(hashKey(f))
+	}
+	return HashKey{Type: s.Type(), Value: strings.Join(keys, "\x00")}
+}
+
+func (i *Interface) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: types.TypeString(i.Dynamic, nil) + "\x00" + fmt.Sprint(hashKey(i.Value))}
+}
+
+func hashKey(obj Object) HashKey {
+	if h, ok := obj.(Hashable); ok {
+		return h.HashKey()
+	}
+	return HashKey{Type: obj.Type(), Value: obj}
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash is a map. Its keys are kept in insertion order so ranging over
+// maps is deterministic, like the javascript objects of compiled pages.
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	Keys  []HashKey
+}
+
+// NewHash returns an empty map
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+// Get returns the value of key, if present
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	p, ok := h.Pairs[key.HashKey()]
+	return p.Value, ok
+}
+
+// Set sets the value of key
+func (h *Hash) Set(key Object, value Object) {
+	k := hashKey(key)
+	if _, ok := h.Pairs[k]; !ok {
+		h.Keys = append(h.Keys, k)
+	}
+	h.Pairs[k] = HashPair{Key: key, Value: value}
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+	out.WriteString("map[")
+	for i, k := range h.Keys {
+		if i > 0 {
+			out.WriteString(" ")
+		}
+		p := h.Pairs[k]
+		out.WriteString(p.Key.Inspect() + ":" + p.Value.Inspect())
+	}
+	out.WriteString("]")
+	return out.String()
+}
+
+// Struct is a struct value of type StructType, holding its fields in
+// declaration order. Structs are shared by the objects referring to
+// them; Copy copies them where wl copies struct values.
+type Struct struct {
+	StructType types.Type
+	Fields     []Object
+}
+
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+func (s *Struct) Inspect() string {
+	var out bytes.Buffer
+	out.WriteString("{")
+	for i, f := range s.Fields {
+		if i > 0 {
+			out.WriteString(" ")
+		}
+		out.WriteString(f.Inspect())
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+// Enum is the member of an enum type
+type Enum struct {
+	EnumType types.Type
+	Member   *types.Const
+}
+
+func (e *Enum) Type() ObjectType { return ENUM_OBJ }
+func (e *Enum) Inspect() string  { return e.Member.Name() }
+
+// Interface is a non-nil interface value: a value boxed with its
+// dynamic type. Nil interfaces are NULL.
+type Interface struct {
+	Dynamic types.Type
+	Value   Object
+}
+
+func (i *Interface) Type() ObjectType { return INTERFACE_OBJ }
+func (i *Interface) Inspect() string  { return i.Value.Inspect() }
+
+// Function is a function or method declared in wl source, or a
+// function literal closing over Env. Info is the type information of
+// the package declaring it.
+type Function struct {
+	Name    string
+	Sig     *types.Signature
+	Recv    *ast.FieldList
+	Params  *ast.FieldList
+	Results *ast.FieldList
+	Body    *ast.BlockStmt
+	Env     *Environment
+	Info    *types.Info
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	if f.Name == "" {
+		return "func literal"
+	}
+	return "func " + f.Name
+}
+
+// Method is a method value: a method bound to its receiver
+type Method struct {
+	Recv Object
+	Func Object
+}
+
+func (m *Method) Type() ObjectType { return METHOD_OBJ }
+func (m *Method) Inspect() string  { return m.Func.Inspect() }
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin " + b.Name }
+
+// Copy returns a copy of the value obj, copying structs and the structs
+// they hold
+func Copy(obj Object) Object {
+	s, ok := obj.(*Struct)
+	if !ok {
+		return obj
+	}
+	fields := make([]Object, len(s.Fields))
+	for i, f := range s.Fields {
+		fields[i] = Copy(f)
+	}
+	return &Struct{StructType: s.StructType, Fields: fields}
+}
+
+// Equal reports whether the values a and b of the same type are equal.
+// ok is false if they hold values of a type that isn't comparable.
+func Equal(a, b Object) (equal, ok bool) {
+	switch a := a.(type) {
+	case *Integer:
+		b, isInt := b.(*Integer)
+		return isInt && a.Value == b.Value, true
+	case *Float:
+		b, isFloat := b.(*Float)
+		return isFloat && a.Value == b.Value, true
+	case *Boolean:
+		b, isBool := b.(*Boolean)
+		return isBool && a.Value == b.Value, true
+	case *String:
+		b, isString := b.(*String)
+		return isString && a.Value == b.Value, true
+	case *Enum:
+		b, isEnum := b.(*Enum)
+		return isEnum && a.Member == b.Member, true
+	case *Null:
+		return b == NULL, true
+	case *Error:
+		return a == b, true
+	case *Struct:
+		b, isStruct := b.(*Struct)
+		if !isStruct {
+			return false, true
+		}
+		for i, f := range a.Fields {
+			if eq, ok := Equal(f, b.Fields[i]); !ok || !eq {
+				return eq, ok
+			}
+		}
+		return true, true
+	case *Interface:
+		b, isIface := b.(*Interface)
+		if !isIface {
+			return false, true
+		}
+		if !types.Identical(a.Dynamic, b.Dynamic) {
+			return false, true
+		}
+		if !types.Comparable(a.Dynamic) {
+			return false, false
+		}
+		return Equal(a.Value, b.Value)
+	}
+	// slices, maps and functions only compare to nil
+	return false, b == NULL
+}
+
+// Zero returns the zero value of type t. Like in compiled pages, the
+// zero values of slices and maps are empty rather than nil, and the
+// first member is the zero value of enums.
+func Zero(t types.Type) Object {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		info := u.Info()
+		switch {
+		case info&types.IsBoolean != 0:
+			return FALSE
+		case info&types.IsInteger != 0:
+			return &Integer{}
+		case info&types.IsFloat != 0:
+			return &Float{}
+		case info&types.IsString != 0:
+			return &String{}
+		}
+	case *types.Slice:
+		return &Array{}
+	case *types.Map:
+		return NewHash()
+	case *types.Enum:
+		if u.NumValues() > 0 {
+			return &Enum{EnumType: t, Member: u.Value(0)}
+		}
+	case *types.Struct:
+		fields := make([]Object, u.NumFields())
+		for i := range fields {
+			fields[i] = Zero(u.Field(i).Type())
+		}
+		return &Struct{StructType: t, Fields: fields}
+	}
+	return NULL
+}
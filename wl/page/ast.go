@@ -0,0 +1,146 @@
+package page
+
+import (
+	"weblang/wl/ast"
+	"weblang/wl/token"
+)
+
+// Node is any node of a parsed page template
+type Node interface {
+	Pos() token.Pos // position of first character belonging to the node
+	End() token.Pos // position of first character immediately after the node
+}
+
+// Template is a parsed .wlpage file
+type Template struct {
+	Name  string // file name
+	Nodes []Node // top level nodes
+}
+
+// Template nodes
+type (
+	// Text is literal text between tags and actions
+	Text struct {
+		ValuePos token.Pos
+		Value    string
+	}
+
+	// Raw is markup copied to the output as-is, such as the
+	// doctype and html comments
+	Raw struct {
+		ValuePos token.Pos
+		Value    string
+	}
+
+	// Element is an html tag, its attributes and its content
+	Element struct {
+		Lt          token.Pos // position of "<"
+		Name        string    // lower case tag name
+		Attrs       []Node    // *Attr, *EventAttr or *IfBlock of attributes
+		SelfClosing bool      // true if the tag ended with "/>"
+		Children    []Node    // content; nil for void elements
+		EndPos      token.Pos // position after the end tag, or after ">" if there is none
+	}
+
+	// Attr is a plain html attribute
+	Attr struct {
+		NamePos  token.Pos
+		Name     string
+		HasValue bool   // false for boolean attributes such as "autofocus"
+		Value    []Node // *Text, *Action or *IfBlock
+		EndPos   token.Pos
+	}
+
+	// EventAttr is an event binding: @name.modifier="handler"
+	EventAttr struct {
+		NamePos   token.Pos
+		Name      string   // event name, e.g. "keyup"
+		Modifiers []string // modifiers in source order, e.g. "enter"
+		Handler   ast.Expr // function name or call expression
+		EndPos    token.Pos
+	}
+
+	// Action is an expression whose value is written to the output: {{x}}
+	Action struct {
+		Lbrace token.Pos // position of "{{"
+		X      ast.Expr
+		Rbrace token.Pos // position of "}}"
+	}
+
+	// IfBlock is a conditional section: {{if cond}}...{{else}}...{{/if}}
+	IfBlock struct {
+		If     token.Pos // position of "{{" of the if action
+		Cond   ast.Expr
+		Then   []Node
+		Else   []Node // or nil
+		EndPos token.Pos
+	}
+
+	// ForBlock repeats its body for each element of X:
+	// {{for key, value := range X}}...{{/for}}
+	ForBlock struct {
+		For        token.Pos  // position of "{{" of the for action
+		Key, Value *ast.Ident // Key may be "_"; Value may be nil
+		X          ast.Expr
+		Body       []Node
+		EndPos     token.Pos
+	}
+)
+
+func (n *Text) Pos() token.Pos      { return n.ValuePos }
+func (n *Raw) Pos() token.Pos       { return n.ValuePos }
+func (n *Element) Pos() token.Pos   { return n.Lt }
+func (n *Attr) Pos() token.Pos      { return n.NamePos }
+func (n *EventAttr) Pos() token.Pos { return n.NamePos }
+func (n *Action) Pos() token.Pos    { return n.Lbrace }
+func (n *IfBlock) Pos() token.Pos   { return n.If }
+func (n *ForBlock) Pos() token.Pos  { return n.For }
+
+func (n *Text) End() token.Pos      { return token.Pos(int(n.ValuePos) + len(n.Value)) }
+func (n *Raw) End() token.Pos       { return token.Pos(int(n.ValuePos) + len(n.Value)) }
+func (n *Element) End() token.Pos   { return n.EndPos }
+func (n *Attr) End() token.Pos      { return n.EndPos }
+func (n *EventAttr) End() token.Pos { return n.EndPos }
+func (n *Action) End() token.Pos    { return n.Rbrace + 2 }
+func (n *IfBlock) End() token.Pos   { return n.EndPos }
+func (n *ForBlock) End() token.Pos  { return n.EndPos }
+
+// voidElements never have content or an end tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// IsVoid reports whether the element can't have content
+func (n *Element) IsVoid() bool {
+	return voidElements[n.Name] || n.SelfClosing
+}
+
+// rawTextElements have text content that isn't parsed as html
+var rawTextElements = map[string]bool{
+	"script": true, "style": true, "textarea": true, "title": true,
+}
+
+// Inspect traverses the template in depth-first order, calling f for
+// each node (including attributes). If f returns false the children
+// of the node are skipped.
+func Inspect(nodes []Node, f func(Node) bool) {
+	for _, n := range nodes {
+		if !f(n) {
+			continue
+		}
+		switch n := n.(type) {
+		case *Element:
+			Inspect(n.Attrs, f)
+			Inspect(n.Children, f)
+		case *Attr:
+			Inspect(n.Value, f)
+		case *IfBlock:
+			Inspect(n.Then, f)
+			Inspect(n.Else, f)
+		case *ForBlock:
+			Inspect(n.Body, f)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package page
+
+import (
+	"strings"
+	"weblang/wl/ast"
+	"weblang/wl/types"
+)
+
+// bindAttr is the name of the two-way binding attribute, @bind
+const bindAttr = "bind"
+
+// Binding is a checked two-way @bind between an element and an
+// assignable expression
+type Binding struct {
+	Prop     string // element property holding the value: "value" or "checked"
+	DOMEvent string // DOM event signalling the property changed
+
+	// Convert is the conversion between the property and the bound
+	// type: "string", "int", "float", "bool", "checked" or "enum"
+	Convert string
+
+	// Type is the type of the bound expression
+	Type types.Type
+}
+
+// bindable elements and the DOM event signalling a new value
+var bindEvents = map[string]string{
+	"input":    "input",
+	"textarea": "input",
+	"select":   "change",
+}
+
+func (c *checker) bind(scope *types.Scope, n *EventAttr) {
+	el := c.elem
+	if el == nil {
+		c.errorf(n.Pos(), "@bind must be an attribute of an element")
+		return
+	}
+	tag := strings.ToLower(el.Name)
+	event, ok := bindEvents[tag]
+	if !ok {
+		c.errorf(n.Pos(), "@bind is not supported on <%s>", el.Name)
+		return
+	}
+	if len(n.Modifiers) > 0 {
+		c.errorf(modifierPos(n, 0), "@bind does not take modifiers")
+	}
+	for _, a := range el.Attrs {
+		if a == Node(n) {
+			break
+		}
+		if a, ok := a.(*EventAttr); ok && a.Name == bindAttr {
+			c.errorf(n.Pos(), "duplicate @bind on <%s>", el.Name)
+			return
+		}
+	}
+
+	b := &Binding{Prop: "value", DOMEvent: event}
+	if _, typ, _ := staticAttr(el, "type"); tag == "input" {
+		switch strings.ToLower(typ) {
+		case "checkbox":
+			b.Prop, b.DOMEvent = "checked", "change"
+		case "radio", "file":
+			c.errorf(n.Pos(), "@bind is not supported on <input type=%q>", typ)
+			return
+		}
+	}
+	for _, a := range el.Attrs {
+		if a, ok := a.(*Attr); ok && strings.EqualFold(a.Name, b.Prop) {
+			c.errorf(a.Pos(), "%s attribute conflicts with @bind", a.Name)
+		}
+	}
+
+	if _, bad := n.Handler.(*ast.BadExpr); bad {
+		return
+	}
+	tv, ok := c.value(scope, n.Handler)
+	if !ok {
+		return
+	}
+	if !tv.Assignable() {
+		c.errorf(n.Handler.Pos(), "cannot bind %s: not assignable", types.ExprString(n.Handler))
+		return
+	}
+	b.Type = tv.Type
+
+	switch u := tv.Type.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			b.Convert = "bool"
+			if b.Prop == "checked" {
+				b.Convert = "checked"
+			}
+		case b.Prop == "checked":
+		case u.Info()&types.IsInteger != 0:
+			b.Convert = "int"
+		case u.Info()&types.IsFloat != 0:
+			b.Convert = "float"
+		case u.Info()&types.IsString != 0:
+			b.Convert = "string"
+		}
+	case *types.Enum:
+		if _, named := tv.Type.(*types.Named); named && b.Prop != "checked" {
+			b.Convert = "enum"
+		}
+	}
+	if b.Convert == "" {
+		if b.Prop == "checked" {
+			c.errorf(n.Handler.Pos(), "cannot bind %s (type %s) to a checkbox, want bool", types.ExprString(n.Handler), tv.Type)
+		} else {
+			c.errorf(n.Handler.Pos(), "cannot bind %s (type %s) to <%s>", types.ExprString(n.Handler), tv.Type, el.Name)
+		}
+		return
+	}
+
+	c.result.Bindings[n] = b
+}
@@ -0,0 +1,398 @@
+package page
+
+import (
+	"fmt"
+	"weblang/wl/ast"
+	"weblang/wl/scanner"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// Info holds the results of type-checking a page template
+type Info struct {
+	// Handlers maps each event binding to its checked handler
+	Handlers map[*EventAttr]*Handler
+
+	// Scopes maps each {{for}} block to the scope declaring its
+	// loop variables
+	Scopes map[*ForBlock]*types.Scope
+
+	// Refs maps elements to the package variables bound to them by id
+	Refs map[*Element]*Ref
+
+	// Bindings maps each @bind attribute to its checked binding
+	Bindings map[*EventAttr]*Binding
+
+	// Escapes maps each action that produces output to how its
+	// output is escaped
+	Escapes map[*Action]Escape
+
+	// Components maps each component passed to Check to its checked
+	// props and slots
+	Components map[*Component]*ComponentInfo
+
+	// Instances maps elements using a component to the checked use
+	Instances map[*Element]*Instance
+
+	// Slots maps the <placeholder> elements of component templates
+	// to the slot they declare
+	Slots map[*Element]*Slot
+
+	// Routes are the routes declared by the package in source order
+	Routes []*Route
+}
+
+// Handler is a checked event binding
+type Handler struct {
+	DOMEvent  string   // DOM event type to listen for
+	EventType string   // name of the events type passed to the handler
+	Keys      []string // KeyboardEvent.key values to filter on; nil for any key
+
+	Prevent bool // call preventDefault before the handler
+	Stop    bool // call stopPropagation before the handler
+	Once    bool // only invoke the handler the first time the event fires
+
+	// Func is the handler function, or func typed component prop, if
+	// it was bound by name, or nil if the handler is a call expression
+	Func types.Object
+
+	// TakesEvent is set if Func takes the events type as its parameter
+	TakesEvent bool
+}
+
+// Check type-checks the expressions in tmpl against pkg, which must
+// already be type-checked. Types and uses of names in template
+// expressions are recorded in info, which may be nil. Errors are
+// returned as a scanner.ErrorList sorted by position.
+//
+// The components in comps may be used by tmpl and by each other; their
+// templates are checked along with tmpl.
+func Check(fset *token.FileSet, pkg *types.Package, info *types.Info, tmpl *Template, comps ...*Component) (*Info, error) {
+	if info == nil {
+		info = new(types.Info)
+	}
+	if info.Uses == nil {
+		// we need uses to resolve handlers bound by name
+		cpy := *info
+		cpy.Uses = make(map[*ast.Ident]types.Object)
+		info = &cpy
+	}
+
+	c := &checker{
+		fset: fset,
+		pkg:  pkg,
+		info: info,
+		result: &Info{
+			Handlers:   make(map[*EventAttr]*Handler),
+			Scopes:     make(map[*ForBlock]*types.Scope),
+			Refs:       make(map[*Element]*Ref),
+			Bindings:   make(map[*EventAttr]*Binding),
+			Escapes:    make(map[*Action]Escape),
+			Components: make(map[*Component]*ComponentInfo),
+			Instances:  make(map[*Element]*Instance),
+			Slots:      make(map[*Element]*Slot),
+		},
+		refs:  refVars(pkg),
+		bound: make(map[*types.Var]token.Pos),
+		comps: make(map[string]*Component),
+		top:   importScope(pkg),
+	}
+
+	c.routes()
+	c.declareComponents(comps)
+	for _, comp := range comps {
+		if c.comps[comp.Name] == comp {
+			c.component(comp)
+		}
+	}
+
+	var pos, end token.Pos
+	if n := len(tmpl.Nodes); n > 0 {
+		pos, end = tmpl.Nodes[0].Pos(), tmpl.Nodes[n-1].End()
+	}
+	scope := types.NewScope(c.top, pos, end, "page "+tmpl.Name)
+	c.nodes(scope, tmpl.Nodes)
+	c.unboundRefs()
+
+	c.errors.Sort()
+	return c.result, c.errors.Err()
+}
+
+type checker struct {
+	fset   *token.FileSet
+	pkg    *types.Package
+	info   *types.Info
+	result *Info
+	errors scanner.ErrorList
+
+	refs  map[string]*types.Var    // element variables by name
+	bound map[*types.Var]token.Pos // id attribute bound to each element variable
+	loop  *ForBlock                // innermost {{for}} being checked
+	elem  *Element                 // element whose attributes are being checked
+	ctx   Context                  // context of actions being checked
+
+	comps map[string]*Component // components by name
+	comp  *Component            // component whose template is being checked
+	top   *types.Scope          // scope of the package and its imports
+}
+
+// importScope returns a scope declaring the packages imported by the
+// files of pkg, whose parent is the package scope. Templates aren't
+// part of a file, so they see the imports of all files.
+func importScope(pkg *types.Package) *types.Scope {
+	scope := types.NewScope(pkg.Scope(), token.NoPos, token.NoPos, "imports")
+	for i := 0; i < pkg.Scope().NumChildren(); i++ {
+		file := pkg.Scope().Child(i)
+		for _, name := range file.Names() {
+			if obj, ok := file.Lookup(name).(*types.PkgName); ok {
+				scope.Insert(obj)
+			}
+		}
+	}
+	return scope
+}
+
+func (c *checker) errorf(pos token.Pos, format string, args ...interface{}) {
+	c.errors.Add(c.fset.Position(pos), fmt.Sprintf(format, args...))
+}
+
+func (c *checker) nodes(scope *types.Scope, nodes []Node) {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *Element:
+			if comp := c.comps[n.Name]; comp != nil {
+				c.instance(scope, n, comp)
+				continue
+			}
+			if n.Name == slotTag {
+				if c.comp == nil {
+					c.errorf(n.Pos(), "<%s> outside of a component", slotTag)
+					continue
+				}
+				c.slot(scope, n)
+				continue
+			}
+			c.elementRef(n)
+			outer := c.elem
+			c.elem = n
+			c.nodes(scope, n.Attrs)
+			c.elem = outer
+			ctx := c.ctx
+			c.ctx = contentContext(n.Name)
+			c.nodes(scope, n.Children)
+			c.ctx = ctx
+		case *Attr:
+			c.attr(scope, n)
+		case *EventAttr:
+			c.event(scope, n)
+		case *Action:
+			c.action(scope, n)
+		case *IfBlock:
+			c.cond(scope, n.Cond)
+			c.nodes(scope, n.Then)
+			c.nodes(scope, n.Else)
+		case *ForBlock:
+			c.forBlock(scope, n)
+		}
+	}
+}
+
+// expr type-checks x in scope, reporting any error
+func (c *checker) expr(scope *types.Scope, x ast.Expr) (types.TypeAndValue, bool) {
+	if _, bad := x.(*ast.BadExpr); bad {
+		return types.TypeAndValue{}, false // error reported by the parser
+	}
+	tv, err := types.CheckExpr(c.fset, c.pkg, scope, x, c.info)
+	if err != nil {
+		if terr, ok := err.(types.Error); ok {
+			c.errors.Add(terr.Fset.Position(terr.Pos), terr.Msg)
+		} else {
+			c.errorf(x.Pos(), "%v", err)
+		}
+		return tv, false
+	}
+	return tv, true
+}
+
+func (c *checker) value(scope *types.Scope, x ast.Expr) (types.TypeAndValue, bool) {
+	tv, ok := c.expr(scope, x)
+	if ok && !tv.IsValue() {
+		c.errorf(x.Pos(), "%s is not a value", types.ExprString(x))
+		return tv, false
+	}
+	return tv, ok
+}
+
+func (c *checker) cond(scope *types.Scope, x ast.Expr) {
+	tv, ok := c.value(scope, x)
+	if !ok {
+		return
+	}
+	if b, _ := tv.Type.Underlying().(*types.Basic); b == nil || b.Info()&types.IsBoolean == 0 {
+		c.errorf(x.Pos(), "non-boolean condition %s in {{if}}", types.ExprString(x))
+	}
+}
+
+func (c *checker) forBlock(parent *types.Scope, n *ForBlock) {
+	var key, val types.Type = types.Typ[types.Invalid], types.Typ[types.Invalid]
+	if tv, ok := c.value(parent, n.X); ok {
+		switch t := tv.Type.Underlying().(type) {
+		case *types.Slice:
+			key, val = types.Typ[types.Int], t.Elem()
+		case *types.Map:
+			key, val = t.Key(), t.Elem()
+		default:
+			c.errorf(n.X.Pos(), "cannot range over %s (type %s)", types.ExprString(n.X), tv.Type)
+		}
+	}
+
+	scope := types.NewScope(parent, n.Pos(), n.End(), "for")
+	c.result.Scopes[n] = scope
+	c.declare(scope, n.Key, key)
+	c.declare(scope, n.Value, val)
+
+	outer := c.loop
+	c.loop = n
+	c.nodes(scope, n.Body)
+	c.loop = outer
+}
+
+func (c *checker) declare(scope *types.Scope, ident *ast.Ident, typ types.Type) {
+	if ident == nil {
+		return
+	}
+	obj := types.NewVar(ident.Pos(), c.pkg, ident.Name, typ)
+	if ident.Name != "_" {
+		if alt := scope.Insert(obj); alt != nil {
+			c.errorf(ident.Pos(), "%s redeclared in {{for}}", ident.Name)
+		}
+	}
+	if c.info.Defs != nil {
+		c.info.Defs[ident] = obj
+	}
+}
+
+func (c *checker) event(scope *types.Scope, n *EventAttr) {
+	if n.Name == bindAttr {
+		c.bind(scope, n)
+		return
+	}
+	ev, ok := events[n.Name]
+	if !ok {
+		c.errorf(n.Pos(), "unknown event @%s", n.Name)
+		return
+	}
+
+	h := &Handler{
+		DOMEvent:  ev.domEvent,
+		EventType: ev.typeName,
+	}
+
+	seen := make(map[string]bool)
+	for i, m := range n.Modifiers {
+		pos := modifierPos(n, i)
+		if seen[m] {
+			c.errorf(pos, "duplicate modifier .%s", m)
+			continue
+		}
+		seen[m] = true
+
+		switch m {
+		case modPrevent:
+			h.Prevent = true
+		case modStop:
+			h.Stop = true
+		case modOnce:
+			h.Once = true
+		default:
+			key, ok := keyModifiers[m]
+			switch {
+			case !ok:
+				c.errorf(pos, "unknown modifier .%s", m)
+			case !ev.keyboard:
+				c.errorf(pos, "key modifier .%s is not valid on @%s", m, n.Name)
+			default:
+				h.Keys = append(h.Keys, key)
+			}
+		}
+	}
+
+	switch x := n.Handler.(type) {
+	case *ast.BadExpr:
+		return
+	case *ast.Ident, *ast.SelectorExpr:
+		c.handlerFunc(scope, n, h, x)
+	case *ast.CallExpr:
+		if _, ok := c.expr(scope, x); !ok {
+			return
+		}
+	default:
+		c.errorf(x.Pos(), "handler for @%s must be a function name or a call", n.Name)
+		return
+	}
+
+	c.result.Handlers[n] = h
+}
+
+// handlerFunc checks a handler bound by name. The function may take
+// no parameters or a single parameter of the event's type.
+func (c *checker) handlerFunc(scope *types.Scope, n *EventAttr, h *Handler, x ast.Expr) {
+	if _, ok := c.expr(scope, x); !ok {
+		return
+	}
+
+	ident, _ := x.(*ast.Ident)
+	if sel, ok := x.(*ast.SelectorExpr); ok {
+		ident = sel.Sel
+	}
+	fn := c.info.Uses[ident]
+	var sig *types.Signature
+	switch fn := fn.(type) {
+	case *types.Func:
+		sig = fn.Type().(*types.Signature)
+	case *types.Var:
+		// a func typed prop of a component
+		if c.self(fn) {
+			sig, _ = fn.Type().Underlying().(*types.Signature)
+		}
+	}
+	if sig == nil {
+		c.errorf(x.Pos(), "handler %s for @%s is not a function", types.ExprString(x), n.Name)
+		return
+	}
+
+	h.Func = fn
+	params := sig.Params()
+	switch params.Len() {
+	case 0:
+	case 1:
+		if p := params.At(0); !isEventType(p.Type(), h.EventType) {
+			c.errorf(x.Pos(), "cannot use %s as handler for @%s: parameter %s has type %s, want %s.%s",
+				types.ExprString(x), n.Name, p.Name(), p.Type(), EventsPackage, h.EventType)
+			return
+		}
+		h.TakesEvent = true
+	default:
+		c.errorf(x.Pos(), "cannot use %s as handler for @%s: must take no parameters or a single %s.%s",
+			types.ExprString(x), n.Name, EventsPackage, h.EventType)
+	}
+}
+
+// isEventType reports whether t is the events type with the given name
+func isEventType(t types.Type, name string) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == EventsPackage && obj.Name() == name
+}
+
+// modifierPos returns the position of the i'th modifier of n
+func modifierPos(n *EventAttr, i int) token.Pos {
+	offs := 1 + len(n.Name) // @name
+	for _, m := range n.Modifiers[:i] {
+		offs += 1 + len(m)
+	}
+	return n.NamePos + token.Pos(offs+1)
+}
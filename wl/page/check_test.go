@@ -0,0 +1,646 @@
+package page
+
+import (
+	"testing"
+	"weblang/wl/ast"
+	"weblang/wl/importer"
+	wlparser "weblang/wl/parser"
+	"weblang/wl/scanner"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+const checkSrc = `package main
+
+import "events"
+
+type Todo struct {
+	Title string
+	Done bool
+}
+
+var todos []Todo
+var count int
+
+func add(e events.KeyUp) {
+	count = count + 1
+}
+
+func reset() {
+	count = 0
+}
+
+func toggle(todo Todo) {
+}
+
+func clicked(e events.Click) {
+}
+
+func pair(a int, b int) {
+}
+`
+
+func TestCheckHandlers(t *testing.T) {
+	tmpl, info := check(t, checkSrc, `<input @keyup.enter.esc.prevent="add" @focus.once="reset">
+{{for _, todo := range todos}}<button @click.stop="toggle(todo)">{{todo.Title}}</button>{{/for}}`)
+
+	input := tmpl.Nodes[0].(*Element)
+	add := info.Handlers[input.Attrs[0].(*EventAttr)]
+	if add == nil {
+		t.Fatalf("no handler recorded for @keyup")
+	}
+	if want, got := "keyup", add.DOMEvent; want != got {
+		t.Errorf("dom event, want %v got %v", want, got)
+	}
+	if want, got := "KeyUp", add.EventType; want != got {
+		t.Errorf("event type, want %v got %v", want, got)
+	}
+	if len(add.Keys) != 2 || add.Keys[0] != "Enter" || add.Keys[1] != "Escape" {
+		t.Errorf("keys, want [Enter Escape] got %v", add.Keys)
+	}
+	if !add.Prevent || add.Stop || add.Once {
+		t.Errorf("flags, want prevent only got %+v", add)
+	}
+	if add.Func == nil || add.Func.Name() != "add" || !add.TakesEvent {
+		t.Errorf("func, want add taking the event got %v (takes event %v)", add.Func, add.TakesEvent)
+	}
+
+	reset := info.Handlers[input.Attrs[1].(*EventAttr)]
+	if reset == nil || !reset.Once || reset.TakesEvent {
+		t.Errorf("@focus.once, got %+v", reset)
+	}
+
+	loop := tmpl.Nodes[2].(*ForBlock)
+	if info.Scopes[loop].Lookup("todo") == nil {
+		t.Errorf("loop variable todo not declared")
+	}
+	toggle := info.Handlers[loop.Body[0].(*Element).Attrs[0].(*EventAttr)]
+	if toggle == nil || toggle.Func != nil || !toggle.Stop {
+		t.Errorf("call handler, got %+v", toggle)
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		err  string
+	}{
+		{`<div @hover="reset"></div>`, "1:6: unknown event @hover"},
+		{`<div @click.fast="reset"></div>`, "1:13: unknown modifier .fast"},
+		{`<div @click.once.once="reset"></div>`, "1:18: duplicate modifier .once"},
+		{`<div @click.enter="reset"></div>`, "1:13: key modifier .enter is not valid on @click"},
+		{`<input @keyup="clicked">`, "1:16: cannot use clicked as handler for @keyup: parameter e has type events.Click, want events.KeyUp"},
+		{`<input @keyup="toggle">`, "1:16: cannot use toggle as handler for @keyup: parameter todo has type main.Todo, want events.KeyUp"},
+		{`<input @click="pair">`, "1:16: cannot use pair as handler for @click: must take no parameters or a single events.Click"},
+		{`<input @click="count">`, "1:16: handler count for @click is not a function"},
+		{`<input @click="count + 1">`, "1:16: handler for @click must be a function name or a call"},
+		{`<input @click="missing">`, "1:16: undeclared name: missing"},
+		{`<input @click="toggle(1)">`, "1:23: cannot convert 1 (untyped int constant) to Todo"},
+		{`<p>{{if count}}x{{/if}}</p>`, "1:9: non-boolean condition count in {{if}}"},
+		{`<p>{{for x := range count}}{{/for}}</p>`, "1:21: cannot range over count (type int)"},
+		{`<p>{{Todo}}</p>`, "1:6: Todo is not a value"},
+	}
+
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		pkg, info := checkPackage(t, fset, checkSrc)
+		tmpl, err := ParseFile(fset, "test.wlpage", test.tmpl)
+		if err != nil {
+			t.Fatalf("%s: parse error: %v", test.tmpl, err)
+		}
+		_, err = Check(fset, pkg, info, tmpl)
+		list, _ := err.(scanner.ErrorList)
+		if !containsError(list, test.err) {
+			t.Errorf("%s: want error %q got %v", test.tmpl, test.err, list)
+		}
+	}
+}
+
+const refSrc = `package main
+
+import "html"
+
+var names []string
+var title html.Input
+var boxes []html.Input
+var labels []html.Label
+`
+
+func TestCheckRefs(t *testing.T) {
+	tmpl, info := check(t, refSrc, `<input id="title">
+{{for i := range names}}<input id="boxes">{{/for}}
+{{for _, name := range names}}<label id="labels">{{name}}</label>{{/for}}`)
+
+	title := info.Refs[tmpl.Nodes[0].(*Element)]
+	if title == nil || title.Var.Name() != "title" || title.Loop != nil {
+		t.Errorf("title ref, got %+v", title)
+	}
+	loop := tmpl.Nodes[2].(*ForBlock)
+	boxes := info.Refs[loop.Body[0].(*Element)]
+	if boxes == nil || boxes.Var.Name() != "boxes" || boxes.Loop != loop {
+		t.Errorf("boxes ref, got %+v", boxes)
+	}
+	labels := info.Refs[tmpl.Nodes[4].(*ForBlock).Body[0].(*Element)]
+	if labels == nil || labels.Var.Name() != "labels" {
+		t.Errorf("labels ref, got %+v", labels)
+	}
+}
+
+func TestCheckRefErrors(t *testing.T) {
+	const rest = `{{for i := range names}}<input id="boxes">{{/for}}{{for i := range names}}<label id="labels"></label>{{/for}}`
+	tests := []struct {
+		tmpl string
+		err  string
+	}{
+		{rest, `test.wl:6:5: no element with id "title" for title (type html.Input)`},
+		{`<div id="title"></div>` + rest, `1:6: cannot bind title (type html.Input) to <div id="title">`},
+		{`<input id="title"><input id="title">` + rest, `1:26: duplicate element id "title"`},
+		{`<input id="title"><input id="boxes">`, `1:26: cannot bind boxes (type []html.Input) to <input id="boxes"> outside of {{for}}`},
+		{`{{for i := range names}}<input id="title">{{/for}}`, `1:32: cannot bind title (type html.Input) to <input id="title"> inside {{for}}, want []html.Input`},
+		{`<input id="title">{{for i := range names}}<label id="boxes"></label>{{/for}}<label id="labels"></label>`, `1:50: cannot bind boxes (type []html.Input) to <label id="boxes">`},
+	}
+
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		pkg, info := checkPackage(t, fset, refSrc)
+		tmpl, err := ParseFile(fset, "test.wlpage", test.tmpl)
+		if err != nil {
+			t.Fatalf("%s: parse error: %v", test.tmpl, err)
+		}
+		_, err = Check(fset, pkg, info, tmpl)
+		list, _ := err.(scanner.ErrorList)
+		if !containsError(list, test.err) {
+			t.Errorf("%s: want error %q got %v", test.tmpl, test.err, list)
+		}
+	}
+}
+
+const bindSrc = `package main
+
+type color enum {
+	Red = iota
+	Green
+}
+
+type todo struct {
+	Title string
+	Done bool
+}
+
+var name string
+var count int
+var ratio float
+var on bool
+var c color
+var todos []todo
+
+const max = 10
+
+func label() string {
+	return name
+}
+`
+
+func TestCheckBind(t *testing.T) {
+	tmpl, info := check(t, bindSrc, `<input @bind="name"><input type="checkbox" @bind="on"><textarea @bind="count"></textarea>`+
+		`<select @bind="c"></select><input @bind="ratio"><select @bind="on"></select>`+
+		`{{for _, t := range todos}}<input type=checkbox @bind="t.Done">{{/for}}`)
+
+	tests := []struct {
+		node    Node
+		prop    string
+		event   string
+		convert string
+	}{
+		{tmpl.Nodes[0], "value", "input", "string"},
+		{tmpl.Nodes[1], "checked", "change", "checked"},
+		{tmpl.Nodes[2], "value", "input", "int"},
+		{tmpl.Nodes[3], "value", "change", "enum"},
+		{tmpl.Nodes[4], "value", "input", "float"},
+		{tmpl.Nodes[5], "value", "change", "bool"},
+		{tmpl.Nodes[6].(*ForBlock).Body[0], "checked", "change", "checked"},
+	}
+	for i, test := range tests {
+		el := test.node.(*Element)
+		b := info.Bindings[el.Attrs[len(el.Attrs)-1].(*EventAttr)]
+		if b == nil {
+			t.Errorf("%d: no binding recorded", i)
+			continue
+		}
+		if b.Prop != test.prop || b.DOMEvent != test.event || b.Convert != test.convert {
+			t.Errorf("%d: want %v/%v/%v got %v/%v/%v", i, test.prop, test.event, test.convert, b.Prop, b.DOMEvent, b.Convert)
+		}
+	}
+}
+
+func TestCheckBindErrors(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		err  string
+	}{
+		{`<div @bind="name"></div>`, "1:6: @bind is not supported on <div>"},
+		{`<input @bind="max">`, "1:15: cannot bind max: not assignable"},
+		{`<input @bind="label()">`, "1:15: cannot bind label(): not assignable"},
+		{`<input @bind="name + name">`, "1:15: cannot bind name + name: not assignable"},
+		{`<input @bind="todos">`, "1:15: cannot bind todos (type []main.todo) to <input>"},
+		{`<input type=checkbox @bind="name">`, "1:29: cannot bind name (type string) to a checkbox, want bool"},
+		{`<input type=radio @bind="name">`, `1:19: @bind is not supported on <input type="radio">`},
+		{`<input value="x" @bind="name">`, "1:8: value attribute conflicts with @bind"},
+		{`<input @bind="name" @bind="name">`, "1:21: duplicate @bind on <input>"},
+		{`<input @bind.lazy="name">`, "1:14: @bind does not take modifiers"},
+		{`<input @bind="missing">`, "1:15: undeclared name: missing"},
+	}
+
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		pkg, info := checkPackage(t, fset, bindSrc)
+		tmpl, err := ParseFile(fset, "test.wlpage", test.tmpl)
+		if err != nil {
+			t.Fatalf("%s: parse error: %v", test.tmpl, err)
+		}
+		_, err = Check(fset, pkg, info, tmpl)
+		list, _ := err.(scanner.ErrorList)
+		if !containsError(list, test.err) {
+			t.Errorf("%s: want error %q got %v", test.tmpl, test.err, list)
+		}
+	}
+}
+
+const escapeSrc = `package main
+
+import "html"
+
+var name string
+var id int
+var color string
+var markup html.Safe
+var link html.Safe
+`
+
+func TestCheckEscapes(t *testing.T) {
+	tmpl, info := check(t, escapeSrc, `<p title="{{name}}" style="color: {{color}}">{{name}}{{markup}}</p>`+
+		`<a href="{{link}}"></a><a href="{{name}}/users/{{id}}?q={{if id > 0}}{{name}}{{/if}}"></a>`+
+		`<style>p { color: {{color}} }</style><script>var id = {{id}};</script>`+
+		`<img srcset="{{link}} 1x, /big/{{name}} 2x">`)
+
+	var actions []*Action
+	Inspect(tmpl.Nodes, func(n Node) bool {
+		if a, ok := n.(*Action); ok {
+			actions = append(actions, a)
+		}
+		return true
+	})
+
+	want := []Escape{
+		{Context: ContextAttr},
+		{Context: ContextCSS},
+		{Context: ContextText},
+		{Context: ContextText, Safe: true},
+		{Context: ContextURL, Safe: true},
+		{Context: ContextURL},
+		{Context: ContextURLPart},
+		{Context: ContextURLPart},
+		{Context: ContextCSS},
+		{Context: ContextScript},
+		{Context: ContextSrcset, Safe: true},
+		{Context: ContextSrcset},
+	}
+	if len(actions) != len(want) {
+		t.Fatalf("want %v actions got %v", len(want), len(actions))
+	}
+	for i, a := range actions {
+		if got := info.Escapes[a]; got != want[i] {
+			t.Errorf("%s: want %+v got %+v", types.ExprString(a.X), want[i], got)
+		}
+	}
+}
+
+func TestCheckEscapeErrors(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		err  string
+	}{
+		{`<button onclick="go({{id}})"></button>`, "1:21: cannot interpolate into event handler attribute onclick, use @click"},
+		{`<a href="javascript:go({{id}})"></a>`, "1:24: cannot interpolate into javascript: URL in href"},
+		{`<a href=" JavaScript:{{if id > 0}}{{name}}{{/if}}"></a>`, "1:35: cannot interpolate into javascript: URL in href"},
+		{`<a href="java&#9;script:{{name}}"></a>`, "1:25: cannot interpolate into javascript: URL in href"},
+		{`<iframe srcdoc="<p>{{name}}</p>"></iframe>`, "1:20: cannot interpolate into srcdoc attribute"},
+	}
+
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		pkg, info := checkPackage(t, fset, escapeSrc)
+		tmpl, err := ParseFile(fset, "test.wlpage", test.tmpl)
+		if err != nil {
+			t.Fatalf("%s: parse error: %v", test.tmpl, err)
+		}
+		_, err = Check(fset, pkg, info, tmpl)
+		list, _ := err.(scanner.ErrorList)
+		if !containsError(list, test.err) {
+			t.Errorf("%s: want error %q got %v", test.tmpl, test.err, list)
+		}
+	}
+}
+
+func check(t *testing.T, src, tmplSrc string) (*Template, *Info) {
+	fset := token.NewFileSet()
+	pkg, info := checkPackage(t, fset, src)
+	tmpl, err := ParseFile(fset, "test.wlpage", tmplSrc)
+	if err != nil {
+		t.Fatalf("Error during parse: %v", err)
+	}
+	pinfo, err := Check(fset, pkg, info, tmpl)
+	if err != nil {
+		t.Fatalf("Error during check: %v", err)
+	}
+	return tmpl, pinfo
+}
+
+func checkPackage(t *testing.T, fset *token.FileSet, src string) (*types.Package, *types.Info) {
+	f, err := wlparser.ParseFile(fset, "test.wl", src, 0)
+	if err != nil {
+		t.Fatalf("Error during parse: %v", err)
+	}
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	conf := types.Config{Importer: importer.Default()}
+	pkg, err := conf.Check("main", fset, []*ast.File{f}, info)
+	if err != nil {
+		t.Fatalf("Error during type check: %v", err)
+	}
+	return pkg, info
+}
+
+const componentSrc = `package main
+
+type Todo struct {
+	Title string
+	Done bool
+}
+
+type TodoItem struct {
+	todo Todo
+	label string
+	compact bool
+	remove func()
+	editing bool
+}
+
+func (t TodoItem) edit() {
+	t.editing = true
+}
+
+type Card struct {
+	title string
+}
+
+var todos []Todo
+var heading string
+
+func removeTodo(todo Todo) {
+}
+
+func clear() {
+}
+`
+
+const todoItemSrc = `<li><span @click="edit">{{todo.Title}}</span><button @click="remove">{{label}}</button>
+<placeholder id="extra"></placeholder></li>`
+
+const cardSrc = `<div><h2>{{title}}</h2><placeholder>empty</placeholder><placeholder id="footer"/></div>`
+
+func TestCheckComponents(t *testing.T) {
+	fset := token.NewFileSet()
+	pkg, info := checkPackage(t, fset, componentSrc)
+	item := parseComponent(t, fset, "TodoItem", todoItemSrc)
+	card := parseComponent(t, fset, "Card", cardSrc)
+	tmpl, err := ParseFile(fset, "test.wlpage", `<Card title="Todos: {{heading}}">
+{{for i, todo := range todos}}<TodoItem key="{{i}}" todo="{{todo}}" label="x" compact @remove="removeTodo(todo)"/>{{/for}}
+<placeholder id="footer"><button @click="clear">clear</button></placeholder>
+</Card>`)
+	if err != nil {
+		t.Fatalf("Error during parse: %v", err)
+	}
+	pinfo, err := Check(fset, pkg, info, tmpl, item, card)
+	if err != nil {
+		t.Fatalf("Error during check: %v", err)
+	}
+
+	ci := pinfo.Components[item]
+	if want, got := "TodoItem", ci.Props.Obj().Name(); want != got {
+		t.Errorf("props type, want %v got %v", want, got)
+	}
+	if len(ci.Slots) != 1 || ci.Slots["extra"] == nil {
+		t.Errorf("slots, want [extra] got %v", ci.Slots)
+	}
+	if want, got := 6, len(ci.Self); want != got {
+		t.Errorf("instance members, want %v got %v", want, got)
+	}
+
+	// the handlers in the component template are its method and prop
+	span := item.Template.Nodes[0].(*Element).Children[0].(*Element)
+	if h := pinfo.Handlers[span.Attrs[0].(*EventAttr)]; h == nil || h.Func.Name() != "edit" || !ci.Self[h.Func] {
+		t.Errorf("edit handler, got %+v", h)
+	}
+	button := item.Template.Nodes[0].(*Element).Children[1].(*Element)
+	if h := pinfo.Handlers[button.Attrs[0].(*EventAttr)]; h == nil || h.Func.Name() != "remove" || !ci.Self[h.Func] {
+		t.Errorf("remove handler, got %+v", h)
+	}
+
+	use := tmpl.Nodes[0].(*Element)
+	inst := pinfo.Instances[use]
+	if inst == nil || inst.Component != card {
+		t.Fatalf("no instance of Card recorded")
+	}
+	if f := inst.Props[use.Attrs[0]]; f == nil || f.Name() != "title" {
+		t.Errorf("title prop, got %v", f)
+	}
+	if want, got := 1, len(inst.Slots[""]); want != got {
+		t.Errorf("default slot content, want %v nodes got %v", want, got)
+	}
+	if want, got := 1, len(inst.Slots["footer"]); want != got {
+		t.Errorf("footer slot content, want %v nodes got %v", want, got)
+	}
+
+	loop := use.Children[1].(*ForBlock)
+	todo := pinfo.Instances[loop.Body[0].(*Element)]
+	if todo == nil || len(todo.Props) != 4 {
+		t.Errorf("TodoItem props, want 4 got %+v", todo)
+	}
+	if id, ok := todo.Key.(*ast.Ident); !ok || id.Name != "i" {
+		t.Errorf("TodoItem key, want i got %v", todo.Key)
+	}
+
+	footer := card.Template.Nodes[0].(*Element).Children[2].(*Element)
+	if s := pinfo.Slots[footer]; s == nil || s.Component != card || s.Name != "footer" {
+		t.Errorf("footer slot, got %+v", s)
+	}
+}
+
+func TestCheckComponentErrors(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		err  string
+	}{
+		{`<Card title="{{1}}"/>`, "1:16: cannot use 1 (type untyped int) as string value for prop title"},
+		{`<Card heading="x"/>`, "1:7: unknown prop heading of <Card>"},
+		{`<Card title/>`, "1:7: cannot use boolean attribute as string value for prop title"},
+		{`<TodoItem compact="yes"/>`, "1:11: cannot use text as bool value for prop compact"},
+		{`<TodoItem @label="clear"/>`, "1:11: prop label (type string) is not a func"},
+		{`<TodoItem @remove="removeTodo"/>`, "1:20: cannot use removeTodo (type func(todo main.Todo)) as func() value for prop remove"},
+		{`<TodoItem @remove.once="clear"/>`, "1:19: event props of <TodoItem> do not take modifiers"},
+		{`<TodoItem @bind="todos"/>`, "1:11: @bind is not supported on component <TodoItem>"},
+		{`<TodoItem {{if true}}compact{{/if}}/>`, "1:11: conditional props are not supported on component <TodoItem>"},
+		{`<TodoItem>text</TodoItem>`, "1:11: <TodoItem> has no default slot"},
+		{`<TodoItem><placeholder id="footer"></placeholder></TodoItem>`, `1:11: <TodoItem> has no slot "footer"`},
+		{`<Card><placeholder id="footer"></placeholder><placeholder id="footer"></placeholder></Card>`, `1:46: duplicate content for slot "footer"`},
+		{`<div><placeholder/></div>`, "1:6: <placeholder> outside of a component"},
+		{`<TodoItem key="x"/>`, "1:11: key of <TodoItem> must be a single {{action}}"},
+		{`<TodoItem key="{{todos}}"/>`, "1:18: cannot use todos (type []main.Todo) as key of <TodoItem>, want a string or an integer"},
+	}
+
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		pkg, info := checkPackage(t, fset, componentSrc)
+		item := parseComponent(t, fset, "TodoItem", todoItemSrc)
+		card := parseComponent(t, fset, "Card", cardSrc)
+		tmpl, err := ParseFile(fset, "test.wlpage", test.tmpl)
+		if err != nil {
+			t.Fatalf("%s: parse error: %v", test.tmpl, err)
+		}
+		_, err = Check(fset, pkg, info, tmpl, item, card)
+		list, _ := err.(scanner.ErrorList)
+		if !containsError(list, test.err) {
+			t.Errorf("%s: want error %q got %v", test.tmpl, test.err, list)
+		}
+	}
+}
+
+func TestCheckComponentDeclErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl string
+		err  string
+	}{
+		{"Missing", `<p></p>`, "Missing.wlcomp:1:1: component Missing has no props struct type Missing"},
+		{"removeTodo", `<p></p>`, "removeTodo.wlcomp:1:1: component removeTodo has no props struct type removeTodo"},
+		{"Card", `<p>{{todos}}</p>`, ""},
+		{"Card", `<p>{{label}}</p>`, "Card.wlcomp:1:6: undeclared name: label"},
+		{"Card", `<p><placeholder/><placeholder></placeholder></p>`, `Card.wlcomp:1:18: duplicate slot "" in component Card`},
+		{"Card", `<p><placeholder id="a" class="b"></placeholder></p>`, "Card.wlcomp:1:24: <placeholder> only takes an id attribute"},
+	}
+
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		pkg, info := checkPackage(t, fset, componentSrc)
+		comp := parseComponent(t, fset, test.name, test.tmpl)
+		tmpl, err := ParseFile(fset, "test.wlpage", `<p></p>`)
+		if err != nil {
+			t.Fatalf("%s: parse error: %v", test.tmpl, err)
+		}
+		_, err = Check(fset, pkg, info, tmpl, comp)
+		list, _ := err.(scanner.ErrorList)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.tmpl, err)
+			}
+			continue
+		}
+		if !containsError(list, test.err) {
+			t.Errorf("%s: want error %q got %v", test.tmpl, test.err, list)
+		}
+	}
+}
+
+func parseComponent(t *testing.T, fset *token.FileSet, name, src string) *Component {
+	tmpl, err := ParseFile(fset, name+".wlcomp", src)
+	if err != nil {
+		t.Fatalf("Error during parse of %s: %v", name, err)
+	}
+	return &Component{Name: name, Template: tmpl}
+}
+
+const routeSrc = `package main
+
+import "router"
+
+type filter enum {
+	All = iota
+	Active
+	Completed
+}
+
+var curFilter = filter.All
+var page int
+var tag string
+var done bool
+
+var filters = router.Path("#/{curFilter}")
+var pages = router.Path("#/page/{page}/{tag}")
+`
+
+func TestCheckRoutes(t *testing.T) {
+	_, info := check(t, routeSrc, `<a href="#/active">Active</a><a href="#/page/2/news">2</a>
+<a href="{{routes.Filters(filter.Completed)}}">Completed</a><a href="{{routes.Pages(page + 1, tag)}}">next</a>
+<a href="/about.html">About</a>`)
+
+	if want, got := 2, len(info.Routes); want != got {
+		t.Fatalf("routes, want %v got %v", want, got)
+	}
+	r := info.Routes[1]
+	if want, got := "pages", r.Var.Name(); want != got {
+		t.Errorf("route var, want %v got %v", want, got)
+	}
+	if !r.Hash || len(r.Segments) != 3 {
+		t.Fatalf("route segments, want hash route with 3 segments got %+v", r)
+	}
+	if s := r.Segments[0]; s.Param != nil || s.Literal != "page" {
+		t.Errorf("literal segment, got %+v", s)
+	}
+	if s := r.Segments[1]; s.Param == nil || s.Param.Name() != "page" || s.Convert != "int" {
+		t.Errorf("int segment, got %+v", s)
+	}
+	if want, got := "func(page int, tag string) string", r.URL.Type().String(); want != got {
+		t.Errorf("URL func, want %v got %v", want, got)
+	}
+	if want, got := "enum", info.Routes[0].Segments[0].Convert; want != got {
+		t.Errorf("enum segment, want %v got %v", want, got)
+	}
+}
+
+func TestCheckRouteErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		tmpl string
+		err  string
+	}{
+		{"", `<a href="#/archived">x</a>`, `1:4: href "#/archived" matches no route`},
+		{"", `<a href="#/page/two/news">x</a>`, `1:4: href "#/page/two/news" matches no route`},
+		{"", `<a href="{{routes.Filters(1)}}">x</a>`, "1:27: cannot convert 1 (untyped int constant) to filter"},
+		{"", `<a href="{{routes.Pages(1)}}">x</a>`, "1:26: too few arguments in call to routes.Pages"},
+		{"var Filters = router.Path(\"#/x\")", `<p></p>`, "route Filters conflicts with another route for routes.Filters"},
+		{"var bad = router.Path(\"#/{done}\")", `<p></p>`, "cannot bind route segment {done} to done (type bool), want an enum, int or string"},
+		{"var bad = router.Path(\"#/{missing}\")", `<p></p>`, "route segment {missing} is not a package variable"},
+		{"var bad = router.Path(\"#/{page}/{page}\")", `<p></p>`, "duplicate route segment {page}"},
+		{"var bad = router.Path(\"page\")", `<p></p>`, `route pattern "page" must start with "#/" or "/"`},
+		{"var bad = router.Path(\"#/a{b}\")", `<p></p>`, `invalid segment "a{b}" in route pattern "#/a{b}"`},
+		{"var routes = 1", `<p></p>`, "routes is reserved for the URLs of routes"},
+	}
+
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		pkg, info := checkPackage(t, fset, routeSrc+test.src)
+		tmpl, err := ParseFile(fset, "test.wlpage", test.tmpl)
+		if err != nil {
+			t.Fatalf("%s: parse error: %v", test.tmpl, err)
+		}
+		_, err = Check(fset, pkg, info, tmpl)
+		list, _ := err.(scanner.ErrorList)
+		if !containsError(list, test.err) {
+			t.Errorf("%s %s: want error %q got %v", test.src, test.tmpl, test.err, list)
+		}
+	}
+}
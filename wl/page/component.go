@@ -0,0 +1,374 @@
+package page
+
+import (
+	"strings"
+	"weblang/wl/ast"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// slotTag is the tag declaring a slot in a component template, and
+// filling a named slot at a use of the component
+const slotTag = "placeholder"
+
+// keyAttr is the attribute of a use of a component identifying the
+// instance it renders, rather than a prop
+const keyAttr = "key"
+
+// Component is a reusable template used from other templates as a
+// custom tag. Its props are the fields of the package struct type
+// with the same name as the component; the struct's methods may be
+// used as handlers in the component template.
+type Component struct {
+	Name     string
+	Template *Template
+}
+
+// ComponentInfo is a checked component
+type ComponentInfo struct {
+	Props *types.Named // struct type declaring the props
+
+	// Slots maps slot names to their <placeholder> element in the
+	// template; the default slot is named ""
+	Slots map[string]*Element
+
+	// Self holds the objects declared for the props and methods,
+	// which are members of the component instance
+	Self map[types.Object]bool
+}
+
+// Instance is a use of a component in a template
+type Instance struct {
+	Component *Component
+
+	// Props maps each prop attribute to the struct field it sets
+	Props map[Node]*types.Var
+
+	// Slots maps slot names to the content filling them
+	Slots map[string][]Node
+
+	// Key is the action of the key attribute, a string or integer
+	// identifying the instance among the iterations of the innermost
+	// enclosing {{for}}, or nil to identify it by the loop key
+	Key ast.Expr
+}
+
+// Slot is a <placeholder> declaring a slot in a component template;
+// its content is the fallback if the slot isn't filled
+type Slot struct {
+	Component *Component
+	Name      string
+}
+
+// slotName returns the slot named by a <placeholder> element
+func slotName(el *Element) string {
+	_, name, _ := staticAttr(el, "id")
+	return name
+}
+
+// declareComponents resolves the props type of each component and
+// collects the slots declared by its template
+func (c *checker) declareComponents(comps []*Component) {
+	for _, comp := range comps {
+		pos := templatePos(comp.Template)
+		if prev := c.comps[comp.Name]; prev != nil {
+			c.errorf(pos, "component %s redeclared", comp.Name)
+			continue
+		}
+		c.comps[comp.Name] = comp
+
+		ci := &ComponentInfo{
+			Slots: make(map[string]*Element),
+			Self:  make(map[types.Object]bool),
+		}
+		c.result.Components[comp] = ci
+
+		obj, _ := c.pkg.Scope().Lookup(comp.Name).(*types.TypeName)
+		if obj != nil {
+			if named, ok := obj.Type().(*types.Named); ok {
+				if _, ok := named.Underlying().(*types.Struct); ok {
+					ci.Props = named
+				}
+			}
+		}
+		if ci.Props == nil {
+			c.errorf(pos, "component %s has no props struct type %s", comp.Name, comp.Name)
+		}
+
+		Inspect(comp.Template.Nodes, func(n Node) bool {
+			el, ok := n.(*Element)
+			if !ok {
+				return true
+			}
+			if el.Name != slotTag {
+				// the content of a nested component fills its slots
+				return !c.isComponent(el)
+			}
+			name := slotName(el)
+			if prev := ci.Slots[name]; prev != nil {
+				c.errorf(el.Pos(), "duplicate slot %q in component %s (previous at %s)", name, comp.Name, c.fset.Position(prev.Pos()))
+				return true
+			}
+			ci.Slots[name] = el
+			return true
+		})
+	}
+}
+
+// templatePos returns the position of the first node of tmpl
+func templatePos(tmpl *Template) token.Pos {
+	if len(tmpl.Nodes) > 0 {
+		return tmpl.Nodes[0].Pos()
+	}
+	return token.NoPos
+}
+
+func (c *checker) isComponent(el *Element) bool {
+	return el.Name != "" && c.comps[el.Name] != nil
+}
+
+// component checks the template of comp in a scope declaring its props
+// and methods
+func (c *checker) component(comp *Component) {
+	ci := c.result.Components[comp]
+	tmpl := comp.Template
+
+	var pos, end token.Pos
+	if n := len(tmpl.Nodes); n > 0 {
+		pos, end = tmpl.Nodes[0].Pos(), tmpl.Nodes[n-1].End()
+	}
+	scope := types.NewScope(c.top, pos, end, "component "+comp.Name)
+	if ci.Props != nil {
+		st := ci.Props.Underlying().(*types.Struct)
+		for i := 0; i < st.NumFields(); i++ {
+			f := st.Field(i)
+			v := types.NewVar(f.Pos(), c.pkg, f.Name(), f.Type())
+			scope.Insert(v)
+			ci.Self[v] = true
+		}
+		for i := 0; i < ci.Props.NumMethods(); i++ {
+			m := ci.Props.Method(i)
+			fn := types.NewFunc(m.Pos(), c.pkg, m.Name(), m.Type().(*types.Signature))
+			if alt := scope.Insert(fn); alt != nil {
+				c.errorf(m.Pos(), "method %s.%s conflicts with prop %s", comp.Name, m.Name(), m.Name())
+				continue
+			}
+			ci.Self[fn] = true
+		}
+	}
+
+	outer := c.comp
+	c.comp = comp
+	c.nodes(scope, tmpl.Nodes)
+	c.comp = outer
+}
+
+// slot checks a <placeholder> declaring a slot of the component being
+// checked, whose content is the fallback for the slot
+func (c *checker) slot(scope *types.Scope, el *Element) {
+	c.result.Slots[el] = &Slot{Component: c.comp, Name: slotName(el)}
+	for _, n := range el.Attrs {
+		if a, ok := n.(*Attr); !ok || a.Name != "id" {
+			c.errorf(n.Pos(), "<%s> only takes an id attribute", slotTag)
+		}
+	}
+	if a, _, static := staticAttr(el, "id"); a != nil && !static {
+		c.errorf(a.Pos(), "<%s> id must not contain actions", slotTag)
+	}
+	c.nodes(scope, el.Children)
+}
+
+// instance checks a use of comp: its attributes set props and its
+// content fills slots
+func (c *checker) instance(scope *types.Scope, el *Element, comp *Component) {
+	ci := c.result.Components[comp]
+	inst := &Instance{
+		Component: comp,
+		Props:     make(map[Node]*types.Var),
+		Slots:     make(map[string][]Node),
+	}
+	c.result.Instances[el] = inst
+
+	var st *types.Struct
+	if ci.Props != nil {
+		st = ci.Props.Underlying().(*types.Struct)
+	}
+	field := func(pos token.Pos, name string) *types.Var {
+		if st == nil {
+			return nil
+		}
+		for i := 0; i < st.NumFields(); i++ {
+			if f := st.Field(i); f.Name() == name {
+				return f
+			}
+		}
+		c.errorf(pos, "unknown prop %s of <%s>", name, comp.Name)
+		return nil
+	}
+
+	set := make(map[string]bool)
+	for _, a := range el.Attrs {
+		switch a := a.(type) {
+		case *Attr:
+			if set[a.Name] {
+				c.errorf(a.Pos(), "duplicate prop %s", a.Name)
+			}
+			set[a.Name] = true
+			if a.Name == keyAttr {
+				inst.Key = c.key(scope, a, comp)
+				continue
+			}
+			f := field(a.Pos(), a.Name)
+			c.prop(scope, a, f)
+			if f != nil {
+				inst.Props[a] = f
+			}
+		case *EventAttr:
+			if set[a.Name] {
+				c.errorf(a.Pos(), "duplicate prop %s", a.Name)
+			}
+			set[a.Name] = true
+			if a.Name == bindAttr {
+				c.errorf(a.Pos(), "@bind is not supported on component <%s>", comp.Name)
+				continue
+			}
+			if len(a.Modifiers) > 0 {
+				c.errorf(modifierPos(a, 0), "event props of <%s> do not take modifiers", comp.Name)
+			}
+			f := field(a.Pos(), a.Name)
+			c.funcProp(scope, a, f)
+			if f != nil {
+				inst.Props[a] = f
+			}
+		case *IfBlock:
+			c.errorf(a.Pos(), "conditional props are not supported on component <%s>", comp.Name)
+		}
+	}
+
+	// named fills are <placeholder id=".."> children, anything else
+	// fills the default slot
+	fills := make(map[string]token.Pos)
+	for _, n := range el.Children {
+		if fill, ok := n.(*Element); ok && fill.Name == slotTag {
+			name := slotName(fill)
+			if prev, dup := fills[name]; dup {
+				c.errorf(fill.Pos(), "duplicate content for slot %q (previous at %s)", name, c.fset.Position(prev))
+			} else if ci.Slots[name] == nil {
+				c.errorf(fill.Pos(), "<%s> has no slot %q", comp.Name, name)
+			}
+			fills[name] = fill.Pos()
+			inst.Slots[name] = fill.Children
+			c.nodes(scope, fill.Children)
+			continue
+		}
+		if t, ok := n.(*Text); ok && strings.TrimSpace(t.Value) == "" {
+			continue
+		}
+		if _, ok := fills[""]; !ok {
+			if ci.Slots[""] == nil {
+				c.errorf(n.Pos(), "<%s> has no default slot", comp.Name)
+			}
+			fills[""] = n.Pos()
+		}
+		inst.Slots[""] = append(inst.Slots[""], n)
+		c.nodes(scope, []Node{n})
+	}
+}
+
+// prop checks an attribute setting a prop. A single action sets the
+// prop to the value of its expression, other values are strings and a
+// boolean attribute sets a bool prop.
+func (c *checker) prop(scope *types.Scope, a *Attr, f *types.Var) {
+	if len(a.Value) == 1 {
+		if x, ok := a.Value[0].(*Action); ok {
+			tv, ok := c.value(scope, x.X)
+			if !ok || f == nil {
+				return
+			}
+			if !types.AssignableTo(tv.Type, f.Type()) {
+				c.errorf(x.X.Pos(), "cannot use %s (type %s) as %s value for prop %s",
+					types.ExprString(x.X), tv.Type, f.Type(), a.Name)
+			}
+			return
+		}
+	}
+
+	outer := c.ctx
+	c.ctx = ContextAttr
+	c.attrValue(scope, a.Value, false)
+	c.ctx = outer
+	if f == nil {
+		return
+	}
+
+	want := types.IsString
+	if !a.HasValue {
+		want = types.IsBoolean
+	}
+	if b, ok := f.Type().Underlying().(*types.Basic); !ok || b.Info()&want == 0 {
+		what := "text"
+		if !a.HasValue {
+			what = "boolean attribute"
+		}
+		c.errorf(a.Pos(), "cannot use %s as %s value for prop %s", what, f.Type(), a.Name)
+	}
+}
+
+// key checks the key attribute of a use of comp, which must be a single
+// action of string or integer type, and returns its expression
+func (c *checker) key(scope *types.Scope, a *Attr, comp *Component) ast.Expr {
+	var x *Action
+	if len(a.Value) == 1 {
+		x, _ = a.Value[0].(*Action)
+	}
+	if x == nil {
+		c.errorf(a.Pos(), "key of <%s> must be a single {{action}}", comp.Name)
+		return nil
+	}
+	tv, ok := c.value(scope, x.X)
+	if !ok {
+		return nil
+	}
+	if b, ok := tv.Type.Underlying().(*types.Basic); !ok || b.Info()&(types.IsString|types.IsInteger) == 0 {
+		c.errorf(x.X.Pos(), "cannot use %s (type %s) as key of <%s>, want a string or an integer", types.ExprString(x.X), tv.Type, comp.Name)
+		return nil
+	}
+	return x.X
+}
+
+// funcProp checks an @name attribute setting a prop of func type,
+// either to a function or to a call evaluated when the prop is called
+func (c *checker) funcProp(scope *types.Scope, a *EventAttr, f *types.Var) {
+	var sig *types.Signature
+	if f != nil {
+		if sig, _ = f.Type().Underlying().(*types.Signature); sig == nil {
+			c.errorf(a.Pos(), "prop %s (type %s) is not a func", a.Name, f.Type())
+		}
+	}
+
+	switch x := a.Handler.(type) {
+	case *ast.BadExpr:
+	case *ast.CallExpr:
+		if _, ok := c.expr(scope, x); !ok || sig == nil {
+			return
+		}
+		if sig.Params().Len() > 0 || sig.Results().Len() > 0 {
+			c.errorf(x.Pos(), "cannot use call %s as prop %s (type %s), want a func",
+				types.ExprString(x), a.Name, f.Type())
+		}
+	default:
+		tv, ok := c.value(scope, x)
+		if !ok || sig == nil {
+			return
+		}
+		if !types.AssignableTo(tv.Type, f.Type()) {
+			c.errorf(x.Pos(), "cannot use %s (type %s) as %s value for prop %s",
+				types.ExprString(x), tv.Type, f.Type(), a.Name)
+		}
+	}
+}
+
+// self reports whether obj is a member of the component being checked
+func (c *checker) self(obj types.Object) bool {
+	return c.comp != nil && c.result.Components[c.comp].Self[obj]
+}
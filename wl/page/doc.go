@@ -0,0 +1,21 @@
+/*
+
+Package page parses and type-checks .wlpage templates. A template is html
+with {{expr}} actions, {{if}} and {{for}} blocks and @event bindings whose
+expressions are checked against the wl package backing the page.
+
+Components are templates used from other templates as custom tags, such
+as <TodoItem todo="{{todo}}" @remove="removeTodo(todo)">. The attributes
+of a use set the fields of the package struct named after the component,
+and its content fills the slots the component template declares with
+<placeholder id="name">fallback</placeholder>; <placeholder> without an
+id is the default slot.
+
+The instances of a component keep their state between renders. Those
+rendered in a {{for}} block are told apart by the loop key, so removing
+an item of a slice hands the state of its instance to the next item;
+a key="{{item.ID}}" attribute identifies them by a string or integer of
+the item instead.
+
+*/
+package page
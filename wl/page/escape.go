@@ -0,0 +1,173 @@
+package page
+
+import (
+	"html"
+	"strings"
+	"weblang/wl/types"
+)
+
+// Context is the html context an action's output is placed in, which
+// determines how it is escaped
+type Context int
+
+const (
+	ContextText    Context = iota // element content
+	ContextAttr                   // attribute value
+	ContextURL                    // start of a URL attribute value
+	ContextURLPart                // URL attribute value after its start
+	ContextCSS                    // style attribute or <style> content
+	ContextScript                 // <script> content
+	ContextSrcset                 // srcset attribute value, a list of URLs
+)
+
+// Escape describes how the output of an action is escaped
+type Escape struct {
+	Context Context
+
+	// Safe is set if the action is an html.Safe value, which is
+	// output as-is
+	Safe bool
+}
+
+// urlAttrs are the attributes holding URLs
+var urlAttrs = map[string]bool{
+	"action":     true,
+	"background": true,
+	"cite":       true,
+	"formaction": true,
+	"href":       true,
+	"icon":       true,
+	"longdesc":   true,
+	"manifest":   true,
+	"poster":     true,
+	"src":        true,
+	"usemap":     true,
+	"xlink:href": true,
+}
+
+// contentContext returns the context of the content of the element tag
+func contentContext(tag string) Context {
+	switch strings.ToLower(tag) {
+	case "script":
+		return ContextScript
+	case "style":
+		return ContextCSS
+	}
+	return ContextText
+}
+
+// isSafe reports whether t is html.Safe
+func isSafe(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == HTMLPackage && obj.Name() == "Safe"
+}
+
+// firstAction returns the first action in nodes, looking inside {{if}}
+// blocks, or nil
+func firstAction(nodes []Node) *Action {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *Action:
+			return n
+		case *IfBlock:
+			if a := firstAction(n.Then); a != nil {
+				return a
+			}
+			if a := firstAction(n.Else); a != nil {
+				return a
+			}
+		}
+	}
+	return nil
+}
+
+// attr checks an attribute value, recording the context of each of
+// its actions
+func (c *checker) attr(scope *types.Scope, n *Attr) {
+	name := strings.ToLower(n.Name)
+	if a := firstAction(n.Value); a != nil {
+		switch {
+		case strings.HasPrefix(name, "on"):
+			c.errorf(a.Pos(), "cannot interpolate into event handler attribute %s, use @%s", n.Name, name[2:])
+		case name == "srcdoc":
+			// the value is the markup of a document of the same origin
+			c.errorf(a.Pos(), "cannot interpolate into srcdoc attribute")
+		case urlAttrs[name] && len(n.Value) > 0:
+			if t, ok := n.Value[0].(*Text); ok {
+				if strings.HasPrefix(urlText(t.Value), "javascript:") {
+					c.errorf(a.Pos(), "cannot interpolate into javascript: URL in %s", n.Name)
+				}
+			}
+		}
+	}
+
+	if name == "href" {
+		c.href(n)
+	}
+
+	outer := c.ctx
+	defer func() { c.ctx = outer }()
+	switch {
+	case urlAttrs[name]:
+		c.ctx = ContextURL
+	case name == "srcset":
+		c.ctx = ContextSrcset
+	case name == "style":
+		c.ctx = ContextCSS
+	default:
+		c.ctx = ContextAttr
+	}
+	c.attrValue(scope, n.Value, c.ctx == ContextURL)
+}
+
+// urlText returns the lower case text of the start of a URL attribute
+// value without the tabs, newlines and control characters the URL
+// parser drops, so it has the scheme the browser sees
+func urlText(value string) string {
+	return strings.ToLower(strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, html.UnescapeString(value)))
+}
+
+// attrValue checks the parts of an attribute value. Actions in a URL
+// attribute are in ContextURL only at the start of the value.
+func (c *checker) attrValue(scope *types.Scope, nodes []Node, start bool) {
+	for _, n := range nodes {
+		if !start && c.ctx == ContextURL {
+			c.ctx = ContextURLPart
+		}
+		switch n := n.(type) {
+		case *Text:
+			start = start && n.Value == ""
+		case *Action:
+			c.action(scope, n)
+			start = false
+		case *IfBlock:
+			c.cond(scope, n.Cond)
+			ctx := c.ctx
+			c.attrValue(scope, n.Then, start)
+			c.ctx = ctx
+			c.attrValue(scope, n.Else, start)
+			start = false
+		default:
+			c.nodes(scope, []Node{n})
+		}
+	}
+}
+
+// action checks the expression of an action and records how its
+// output is escaped
+func (c *checker) action(scope *types.Scope, n *Action) {
+	tv, ok := c.value(scope, n.X)
+	if !ok {
+		return
+	}
+	c.result.Escapes[n] = Escape{Context: c.ctx, Safe: isSafe(tv.Type)}
+}
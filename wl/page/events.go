@@ -0,0 +1,51 @@
+package page
+
+// eventInfo describes an event that can be bound with @name
+type eventInfo struct {
+	domEvent string // DOM event type listened for
+	typeName string // name of the events.* type passed to handlers
+	keyboard bool   // whether key modifiers apply
+}
+
+// events is the set of bindable events by name
+var events = map[string]eventInfo{
+	"click":      {"click", "Click", false},
+	"dblclick":   {"dblclick", "DblClick", false},
+	"mouseenter": {"mouseenter", "MouseEnter", false},
+	"mouseleave": {"mouseleave", "MouseLeave", false},
+	"keyup":      {"keyup", "KeyUp", true},
+	"keydown":    {"keydown", "KeyDown", true},
+	"keypress":   {"keypress", "KeyPress", true},
+	"input":      {"input", "Input", false},
+	"change":     {"change", "Change", false},
+	"checked":    {"change", "Checked", false},
+	"focus":      {"focus", "Focus", false},
+	"blur":       {"blur", "Blur", false},
+	"submit":     {"submit", "Submit", false},
+}
+
+// keyModifiers map key modifiers to the KeyboardEvent.key value
+// they filter on
+var keyModifiers = map[string]string{
+	"enter":     "Enter",
+	"esc":       "Escape",
+	"tab":       "Tab",
+	"space":     " ",
+	"up":        "ArrowUp",
+	"down":      "ArrowDown",
+	"left":      "ArrowLeft",
+	"right":     "ArrowRight",
+	"delete":    "Delete",
+	"backspace": "Backspace",
+}
+
+// behavior modifiers valid on any event
+const (
+	modPrevent = "prevent"
+	modStop    = "stop"
+	modOnce    = "once"
+)
+
+// EventsPackage is the import path of the package declaring the
+// event types passed to handlers
+const EventsPackage = "events"
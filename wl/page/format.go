@@ -0,0 +1,393 @@
+package page
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"weblang/wl/ast"
+	"weblang/wl/printer"
+	"weblang/wl/token"
+)
+
+// preformatted elements keep the indentation of their content
+var preformatted = map[string]bool{
+	"pre": true, "textarea": true, "script": true, "style": true,
+}
+
+// Format formats the template src. The wl expressions of actions and
+// of {{if}} and {{for}} headers are printed in canonical form, and the
+// content lines of blocks spanning several lines are indented one level
+// deeper than the line opening the block, with {{else}} and the end
+// action at the level of the opening line. All other markup is left as
+// is. Errors in src are returned as a scanner.ErrorList.
+func Format(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	tmpl, err := ParseFile(fset, "", src)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &formatter{
+		fset:   fset,
+		src:    src,
+		unit:   indentUnit(src),
+		indent: make(map[int]string),
+		frozen: make(map[int]bool),
+	}
+	fset.Iterate(func(file *token.File) bool {
+		f.base = file.Base()
+		return false
+	})
+	f.lineStarts()
+	f.freeze(tmpl.Nodes)
+	f.nodes(tmpl.Nodes, true)
+	return f.apply(), nil
+}
+
+type formatter struct {
+	fset  *token.FileSet
+	src   []byte
+	base  int
+	unit  string // one level of indentation
+	lines []int  // start offsets of the lines of src
+	edits []edit
+
+	// indent holds the new indentation of the lines re-indented so
+	// far; frozen lines are never re-indented
+	indent map[int]string
+	frozen map[int]bool
+}
+
+// edit replaces src[start:end] with text
+type edit struct {
+	start, end int
+	text       string
+}
+
+func (f *formatter) offset(pos token.Pos) int { return int(pos) - f.base }
+
+func (f *formatter) lineStarts() {
+	f.lines = []int{0}
+	for i, c := range f.src {
+		if c == '\n' {
+			f.lines = append(f.lines, i+1)
+		}
+	}
+}
+
+// line returns the index of the line containing offs
+func (f *formatter) line(offs int) int {
+	return sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offs }) - 1
+}
+
+// sourceIndent returns the indentation of line i in the source
+func (f *formatter) sourceIndent(i int) string {
+	start := f.lines[i]
+	end := start
+	for end < len(f.src) && (f.src[end] == ' ' || f.src[end] == '\t') {
+		end++
+	}
+	return string(f.src[start:end])
+}
+
+// currentIndent returns the indentation of line i, as re-indented so far
+func (f *formatter) currentIndent(i int) string {
+	if ind, ok := f.indent[i]; ok {
+		return ind
+	}
+	return f.sourceIndent(i)
+}
+
+// blank reports whether line i has only white space
+func (f *formatter) blank(i int) bool {
+	end := len(f.src)
+	if i+1 < len(f.lines) {
+		end = f.lines[i+1]
+	}
+	return len(bytes.TrimSpace(f.src[f.lines[i]:end])) == 0
+}
+
+// indentUnit returns the indentation of one level in src: a tab if
+// lines are indented with tabs, otherwise the least number of spaces
+// lines are indented with
+func indentUnit(src []byte) string {
+	unit := ""
+	for _, line := range bytes.Split(src, []byte("\n")) {
+		ind := line[:len(line)-len(bytes.TrimLeft(line, " \t"))]
+		switch {
+		case len(ind) == 0 || len(ind) == len(line):
+		case ind[0] == '\t':
+			return "\t"
+		case unit == "" || len(ind) < len(unit):
+			unit = string(ind)
+		}
+	}
+	if unit == "" {
+		return "\t"
+	}
+	return unit
+}
+
+// freeze marks the lines whose indentation is significant or part of
+// another construct: lines starting inside preformatted elements,
+// comments and actions
+func (f *formatter) freeze(nodes []Node) {
+	mark := func(from, to token.Pos) {
+		first, last := f.line(f.offset(from)), f.line(f.offset(to))
+		for i := first + 1; i <= last && i < len(f.lines); i++ {
+			if f.lines[i] < f.offset(to) {
+				f.frozen[i] = true
+			}
+		}
+	}
+	Inspect(nodes, func(n Node) bool {
+		switch n := n.(type) {
+		case *Element:
+			if preformatted[strings.ToLower(n.Name)] {
+				mark(n.Pos(), n.End())
+				return false
+			}
+		case *Raw, *Action, *Attr, *EventAttr:
+			mark(n.Pos(), n.End())
+		case *IfBlock:
+			mark(n.If, f.actionEnd(n.If))
+		case *ForBlock:
+			mark(n.For, f.actionEnd(n.For))
+		}
+		return true
+	})
+}
+
+// actionEnd returns the position after the "}}" of the action at pos
+func (f *formatter) actionEnd(pos token.Pos) token.Pos {
+	offs := f.offset(pos)
+	if i := bytes.Index(f.src[offs:], []byte("}}")); i >= 0 {
+		return pos + token.Pos(i+2)
+	}
+	return token.Pos(f.base + len(f.src))
+}
+
+// nodes formats nodes; content is set for nodes outside of tags, whose
+// blocks are re-indented
+func (f *formatter) nodes(nodes []Node, content bool) {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *Element:
+			if preformatted[strings.ToLower(n.Name)] {
+				f.nodes(n.Attrs, false)
+				continue
+			}
+			f.nodes(n.Attrs, false)
+			f.nodes(n.Children, true)
+		case *Attr:
+			f.nodes(n.Value, false)
+		case *Action:
+			f.replace(n.Lbrace, n.End(), "{{"+f.expr(n.X)+"}}")
+		case *IfBlock:
+			f.ifBlock(n, content)
+		case *ForBlock:
+			f.forBlock(n, content)
+		}
+	}
+}
+
+func (f *formatter) ifBlock(b *IfBlock, content bool) {
+	header := f.actionEnd(b.If)
+	f.replace(b.If, header, "{{if "+f.expr(b.Cond)+"}}")
+
+	var terms []token.Pos // {{else}}, if any, and {{/if}}
+	elseAt := f.nextAction(header, b.Then)
+	if b.Else != nil || elseAt != f.lastAction(b.EndPos) {
+		terms = append(terms, elseAt)
+		f.replace(elseAt, f.actionEnd(elseAt), "{{"+termElse+"}}")
+	}
+	end := f.lastAction(b.EndPos)
+	terms = append(terms, end)
+	f.replace(end, b.EndPos, "{{"+termEndIf+"}}")
+
+	if content {
+		f.reindent(b.If, terms, b.EndPos, b.Then, b.Else)
+	}
+	f.nodes(b.Then, content)
+	f.nodes(b.Else, content)
+}
+
+func (f *formatter) forBlock(b *ForBlock, content bool) {
+	header := f.actionEnd(b.For)
+	if b.Key != nil && b.X != nil {
+		vars := b.Key.Name
+		if b.Value != nil {
+			vars += ", " + b.Value.Name
+		}
+		f.replace(b.For, header, "{{for "+vars+" := range "+f.expr(b.X)+"}}")
+	}
+	end := f.lastAction(b.EndPos)
+	f.replace(end, b.EndPos, "{{"+termEndFo+"}}")
+
+	if content {
+		f.reindent(b.For, []token.Pos{end}, b.EndPos, b.Body)
+	}
+	f.nodes(b.Body, content)
+}
+
+// nextAction returns the position of the first action after the block
+// content nodes, which start at pos
+func (f *formatter) nextAction(pos token.Pos, nodes []Node) token.Pos {
+	if len(nodes) > 0 {
+		pos = nodes[len(nodes)-1].End()
+	}
+	offs := f.offset(pos)
+	if i := bytes.Index(f.src[offs:], []byte("{{")); i >= 0 {
+		return pos + token.Pos(i)
+	}
+	return pos
+}
+
+// lastAction returns the position of the last action ending at end
+func (f *formatter) lastAction(end token.Pos) token.Pos {
+	offs := f.offset(end)
+	if offs > len(f.src) {
+		offs = len(f.src)
+	}
+	if i := bytes.LastIndex(f.src[:offs], []byte("{{")); i >= 0 {
+		return token.Pos(f.base + i)
+	}
+	return end
+}
+
+// reindent indents the lines of a block opened at open one level
+// deeper than the opening line. Lines starting with one of the
+// terminator actions at terms are indented like the opening line; body
+// holds the content of the block.
+func (f *formatter) reindent(open token.Pos, terms []token.Pos, end token.Pos, body ...[]Node) {
+	first, last := f.line(f.offset(open)), f.line(f.offset(end)-1)
+	if first == last {
+		return
+	}
+	base := f.currentIndent(first)
+
+	isTerm := make(map[int]bool)
+	for _, t := range terms {
+		i := f.line(f.offset(t))
+		if f.lines[i]+len(f.sourceIndent(i)) == f.offset(t) {
+			isTerm[i] = true
+		}
+	}
+
+	// the blocks nested in the content itself, rather than in its
+	// elements, start at its level; the lines inside nested blocks are
+	// normalized with their block
+	headers := make(map[int]bool)
+	nested := make(map[int]bool)
+	for _, nodes := range body {
+		for _, n := range nodes {
+			switch n.(type) {
+			case *IfBlock, *ForBlock:
+				if i := f.line(f.offset(n.Pos())); f.lines[i]+len(f.sourceIndent(i)) == f.offset(n.Pos()) {
+					headers[i] = true
+				}
+			}
+		}
+		Inspect(nodes, func(n Node) bool {
+			switch n.(type) {
+			case *IfBlock, *ForBlock:
+				for i := f.line(f.offset(n.Pos())) + 1; i <= f.line(f.offset(n.End())-1); i++ {
+					nested[i] = true
+				}
+				return false
+			}
+			return true
+		})
+	}
+
+	// the content between terminators keeps its relative indentation,
+	// shifted so that its least indented line is one level deeper than
+	// the opening line
+	for from := first + 1; from <= last; {
+		to := from
+		for to <= last && !isTerm[to] {
+			to++
+		}
+		f.shift(from, to, base+f.unit, headers, nested)
+		if to <= last {
+			f.indent[to] = base
+		}
+		from = to + 1
+	}
+}
+
+// shift re-indents lines [from, to) to indent, keeping their relative
+// indentation, except for the headers of nested blocks, which are
+// indented to indent
+func (f *formatter) shift(from, to int, indent string, headers, nested map[int]bool) {
+	var min string
+	found := false
+	for i := from; i < to; i++ {
+		if f.frozen[i] || headers[i] || nested[i] || f.blank(i) {
+			continue
+		}
+		ind := f.currentIndent(i)
+		if !found || len(ind) < len(min) {
+			min, found = ind, true
+		}
+	}
+	for i := from; i < to; i++ {
+		if f.frozen[i] || f.blank(i) {
+			continue
+		}
+		if headers[i] {
+			f.indent[i] = indent
+			continue
+		}
+		ind := f.currentIndent(i)
+		rel := ""
+		if strings.HasPrefix(ind, min) {
+			rel = ind[len(min):]
+		}
+		f.indent[i] = indent + rel
+	}
+}
+
+// replace records the replacement of the source between from and to
+func (f *formatter) replace(from, to token.Pos, text string) {
+	start, end := f.offset(from), f.offset(to)
+	if end > len(f.src) {
+		end = len(f.src)
+	}
+	if string(f.src[start:end]) != text {
+		f.edits = append(f.edits, edit{start, end, text})
+	}
+}
+
+// expr returns x printed in canonical form
+func (f *formatter) expr(x ast.Expr) string {
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := cfg.Fprint(&buf, f.fset, x); err != nil {
+		return string(f.src[f.offset(x.Pos()):f.offset(x.End())])
+	}
+	return buf.String()
+}
+
+// apply returns the source with the indentation changes and edits
+func (f *formatter) apply() []byte {
+	for i, ind := range f.indent {
+		if cur := f.sourceIndent(i); cur != ind {
+			f.edits = append(f.edits, edit{f.lines[i], f.lines[i] + len(cur), ind})
+		}
+	}
+	sort.Slice(f.edits, func(i, j int) bool { return f.edits[i].start < f.edits[j].start })
+
+	var buf bytes.Buffer
+	offs := 0
+	for _, e := range f.edits {
+		if e.start < offs {
+			continue // overlapping edit
+		}
+		buf.Write(f.src[offs:e.start])
+		buf.WriteString(e.text)
+		offs = e.end
+	}
+	buf.Write(f.src[offs:])
+	return buf.Bytes()
+}
@@ -0,0 +1,108 @@
+package page
+
+import (
+	"strings"
+	"weblang/wl/scanner"
+	"weblang/wl/token"
+)
+
+// UsesLayout reports whether tmpl fills the placeholders of a layout
+// (a .wltemplate file) with top level <placeholder id=".."> elements
+func UsesLayout(tmpl *Template) bool {
+	for _, n := range tmpl.Nodes {
+		if el, ok := n.(*Element); ok && el.Name == slotTag {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyLayout returns the template of a page using a layout: the layout
+// with each of its <placeholder id=".."> elements replaced by the content
+// of the page's placeholder with the same id, or by the placeholder's
+// own content if the page doesn't fill it. The content of a top level
+// <head> of the page is appended to the layout's <head>. Neither
+// template is modified.
+func ApplyLayout(fset *token.FileSet, layout, tmpl *Template) (*Template, error) {
+	var errors scanner.ErrorList
+	fills := make(map[string]*Element)
+	var head []Node
+	for _, n := range tmpl.Nodes {
+		switch n := n.(type) {
+		case *Element:
+			switch {
+			case n.Name == slotTag:
+				id := slotName(n)
+				if prev := fills[id]; prev != nil {
+					errors.Add(fset.Position(n.Pos()), "duplicate content for placeholder \""+id+"\"")
+					continue
+				}
+				fills[id] = n
+			case strings.EqualFold(n.Name, "head"):
+				head = append(head, n.Children...)
+			default:
+				errors.Add(fset.Position(n.Pos()), "content of a page using a layout must be in <placeholder id=\"..\"> or <head>")
+			}
+		case *Text:
+			if strings.TrimSpace(n.Value) != "" {
+				errors.Add(fset.Position(n.Pos()), "content of a page using a layout must be in <placeholder id=\"..\"> or <head>")
+			}
+		case *Raw:
+			// comments
+		default:
+			errors.Add(fset.Position(n.Pos()), "content of a page using a layout must be in <placeholder id=\"..\"> or <head>")
+		}
+	}
+
+	used := make(map[string]bool)
+	var apply func(nodes []Node) []Node
+	apply = func(nodes []Node) []Node {
+		var out []Node
+		for _, n := range nodes {
+			switch n := n.(type) {
+			case *Element:
+				if n.Name == slotTag {
+					id := slotName(n)
+					if fill := fills[id]; fill != nil {
+						used[id] = true
+						out = append(out, fill.Children...)
+					} else {
+						out = append(out, apply(n.Children)...)
+					}
+					continue
+				}
+				cpy := *n
+				cpy.Children = apply(n.Children)
+				if head != nil && strings.EqualFold(n.Name, "head") {
+					cpy.Children = append(cpy.Children, head...)
+					head = nil
+				}
+				out = append(out, &cpy)
+			case *IfBlock:
+				cpy := *n
+				cpy.Then, cpy.Else = apply(n.Then), apply(n.Else)
+				out = append(out, &cpy)
+			case *ForBlock:
+				cpy := *n
+				cpy.Body = apply(n.Body)
+				out = append(out, &cpy)
+			default:
+				out = append(out, n)
+			}
+		}
+		return out
+	}
+	result := &Template{Name: tmpl.Name, Nodes: apply(layout.Nodes)}
+
+	for id, fill := range fills {
+		if !used[id] {
+			errors.Add(fset.Position(fill.Pos()), "layout "+layout.Name+" has no placeholder \""+id+"\"")
+		}
+	}
+	if head != nil {
+		errors.Add(fset.Position(head[0].Pos()), "layout "+layout.Name+" has no <head>")
+	}
+
+	errors.Sort()
+	return result, errors.Err()
+}
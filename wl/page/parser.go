@@ -0,0 +1,643 @@
+package page
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode"
+	"weblang/wl/ast"
+	wlparser "weblang/wl/parser"
+	"weblang/wl/scanner"
+	"weblang/wl/token"
+)
+
+// ParseFile parses a page template and returns the corresponding tree
+// of template nodes. If src != nil it is used as the template source
+// (string, []byte or io.Reader), otherwise the file named filename
+// is read.
+//
+// Expressions inside {{actions}} and event handlers are parsed as wl
+// expressions with positions relative to the template file. Errors are
+// returned as a scanner.ErrorList sorted by position; the returned
+// template is still usable (with ast.BadExprs) if there were errors.
+func ParseFile(fset *token.FileSet, filename string, src interface{}) (*Template, error) {
+	text, err := readSource(filename, src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{
+		fset:     fset,
+		filename: filename,
+		src:      text,
+	}
+	p.file = fset.AddFile(filename, -1, len(text))
+	p.file.SetLinesForContent(text)
+
+	t := &Template{Name: filename}
+	for {
+		nodes, term, offs := p.parseNodes("", false)
+		t.Nodes = append(t.Nodes, nodes...)
+		if term == "" {
+			break
+		}
+		p.errorf(offs, "unexpected %s", termString(term))
+	}
+
+	p.errors.Sort()
+	return t, p.errors.Err()
+}
+
+func readSource(filename string, src interface{}) ([]byte, error) {
+	if src != nil {
+		switch s := src.(type) {
+		case string:
+			return []byte(s), nil
+		case []byte:
+			return s, nil
+		case *bytes.Buffer:
+			if s != nil {
+				return s.Bytes(), nil
+			}
+		case io.Reader:
+			return ioutil.ReadAll(s)
+		}
+		return nil, errors.New("invalid source")
+	}
+	return ioutil.ReadFile(filename)
+}
+
+type parser struct {
+	fset     *token.FileSet
+	file     *token.File
+	filename string
+	src      []byte
+	offs     int // current reading offset
+	errors   scanner.ErrorList
+}
+
+func (p *parser) pos(offs int) token.Pos {
+	return p.file.Pos(offs)
+}
+
+func (p *parser) errorf(offs int, msg string, args ...interface{}) {
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	p.errors.Add(p.file.Position(p.pos(offs)), msg)
+}
+
+func (p *parser) at(s string) bool {
+	return bytes.HasPrefix(p.src[p.offs:], []byte(s))
+}
+
+func (p *parser) eof() bool {
+	return p.offs >= len(p.src)
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() && isSpace(p.src[p.offs]) {
+		p.offs++
+	}
+}
+
+// terminators returned from parseNodes and parseAttrs, other than
+// end tags which are returned as "</name"
+const (
+	termElse  = "else"
+	termEndIf = "/if"
+	termEndFo = "/for"
+	termTagGt = ">"
+	termValue = "\"" // end of an attribute value
+)
+
+func termString(term string) string {
+	switch {
+	case strings.HasPrefix(term, "</"):
+		return term + ">"
+	case term == termValue:
+		return "end of attribute value"
+	}
+	return "{{" + term + "}}"
+}
+
+// parseNodes parses content until the end of the file, an end tag or
+// a block terminator action ({{else}}, {{/if}}, {{/for}}). The
+// terminator is consumed and returned along with its offset so the
+// caller can match it against the block being parsed.
+//
+// If raw is set the content belongs to a raw text element (such as
+// <script>) and only the end tag of parent is recognized.
+func (p *parser) parseNodes(parent string, raw bool) (nodes []Node, term string, termOffs int) {
+	textStart := p.offs
+	flush := func() {
+		if p.offs > textStart {
+			nodes = append(nodes, &Text{ValuePos: p.pos(textStart), Value: string(p.src[textStart:p.offs])})
+		}
+	}
+
+	for !p.eof() {
+		switch {
+		case p.at("{{"):
+			flush()
+			n, term, offs := p.parseAction(func() ([]Node, string, int) {
+				return p.parseNodes(parent, raw)
+			}, false)
+			if term != "" {
+				return nodes, term, offs
+			}
+			if n != nil {
+				nodes = append(nodes, n)
+			}
+			textStart = p.offs
+
+		case p.at("</"):
+			if raw && !p.atEndTag(parent) {
+				p.offs += 2
+				continue
+			}
+			flush()
+			offs := p.offs
+			p.offs += 2
+			name := p.scanName()
+			p.skipSpace()
+			if !p.eof() && p.src[p.offs] == '>' {
+				p.offs++
+			} else {
+				p.errorf(p.offs, "expected '>' to close </%s", name)
+			}
+			return nodes, "</" + name, offs
+
+		case !raw && p.at("<!--"):
+			flush()
+			start := p.offs
+			if end := bytes.Index(p.src[p.offs:], []byte("-->")); end >= 0 {
+				p.offs += end + 3
+			} else {
+				p.errorf(start, "comment not terminated")
+				p.offs = len(p.src)
+			}
+			nodes = append(nodes, &Raw{ValuePos: p.pos(start), Value: string(p.src[start:p.offs])})
+			textStart = p.offs
+
+		case !raw && p.at("<!"):
+			flush()
+			start := p.offs
+			if end := bytes.IndexByte(p.src[p.offs:], '>'); end >= 0 {
+				p.offs += end + 1
+			} else {
+				p.errorf(start, "declaration not terminated")
+				p.offs = len(p.src)
+			}
+			nodes = append(nodes, &Raw{ValuePos: p.pos(start), Value: string(p.src[start:p.offs])})
+			textStart = p.offs
+
+		case !raw && p.src[p.offs] == '<' && p.offs+1 < len(p.src) && isLetter(rune(p.src[p.offs+1])):
+			flush()
+			n, term, offs := p.parseElement()
+			nodes = append(nodes, n)
+			if term != "" {
+				return nodes, term, offs
+			}
+			textStart = p.offs
+
+		default:
+			p.offs++
+		}
+	}
+	flush()
+	return nodes, "", p.offs
+}
+
+// parseValue parses an attribute value up to the closing quote, which
+// is left unread and reported as termValue. A zero quote parses an
+// unquoted value.
+func (p *parser) parseValue(quote byte) (nodes []Node, term string, termOffs int) {
+	textStart := p.offs
+	flush := func() {
+		if p.offs > textStart {
+			nodes = append(nodes, &Text{ValuePos: p.pos(textStart), Value: string(p.src[textStart:p.offs])})
+		}
+	}
+
+	for !p.eof() {
+		c := p.src[p.offs]
+		switch {
+		case quote != 0 && c == quote,
+			quote == 0 && (isSpace(c) || c == '>' || p.at("/>")):
+			flush()
+			return nodes, termValue, p.offs
+		case p.at("{{"):
+			flush()
+			n, term, offs := p.parseAction(func() ([]Node, string, int) {
+				return p.parseValue(quote)
+			}, true)
+			if term != "" {
+				return nodes, term, offs
+			}
+			if n != nil {
+				nodes = append(nodes, n)
+			}
+			textStart = p.offs
+		default:
+			p.offs++
+		}
+	}
+	flush()
+	if quote != 0 {
+		p.errorf(p.offs, "attribute value not terminated")
+	}
+	return nodes, termValue, p.offs
+}
+
+// readAction reads a {{...}} action at the current offset and returns
+// the offsets of its trimmed content
+func (p *parser) readAction() (lbrace, start, end, rbrace int) {
+	lbrace = p.offs
+	p.offs += 2
+	idx := bytes.Index(p.src[p.offs:], []byte("}}"))
+	if idx < 0 {
+		p.errorf(lbrace, "action not terminated")
+		rbrace = len(p.src)
+		p.offs = len(p.src)
+	} else {
+		rbrace = p.offs + idx
+		p.offs = rbrace + 2
+	}
+
+	start, end = lbrace+2, rbrace
+	for start < end && isSpace(p.src[start]) {
+		start++
+	}
+	for end > start && isSpace(p.src[end-1]) {
+		end--
+	}
+	return
+}
+
+// parseAction parses the action at the current offset. Block actions
+// ({{if}}, {{for}}) are parsed through to their end action, using body
+// to parse the content of the block. Block terminators are returned as
+// term so the enclosing block can match them.
+func (p *parser) parseAction(body func() ([]Node, string, int), inValue bool) (n Node, term string, termOffs int) {
+	lbrace, start, end, rbrace := p.readAction()
+	content := string(p.src[start:end])
+	keyword := content
+	if i := strings.IndexFunc(content, unicode.IsSpace); i >= 0 {
+		keyword = content[:i]
+	}
+
+	switch keyword {
+	case termElse, termEndIf, termEndFo:
+		if keyword != content {
+			p.errorf(start+len(keyword), "unexpected text after {{%s", keyword)
+		}
+		return nil, keyword, lbrace
+
+	case "if":
+		b := &IfBlock{
+			If:   p.pos(lbrace),
+			Cond: p.parseExpr(start+len(keyword), end),
+		}
+		var term string
+		var offs int
+		b.Then, term, offs = body()
+		if term == termElse {
+			b.Else, term, offs = body()
+		}
+		b.EndPos = p.pos(p.offs)
+		if term != termEndIf {
+			p.errorf(lbrace, "missing {{/if}}")
+			return b, term, offs
+		}
+		return b, "", 0
+
+	case "for":
+		if inValue {
+			p.errorf(lbrace, "{{for}} is not allowed in attribute values")
+		}
+		b := &ForBlock{For: p.pos(lbrace)}
+		p.parseForHeader(b, start+len(keyword), end)
+		var term string
+		var offs int
+		b.Body, term, offs = body()
+		b.EndPos = p.pos(p.offs)
+		if term != termEndFo {
+			p.errorf(lbrace, "missing {{/for}}")
+			return b, term, offs
+		}
+		return b, "", 0
+	}
+
+	return &Action{
+		Lbrace: p.pos(lbrace),
+		X:      p.parseExpr(start, end),
+		Rbrace: p.pos(rbrace),
+	}, "", 0
+}
+
+// parseForHeader parses "key, value := range x" from src[start:end]
+func (p *parser) parseForHeader(b *ForBlock, start, end int) {
+	header := string(p.src[start:end])
+	def := strings.Index(header, ":=")
+	if def < 0 {
+		p.errorf(start, "expected {{for key, value := range x}}")
+		b.X = &ast.BadExpr{From: p.pos(start), To: p.pos(end)}
+		return
+	}
+
+	// loop variables
+	var idents []*ast.Ident
+	offs := start
+	for _, name := range strings.Split(header[:def], ",") {
+		lead := len(name) - len(strings.TrimLeftFunc(name, unicode.IsSpace))
+		name = strings.TrimSpace(name)
+		if !isIdent(name) {
+			p.errorf(offs+lead, "expected identifier in {{for}}, found %q", name)
+		}
+		idents = append(idents, &ast.Ident{NamePos: p.pos(offs + lead), Name: name})
+		offs += len(name) + lead + 1
+	}
+	switch len(idents) {
+	case 1:
+		b.Key = idents[0]
+	case 2:
+		b.Key, b.Value = idents[0], idents[1]
+	default:
+		p.errorf(start, "{{for}} declares at most a key and a value")
+		b.Key, b.Value = idents[0], idents[1]
+	}
+
+	// range expression
+	rest := start + def + 2
+	for rest < end && isSpace(p.src[rest]) {
+		rest++
+	}
+	if !strings.HasPrefix(string(p.src[rest:end]), "range") {
+		p.errorf(rest, "expected range")
+		b.X = &ast.BadExpr{From: p.pos(rest), To: p.pos(end)}
+		return
+	}
+	b.X = p.parseExpr(rest+len("range"), end)
+}
+
+// parseExpr parses src[start:end] as a wl expression. The expression
+// is parsed from a copy of the template where everything before start
+// is blanked out, so that positions in the resulting ast (and errors)
+// are reported at their line and column in the template.
+func (p *parser) parseExpr(start, end int) ast.Expr {
+	masked := make([]byte, end)
+	for i := 0; i < start; i++ {
+		if p.src[i] == '\n' {
+			masked[i] = '\n'
+		} else {
+			masked[i] = ' '
+		}
+	}
+	copy(masked[start:], p.src[start:end])
+
+	x, err := wlparser.ParseExprFrom(p.fset, p.filename, masked, 0)
+	if err != nil {
+		if list, ok := err.(scanner.ErrorList); ok {
+			for _, e := range list {
+				p.errors.Add(e.Pos, e.Msg)
+			}
+		} else {
+			p.errorf(start, "%v", err)
+		}
+		return &ast.BadExpr{From: p.pos(start), To: p.pos(end)}
+	}
+	return x
+}
+
+// parseElement parses an element starting at "<" including its
+// content and end tag.
+func (p *parser) parseElement() (n *Element, term string, termOffs int) {
+	lt := p.offs
+	p.offs++
+	n = &Element{
+		Lt:   p.pos(lt),
+		Name: p.scanName(),
+	}
+
+	for {
+		attrs, term, offs := p.parseAttrs()
+		n.Attrs = append(n.Attrs, attrs...)
+		if term == termTagGt || term == "" {
+			break
+		}
+		p.errorf(offs, "unexpected %s in <%s>", termString(term), n.Name)
+	}
+
+	switch {
+	case p.eof():
+		p.errorf(lt, "<%s> not terminated", n.Name)
+		n.EndPos = p.pos(p.offs)
+		return n, "", 0
+	case p.at("/>"):
+		p.offs += 2
+		n.SelfClosing = true
+	default:
+		p.offs++ // >
+	}
+
+	if n.IsVoid() {
+		n.EndPos = p.pos(p.offs)
+		return n, "", 0
+	}
+
+	name := strings.ToLower(n.Name)
+	for {
+		children, term, offs := p.parseNodes(n.Name, rawTextElements[name])
+		n.Children = append(n.Children, children...)
+		n.EndPos = p.pos(p.offs)
+		switch {
+		case term == "":
+			p.errorf(lt, "missing </%s>", n.Name)
+			return n, "", 0
+		case strings.EqualFold(term, "</"+n.Name):
+			return n, "", 0
+		case strings.HasPrefix(term, "</"):
+			// the end tag belongs to an enclosing element
+			p.errorf(offs, "missing </%s> before %s", n.Name, termString(term))
+			return n, term, offs
+		default:
+			p.errorf(offs, "unexpected %s in <%s>", termString(term), n.Name)
+		}
+	}
+}
+
+// atEndTag reports whether the source is at the end tag for name
+func (p *parser) atEndTag(name string) bool {
+	end := p.offs + 2 + len(name)
+	if end > len(p.src) {
+		return false
+	}
+	if !strings.EqualFold(string(p.src[p.offs+2:end]), name) {
+		return false
+	}
+	return end == len(p.src) || p.src[end] == '>' || isSpace(p.src[end])
+}
+
+// parseAttrs parses attributes up to the end of a start tag. It stops
+// before ">" or "/>" and returns termTagGt, or returns a block
+// terminator of an enclosing {{if}}.
+func (p *parser) parseAttrs() (attrs []Node, term string, termOffs int) {
+	for {
+		p.skipSpace()
+		switch {
+		case p.eof():
+			return attrs, "", p.offs
+		case p.src[p.offs] == '>' || p.at("/>"):
+			return attrs, termTagGt, p.offs
+		case p.at("{{"):
+			lbrace, start, end, _ := p.readAction()
+			content := string(p.src[start:end])
+			switch {
+			case content == termElse || content == termEndIf:
+				return attrs, content, lbrace
+			case strings.HasPrefix(content, "if") && len(content) > 2 && isSpace(content[2]):
+				b := &IfBlock{
+					If:   p.pos(lbrace),
+					Cond: p.parseExpr(start+2, end),
+				}
+				var term string
+				var offs int
+				b.Then, term, offs = p.parseAttrs()
+				if term == termElse {
+					b.Else, term, offs = p.parseAttrs()
+				}
+				b.EndPos = p.pos(p.offs)
+				attrs = append(attrs, b)
+				if term != termEndIf {
+					p.errorf(lbrace, "missing {{/if}}")
+					return attrs, term, offs
+				}
+			default:
+				p.errorf(lbrace, "only {{if}} actions are allowed between attributes")
+			}
+		default:
+			if a := p.parseAttr(); a != nil {
+				attrs = append(attrs, a)
+			}
+		}
+	}
+}
+
+// parseAttr parses a single attribute, name="value"
+func (p *parser) parseAttr() Node {
+	start := p.offs
+	for !p.eof() {
+		c := p.src[p.offs]
+		if isSpace(c) || c == '=' || c == '>' || p.at("/>") || p.at("{{") || c == '"' || c == '\'' {
+			break
+		}
+		p.offs++
+	}
+	name := string(p.src[start:p.offs])
+	if name == "" {
+		p.errorf(start, "unexpected %q in tag", p.src[start])
+		p.offs++
+		return nil
+	}
+
+	// optional value
+	hasValue := false
+	valStart, valEnd := p.offs, p.offs
+	var value []Node
+	save := p.offs
+	p.skipSpace()
+	if !p.eof() && p.src[p.offs] == '=' {
+		hasValue = true
+		p.offs++
+		p.skipSpace()
+		var quote byte
+		if !p.eof() && (p.src[p.offs] == '"' || p.src[p.offs] == '\'') {
+			quote = p.src[p.offs]
+			p.offs++
+		}
+		valStart = p.offs
+		for {
+			var nodes []Node
+			var term string
+			var offs int
+			nodes, term, offs = p.parseValue(quote)
+			value = append(value, nodes...)
+			if term == termValue {
+				break
+			}
+			p.errorf(offs, "unexpected %s in attribute %s", termString(term), name)
+		}
+		valEnd = p.offs
+		if quote != 0 && !p.eof() {
+			p.offs++
+		}
+	} else {
+		p.offs = save
+	}
+
+	if strings.HasPrefix(name, "@") {
+		parts := strings.Split(name[1:], ".")
+		a := &EventAttr{
+			NamePos:   p.pos(start),
+			Name:      parts[0],
+			Modifiers: parts[1:],
+			EndPos:    p.pos(p.offs),
+		}
+		switch {
+		case !hasValue:
+			p.errorf(start, "missing handler for %s", name)
+			a.Handler = &ast.BadExpr{From: p.pos(start), To: p.pos(p.offs)}
+		case bytes.Contains(p.src[valStart:valEnd], []byte("{{")):
+			p.errorf(valStart, "event handlers are expressions and can't contain actions")
+			a.Handler = &ast.BadExpr{From: p.pos(valStart), To: p.pos(valEnd)}
+		default:
+			a.Handler = p.parseExpr(valStart, valEnd)
+		}
+		return a
+	}
+
+	return &Attr{
+		NamePos:  p.pos(start),
+		Name:     name,
+		HasValue: hasValue,
+		Value:    value,
+		EndPos:   p.pos(p.offs),
+	}
+}
+
+// scanName scans a tag name
+func (p *parser) scanName() string {
+	start := p.offs
+	for !p.eof() {
+		c := rune(p.src[p.offs])
+		if !isLetter(c) && !unicode.IsDigit(c) && c != '-' && c != ':' && c != '_' && c != '.' {
+			break
+		}
+		p.offs++
+	}
+	return string(p.src[start:p.offs])
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || ch >= 0x80 && unicode.IsLetter(ch)
+}
+
+func isIdent(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if !isLetter(c) && (i == 0 || !unicode.IsDigit(c)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,256 @@
+package page
+
+import (
+	"strings"
+	"testing"
+	"weblang/wl/ast"
+	"weblang/wl/scanner"
+	"weblang/wl/token"
+)
+
+func TestParseElements(t *testing.T) {
+	tmpl := parse(t, `<!doctype html>
+<ul class="list">
+	<li><input type=checkbox checked></li>
+	<br/>
+</ul>`)
+
+	if want, got := 3, len(tmpl.Nodes); want != got {
+		t.Fatalf("top level nodes, want %v got %v", want, got)
+	}
+	if want, got := "<!doctype html>", tmpl.Nodes[0].(*Raw).Value; want != got {
+		t.Errorf("doctype, want %v got %v", want, got)
+	}
+
+	ul := tmpl.Nodes[2].(*Element)
+	if want, got := "ul", ul.Name; want != got {
+		t.Errorf("element name, want %v got %v", want, got)
+	}
+	class := ul.Attrs[0].(*Attr)
+	if want, got := "list", class.Value[0].(*Text).Value; class.Name != "class" || want != got {
+		t.Errorf("class attr, want %v got %v=%v", want, class.Name, got)
+	}
+
+	li := ul.Children[1].(*Element)
+	input := li.Children[0].(*Element)
+	if !input.IsVoid() || input.Children != nil {
+		t.Errorf("input should be void with no children")
+	}
+	if want, got := "checkbox", input.Attrs[0].(*Attr).Value[0].(*Text).Value; want != got {
+		t.Errorf("unquoted attribute, want %v got %v", want, got)
+	}
+	if checked := input.Attrs[1].(*Attr); checked.Name != "checked" || checked.HasValue {
+		t.Errorf("boolean attribute, got %v (has value %v)", checked.Name, checked.HasValue)
+	}
+	if br := ul.Children[3].(*Element); !br.SelfClosing {
+		t.Errorf("expected self closing <br/>")
+	}
+}
+
+func TestParseEvents(t *testing.T) {
+	tmpl := parse(t, `<input @keyup.enter.prevent="addTodo" @click="remove(todo)">`)
+
+	input := tmpl.Nodes[0].(*Element)
+	keyup := input.Attrs[0].(*EventAttr)
+	if want, got := "keyup", keyup.Name; want != got {
+		t.Errorf("event name, want %v got %v", want, got)
+	}
+	if want, got := "enter,prevent", strings.Join(keyup.Modifiers, ","); want != got {
+		t.Errorf("modifiers, want %v got %v", want, got)
+	}
+	if want, got := "addTodo", keyup.Handler.(*ast.Ident).Name; want != got {
+		t.Errorf("handler, want %v got %v", want, got)
+	}
+
+	click := input.Attrs[1].(*EventAttr)
+	if len(click.Modifiers) != 0 {
+		t.Errorf("unexpected modifiers %v", click.Modifiers)
+	}
+	if _, ok := click.Handler.(*ast.CallExpr); !ok {
+		t.Errorf("handler, want *ast.CallExpr got %T", click.Handler)
+	}
+}
+
+func TestParseBlocks(t *testing.T) {
+	tmpl := parse(t, `{{for i, todo := range todos}}
+<li class="{{if todo.done}}done{{else}}open{{/if}}" {{if i == 0}}autofocus{{/if}}>{{todo.title}}</li>
+{{/for}}`)
+
+	f := tmpl.Nodes[0].(*ForBlock)
+	if f.Key.Name != "i" || f.Value.Name != "todo" {
+		t.Errorf("loop vars, want i, todo got %v, %v", f.Key, f.Value)
+	}
+	if want, got := "todos", f.X.(*ast.Ident).Name; want != got {
+		t.Errorf("range expr, want %v got %v", want, got)
+	}
+
+	li := f.Body[1].(*Element)
+	class := li.Attrs[0].(*Attr).Value[0].(*IfBlock)
+	if want, got := "done", class.Then[0].(*Text).Value; want != got {
+		t.Errorf("attr value then, want %v got %v", want, got)
+	}
+	if want, got := "open", class.Else[0].(*Text).Value; want != got {
+		t.Errorf("attr value else, want %v got %v", want, got)
+	}
+	cond := li.Attrs[1].(*IfBlock)
+	if want, got := "autofocus", cond.Then[0].(*Attr).Name; want != got {
+		t.Errorf("conditional attr, want %v got %v", want, got)
+	}
+	if _, ok := li.Children[0].(*Action).X.(*ast.SelectorExpr); !ok {
+		t.Errorf("action, want *ast.SelectorExpr got %T", li.Children[0].(*Action).X)
+	}
+}
+
+func TestParseRawText(t *testing.T) {
+	tmpl := parse(t, `<script>if (a < b && c > d) { x = "</div>" }</script>`)
+
+	script := tmpl.Nodes[0].(*Element)
+	if want, got := `if (a < b && c > d) { x = "</div>" }`, script.Children[0].(*Text).Value; want != got {
+		t.Errorf("script text, want %v got %v", want, got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{`<div>`, "1:1: missing </div>"},
+		{`<ul><li></ul>`, "1:9: missing </li> before </ul>"},
+		{`{{if a}}<p></p>`, "1:1: missing {{/if}}"},
+		{`<p>{{/for}}</p>`, "1:4: unexpected {{/for}} in <p>"},
+		{`{{for x in xs}}{{/for}}`, "1:6: expected {{for key, value := range x}}"},
+		{`<p>{{a +}}</p>`, "1:9: expected operand"},
+		{`<p {{a}}>`, "1:4: only {{if}} actions are allowed between attributes"},
+		{`<button @click>`, "1:9: missing handler for @click"},
+		{`<button @click="{{a}}">`, "1:17: event handlers are expressions"},
+		{"<p>\n  {{x.}}</p>", "2:7: expected selector or type assertion"},
+	}
+
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		_, err := ParseFile(fset, "test.wlpage", test.src)
+		list, _ := err.(scanner.ErrorList)
+		if !containsError(list, test.err) {
+			t.Errorf("%s: want error %q got %v", test.src, test.err, list)
+		}
+	}
+}
+
+func containsError(list scanner.ErrorList, msg string) bool {
+	for _, e := range list {
+		if strings.Contains(e.Error(), msg) {
+			return true
+		}
+	}
+	return false
+}
+
+func parse(t *testing.T, src string) *Template {
+	fset := token.NewFileSet()
+	tmpl, err := ParseFile(fset, "test.wlpage", src)
+	if err != nil {
+		t.Fatalf("Error during parse: %v", err)
+	}
+	return tmpl
+}
+
+func TestApplyLayout(t *testing.T) {
+	fset := token.NewFileSet()
+	layout, err := ParseFile(fset, "main.wltemplate", `<html><head><title>t</title></head>
+<body><placeholder id="main"/><footer><placeholder id="footer">default</placeholder></footer></body></html>`)
+	if err != nil {
+		t.Fatalf("Error during parse: %v", err)
+	}
+	tmpl, err := ParseFile(fset, "index.wlpage", `<head><link rel="stylesheet" href="index.css"></head>
+<placeholder id="main"><p>{{message}}</p></placeholder>`)
+	if err != nil {
+		t.Fatalf("Error during parse: %v", err)
+	}
+	if !UsesLayout(tmpl) {
+		t.Fatalf("page should use a layout")
+	}
+
+	merged, err := ApplyLayout(fset, layout, tmpl)
+	if err != nil {
+		t.Fatalf("Error applying layout: %v", err)
+	}
+	html := merged.Nodes[0].(*Element)
+	head := html.Children[0].(*Element)
+	if want, got := 2, len(head.Children); want != got {
+		t.Fatalf("head children, want %v got %v", want, got)
+	}
+	if want, got := "link", head.Children[1].(*Element).Name; want != got {
+		t.Errorf("appended head content, want %v got %v", want, got)
+	}
+	body := html.Children[2].(*Element)
+	if want, got := "p", body.Children[0].(*Element).Name; want != got {
+		t.Errorf("filled placeholder, want %v got %v", want, got)
+	}
+	footer := body.Children[1].(*Element)
+	if want, got := "default", footer.Children[0].(*Text).Value; want != got {
+		t.Errorf("unfilled placeholder, want %v got %v", want, got)
+	}
+	if len(layout.Nodes[0].(*Element).Children[0].(*Element).Children) != 1 {
+		t.Errorf("layout was modified")
+	}
+
+	bad, err := ParseFile(fset, "bad.wlpage", `<placeholder id="side"></placeholder><p>loose</p>`)
+	if err != nil {
+		t.Fatalf("Error during parse: %v", err)
+	}
+	_, err = ApplyLayout(fset, layout, bad)
+	list, _ := err.(scanner.ErrorList)
+	for _, want := range []string{
+		`bad.wlpage:1:1: layout main.wltemplate has no placeholder "side"`,
+		`bad.wlpage:1:38: content of a page using a layout must be in <placeholder id=".."> or <head>`,
+	} {
+		if !containsError(list, want) {
+			t.Errorf("want error %q got %v", want, list)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for _, test := range []struct {
+		src, want string
+	}{
+		// expressions
+		{`<p>{{ a+b }}</p>`, `<p>{{a + b}}</p>`},
+		{`<a href="/{{ page .Title }}" @click="go( 1 )">x</a>`, `<a href="/{{page.Title}}" @click="go( 1 )">x</a>`},
+		{`<p>{{if !done}}a{{ else }}b{{ /if }}</p>`, `<p>{{if !done}}a{{else}}b{{/if}}</p>`},
+		{`<input {{if  x>1 }}checked{{/if}}>`, `<input {{if x > 1}}checked{{/if}}>`},
+
+		// block indentation
+		{"<ul>\n    {{for i,t:=range  todos}}\n<li>{{t}}</li>\n            {{/for}}\n</ul>",
+			"<ul>\n    {{for i, t := range todos}}\n        <li>{{t}}</li>\n    {{/for}}\n</ul>"},
+		{"{{if a}}\n\t\t<div>\n\t\t\t<p>x</p>\n\t\t</div>\n  {{else}}\n<p>y</p>\n{{/if}}",
+			"{{if a}}\n\t<div>\n\t\t<p>x</p>\n\t</div>\n{{else}}\n\t<p>y</p>\n{{/if}}"},
+		{"{{for _, t := range todos}}\n  {{if t.done}}\n<b>x</b>\n          {{/if}}\n{{/for}}",
+			"{{for _, t := range todos}}\n  {{if t.done}}\n    <b>x</b>\n  {{/if}}\n{{/for}}"},
+		{"{{if a}}\n  <p>x</p>\n      {{for _, t := range todos}}\n      <li>{{t}}</li>\n      {{/for}}\n{{/if}}",
+			"{{if a}}\n  <p>x</p>\n  {{for _, t := range todos}}\n    <li>{{t}}</li>\n  {{/for}}\n{{/if}}"},
+
+		// unchanged
+		{"<pre>\n{{if a}}\n   keep\n{{/if}}\n</pre>", "<pre>\n{{if a}}\n   keep\n{{/if}}\n</pre>"},
+		{"<!-- {{ a+b }} -->\n<p  class=x>text</p>\n", "<!-- {{ a+b }} -->\n<p  class=x>text</p>\n"},
+	} {
+		got, err := Format([]byte(test.src))
+		if err != nil {
+			t.Errorf("%q: %v", test.src, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%q:\nwant %q\ngot  %q", test.src, test.want, got)
+			continue
+		}
+		again, err := Format(got)
+		if err != nil || string(again) != string(got) {
+			t.Errorf("%q: formatting is not idempotent: %q", test.src, again)
+		}
+	}
+
+	if _, err := Format([]byte(`<p>{{if a}}</p>`)); err == nil {
+		t.Errorf("expected an error for a template with syntax errors")
+	}
+}
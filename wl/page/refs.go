@@ -0,0 +1,147 @@
+package page
+
+import (
+	"strings"
+	"weblang/wl/types"
+)
+
+// HTMLPackage is the import path of the package declaring the element
+// types page variables use to reference template elements
+const HTMLPackage = "html"
+
+// elementTags maps html types to the tag of the elements they may
+// reference; "" matches any element
+var elementTags = map[string]string{
+	"Element":  "",
+	"Input":    "input",
+	"TextArea": "textarea",
+	"Select":   "select",
+	"Button":   "button",
+	"A":        "a",
+	"Form":     "form",
+	"Label":    "label",
+	"Div":      "div",
+	"Span":     "span",
+}
+
+// Ref is a package variable bound to a template element by id
+type Ref struct {
+	Var *types.Var
+
+	// Loop is the innermost {{for}} block containing the element, or
+	// nil. Refs inside a loop bind a slice of elements indexed by the
+	// loop key.
+	Loop *ForBlock
+}
+
+// elementType returns the html type name of t, if t is one
+func elementType(t types.Type) (string, bool) {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return "", false
+	}
+	obj := named.Obj()
+	if obj.Pkg() == nil || obj.Pkg().Path() != HTMLPackage {
+		return "", false
+	}
+	_, ok = elementTags[obj.Name()]
+	return obj.Name(), ok
+}
+
+// refElem returns the element type of a ref variable's type: t itself,
+// or the element type of a slice of html types
+func refElem(t types.Type) (types.Type, bool) {
+	if _, ok := elementType(t); ok {
+		return t, true
+	}
+	if s, ok := t.Underlying().(*types.Slice); ok {
+		_, ok := elementType(s.Elem())
+		return s.Elem(), ok
+	}
+	return nil, false
+}
+
+// refVars returns the package variables of pkg declared with html types
+func refVars(pkg *types.Package) map[string]*types.Var {
+	vars := make(map[string]*types.Var)
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		if v, ok := scope.Lookup(name).(*types.Var); ok {
+			if _, ok := refElem(v.Type()); ok {
+				vars[name] = v
+			}
+		}
+	}
+	return vars
+}
+
+// staticAttr returns el's attribute name and its value if the value
+// has no actions
+func staticAttr(el *Element, name string) (*Attr, string, bool) {
+	for _, n := range el.Attrs {
+		a, ok := n.(*Attr)
+		if !ok || !strings.EqualFold(a.Name, name) {
+			continue
+		}
+		value, ok := staticValue(a)
+		return a, value, ok
+	}
+	return nil, "", false
+}
+
+// staticValue returns the value of a if it has no actions
+func staticValue(a *Attr) (string, bool) {
+	var b strings.Builder
+	for _, v := range a.Value {
+		t, ok := v.(*Text)
+		if !ok {
+			return "", false
+		}
+		b.WriteString(t.Value)
+	}
+	return b.String(), true
+}
+
+// elementRef binds el to the package variable named by its id
+func (c *checker) elementRef(el *Element) {
+	attr, id, ok := staticAttr(el, "id")
+	if !ok {
+		return
+	}
+	v := c.refs[id]
+	if v == nil {
+		return
+	}
+	if prev, dup := c.bound[v]; dup {
+		c.errorf(attr.Pos(), "duplicate element id %q (previous at %s)", id, c.fset.Position(prev))
+		return
+	}
+	c.bound[v] = attr.Pos()
+
+	elem, _ := refElem(v.Type())
+	name, _ := elementType(elem)
+	if tag := elementTags[name]; tag != "" && !strings.EqualFold(tag, el.Name) {
+		c.errorf(attr.Pos(), "cannot bind %s (type %s) to <%s id=%q>", v.Name(), v.Type(), el.Name, id)
+		return
+	}
+
+	switch {
+	case c.loop == nil && elem != v.Type():
+		c.errorf(attr.Pos(), "cannot bind %s (type %s) to <%s id=%q> outside of {{for}}", v.Name(), v.Type(), el.Name, id)
+		return
+	case c.loop != nil && elem == v.Type():
+		c.errorf(attr.Pos(), "cannot bind %s (type %s) to <%s id=%q> inside {{for}}, want []%s", v.Name(), v.Type(), el.Name, id, elem)
+		return
+	}
+
+	c.result.Refs[el] = &Ref{Var: v, Loop: c.loop}
+}
+
+// unboundRefs reports the element variables no template element binds
+func (c *checker) unboundRefs() {
+	for id, v := range c.refs {
+		if _, ok := c.bound[v]; !ok {
+			c.errorf(v.Pos(), "no element with id %q for %s (type %s)", id, v.Name(), v.Type())
+		}
+	}
+}
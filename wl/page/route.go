@@ -0,0 +1,249 @@
+package page
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"weblang/wl/ast"
+	"weblang/wl/constant"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// RouterPackage is the import path of the package declaring routes
+const RouterPackage = "router"
+
+// RoutesName is the name of the package templates use to build the URLs
+// of routes: routes.Name(args) returns the URL of the route declared by
+// the package variable name
+const RoutesName = "routes"
+
+// Route is a package variable declared with router.Path, binding page
+// variables to the segments of the URL
+type Route struct {
+	Var     *types.Var
+	Pattern string
+	Hash    bool // the pattern matches location.hash rather than the path
+
+	// Segments are the segments of the pattern after "#/" or "/"
+	Segments []*Segment
+
+	// URL is the function in the routes package building the URL of
+	// the route from values of its parameters
+	URL *types.Func
+}
+
+// Segment is a literal segment or a {name} parameter of a route pattern
+type Segment struct {
+	Literal string     // literal text if Param is nil
+	Param   *types.Var // page variable bound to the segment
+
+	// Convert is the conversion between the segment and the type of
+	// Param: "int", "string" or "enum"
+	Convert string
+}
+
+// routes finds the routes declared by pkg and declares the routes
+// package for their URLs in the template scope
+func (c *checker) routes() {
+	for _, init := range c.info.InitOrder {
+		call, ok := init.Rhs.(*ast.CallExpr)
+		if !ok || len(init.Lhs) != 1 || !c.isRouterPath(call.Fun) || len(call.Args) != 1 {
+			continue
+		}
+		r := &Route{Var: init.Lhs[0]}
+		if !c.pattern(r, call.Args[0]) {
+			continue
+		}
+		c.result.Routes = append(c.result.Routes, r)
+	}
+	if len(c.result.Routes) == 0 {
+		return
+	}
+	sort.Slice(c.result.Routes, func(i, j int) bool { return c.result.Routes[i].Var.Pos() < c.result.Routes[j].Var.Pos() })
+
+	if obj := c.pkg.Scope().Lookup(RoutesName); obj != nil {
+		c.errorf(obj.Pos(), "%s is reserved for the URLs of routes", RoutesName)
+		return
+	}
+	pkg := types.NewPackage(RoutesName, RoutesName)
+	for _, r := range c.result.Routes {
+		var params []*types.Var
+		for _, s := range r.Segments {
+			if s.Param != nil {
+				params = append(params, types.NewParam(token.NoPos, pkg, s.Param.Name(), s.Param.Type()))
+			}
+		}
+		result := types.NewParam(token.NoPos, pkg, "", types.Typ[types.String])
+		sig := types.NewSignature(nil, types.NewTuple(params...), types.NewTuple(result), false)
+		name := r.Var.Name()
+		name = strings.ToUpper(name[:1]) + name[1:]
+		r.URL = types.NewFunc(r.Var.Pos(), pkg, name, sig)
+		if alt := pkg.Scope().Insert(r.URL); alt != nil {
+			c.errorf(r.Var.Pos(), "route %s conflicts with another route for routes.%s", r.Var.Name(), name)
+		}
+	}
+	pkg.MarkComplete()
+	c.top.Insert(types.NewPkgName(token.NoPos, c.pkg, RoutesName, pkg))
+}
+
+// isRouterPath reports whether fun refers to router.Path
+func (c *checker) isRouterPath(fun ast.Expr) bool {
+	sel, ok := fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	fn, ok := c.info.Uses[sel.Sel].(*types.Func)
+	return ok && fn.Pkg() != nil && fn.Pkg().Path() == RouterPackage && fn.Name() == "Path"
+}
+
+// pattern parses and checks the pattern of r
+func (c *checker) pattern(r *Route, x ast.Expr) bool {
+	var pattern string
+	if tv, ok := c.info.Types[x]; ok && tv.Value != nil && tv.Value.Kind() == constant.String {
+		pattern = constant.StringVal(tv.Value)
+	} else if lit, ok := x.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+		pattern, _ = strconv.Unquote(lit.Value)
+	} else {
+		c.errorf(x.Pos(), "route pattern must be a constant string")
+		return false
+	}
+	r.Pattern = pattern
+
+	rest := pattern
+	switch {
+	case strings.HasPrefix(pattern, "#/"):
+		r.Hash = true
+		rest = pattern[2:]
+	case strings.HasPrefix(pattern, "/"):
+		rest = pattern[1:]
+	default:
+		c.errorf(x.Pos(), "route pattern %q must start with \"#/\" or \"/\"", pattern)
+		return false
+	}
+
+	ok := true
+	bound := make(map[*types.Var]bool)
+	for _, seg := range splitPath(rest) {
+		if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+			if strings.ContainsAny(seg, "{}") {
+				c.errorf(x.Pos(), "invalid segment %q in route pattern %q", seg, pattern)
+				ok = false
+			}
+			r.Segments = append(r.Segments, &Segment{Literal: seg})
+			continue
+		}
+
+		name := seg[1 : len(seg)-1]
+		v, _ := c.pkg.Scope().Lookup(name).(*types.Var)
+		if v == nil {
+			c.errorf(x.Pos(), "route segment {%s} is not a package variable", name)
+			ok = false
+			continue
+		}
+		if bound[v] {
+			c.errorf(x.Pos(), "duplicate route segment {%s}", name)
+			ok = false
+			continue
+		}
+		bound[v] = true
+
+		s := &Segment{Param: v, Convert: segmentConvert(v.Type())}
+		if s.Convert == "" {
+			c.errorf(x.Pos(), "cannot bind route segment {%s} to %s (type %s), want an enum, int or string", name, name, v.Type())
+			ok = false
+			continue
+		}
+		r.Segments = append(r.Segments, s)
+	}
+	return ok
+}
+
+// splitPath returns the segments of a path after its leading "/"
+func splitPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// segmentConvert returns the conversion of route segments bound to a
+// variable of type t, or "" if t can't be bound
+func segmentConvert(t types.Type) string {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsInteger != 0:
+			return "int"
+		case u.Info()&types.IsString != 0:
+			return "string"
+		}
+	case *types.Enum:
+		if _, named := t.(*types.Named); named {
+			return "enum"
+		}
+	}
+	return ""
+}
+
+// href checks that a static "#/" link matches a hash route
+func (c *checker) href(a *Attr) {
+	href, static := staticValue(a)
+	if !static || !strings.HasPrefix(href, "#/") {
+		return
+	}
+	hash := false
+	for _, r := range c.result.Routes {
+		if !r.Hash {
+			continue
+		}
+		hash = true
+		if r.match(splitPath(href[2:])) {
+			return
+		}
+	}
+	if hash {
+		c.errorf(a.Pos(), "href %q matches no route", href)
+	}
+}
+
+// match reports whether the segments of a URL match r
+func (r *Route) match(segs []string) bool {
+	if len(segs) != len(r.Segments) {
+		return false
+	}
+	for i, s := range r.Segments {
+		seg := segs[i]
+		switch {
+		case s.Param == nil:
+			if seg != s.Literal {
+				return false
+			}
+		case s.Convert == "int":
+			if _, err := strconv.Atoi(seg); err != nil {
+				return false
+			}
+		case s.Convert == "string":
+			if seg == "" {
+				return false
+			}
+		case s.Convert == "enum":
+			if enumMember(s.Param.Type(), seg) == nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// enumMember returns the member of enum type t named seg, ignoring case
+// as URLs use lower case member names
+func enumMember(t types.Type, seg string) *types.Const {
+	e := t.Underlying().(*types.Enum)
+	for i := 0; i < e.NumValues(); i++ {
+		if v := e.Value(i); strings.EqualFold(v.Name(), seg) {
+			return v
+		}
+	}
+	return nil
+}
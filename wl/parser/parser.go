@@ -476,6 +476,7 @@ var stmtStart = map[token.Token]bool{
 	token.BREAK:       true,
 	token.CONST:       true,
 	token.CONTINUE:    true,
+	token.DEFER:       true,
 	token.FALLTHROUGH: true,
 	token.FOR:         true,
 	token.GOTO:        true,
@@ -1789,7 +1790,7 @@ func (p *parser) parseLiteralValue(typ ast.Expr) ast.Expr {
 
 // checkExpr checks that x is an expression (and not a type).
 func (p *parser) checkExpr(x ast.Expr) ast.Expr {
-	switch unparen(x).(type) {
+	switch ast.Unparen(x).(type) {
 	case *ast.BadExpr:
 	case *ast.Ident:
 	case *ast.BasicLit:
@@ -1859,19 +1860,11 @@ func isLiteralType(x ast.Expr) bool {
 	return x
 }*/
 
-// If x is of the form (T), unparen returns unparen(T), otherwise it returns x.
-func unparen(x ast.Expr) ast.Expr {
-	if p, isParen := x.(*ast.ParenExpr); isParen {
-		x = unparen(p.X)
-	}
-	return x
-}
-
 // checkExprOrType checks that x is an expression or a type
 // (and not a raw type such as [...]T).
 //
 func (p *parser) checkExprOrType(x ast.Expr) ast.Expr {
-	switch t := unparen(x).(type) {
+	switch t := ast.Unparen(x).(type) {
 	case *ast.ParenExpr:
 		panic("unreachable")
 	case *ast.UnaryExpr:
@@ -2187,7 +2180,7 @@ func (p *parser) parseCallExpr(callType string) *ast.CallExpr {
 	}
 
 	return &ast.GoStmt{Go: pos, Call: call}
-}
+}*/
 
 func (p *parser) parseDeferStmt() ast.Stmt {
 	if p.trace {
@@ -2202,7 +2195,7 @@ func (p *parser) parseDeferStmt() ast.Stmt {
 	}
 
 	return &ast.DeferStmt{Defer: pos, Call: call}
-}*/
+}
 
 func (p *parser) parseCatchStmt() *ast.CatchStmt {
 	if p.trace {
@@ -2692,8 +2685,8 @@ func (p *parser) parseStmt() (s ast.Stmt) {
 		}
 	//case token.GO:
 	//	s = p.parseGoStmt()
-	//case token.DEFER:
-	//	s = p.parseDeferStmt()
+	case token.DEFER:
+		s = p.parseDeferStmt()
 	case token.RETURN:
 		s = p.parseReturnStmt()
 	case token.BREAK, token.CONTINUE, token.GOTO, token.FALLTHROUGH:
@@ -2822,10 +2815,16 @@ func (p *parser) parseValueSpec(scope *ast.Scope, doc *ast.CommentGroup, keyword
 		if typ == nil && values == nil {
 			p.error(pos, "missing variable type or initialization")
 		}
-	case token.CONST, token.ENUM:
+	case token.CONST:
 		if values == nil && (iota == 0 || typ != nil) {
 			p.error(pos, "missing constant value")
 		}
+	case token.ENUM:
+		// the members of enums without values are numbered by the
+		// checker
+		if values == nil && typ != nil {
+			p.error(pos, "missing constant value")
+		}
 	}
 
 	// Go spec: The scope of a constant or variable identifier declared inside
@@ -28,6 +28,7 @@ var valids = []string{
 	`package p; type T []int; func g(int) bool { return true }; func f() { if g(T{42}[0]) {} };`,
 	`package p; type T []int; func f() { for _ = range []int{T{42}[0]} {} };`,
 	`package p; var a = T{{1, 2}, {3, 4}}`,
+	`package p; type e enum { A; B; C }`,
 	//`package p; func f() { select { case <- c: case c <- d: case c <- <- d: case <-c <- d: } };`,
 	//`package p; func f() { select { case x := (<-c): } };`,
 	`package p; func f() { if ; true {} };`,
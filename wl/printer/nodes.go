@@ -334,7 +334,7 @@ func (p *printer) parameters(fields *ast.FieldList) {
 			} else {
 				parLineBeg = p.lineFor(par.Type.Pos())
 			}
-			var parLineEnd = p.lineFor(par.Type.End())
+			var parLineEnd = p.lineFor(par.End())
 			// separating "," if needed
 			needsLinebreak := 0 < prevLine && prevLine < parLineBeg
 			if i > 0 {
@@ -362,10 +362,14 @@ func (p *printer) parameters(fields *ast.FieldList) {
 				// by a linebreak call after a type, or in the next multi-line identList
 				// will do the right thing.
 				p.identList(par.Names, ws == indent)
-				p.print(blank)
 			}
-			// parameter type
-			p.expr(stripParensAlways(par.Type))
+			// parameter type; lambda parameters may have none
+			if par.Type != nil {
+				if len(par.Names) > 0 {
+					p.print(blank)
+				}
+				p.expr(stripParensAlways(par.Type))
+			}
 			prevLine = parLineEnd
 		}
 		// if the closing ")" is on a separate line from the last parameter,
@@ -454,7 +458,7 @@ func (p *printer) typeParamList(fields *ast.FieldList, isIncomplete bool) {
 
 	// print on 1 line,
 	// TODO: better support for comments and long lines
-	p.print(lbrace, token.LSS, blank)
+	p.print(lbrace, token.LSS)
 
 	for i, f := range list {
 		if i > 0 {
@@ -462,17 +466,19 @@ func (p *printer) typeParamList(fields *ast.FieldList, isIncomplete bool) {
 		}
 
 		if len(f.Names) > 0 {
-			p.expr(f.Names[0])
-			p.print(blank)
+			p.identList(f.Names, false)
 		}
 
 		if f.Type != nil {
 			//restrictions
+			if len(f.Names) > 0 {
+				p.print(blank)
+			}
 			p.expr(f.Type)
 		}
 	}
 
-	p.print(rbrace, token.GTR, blank)
+	p.print(rbrace, token.GTR)
 }
 
 func (p *printer) fieldList(fields *ast.FieldList, isStruct, isIncomplete bool) {
@@ -510,6 +516,11 @@ func (p *printer) fieldList(fields *ast.FieldList, isStruct, isIncomplete bool)
 					// method
 					p.expr(f.Names[0])
 					p.signature(ftyp.TypeParams, ftyp.Params, ftyp.Results)
+				} else if len(f.Names) > 0 {
+					// field
+					p.expr(f.Names[0])
+					p.print(blank)
+					p.expr(f.Type)
 				} else {
 					// embedded interface
 					p.expr(f.Type)
@@ -587,6 +598,11 @@ func (p *printer) fieldList(fields *ast.FieldList, isStruct, isIncomplete bool)
 				// method
 				p.expr(f.Names[0])
 				p.signature(ftyp.TypeParams, ftyp.Params, ftyp.Results)
+			} else if len(f.Names) > 0 {
+				// field
+				p.expr(f.Names[0])
+				p.print(blank)
+				p.expr(f.Type)
 			} else {
 				// embedded interface
 				p.expr(f.Type)
@@ -879,9 +895,12 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 	case *ast.TypeAssertExpr:
 		p.expr1(x.X, token.HighestPrec, depth)
 		p.print(token.PERIOD, x.Lparen, token.LPAREN)
-		if x.Type != nil {
+		switch {
+		case x.Type != nil:
 			p.expr(x.Type)
-		} else {
+		case x.Special == ast.SpecialTypeAssertUnion:
+			p.print(token.UNION)
+		default:
 			p.print(token.TYPE)
 		}
 		p.print(x.Rparen, token.RPAREN)
@@ -948,6 +967,15 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 			wasIndented = p.possibleSelectorExpr(x.Fun, token.HighestPrec, depth)
 		}
 		p.print(x.Lparen, token.LPAREN)
+		if len(x.TypeArgs) > 0 {
+			// generic call: f(<T, U> args)
+			p.print(x.Opening, token.LSS)
+			p.exprList(x.Opening, x.TypeArgs, depth+1, 0, x.Closing, false)
+			p.print(x.Closing, token.GTR)
+			if len(x.Args) > 0 {
+				p.print(blank)
+			}
+		}
 		if x.Ellipsis.IsValid() {
 			p.exprList(x.Lparen, x.Args, depth, 0, x.Ellipsis, false)
 			p.print(x.Ellipsis, token.ELLIPSIS)
@@ -973,6 +1001,9 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 			p.print(token.LSS)
 			p.exprList(x.TypeArgsOpening, x.TypeArgs, depth+1, 0, x.TypeArgsClosing, false)
 			p.print(token.GTR)
+			if len(x.Elts) > 0 {
+				p.print(blank)
+			}
 		}
 		p.exprList(x.Lbrace, x.Elts, 1, commaTerm, x.Rbrace, x.Incomplete)
 		// do not insert extra line break following a /*-style comment
@@ -1017,7 +1048,45 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 		p.typeParamList(x.TypeParams, x.Incomplete)
 		p.fieldList(x.Fields, false, x.Incomplete)
 
-		//TODO:wl add new types to printer
+	case *ast.EnumType:
+		p.print(token.ENUM, blank)
+		if x.Type != nil {
+			p.expr(x.Type)
+			p.print(blank)
+		}
+		p.print(x.Opening, token.LBRACE)
+		if len(x.Specs) > 0 {
+			// enum values are aligned like a const group
+			p.print(indent, formfeed)
+			keepType := keepTypeColumn(x.Specs)
+			var line int
+			for i, s := range x.Specs {
+				if i > 0 {
+					p.linebreak(p.lineFor(s.Pos()), 1, ignore, p.linesFrom(line) > 0)
+				}
+				p.recordLine(&line)
+				p.valueSpec(s.(*ast.ValueSpec), keepType[i])
+			}
+			p.print(unindent, formfeed)
+		}
+		p.print(x.Closing, token.RBRACE)
+
+	case *ast.UnionType:
+		p.print(token.UNION)
+		p.typeParamList(x.TypeParams, x.Incomplete)
+		p.fieldList(x.SubTypes, true, x.Incomplete)
+
+	case *ast.LambdaLit:
+		p.print(token.FN)
+		p.parameters(x.Params)
+		p.print(blank)
+		if x.Lbrace.IsValid() {
+			p.print(x.Lbrace, token.LBRACE, blank)
+			p.exprList(x.Lbrace, x.Body, depth, 0, x.Rbrace, false)
+			p.print(blank, x.Rbrace, token.RBRACE)
+		} else if len(x.Body) > 0 {
+			p.expr(x.Body[0])
+		}
 
 	/*case *ast.MapType:
 		p.print(token.MAP, token.LBRACK)
@@ -1295,11 +1364,11 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 	/*case *ast.GoStmt:
 		p.print(token.GO, blank)
 		p.expr(s.Call)
-
+	*/
 	case *ast.DeferStmt:
 		p.print(token.DEFER, blank)
 		p.expr(s.Call)
-	*/
+
 	case *ast.CatchStmt:
 		p.print(token.CATCH)
 		if s.Fun != nil {
@@ -1381,6 +1450,18 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 		p.print(blank)
 		p.block(s.Body, 0)
 
+	case *ast.UnionSwitchStmt:
+		p.print(token.SWITCH)
+		if s.Init != nil {
+			p.print(blank)
+			p.stmt(s.Init, false)
+			p.print(token.SEMICOLON)
+		}
+		p.print(blank)
+		p.stmt(s.Assign, false)
+		p.print(blank)
+		p.block(s.Body, 0)
+
 	/*case *ast.CommClause:
 		if s.Comm != nil {
 			p.print(token.CASE, blank)
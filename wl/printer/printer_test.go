@@ -196,6 +196,7 @@ var data = []entry{
 	{"statements.input", "statements.golden", 0},
 	{"slow.input", "slow.golden", idempotent},
 	{"complit.input", "complit.x", export},
+	{"wl.input", "wl.golden", idempotent},
 }
 
 func TestFiles(t *testing.T) {
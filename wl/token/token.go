@@ -90,6 +90,7 @@ const (
 	CONTINUE
 
 	DEFAULT
+	DEFER
 	ELSE
 	FALLTHROUGH
 	FOR
@@ -187,6 +188,7 @@ var tokens = [...]string{
 	CONTINUE: "continue",
 
 	DEFAULT:     "default",
+	DEFER:       "defer",
 	ELSE:        "else",
 	FALLTHROUGH: "fallthrough",
 	FOR:         "for",
@@ -135,7 +135,7 @@ func (check *Checker) assignVar(lhs ast.Expr, x *operand) Type {
 	}
 
 	// Determine if the lhs is a (possibly parenthesized) identifier.
-	ident, _ := unparen(lhs).(*ast.Ident)
+	ident, _ := ast.Unparen(lhs).(*ast.Ident)
 
 	// Don't evaluate lhs if it is the blank identifier.
 	if ident != nil && ident.Name == "_" {
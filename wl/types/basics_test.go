@@ -1,6 +1,7 @@
 package types_test
 
 import (
+	"strings"
 	"testing"
 
 	"weblang/wl/ast"
@@ -39,6 +40,75 @@ func TestBasicStructLitCheck(t *testing.T) {
 	}
 }
 
+func TestBasicEnum(t *testing.T) {
+	pkg, err := check(t, `package a
+type color enum {
+	Red = iota
+	Green
+	Blue
+}
+type size enum string {
+	Small = "s"
+	Large = "l"
+}
+type filter enum {
+	All
+	Active, Completed
+}
+var c = color.Green
+var same = c == color.Blue
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	scope := pkg.Scope()
+	color := scope.Lookup("color").Type()
+	enum, ok := color.Underlying().(*Enum)
+	if !ok {
+		t.Fatalf("color, wanted *Enum got %T", color.Underlying())
+	}
+	if want, got := "enum{Red; Green; Blue}", enum.String(); want != got {
+		t.Errorf("enum, wanted %v got %v", want, got)
+	}
+	if want, got := "2", enum.Lookup("Blue").Val().String(); want != got {
+		t.Errorf("Blue, wanted %v got %v", want, got)
+	}
+	if want, got := "a.color", scope.Lookup("c").Type().String(); want != got {
+		t.Errorf("type c, wanted %v got %v", want, got)
+	}
+	if want, got := "bool", scope.Lookup("same").Type().String(); want != got {
+		t.Errorf("type same, wanted %v got %v", want, got)
+	}
+	filter := scope.Lookup("filter").Type().Underlying().(*Enum)
+	if want, got := "2", filter.Lookup("Completed").Val().String(); want != got {
+		t.Errorf("Completed, wanted %v got %v", want, got)
+	}
+	size := scope.Lookup("size").Type().Underlying().(*Enum)
+	if want, got := "string", size.Base().String(); want != got {
+		t.Errorf("size base, wanted %v got %v", want, got)
+	}
+}
+
+func TestBasicEnumErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{`package a; type e enum { A = 1; A = 2 }`, "A redeclared"},
+		{`package a; type e enum int { A = "a" }`, "cannot convert"},
+		{`package a; type e enum { A = 1 }; var v = e.B`, "e.B undefined"},
+		{`package a; type e enum { A = 1 }; type f enum { A = 1 }; var v = e.A == f.A`, "mismatched types"},
+		{`package a; type e enum { A = 1 }; var v e = 1`, "cannot convert 1"},
+		{`package a; type e enum string { A }`, "missing init expr for A"},
+	}
+	for _, test := range tests {
+		_, err := check(t, test.src)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: wanted error containing %q got %v", test.src, test.err, err)
+		}
+	}
+}
+
 func check(t *testing.T, src string) (*Package, error) {
 	f := mustParse(t, src)
 	conf := Config{Importer: importer.Default()}
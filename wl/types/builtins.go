@@ -545,7 +545,7 @@ func (check *Checker) builtin(x *operand, call *ast.CallExpr, id builtinId) (_ b
 				// unsafe.Offsetof(x T) uintptr, where x must be a selector
 				// (no argument evaluated yet)
 				arg0 := call.Args[0]
-				selx, _ := unparen(arg0).(*ast.SelectorExpr)
+				selx, _ := ast.Unparen(arg0).(*ast.SelectorExpr)
 				if selx == nil {
 					check.invalidArg(arg0.Pos(), "%s is not a selector expression", arg0)
 					check.use(arg0)
@@ -670,14 +670,3 @@ func makeSig(res Type, args ...Type) *Signature {
 	}
 	return typ
 }*/
-
-// unparen returns e with any enclosing parentheses stripped.
-func unparen(e ast.Expr) ast.Expr {
-	for {
-		p, ok := e.(*ast.ParenExpr)
-		if !ok {
-			return e
-		}
-		e = p.X
-	}
-}
@@ -115,7 +115,7 @@ func (check *Checker) useLHS(arg ...ast.Expr) {
 		// after evaluating the lhs via check.rawExpr.
 		var v *Var
 		var v_used bool
-		if ident, _ := unparen(e).(*ast.Ident); ident != nil {
+		if ident, _ := ast.Unparen(e).(*ast.Ident); ident != nil {
 			// never type-check the blank name on the lhs
 			if ident.Name == "_" {
 				continue
@@ -370,6 +370,16 @@ func (check *Checker) selector(x *operand, e *ast.SelectorExpr) {
 		goto Error
 	}
 
+	if enum, _ := x.typ.Underlying().(*Enum); enum != nil && x.mode == typexpr {
+		// enum member
+		if m := enum.Lookup(sel); m != nil {
+			check.recordUse(e.Sel, m)
+			x.mode = value
+			x.expr = e
+			return
+		}
+	}
+
 	obj, index, indirect = LookupFieldOrMethod(x.typ, x.mode == variable, check.pkg, sel)
 	if obj == nil {
 		switch {
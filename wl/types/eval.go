@@ -6,6 +6,7 @@ package types
 
 import (
 	"fmt"
+	"weblang/wl/ast"
 	"weblang/wl/parser"
 	"weblang/wl/token"
 )
@@ -80,3 +81,32 @@ func Eval(fset *token.FileSet, pkg *Package, pos token.Pos, expr string) (_ Type
 
 	return TypeAndValue{x.mode, x.typ, x.val}, nil
 }
+
+// CheckExpr type checks the expression expr as if it had appeared in
+// the given scope, which must be nested within the scope of package
+// pkg. If scope is nil, the package scope is used. Type information
+// for expr and its sub-expressions is recorded in info, which may be
+// nil.
+//
+// CheckExpr is intended for tools that embed wl expressions in other
+// source formats (such as page templates) and need to bind names that
+// are not declared by any wl file, for instance loop variables.
+//
+func CheckExpr(fset *token.FileSet, pkg *Package, scope *Scope, expr ast.Expr, info *Info) (_ TypeAndValue, err error) {
+	if scope == nil {
+		scope = pkg.scope
+	}
+
+	// initialize checker
+	check := NewChecker(nil, fset, pkg, info)
+	check.scope = scope
+	defer check.handleBailout(&err)
+
+	// evaluate node
+	var x operand
+	check.rawExpr(&x, expr, nil)
+	check.processDelayed(0) // incl. all functions
+	check.recordUntyped()
+
+	return TypeAndValue{x.mode, x.typ, x.val}, nil
+}
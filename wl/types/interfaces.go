@@ -326,7 +326,7 @@ typenameLoop:
 	// doesn't matter for the purpose of determining the under-
 	// lying interface.)
 	if decl := check.objMap[tname]; decl != nil {
-		switch typ := unparen(decl.typ).(type) {
+		switch typ := ast.Unparen(decl.typ).(type) {
 		case *ast.Ident:
 			// type tname T
 			name = typ
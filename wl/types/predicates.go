@@ -84,7 +84,7 @@ func Comparable(T Type) bool {
 		// assume invalid types to be comparable
 		// to avoid follow-up errors
 		return t.kind != UntypedNil
-	case *Interface:
+	case *Interface, *Enum:
 		return true
 	case *Struct:
 		for _, f := range t.fields {
@@ -161,6 +161,12 @@ func identical(x, y Type, cmpTags bool, p *ifacePair) bool {
 			return identical(x.elem, y.elem, cmpTags, p)
 		}
 
+	case *Enum:
+		// Each enum type is distinct.
+		if y, ok := y.(*Enum); ok {
+			return x == y
+		}
+
 	case *Struct:
 		// Two struct types are identical if they have the same sequence of fields,
 		// and if corresponding fields have the same names, and identical types,
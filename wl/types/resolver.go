@@ -483,7 +483,7 @@ func (check *Checker) resolveBaseTypeName(typ ast.Expr) (ptr bool, base *TypeNam
 	// we're done.
 	var path []*TypeName
 	for {
-		typ = unparen(typ)
+		typ = ast.Unparen(typ)
 
 		// typ must be the name
 		name, _ := typ.(*ast.Ident)
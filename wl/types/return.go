@@ -20,7 +20,7 @@ func (check *Checker) isTerminating(s ast.Stmt, label string) bool {
 		unreachable()
 
 	case *ast.BadStmt, *ast.DeclStmt, *ast.EmptyStmt,
-		*ast.IncDecStmt, *ast.AssignStmt, *ast.RangeStmt:
+		*ast.IncDecStmt, *ast.AssignStmt, *ast.DeferStmt, *ast.CatchStmt, *ast.RangeStmt:
 		// no chance
 
 	case *ast.LabeledStmt:
@@ -28,7 +28,7 @@ func (check *Checker) isTerminating(s ast.Stmt, label string) bool {
 
 	case *ast.ExprStmt:
 		// calling the predeclared (possibly parenthesized) panic() function is terminating
-		if call, ok := unparen(s.X).(*ast.CallExpr); ok && check.isPanic[call] {
+		if call, ok := ast.Unparen(s.X).(*ast.CallExpr); ok && check.isPanic[call] {
 			return true
 		}
 
@@ -102,7 +102,7 @@ func hasBreak(s ast.Stmt, label string, implicit bool) bool {
 		unreachable()
 
 	case *ast.BadStmt, *ast.DeclStmt, *ast.EmptyStmt, *ast.ExprStmt,
-		*ast.IncDecStmt, *ast.AssignStmt, *ast.ReturnStmt:
+		*ast.IncDecStmt, *ast.AssignStmt, *ast.DeferStmt, *ast.CatchStmt, *ast.ReturnStmt:
 		// no chance
 
 	case *ast.LabeledStmt:
@@ -395,6 +395,22 @@ func (check *Checker) stmt(ctxt stmtContext, s ast.Stmt) {
 			check.assignVar(s.Lhs[0], &x)
 		}
 
+	case *ast.DeferStmt:
+		check.suspendedCall("defer", s.Call)
+
+	case *ast.CatchStmt:
+		// the function handles the panics of the rest of the function
+		// whose value its interface parameter holds
+		var x operand
+		check.expr(&x, s.Fun)
+		if x.mode == invalid {
+			break
+		}
+		sig, _ := x.typ.Underlying().(*Signature)
+		if sig == nil || sig.params.Len() != 1 || sig.results.Len() != 0 || sig.variadic || !IsInterface(sig.params.vars[0].typ) {
+			check.errorf(x.pos(), "catch requires a function of one interface parameter and no results, not %s", &x)
+		}
+
 	case *ast.ReturnStmt:
 		res := check.sig.results
 		if res.Len() > 0 {
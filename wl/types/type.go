@@ -340,6 +340,39 @@ func (m *Map) Key() Type { return m.key }
 // Elem returns the element type of map m.
 func (m *Map) Elem() Type { return m.elem }
 
+// An Enum represents an enum type: a fixed set of named constants
+// sharing a base type.
+type Enum struct {
+	base   Type     // type of the member values
+	values []*Const // members in declaration order
+}
+
+// NewEnum returns a new enum type with the given base type and members.
+// The members must have the enum (or the named type defined by it) as
+// their type.
+func NewEnum(base Type, values []*Const) *Enum {
+	return &Enum{base, values}
+}
+
+// Base returns the type of the values of the members of e.
+func (e *Enum) Base() Type { return e.base }
+
+// NumValues returns the number of members of e.
+func (e *Enum) NumValues() int { return len(e.values) }
+
+// Value returns the i'th member of e for 0 <= i < e.NumValues().
+func (e *Enum) Value(i int) *Const { return e.values[i] }
+
+// Lookup returns the member of e with the given name, or nil.
+func (e *Enum) Lookup(name string) *Const {
+	for _, v := range e.values {
+		if v.name == name {
+			return v
+		}
+	}
+	return nil
+}
+
 // A Named represents a named type.
 type Named struct {
 	obj        *TypeName // corresponding declared object
@@ -426,6 +459,7 @@ func (t *Tuple) Underlying() Type     { return t }
 func (s *Signature) Underlying() Type { return s }
 func (t *Interface) Underlying() Type { return t }
 func (m *Map) Underlying() Type       { return m }
+func (e *Enum) Underlying() Type      { return e }
 func (t *Named) Underlying() Type     { return t.underlying }
 
 func (b *Basic) String() string     { return TypeString(b, nil) }
@@ -435,4 +469,5 @@ func (t *Tuple) String() string     { return TypeString(t, nil) }
 func (s *Signature) String() string { return TypeString(s, nil) }
 func (t *Interface) String() string { return TypeString(t, nil) }
 func (m *Map) String() string       { return TypeString(m, nil) }
+func (e *Enum) String() string      { return TypeString(e, nil) }
 func (t *Named) String() string     { return TypeString(t, nil) }
@@ -120,6 +120,16 @@ func writeType(buf *bytes.Buffer, typ Type, qf Qualifier, visited []Type) {
 		}
 		buf.WriteByte('}')
 
+	case *Enum:
+		buf.WriteString("enum{")
+		for i, v := range t.values {
+			if i > 0 {
+				buf.WriteString("; ")
+			}
+			buf.WriteString(v.name)
+		}
+		buf.WriteByte('}')
+
 		//	case *Pointer:
 		//		buf.WriteByte('*')
 		//		writeType(buf, t.base, qf, visited)
@@ -147,7 +147,7 @@ func (check *Checker) definedType(e ast.Expr, def *Named) (T Type) {
 		return check.definedTypeWithArgs(e, e.TypeArgs, def)
 	case *ast.SelectorExpr:
 		return check.definedTypeWithArgs(e, e.Sel.TypeArgs, def)
-	case *ast.StructType, *ast.InterfaceType, *ast.UnionType, *ast.EnumType, *ast.FuncType:
+	case *ast.ArrayType, *ast.ParenExpr, *ast.StructType, *ast.InterfaceType, *ast.UnionType, *ast.EnumType, *ast.FuncType:
 		return check.definedTypeWithArgs(e, nil, def)
 
 	default:
@@ -166,8 +166,6 @@ func (check *Checker) definedTypeWithArgs(e ast.Expr, args []ast.Expr, def *Name
 		}()
 	}
 
-	fmt.Printf("Args: %v\n", args)
-
 	T = check.typInternal(e, args, def)
 	assert(isTyped(T))
 	check.recordTypeAndValue(e, typexpr, T, nil)
@@ -255,10 +253,6 @@ func (check *Checker) typInternal(e ast.Expr, args []ast.Expr, def *Named) Type
 
 	case *ast.Ident:
 		var x operand
-		if len(args) > 0 {
-			// we have an ident that looks like: typeName<arg0,arg1>
-			fmt.Printf("Args!\n")
-		}
 		check.ident(&x, e, def, true)
 
 		switch x.mode {
@@ -327,6 +321,12 @@ func (check *Checker) typInternal(e ast.Expr, args []ast.Expr, def *Named) Type
 		check.interfaceType(typ, e, def)
 		return typ
 
+	case *ast.EnumType:
+		typ := new(Enum)
+		def.setUnderlying(typ)
+		check.enumType(typ, e, def)
+		return typ
+
 	/*case *ast.MapType:
 	typ := new(Map)
 	def.setUnderlying(typ)
@@ -834,3 +834,93 @@ func embeddedFieldIdent(e ast.Expr) *ast.Ident {
 	}
 	return nil // invalid embedded field
 }
+
+// enumType type-checks the members of the enum type e. Members without
+// a value repeat the previous value expression with the next iota, as
+// in constant declarations.
+func (check *Checker) enumType(etyp *Enum, e *ast.EnumType, def *Named) {
+	var T Type = etyp
+	if def != nil {
+		T = def
+	}
+
+	if e.Type != nil {
+		etyp.base = check.typ(e.Type)
+		if !isConstType(etyp.base) {
+			if etyp.base.Underlying() != Typ[Invalid] {
+				check.errorf(e.Type.Pos(), "invalid enum type %s", etyp.base)
+			}
+			etyp.base = Typ[Invalid]
+		}
+	}
+
+	var fset objset
+	var last []ast.Expr
+	for iota, s := range e.Specs {
+		spec := s.(*ast.ValueSpec)
+		if spec.Type != nil {
+			check.errorf(spec.Type.Pos(), "enum members cannot declare a type")
+		}
+		values := spec.Values
+		if values == nil {
+			values = last
+		} else {
+			last = values
+		}
+		if len(values) > len(spec.Names) {
+			check.errorf(values[len(spec.Names)].Pos(), "extra init expr")
+		}
+
+		for i, name := range spec.Names {
+			obj := NewConst(name.Pos(), check.pkg, name.Name, T, constant.MakeUnknown())
+			switch {
+			case i < len(values):
+				obj.val = check.enumValue(etyp, values[i], iota)
+			case last == nil && (etyp.base == nil || isInteger(etyp.base)):
+				// the members of enums without values are numbered
+				// in order
+				if etyp.base == nil {
+					etyp.base = Typ[Int]
+				}
+				obj.val = constant.MakeInt64(int64(len(etyp.values)))
+			default:
+				check.errorf(name.Pos(), "missing init expr for %s", name.Name)
+			}
+			if name.Name == "_" || check.declareInSet(&fset, name.Pos(), obj) {
+				etyp.values = append(etyp.values, obj)
+				check.recordDef(name, obj)
+			}
+		}
+	}
+
+	if etyp.base == nil {
+		etyp.base = Typ[Int]
+	}
+}
+
+// enumValue type-checks the value of an enum member, which must be a
+// constant of the enum's base type. If the enum doesn't declare a base
+// type the first value's default type is used.
+func (check *Checker) enumValue(etyp *Enum, e ast.Expr, iota int) constant.Value {
+	check.iota = constant.MakeInt64(int64(iota))
+	defer func() { check.iota = nil }()
+
+	var x operand
+	check.expr(&x, e)
+	if x.mode == invalid {
+		return constant.MakeUnknown()
+	}
+	if x.mode != constant_ {
+		check.errorf(x.pos(), "%s is not constant", &x)
+		return constant.MakeUnknown()
+	}
+
+	if etyp.base == nil {
+		etyp.base = Default(x.typ)
+	}
+	check.assignment(&x, etyp.base, "enum value")
+	if x.mode == invalid {
+		return constant.MakeUnknown()
+	}
+	return x.val
+}
@@ -0,0 +1,264 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions are the bytecode of a function: opcodes followed by
+// their big endian operands
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+	for i := 0; i < len(ins); {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s", i, def.Name)
+		for _, o := range operands {
+			fmt.Fprintf(&out, " %d", o)
+		}
+		out.WriteString("\n")
+		i += 1 + read
+	}
+	return out.String()
+}
+
+type Opcode byte
+
+const (
+	// OpConstant pushes the constant of its operand
+	OpConstant Opcode = iota
+	OpNull
+	OpTrue
+	OpFalse
+	OpPop
+	OpDup
+	OpDup2
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpRem
+	OpAnd
+	OpOr
+	OpXor
+	OpShl
+	OpShr
+	OpEqual
+	OpNotEqual
+	OpLess
+	OpLessEqual
+	OpGreater
+	OpGreaterEqual
+	OpMinus
+	OpNot
+	OpComplement
+
+	OpJump
+	OpJumpNotTruthy
+	OpJumpTruthy
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	// OpGetCell and OpSetCell access the captured variable whose cell
+	// the local holds, which OpNewCell creates
+	OpGetCell
+	OpSetCell
+	OpNewCell
+	// OpGetFree and OpSetFree access the captured variables of the
+	// closure running, which OpGetFreeCell passes on to closures
+	OpGetFree
+	OpSetFree
+	OpGetFreeCell
+	OpGetBuiltin
+	OpClosure
+
+	// OpCall calls the function below its arguments, replacing them
+	// with its results
+	OpCall
+	OpReturn
+	// OpRunDefers runs the deferred calls of the function, then
+	// panics again unless they recovered its panic
+	OpRunDefers
+	OpDefer
+	OpCatch
+
+	OpZero
+	OpCopy
+	OpBox
+	OpConvert
+	OpAssert
+	OpAssertOk
+	OpIsType
+
+	OpArray
+	OpHash
+	OpStruct
+	OpMakeSlice
+	OpAppend
+	OpAppendSlice
+	OpIndex
+	OpMapIndex
+	OpMapIndexOk
+	OpSetIndex
+	OpSlice
+	OpField
+	OpSetField
+	OpMethod
+	OpBindMethod
+	OpRange
+	OpNext
+)
+
+// Definition describes an opcode: its name and the width in bytes of
+// its operands
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpNull:     {"OpNull", []int{}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+	OpPop:      {"OpPop", []int{}},
+	OpDup:      {"OpDup", []int{}},
+	OpDup2:     {"OpDup2", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpRem:          {"OpRem", []int{}},
+	OpAnd:          {"OpAnd", []int{}},
+	OpOr:           {"OpOr", []int{}},
+	OpXor:          {"OpXor", []int{}},
+	OpShl:          {"OpShl", []int{}},
+	OpShr:          {"OpShr", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpLess:         {"OpLess", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreater:      {"OpGreater", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpMinus:        {"OpMinus", []int{}},
+	OpNot:          {"OpNot", []int{}},
+	OpComplement:   {"OpComplement", []int{}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJumpTruthy:    {"OpJumpTruthy", []int{2}},
+
+	OpGetGlobal:   {"OpGetGlobal", []int{2}},
+	OpSetGlobal:   {"OpSetGlobal", []int{2}},
+	OpGetLocal:    {"OpGetLocal", []int{1}},
+	OpSetLocal:    {"OpSetLocal", []int{1}},
+	OpGetCell:     {"OpGetCell", []int{1}},
+	OpSetCell:     {"OpSetCell", []int{1}},
+	OpNewCell:     {"OpNewCell", []int{1}},
+	OpGetFree:     {"OpGetFree", []int{1}},
+	OpSetFree:     {"OpSetFree", []int{1}},
+	OpGetFreeCell: {"OpGetFreeCell", []int{1}},
+	OpGetBuiltin:  {"OpGetBuiltin", []int{1}},
+	OpClosure:     {"OpClosure", []int{2, 1}},
+
+	OpCall:      {"OpCall", []int{1}},
+	OpReturn:    {"OpReturn", []int{1}},
+	OpRunDefers: {"OpRunDefers", []int{}},
+	OpDefer:     {"OpDefer", []int{1}},
+	OpCatch:     {"OpCatch", []int{2}},
+
+	OpZero:     {"OpZero", []int{2}},
+	OpCopy:     {"OpCopy", []int{}},
+	OpBox:      {"OpBox", []int{2}},
+	OpConvert:  {"OpConvert", []int{2}},
+	OpAssert:   {"OpAssert", []int{2, 2}},
+	OpAssertOk: {"OpAssertOk", []int{2}},
+	OpIsType:   {"OpIsType", []int{2}},
+
+	OpArray:       {"OpArray", []int{2}},
+	OpHash:        {"OpHash", []int{2}},
+	OpStruct:      {"OpStruct", []int{2}},
+	OpMakeSlice:   {"OpMakeSlice", []int{2, 1}},
+	OpAppend:      {"OpAppend", []int{2}},
+	OpAppendSlice: {"OpAppendSlice", []int{}},
+	OpIndex:       {"OpIndex", []int{}},
+	OpMapIndex:    {"OpMapIndex", []int{2}},
+	OpMapIndexOk:  {"OpMapIndexOk", []int{2}},
+	OpSetIndex:    {"OpSetIndex", []int{}},
+	OpSlice:       {"OpSlice", []int{1}},
+	OpField:       {"OpField", []int{1}},
+	OpSetField:    {"OpSetField", []int{1}},
+	OpMethod:      {"OpMethod", []int{2}},
+	OpBindMethod:  {"OpBindMethod", []int{2}},
+	OpRange:       {"OpRange", []int{}},
+	OpNext:        {"OpNext", []int{2}},
+}
+
+// Lookup returns the definition of the opcode op
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make returns the instruction of op with operands
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+	ins := make([]byte, length)
+	ins[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		switch w := def.OperandWidths[i]; w {
+		case 2:
+			binary.BigEndian.PutUint16(ins[offset:], uint16(o))
+		case 1:
+			ins[offset] = byte(o)
+		}
+		offset += def.OperandWidths[i]
+	}
+	return ins
+}
+
+// ReadOperands decodes the operands of def from ins, returning them and
+// the number of bytes read
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+	for i, w := range def.OperandWidths {
+		switch w {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += w
+	}
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 { return binary.BigEndian.Uint16(ins) }
+
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
@@ -0,0 +1,1744 @@
+package vm
+
+import (
+	"fmt"
+	"weblang/wl/ast"
+	"weblang/wl/constant"
+	"weblang/wl/object"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// Bytecode is a package compiled for the VM
+type Bytecode struct {
+	Constants  []object.Object
+	NumGlobals int
+
+	// Init initializes the variables of the package and runs its init
+	// functions
+	Init *CompiledFunction
+
+	// Funcs are the functions of the package by name, and Globals the
+	// indices of its variables
+	Funcs   map[string]*CompiledFunction
+	Globals map[string]int
+
+	methods map[*types.Func]*CompiledFunction
+}
+
+// builtins are the builtin functions called like functions, by the
+// index of their BuiltinScope symbols
+var builtins = []string{"print", "println", "panic", "recover", "assert", "trace"}
+
+// A Compiler compiles a type-checked package to bytecode
+type Compiler struct {
+	info      *types.Info
+	pkg       *types.Package
+	constants []object.Object
+	consts    map[interface{}]int
+	funcs     map[*types.Func]int
+	bytecode  *Bytecode
+
+	globals *SymbolTable
+
+	// keys are the names of the symbols of variables: shadowed
+	// variables have the same name, so symbols are unique per object
+	keys map[types.Object]string
+
+	// captured are the variables closures capture, which live in cells
+	captured map[types.Object]bool
+
+	scope *scope
+}
+
+// scope is the state of the function being compiled
+type scope struct {
+	outer   *scope
+	fn      *CompiledFunction
+	sig     *types.Signature
+	ins     Instructions
+	lines   []Line
+	symbols *SymbolTable
+	temps   int
+
+	// results are the slots of the named results, or of the results of
+	// functions with deferred calls
+	results  []slot
+	deferred bool
+	returns  []int
+
+	targets []*target
+	label   string
+}
+
+// slot is a local variable, in a cell if closures capture it
+type slot struct {
+	sym  Symbol
+	cell bool
+}
+
+// target is a statement break and continue statements jump out of
+type target struct {
+	label     string
+	loop      bool
+	breaks    []int
+	continues []int
+}
+
+// compileError aborts the compilation of unsupported code
+type compileError struct {
+	pos token.Pos
+	msg string
+}
+
+// NewCompiler returns a compiler of the package pkg checked with info,
+// which must record its Types, Defs, Uses and Implicits
+func NewCompiler(pkg *types.Package, info *types.Info) *Compiler {
+	c := &Compiler{
+		info:     info,
+		pkg:      pkg,
+		consts:   make(map[interface{}]int),
+		funcs:    make(map[*types.Func]int),
+		globals:  NewSymbolTable(),
+		keys:     make(map[types.Object]string),
+		captured: make(map[types.Object]bool),
+		bytecode: &Bytecode{
+			Funcs:   make(map[string]*CompiledFunction),
+			Globals: make(map[string]int),
+			methods: make(map[*types.Func]*CompiledFunction),
+		},
+	}
+	for i, name := range builtins {
+		c.globals.DefineBuiltin(i, name)
+	}
+	return c
+}
+
+// Compile compiles the package pkg checked with info from files
+func Compile(fset *token.FileSet, pkg *types.Package, info *types.Info, files []*ast.File) (*Bytecode, error) {
+	return NewCompiler(pkg, info).Compile(fset, files)
+}
+
+// Compile compiles the files of the package
+func (c *Compiler) Compile(fset *token.FileSet, files []*ast.File) (bc *Bytecode, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(compileError)
+			if !ok {
+				panic(r)
+			}
+			err = fmt.Errorf("%s: %s", fset.Position(e.pos), e.msg)
+		}
+	}()
+
+	for _, f := range files {
+		c.findCaptured(f)
+	}
+
+	// declare the functions first, as they may call each other
+	var decls []*ast.FuncDecl
+	for _, f := range files {
+		for _, d := range f.Decls {
+			fd, ok := d.(*ast.FuncDecl)
+			if !ok || fd.Body == nil {
+				continue
+			}
+			obj, ok := c.info.Defs[fd.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+			fn := &CompiledFunction{Name: obj.Name(), Epilogue: -1}
+			c.funcs[obj] = c.addConstant(fn)
+			switch {
+			case fd.Recv != nil:
+				c.bytecode.methods[obj] = fn
+			case obj.Name() != "init":
+				c.bytecode.Funcs[obj.Name()] = fn
+			}
+			decls = append(decls, fd)
+		}
+	}
+
+	scope := c.pkg.Scope()
+	var vars []*types.Var
+	for _, name := range scope.Names() {
+		if v, ok := scope.Lookup(name).(*types.Var); ok {
+			sym := c.globals.Define(c.key(v))
+			c.bytecode.Globals[name] = sym.Index
+			vars = append(vars, v)
+		}
+	}
+
+	for _, fd := range decls {
+		obj := c.info.Defs[fd.Name].(*types.Func)
+		fn := c.constants[c.funcs[obj]].(*CompiledFunction)
+		c.function(fn, obj.Type().(*types.Signature), fd.Recv, fd.Type, fd.Body)
+	}
+
+	c.bytecode.Init = c.init(vars, decls)
+	c.bytecode.Constants = c.constants
+	c.bytecode.NumGlobals = c.globals.numDefinitions
+	return c.bytecode, nil
+}
+
+// init compiles the function initializing the package variables vars
+// and calling the init functions of decls
+func (c *Compiler) init(vars []*types.Var, decls []*ast.FuncDecl) *CompiledFunction {
+	fn := &CompiledFunction{Name: "init", Epilogue: -1}
+	c.enter(fn, nil)
+	for _, v := range vars {
+		c.emit(OpZero, c.typeConstant(v.Type()))
+		c.emit(OpSetGlobal, c.globalIndex(v))
+	}
+	for _, init := range c.info.InitOrder {
+		c.line(init.Rhs.Pos())
+		to := make([]types.Type, len(init.Lhs))
+		for i, v := range init.Lhs {
+			to[i] = v.Type()
+		}
+		if len(init.Lhs) == 1 {
+			c.value(init.Rhs, to[0])
+		} else {
+			c.spread(init.Rhs, to)
+		}
+		for i := len(init.Lhs) - 1; i >= 0; i-- {
+			if v := init.Lhs[i]; v.Name() == "_" {
+				c.emit(OpPop)
+			} else {
+				c.emit(OpSetGlobal, c.globalIndex(v))
+			}
+		}
+	}
+	for _, fd := range decls {
+		if fd.Recv == nil && fd.Name.Name == "init" {
+			c.line(fd.Pos())
+			c.emit(OpConstant, c.funcs[c.info.Defs[fd.Name].(*types.Func)])
+			c.emit(OpCall, 0)
+		}
+	}
+	c.emit(OpReturn, 0)
+	c.leave()
+	return fn
+}
+
+// findCaptured records the variables the function literals of f refer
+// to that are declared outside of them
+func (c *Compiler) findCaptured(f *ast.File) {
+	var nodes []ast.Node
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Body != nil {
+				nodes = append(nodes, d.Body)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if s, ok := spec.(*ast.ValueSpec); ok {
+					for _, x := range s.Values {
+						nodes = append(nodes, x)
+					}
+				}
+			}
+		}
+	}
+	for _, n := range nodes {
+		c.findCapturedIn(n)
+	}
+}
+
+func (c *Compiler) findCapturedIn(node ast.Node) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		lit, ok := n.(*ast.FuncLit)
+		if !ok {
+			return true
+		}
+		ast.Inspect(lit.Body, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			v, ok := c.info.Uses[id].(*types.Var)
+			if ok && !v.IsField() && !c.global(v) && (v.Pos() < lit.Pos() || v.Pos() >= lit.End()) {
+				c.captured[v] = true
+			}
+			return true
+		})
+		return true
+	})
+}
+
+// global reports whether v is a package-level variable
+func (c *Compiler) global(v *types.Var) bool {
+	return v.Pkg() != nil && v.Parent() == v.Pkg().Scope()
+}
+
+// key returns the name of the symbol of obj
+func (c *Compiler) key(obj types.Object) string {
+	k, ok := c.keys[obj]
+	if !ok {
+		k = fmt.Sprintf("%s#%d", obj.Name(), len(c.keys))
+		c.keys[obj] = k
+	}
+	return k
+}
+
+// globalIndex returns the index of the package variable v
+func (c *Compiler) globalIndex(v *types.Var) int {
+	sym, ok := c.globals.Resolve(c.key(v))
+	if !ok {
+		c.errorf(v.Pos(), "variable %s of package %s is not compiled", v.Name(), v.Pkg().Name())
+	}
+	return sym.Index
+}
+
+func (c *Compiler) errorf(pos token.Pos, format string, args ...interface{}) {
+	panic(compileError{pos, fmt.Sprintf(format, args...)})
+}
+
+// enter starts compiling the function fn
+func (c *Compiler) enter(fn *CompiledFunction, sig *types.Signature) {
+	outer := c.globals
+	if c.scope != nil {
+		outer = c.scope.symbols
+	}
+	c.scope = &scope{outer: c.scope, fn: fn, sig: sig, symbols: NewEnclosedSymbolTable(outer)}
+}
+
+// leave ends compiling the current function, returning the symbols of
+// the variables it captures
+func (c *Compiler) leave() []Symbol {
+	s := c.scope
+	s.fn.Instructions = s.ins
+	s.fn.Lines = s.lines
+	s.fn.NumLocals = s.symbols.numDefinitions
+	c.scope = s.outer
+	return s.symbols.FreeSymbols
+}
+
+// emit appends the instruction op, returning its offset
+func (c *Compiler) emit(op Opcode, operands ...int) int {
+	pos := len(c.scope.ins)
+	c.scope.ins = append(c.scope.ins, Make(op, operands...)...)
+	return pos
+}
+
+// patch sets the target of the jump at offset to the current offset
+func (c *Compiler) patch(offset int) {
+	op := Opcode(c.scope.ins[offset])
+	copy(c.scope.ins[offset:], Make(op, len(c.scope.ins)))
+}
+
+// line records the position of the code that follows
+func (c *Compiler) line(pos token.Pos) {
+	s := c.scope
+	if n := len(s.lines); n > 0 && s.lines[n-1].Offset == len(s.ins) {
+		s.lines[n-1].Pos = pos
+		return
+	}
+	s.lines = append(s.lines, Line{Offset: len(s.ins), Pos: pos})
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// constant returns the index of the constant obj identified by key
+func (c *Compiler) constant(key interface{}, obj func() object.Object) int {
+	if i, ok := c.consts[key]; ok {
+		return i
+	}
+	i := c.addConstant(obj())
+	c.consts[key] = i
+	return i
+}
+
+func (c *Compiler) typeConstant(t types.Type) int {
+	return c.constant(t, func() object.Object { return &typeRef{t} })
+}
+
+// funcConstant returns the constant of the function or method fn
+func (c *Compiler) funcConstant(fn *types.Func) int {
+	if i, ok := c.funcs[fn]; ok {
+		return i
+	}
+	if fn.Pkg() == c.pkg {
+		c.errorf(fn.Pos(), "function %s has no body", fn.Name())
+	}
+	return c.constant(fn, func() object.Object { return &funcRef{fn} })
+}
+
+// methodRef returns the constant of the method m called dynamically
+func (c *Compiler) methodRef(m *types.Func) int {
+	type key struct{ m *types.Func }
+	return c.constant(key{m}, func() object.Object { return &methodRef{m} })
+}
+
+// define declares a local variable, returning its slot
+func (c *Compiler) define(obj types.Object) slot {
+	return slot{c.scope.symbols.Define(c.key(obj)), c.captured[obj]}
+}
+
+// temp declares a hidden local variable
+func (c *Compiler) temp() slot {
+	c.scope.temps++
+	return slot{sym: c.scope.symbols.Define(fmt.Sprintf("#%d", c.scope.temps))}
+}
+
+// initialize sets the new variable of slot s to the value on the stack
+func (c *Compiler) initialize(s slot) {
+	if s.cell {
+		c.emit(OpNewCell, s.sym.Index)
+	} else {
+		c.emit(OpSetLocal, s.sym.Index)
+	}
+}
+
+// declare declares the variable obj, setting it to the value on the
+// stack
+func (c *Compiler) declare(obj types.Object) {
+	if obj == nil || obj.Name() == "_" {
+		c.emit(OpPop)
+		return
+	}
+	c.initialize(c.define(obj))
+}
+
+func (c *Compiler) load(s slot) {
+	switch s.sym.Scope {
+	case GlobalScope:
+		c.emit(OpGetGlobal, s.sym.Index)
+	case FreeScope:
+		c.emit(OpGetFree, s.sym.Index)
+	default:
+		if s.cell {
+			c.emit(OpGetCell, s.sym.Index)
+		} else {
+			c.emit(OpGetLocal, s.sym.Index)
+		}
+	}
+}
+
+func (c *Compiler) store(s slot) {
+	switch s.sym.Scope {
+	case GlobalScope:
+		c.emit(OpSetGlobal, s.sym.Index)
+	case FreeScope:
+		c.emit(OpSetFree, s.sym.Index)
+	default:
+		if s.cell {
+			c.emit(OpSetCell, s.sym.Index)
+		} else {
+			c.emit(OpSetLocal, s.sym.Index)
+		}
+	}
+}
+
+// variable returns the slot of the variable v
+func (c *Compiler) variable(v *types.Var) slot {
+	sym, ok := c.scope.symbols.Resolve(c.key(v))
+	if !ok {
+		c.errorf(v.Pos(), "variable %s is not compiled", v.Name())
+	}
+	return slot{sym, c.captured[v]}
+}
+
+// function compiles the function or method fn of signature sig
+func (c *Compiler) function(fn *CompiledFunction, sig *types.Signature, recv *ast.FieldList, typ *ast.FuncType, body *ast.BlockStmt) []Symbol {
+	c.enter(fn, sig)
+	s := c.scope
+
+	var params []slot
+	for _, list := range []*ast.FieldList{recv, typ.Params} {
+		if list == nil {
+			continue
+		}
+		for _, f := range list.List {
+			if len(f.Names) == 0 {
+				params = append(params, c.temp())
+			}
+			for _, name := range f.Names {
+				if obj := c.info.Defs[name]; obj != nil && name.Name != "_" {
+					params = append(params, c.define(obj))
+				} else {
+					params = append(params, c.temp())
+				}
+			}
+		}
+	}
+	fn.NumParameters = len(params)
+	for _, p := range params {
+		if p.cell {
+			c.emit(OpGetLocal, p.sym.Index)
+			c.emit(OpNewCell, p.sym.Index)
+		}
+	}
+
+	s.deferred = defers(body)
+	results := sig.Results()
+	named := typ.Results != nil && len(typ.Results.List) > 0 && len(typ.Results.List[0].Names) > 0
+	if named || s.deferred {
+		i := 0
+		for _, f := range fieldList(typ.Results) {
+			names := f.Names
+			if len(names) == 0 {
+				names = []*ast.Ident{nil}
+			}
+			for _, name := range names {
+				var r slot
+				if obj := c.info.Defs[name]; name != nil && obj != nil && name.Name != "_" {
+					r = c.define(obj)
+				} else {
+					r = c.temp()
+				}
+				c.emit(OpZero, c.typeConstant(results.At(i).Type()))
+				c.initialize(r)
+				s.results = append(s.results, r)
+				i++
+			}
+		}
+	}
+
+	c.stmts(body.List)
+
+	if s.deferred {
+		for _, j := range s.returns {
+			c.patch(j)
+		}
+		c.line(body.Rbrace)
+		fn.Epilogue = c.emit(OpRunDefers)
+	}
+	for _, r := range s.results {
+		c.load(r)
+	}
+	c.emit(OpReturn, len(s.results))
+	return c.leave()
+}
+
+func fieldList(l *ast.FieldList) []*ast.Field {
+	if l == nil {
+		return nil
+	}
+	return l.List
+}
+
+// defers reports whether the body of a function has defer or catch
+// statements
+func defers(body *ast.BlockStmt) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.DeferStmt, *ast.CatchStmt:
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// funcLit compiles a function literal to a closure of the cells of the
+// variables it captures
+func (c *Compiler) funcLit(x *ast.FuncLit) {
+	fn := &CompiledFunction{Name: "func literal", Epilogue: -1}
+	free := c.function(fn, c.typeOf(x).(*types.Signature), nil, x.Type, x.Body)
+	for _, sym := range free {
+		switch sym.Scope {
+		case LocalScope:
+			c.emit(OpGetLocal, sym.Index)
+		case FreeScope:
+			c.emit(OpGetFreeCell, sym.Index)
+		}
+	}
+	c.emit(OpClosure, c.addConstant(fn), len(free))
+}
+
+func (c *Compiler) typeOf(x ast.Expr) types.Type {
+	return c.info.TypeOf(x)
+}
+
+func (c *Compiler) tuple(x ast.Expr) bool {
+	_, ok := c.typeOf(x).(*types.Tuple)
+	return ok
+}
+
+// resultType returns the type of the value i of x
+func (c *Compiler) resultType(x ast.Expr, i int) types.Type {
+	t := c.typeOf(x)
+	if tuple, ok := t.(*types.Tuple); ok {
+		return tuple.At(i).Type()
+	}
+	return t
+}
+
+// value compiles x where it is assigned to a variable of type to
+func (c *Compiler) value(x ast.Expr, to types.Type) {
+	c.expr(x)
+	c.convertValue(c.typeOf(x), to, fresh(x))
+}
+
+// convertValue converts the value on the stack of type from where it
+// is assigned to a variable of type to: interfaces box the values of
+// other types, and struct values are copied unless they are fresh
+func (c *Compiler) convertValue(from, to types.Type, fresh bool) {
+	if b, ok := from.(*types.Basic); ok && b.Kind() == types.UntypedNil {
+		return
+	}
+	if to != nil && types.IsInterface(to) && !types.IsInterface(from) {
+		c.emit(OpBox, c.typeConstant(from))
+		return
+	}
+	if _, ok := from.Underlying().(*types.Struct); ok && !fresh {
+		c.emit(OpCopy)
+	}
+}
+
+// fresh reports whether x evaluates to a value nothing else refers to
+func fresh(x ast.Expr) bool {
+	switch ast.Unparen(x).(type) {
+	case *ast.CompositeLit, *ast.CallExpr:
+		return true
+	}
+	return false
+}
+
+// spread compiles the values of the multi-valued expression x where
+// they are assigned to variables of the types to
+func (c *Compiler) spread(x ast.Expr, to []types.Type) {
+	c.values(x)
+	convert := false
+	for i, t := range to {
+		from := c.resultType(x, i)
+		if t != nil && types.IsInterface(t) && !types.IsInterface(from) {
+			convert = true
+		}
+	}
+	if !convert {
+		return
+	}
+	temps := make([]slot, len(to))
+	for i := len(to) - 1; i >= 0; i-- {
+		temps[i] = c.temp()
+		c.store(temps[i])
+	}
+	for i, t := range temps {
+		c.load(t)
+		c.convertValue(c.resultType(x, i), to[i], true)
+	}
+}
+
+// values compiles an expression with several values or none
+func (c *Compiler) values(x ast.Expr) int {
+	if !c.tuple(x) {
+		c.expr(x)
+		return 1
+	}
+	switch x := ast.Unparen(x).(type) {
+	case *ast.CallExpr:
+		return c.call(x, OpCall)
+	case *ast.IndexExpr:
+		t := c.typeOf(x.X).Underlying().(*types.Map)
+		c.expr(x.X)
+		c.value(x.Index, t.Key())
+		c.emit(OpMapIndexOk, c.typeConstant(t.Elem()))
+		return 2
+	case *ast.TypeAssertExpr:
+		c.expr(x.X)
+		c.emit(OpAssertOk, c.typeConstant(c.info.Types[x.Type].Type))
+		return 2
+	}
+	c.errorf(x.Pos(), "unsupported multi-valued expression %T", x)
+	return 0
+}
+
+// expr compiles the expression x, which has a single value
+func (c *Compiler) expr(x ast.Expr) {
+	tv := c.info.Types[x]
+	if tv.Value != nil {
+		c.constValue(tv.Value, tv.Type)
+		return
+	}
+
+	switch x := x.(type) {
+	case *ast.Ident:
+		c.ident(x)
+	case *ast.ParenExpr:
+		c.expr(x.X)
+	case *ast.FuncLit:
+		c.funcLit(x)
+	case *ast.CompositeLit:
+		c.compositeLit(x, tv.Type)
+	case *ast.SelectorExpr:
+		c.selector(x)
+	case *ast.IndexExpr:
+		c.expr(x.X)
+		if t, ok := c.typeOf(x.X).Underlying().(*types.Map); ok {
+			c.value(x.Index, t.Key())
+			c.emit(OpMapIndex, c.typeConstant(t.Elem()))
+			return
+		}
+		c.expr(x.Index)
+		c.emit(OpIndex)
+	case *ast.SliceExpr:
+		c.expr(x.X)
+		flags := 0
+		for i, b := range []ast.Expr{x.Low, x.High, x.Max} {
+			if b != nil {
+				c.expr(b)
+				flags |= 1 << uint(i)
+			}
+		}
+		c.emit(OpSlice, flags)
+	case *ast.TypeAssertExpr:
+		c.expr(x.X)
+		c.emit(OpAssert, c.typeConstant(c.info.Types[x.Type].Type), c.typeConstant(c.typeOf(x.X)))
+	case *ast.CallExpr:
+		c.call(x, OpCall)
+	case *ast.UnaryExpr:
+		c.expr(x.X)
+		switch x.Op {
+		case token.ADD:
+		case token.SUB:
+			c.emit(OpMinus)
+		case token.NOT:
+			c.emit(OpNot)
+		case token.XOR:
+			c.emit(OpComplement)
+		default:
+			c.errorf(x.Pos(), "unsupported unary operator %s", x.Op)
+		}
+	case *ast.BinaryExpr:
+		c.binary(x)
+	default:
+		c.errorf(x.Pos(), "unsupported expression %T", x)
+	}
+}
+
+// constValue compiles the constant val of type t
+func (c *Compiler) constValue(val constant.Value, t types.Type) {
+	type key struct {
+		kind  constant.Kind
+		float bool
+		val   string
+	}
+	switch val.Kind() {
+	case constant.Bool:
+		if constant.BoolVal(val) {
+			c.emit(OpTrue)
+		} else {
+			c.emit(OpFalse)
+		}
+		return
+	case constant.String:
+		s := constant.StringVal(val)
+		c.emit(OpConstant, c.constant(key{constant.String, false, s}, func() object.Object {
+			return &object.String{Value: s}
+		}))
+		return
+	case constant.Int, constant.Float:
+		if isFloat(t) {
+			f, _ := constant.Float64Val(val)
+			c.emit(OpConstant, c.constant(key{constant.Float, true, val.ExactString()}, func() object.Object {
+				return &object.Float{Value: f}
+			}))
+			return
+		}
+		i, _ := constant.Int64Val(constant.ToInt(val))
+		c.emit(OpConstant, c.constant(key{constant.Int, false, val.ExactString()}, func() object.Object {
+			return &object.Integer{Value: i}
+		}))
+		return
+	}
+	c.errorf(token.NoPos, "unsupported constant %s", val)
+}
+
+// ident compiles the identifier x
+func (c *Compiler) ident(x *ast.Ident) {
+	switch obj := c.info.Uses[x].(type) {
+	case *types.Var:
+		if c.global(obj) {
+			c.emit(OpGetGlobal, c.globalIndex(obj))
+			return
+		}
+		c.load(c.variable(obj))
+	case *types.Func:
+		c.emit(OpConstant, c.funcConstant(obj))
+	case *types.Nil:
+		c.emit(OpNull)
+	default:
+		c.errorf(x.Pos(), "unsupported identifier %s", x.Name)
+	}
+}
+
+// compositeLit compiles the composite literal x of type t
+func (c *Compiler) compositeLit(x *ast.CompositeLit, t types.Type) {
+	switch u := t.Underlying().(type) {
+	case *types.Struct:
+		fields := make([]ast.Expr, u.NumFields())
+		for i, elt := range x.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				i = fieldIndex(u, c.info.Uses[kv.Key.(*ast.Ident)].(*types.Var))
+				elt = kv.Value
+			}
+			fields[i] = elt
+		}
+		for i, f := range fields {
+			if f == nil {
+				c.emit(OpZero, c.typeConstant(u.Field(i).Type()))
+			} else {
+				c.value(f, u.Field(i).Type())
+			}
+		}
+		c.emit(OpStruct, c.typeConstant(t))
+	case *types.Slice:
+		var elems []ast.Expr
+		i := 0
+		for _, elt := range x.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				n, _ := constant.Int64Val(c.info.Types[kv.Key].Value)
+				i = int(n)
+				elt = kv.Value
+			}
+			for len(elems) <= i {
+				elems = append(elems, nil)
+			}
+			elems[i] = elt
+			i++
+		}
+		for _, elt := range elems {
+			if elt == nil {
+				c.emit(OpZero, c.typeConstant(u.Elem()))
+			} else {
+				c.value(elt, u.Elem())
+			}
+		}
+		c.emit(OpArray, len(elems))
+	case *types.Map:
+		for _, elt := range x.Elts {
+			kv := elt.(*ast.KeyValueExpr)
+			c.value(kv.Key, u.Key())
+			c.value(kv.Value, u.Elem())
+		}
+		c.emit(OpHash, len(x.Elts))
+	default:
+		c.errorf(x.Pos(), "unsupported composite literal of type %s", t)
+	}
+}
+
+// selector compiles the selector expression x: a qualified identifier,
+// enum member, field, method value or method expression
+func (c *Compiler) selector(x *ast.SelectorExpr) {
+	if id, ok := x.X.(*ast.Ident); ok {
+		if _, ok := c.info.Uses[id].(*types.PkgName); ok {
+			c.ident(x.Sel)
+			return
+		}
+	}
+
+	switch obj := c.info.Uses[x.Sel].(type) {
+	case *types.Const:
+		c.emit(OpConstant, c.constant(obj, func() object.Object {
+			return &object.Enum{EnumType: obj.Type(), Member: obj}
+		}))
+	case *types.Func:
+		tv := c.info.Types[x.X]
+		if tv.IsType() {
+			// the method expression T.m is the method taking the
+			// receiver first
+			f, index, _ := types.LookupFieldOrMethod(tv.Type, false, obj.Pkg(), obj.Name())
+			if len(index) != 1 || types.IsInterface(tv.Type) {
+				c.errorf(x.Pos(), "unsupported method expression %s", types.ExprString(x))
+			}
+			c.emit(OpConstant, c.funcConstant(f.(*types.Func)))
+			return
+		}
+		f, path := c.lookup(c.typeOf(x.X), obj)
+		c.expr(x.X)
+		for _, i := range path {
+			c.emit(OpField, i)
+		}
+		if f == nil {
+			c.emit(OpBindMethod, c.methodRef(obj))
+			return
+		}
+		c.emit(OpMethod, c.funcConstant(f))
+	case *types.Var:
+		c.expr(x.X)
+		for _, i := range c.path(x) {
+			c.emit(OpField, i)
+		}
+	default:
+		c.errorf(x.Pos(), "unsupported selector %s", types.ExprString(x))
+	}
+}
+
+// lookup returns the method m of the type t and the path of the
+// embedded fields it is promoted from. The method is nil if it is the
+// method of an interface, which is bound to the dynamic value.
+func (c *Compiler) lookup(t types.Type, m *types.Func) (*types.Func, []int) {
+	if types.IsInterface(t) {
+		return nil, nil
+	}
+	obj, index, _ := types.LookupFieldOrMethod(t, false, m.Pkg(), m.Name())
+	path := index[:len(index)-1]
+	for _, i := range path {
+		t = t.Underlying().(*types.Struct).Field(i).Type()
+	}
+	if types.IsInterface(t) {
+		return nil, path
+	}
+	return obj.(*types.Func), path
+}
+
+// fieldIndex returns the index of the field f of the struct s
+func fieldIndex(s *types.Struct, f *types.Var) int {
+	for i := 0; i < s.NumFields(); i++ {
+		if s.Field(i) == f {
+			return i
+		}
+	}
+	return -1
+}
+
+// path returns the indices of the fields the field selector x selects,
+// through the embedded fields it is promoted from
+func (c *Compiler) path(x *ast.SelectorExpr) []int {
+	f := c.info.Uses[x.Sel].(*types.Var)
+	_, index, _ := types.LookupFieldOrMethod(c.typeOf(x.X), false, f.Pkg(), f.Name())
+	return index
+}
+
+// binary compiles the binary expression x
+func (c *Compiler) binary(x *ast.BinaryExpr) {
+	switch x.Op {
+	case token.LAND, token.LOR:
+		c.expr(x.X)
+		op := OpJumpNotTruthy
+		if x.Op == token.LOR {
+			op = OpJumpTruthy
+		}
+		short := c.emit(op, 0)
+		c.expr(x.Y)
+		end := c.emit(OpJump, 0)
+		c.patch(short)
+		if x.Op == token.LAND {
+			c.emit(OpFalse)
+		} else {
+			c.emit(OpTrue)
+		}
+		c.patch(end)
+		return
+	case token.EQL, token.NEQ:
+		c.compare(x.X, x.Y)
+		if x.Op == token.NEQ {
+			c.emit(OpNotEqual)
+		} else {
+			c.emit(OpEqual)
+		}
+		return
+	}
+
+	c.expr(x.X)
+	c.expr(x.Y)
+	op, ok := binaryOps[x.Op]
+	if !ok {
+		c.errorf(x.Pos(), "unsupported binary operator %s", x.Op)
+	}
+	c.emit(op)
+}
+
+// binaryOps are the opcodes of the arithmetic and ordering operators
+var binaryOps = map[token.Token]Opcode{
+	token.ADD: OpAdd,
+	token.SUB: OpSub,
+	token.MUL: OpMul,
+	token.QUO: OpDiv,
+	token.REM: OpRem,
+	token.AND: OpAnd,
+	token.OR:  OpOr,
+	token.XOR: OpXor,
+	token.SHL: OpShl,
+	token.SHR: OpShr,
+	token.LSS: OpLess,
+	token.LEQ: OpLessEqual,
+	token.GTR: OpGreater,
+	token.GEQ: OpGreaterEqual,
+}
+
+// compare compiles the operands of a comparison, boxing the operand
+// compared to an interface
+func (c *Compiler) compare(x, y ast.Expr) {
+	xt, yt := c.typeOf(x), c.typeOf(y)
+	c.expr(x)
+	if types.IsInterface(yt) {
+		c.convertValue(xt, yt, true)
+	}
+	c.expr(y)
+	if types.IsInterface(xt) {
+		c.convertValue(yt, xt, true)
+	}
+}
+
+// call compiles the call expression call, returning the number of its
+// results. op is OpCall, or OpDefer for deferred calls.
+func (c *Compiler) call(call *ast.CallExpr, op Opcode) int {
+	if tv := c.info.Types[call.Fun]; tv.IsType() {
+		c.conversion(call.Args[0], tv.Type)
+		return 1
+	}
+	if id, ok := ast.Unparen(call.Fun).(*ast.Ident); ok {
+		if b, ok := c.info.Uses[id].(*types.Builtin); ok {
+			return c.builtinCall(b.Name(), call, op)
+		}
+	}
+
+	sig := c.typeOf(call.Fun).Underlying().(*types.Signature)
+	n := 0
+	if m := c.method(call.Fun); m != nil {
+		// methods take their receiver first
+		sel := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+		f, path := c.lookup(c.typeOf(sel.X), m)
+		if f != nil {
+			c.emit(OpConstant, c.funcConstant(f))
+			n = 1
+		}
+		c.expr(sel.X)
+		for _, i := range path {
+			c.emit(OpField, i)
+		}
+		if f == nil {
+			c.emit(OpBindMethod, c.methodRef(m))
+		}
+	} else {
+		c.expr(call.Fun)
+	}
+	n += c.args(call, sig)
+	c.line(call.Lparen)
+	c.emit(op, n)
+	return sig.Results().Len()
+}
+
+// method returns the method fun selects from a value, or nil
+func (c *Compiler) method(fun ast.Expr) *types.Func {
+	sel, ok := ast.Unparen(fun).(*ast.SelectorExpr)
+	if !ok || c.info.Types[sel.X].IsType() {
+		return nil
+	}
+	m, ok := c.info.Uses[sel.Sel].(*types.Func)
+	if !ok || m.Type().(*types.Signature).Recv() == nil {
+		return nil
+	}
+	return m
+}
+
+// args compiles the arguments of call like assignments to the
+// parameters of sig, passing those of a variadic parameter in a slice.
+// It returns the number of parameters.
+func (c *Compiler) args(call *ast.CallExpr, sig *types.Signature) int {
+	params := sig.Params()
+	n := params.Len()
+	var to []types.Type
+	for i := 0; i < n; i++ {
+		to = append(to, params.At(i).Type())
+	}
+	variadic := sig.Variadic() && !call.Ellipsis.IsValid()
+
+	if len(call.Args) == 1 && c.tuple(call.Args[0]) {
+		// f(g()) passes the results of g
+		x := call.Args[0]
+		m := c.typeOf(x).(*types.Tuple).Len()
+		if !variadic {
+			c.spread(x, to)
+			return n
+		}
+		var spreadTo []types.Type
+		elem := to[n-1].Underlying().(*types.Slice).Elem()
+		for i := 0; i < m; i++ {
+			if i < n-1 {
+				spreadTo = append(spreadTo, to[i])
+			} else {
+				spreadTo = append(spreadTo, elem)
+			}
+		}
+		c.spread(x, spreadTo)
+		c.emit(OpArray, m-(n-1))
+		return n
+	}
+
+	for i, a := range call.Args {
+		if variadic && i >= n-1 {
+			break
+		}
+		c.value(a, to[i])
+	}
+	if variadic {
+		elem := to[n-1].Underlying().(*types.Slice).Elem()
+		count := 0
+		for _, a := range call.Args[n-1:] {
+			c.value(a, elem)
+			count++
+		}
+		c.emit(OpArray, count)
+	}
+	return n
+}
+
+// conversion compiles the conversion of x to the type to
+func (c *Compiler) conversion(x ast.Expr, to types.Type) {
+	from := c.typeOf(x)
+	c.expr(x)
+	switch {
+	case types.IsInterface(to):
+		c.convertValue(from, to, false)
+	case types.Identical(from.Underlying(), to.Underlying()):
+		if _, ok := to.Underlying().(*types.Basic); !ok || !types.Identical(from, to) {
+			c.emit(OpConvert, c.typeConstant(to))
+		}
+	default:
+		c.emit(OpConvert, c.typeConstant(to))
+	}
+}
+
+// builtinCall compiles the call of the builtin function name
+func (c *Compiler) builtinCall(name string, call *ast.CallExpr, op Opcode) int {
+	if op == OpDefer {
+		switch name {
+		case "make", "new", "append":
+			c.errorf(call.Pos(), "unsupported deferred call of %s", name)
+		}
+	}
+
+	switch name {
+	case "make":
+		t := c.info.Types[call.Args[0]].Type
+		if _, ok := t.Underlying().(*types.Map); ok {
+			c.emit(OpHash, 0)
+			return 1
+		}
+		for _, a := range call.Args[1:] {
+			c.expr(a)
+		}
+		c.line(call.Lparen)
+		c.emit(OpMakeSlice, c.typeConstant(t.Underlying().(*types.Slice).Elem()), len(call.Args)-1)
+		return 1
+	case "new":
+		c.emit(OpZero, c.typeConstant(c.info.Types[call.Args[0]].Type))
+		return 1
+	case "append":
+		c.expr(call.Args[0])
+		if call.Ellipsis.IsValid() {
+			c.expr(call.Args[1])
+			c.emit(OpAppendSlice)
+			return 1
+		}
+		elem := c.typeOf(call).Underlying().(*types.Slice).Elem()
+		for _, a := range call.Args[1:] {
+			c.value(a, elem)
+		}
+		c.emit(OpAppend, len(call.Args)-1)
+		return 1
+	case "trace":
+		if op == OpDefer {
+			return 0
+		}
+		for _, a := range call.Args {
+			c.expr(a)
+			c.emit(OpPop)
+		}
+		return 0
+	}
+
+	index := -1
+	for i, b := range builtins {
+		if b == name {
+			index = i
+		}
+	}
+	if index < 0 {
+		c.errorf(call.Pos(), "unsupported builtin %s", name)
+	}
+	c.emit(OpGetBuiltin, index)
+	n := 0
+	switch {
+	case len(call.Args) == 1 && c.tuple(call.Args[0]):
+		n = c.values(call.Args[0])
+	case name == "panic":
+		c.value(call.Args[0], types.NewInterfaceType(nil, nil).Complete())
+		n = 1
+	default:
+		for _, a := range call.Args {
+			c.expr(a)
+			n++
+		}
+	}
+	c.line(call.Lparen)
+	c.emit(op, n)
+	if name == "recover" {
+		return 1
+	}
+	return 0
+}
+
+// stmts compiles a statement list
+func (c *Compiler) stmts(list []ast.Stmt) {
+	for _, s := range list {
+		c.stmt(s)
+	}
+}
+
+// stmt compiles the statement s
+func (c *Compiler) stmt(s ast.Stmt) {
+	c.line(s.Pos())
+	label := c.scope.label
+	c.scope.label = ""
+
+	switch s := s.(type) {
+	case *ast.EmptyStmt:
+	case *ast.ExprStmt:
+		if call, ok := ast.Unparen(s.X).(*ast.CallExpr); ok {
+			for n := c.call(call, OpCall); n > 0; n-- {
+				c.emit(OpPop)
+			}
+		} else {
+			c.expr(s.X)
+			c.emit(OpPop)
+		}
+	case *ast.DeclStmt:
+		c.declStmt(s.Decl.(*ast.GenDecl))
+	case *ast.AssignStmt:
+		c.assignStmt(s)
+	case *ast.IncDecStmt:
+		op := OpAdd
+		if s.Tok == token.DEC {
+			op = OpSub
+		}
+		one := constant.MakeInt64(1)
+		c.update(s.X, func() {
+			c.constValue(one, c.typeOf(s.X))
+			c.emit(op)
+		})
+	case *ast.BlockStmt:
+		c.stmts(s.List)
+	case *ast.IfStmt:
+		if s.Init != nil {
+			c.stmt(s.Init)
+		}
+		c.expr(s.Cond)
+		jump := c.emit(OpJumpNotTruthy, 0)
+		c.stmts(s.Body.List)
+		if s.Else == nil {
+			c.patch(jump)
+			return
+		}
+		end := c.emit(OpJump, 0)
+		c.patch(jump)
+		c.stmt(s.Else)
+		c.patch(end)
+	case *ast.ForStmt:
+		c.forStmt(s, label)
+	case *ast.RangeStmt:
+		c.rangeStmt(s, label)
+	case *ast.SwitchStmt:
+		c.switchStmt(s, label)
+	case *ast.TypeSwitchStmt:
+		c.typeSwitchStmt(s, label)
+	case *ast.LabeledStmt:
+		c.scope.label = s.Label.Name
+		c.stmt(s.Stmt)
+	case *ast.BranchStmt:
+		c.branchStmt(s)
+	case *ast.ReturnStmt:
+		c.returnStmt(s)
+	case *ast.DeferStmt:
+		c.call(s.Call, OpDefer)
+	case *ast.CatchStmt:
+		c.expr(s.Fun)
+		sig := c.typeOf(s.Fun).Underlying().(*types.Signature)
+		c.emit(OpCatch, c.typeConstant(sig.Params().At(0).Type()))
+	default:
+		c.errorf(s.Pos(), "unsupported statement %T", s)
+	}
+}
+
+// declStmt compiles a var declaration
+func (c *Compiler) declStmt(d *ast.GenDecl) {
+	if d.Tok != token.VAR {
+		return
+	}
+	for _, spec := range d.Specs {
+		s := spec.(*ast.ValueSpec)
+		switch {
+		case len(s.Values) == 0:
+			for _, name := range s.Names {
+				c.emit(OpZero, c.typeConstant(c.info.Defs[name].Type()))
+				c.declare(c.info.Defs[name])
+			}
+		case len(s.Values) == len(s.Names):
+			for i, name := range s.Names {
+				c.value(s.Values[i], c.info.Defs[name].Type())
+				c.declare(c.info.Defs[name])
+			}
+		default:
+			var to []types.Type
+			for _, name := range s.Names {
+				to = append(to, c.info.Defs[name].Type())
+			}
+			c.spread(s.Values[0], to)
+			for i := len(s.Names) - 1; i >= 0; i-- {
+				c.declare(c.info.Defs[s.Names[i]])
+			}
+		}
+	}
+}
+
+// assignStmt compiles an assignment or short variable declaration
+func (c *Compiler) assignStmt(s *ast.AssignStmt) {
+	switch s.Tok {
+	case token.ASSIGN, token.DEFINE:
+	default:
+		// x op= y
+		op := binaryOps[s.Tok+(token.ADD-token.ADD_ASSIGN)]
+		c.update(s.Lhs[0], func() {
+			c.expr(s.Rhs[0])
+			c.emit(op)
+		})
+		return
+	}
+
+	to := make([]types.Type, len(s.Lhs))
+	for i, x := range s.Lhs {
+		to[i] = c.lhsType(x)
+	}
+	if len(s.Lhs) == 1 && len(s.Rhs) == 1 {
+		c.assign(s.Lhs[0], s.Tok, func() { c.value(s.Rhs[0], to[0]) })
+		return
+	}
+
+	// the values are computed before any is assigned
+	if len(s.Rhs) == len(s.Lhs) {
+		for i, x := range s.Rhs {
+			c.value(x, to[i])
+		}
+	} else {
+		c.spread(s.Rhs[0], to)
+	}
+	temps := make([]slot, len(s.Lhs))
+	for i := len(s.Lhs) - 1; i >= 0; i-- {
+		temps[i] = c.temp()
+		c.store(temps[i])
+	}
+	for i, x := range s.Lhs {
+		t := temps[i]
+		c.assign(x, s.Tok, func() { c.load(t) })
+	}
+}
+
+// lhsType returns the type of the variable or element assigned by x,
+// or nil for the blank identifier
+func (c *Compiler) lhsType(x ast.Expr) types.Type {
+	if id, ok := x.(*ast.Ident); ok {
+		if obj := c.info.Defs[id]; obj != nil {
+			return obj.Type()
+		}
+		if obj := c.info.Uses[id]; obj != nil {
+			return obj.Type()
+		}
+		return nil
+	}
+	return c.typeOf(x)
+}
+
+// assign compiles the assignment of the value compiled by value to x,
+// declaring x if tok is DEFINE and x is new
+func (c *Compiler) assign(x ast.Expr, tok token.Token, value func()) {
+	switch x := ast.Unparen(x).(type) {
+	case *ast.Ident:
+		if x.Name == "_" {
+			value()
+			c.emit(OpPop)
+			return
+		}
+		if obj := c.info.Defs[x]; obj != nil && tok == token.DEFINE {
+			value()
+			c.declare(obj)
+			return
+		}
+		value()
+		c.storeVar(x)
+		return
+	case *ast.IndexExpr:
+		c.expr(x.X)
+		if t, ok := c.typeOf(x.X).Underlying().(*types.Map); ok {
+			c.value(x.Index, t.Key())
+		} else {
+			c.expr(x.Index)
+		}
+		value()
+		c.emit(OpSetIndex)
+		return
+	case *ast.SelectorExpr:
+		if id, ok := x.X.(*ast.Ident); ok {
+			if _, ok := c.info.Uses[id].(*types.PkgName); ok {
+				value()
+				c.storeVar(x.Sel)
+				return
+			}
+		}
+		if _, ok := c.info.Uses[x.Sel].(*types.Var); ok {
+			c.expr(x.X)
+			path := c.path(x)
+			for _, i := range path[:len(path)-1] {
+				c.emit(OpField, i)
+			}
+			value()
+			c.emit(OpSetField, path[len(path)-1])
+			return
+		}
+	}
+	c.errorf(x.Pos(), "cannot assign to %s", types.ExprString(x))
+}
+
+// storeVar stores the value on the stack in the variable x refers to
+func (c *Compiler) storeVar(x *ast.Ident) {
+	v, _ := c.info.Uses[x].(*types.Var)
+	if v == nil {
+		v = c.info.Defs[x].(*types.Var)
+	}
+	if c.global(v) {
+		c.emit(OpSetGlobal, c.globalIndex(v))
+		return
+	}
+	c.store(c.variable(v))
+}
+
+// update compiles the assignment of x to the result of op, which
+// computes it from the value of x on the stack
+func (c *Compiler) update(x ast.Expr, op func()) {
+	switch x := ast.Unparen(x).(type) {
+	case *ast.Ident:
+		c.expr(x)
+		op()
+		c.storeVar(x)
+		return
+	case *ast.IndexExpr:
+		c.expr(x.X)
+		t, isMap := c.typeOf(x.X).Underlying().(*types.Map)
+		if isMap {
+			c.value(x.Index, t.Key())
+		} else {
+			c.expr(x.Index)
+		}
+		c.emit(OpDup2)
+		if isMap {
+			c.emit(OpMapIndex, c.typeConstant(t.Elem()))
+		} else {
+			c.emit(OpIndex)
+		}
+		op()
+		c.emit(OpSetIndex)
+		return
+	case *ast.SelectorExpr:
+		if id, ok := x.X.(*ast.Ident); ok {
+			if _, ok := c.info.Uses[id].(*types.PkgName); ok {
+				c.update(x.Sel, op)
+				return
+			}
+		}
+		c.expr(x.X)
+		path := c.path(x)
+		for _, i := range path[:len(path)-1] {
+			c.emit(OpField, i)
+		}
+		c.emit(OpDup)
+		c.emit(OpField, path[len(path)-1])
+		op()
+		c.emit(OpSetField, path[len(path)-1])
+		return
+	}
+	c.errorf(x.Pos(), "cannot assign to %s", types.ExprString(x))
+}
+
+// push starts a statement break and continue statements jump out of
+func (c *Compiler) push(label string, loop bool) *target {
+	t := &target{label: label, loop: loop}
+	c.scope.targets = append(c.scope.targets, t)
+	return t
+}
+
+// pop ends the statement t, patching its breaks to jump to the current
+// offset
+func (c *Compiler) pop(t *target) {
+	for _, j := range t.breaks {
+		c.patch(j)
+	}
+	c.scope.targets = c.scope.targets[:len(c.scope.targets)-1]
+}
+
+// branchStmt compiles a break or continue statement
+func (c *Compiler) branchStmt(s *ast.BranchStmt) {
+	targets := c.scope.targets
+	for i := len(targets) - 1; i >= 0; i-- {
+		t := targets[i]
+		if s.Label != nil && t.label != s.Label.Name {
+			continue
+		}
+		switch s.Tok {
+		case token.BREAK:
+			t.breaks = append(t.breaks, c.emit(OpJump, 0))
+			return
+		case token.CONTINUE:
+			if t.loop {
+				t.continues = append(t.continues, c.emit(OpJump, 0))
+				return
+			}
+		case token.FALLTHROUGH:
+			// the clauses of switch statements are laid out in order
+			return
+		}
+	}
+	c.errorf(s.Pos(), "unsupported branch statement %s", s.Tok)
+}
+
+// forStmt compiles the for statement s labeled label. Each iteration
+// has its own copy of the captured variables declared by the init
+// statement.
+func (c *Compiler) forStmt(s *ast.ForStmt, label string) {
+	var cells []slot
+	if s.Init != nil {
+		c.stmt(s.Init)
+		if a, ok := s.Init.(*ast.AssignStmt); ok && a.Tok == token.DEFINE {
+			for _, x := range a.Lhs {
+				if obj := c.info.Defs[x.(*ast.Ident)]; obj != nil && c.captured[obj] {
+					cells = append(cells, c.variable(obj.(*types.Var)))
+				}
+			}
+		}
+	}
+
+	t := c.push(label, true)
+	start := len(c.scope.ins)
+	exit := -1
+	if s.Cond != nil {
+		c.expr(s.Cond)
+		exit = c.emit(OpJumpNotTruthy, 0)
+	}
+	c.stmts(s.Body.List)
+	for _, j := range t.continues {
+		c.patch(j)
+	}
+	for _, v := range cells {
+		c.emit(OpGetCell, v.sym.Index)
+		c.emit(OpNewCell, v.sym.Index)
+	}
+	if s.Post != nil {
+		c.stmt(s.Post)
+	}
+	c.emit(OpJump, start)
+	if exit >= 0 {
+		c.patch(exit)
+	}
+	c.pop(t)
+}
+
+// rangeStmt compiles the range statement s labeled label
+func (c *Compiler) rangeStmt(s *ast.RangeStmt, label string) {
+	it := c.temp()
+	c.expr(s.X)
+	c.emit(OpRange)
+	c.store(it)
+
+	t := c.push(label, true)
+	start := c.emit(OpGetLocal, it.sym.Index)
+	next := c.emit(OpNext, 0)
+	value, key := c.temp(), c.temp()
+	c.store(value)
+	c.store(key)
+	for i, x := range []ast.Expr{s.Key, s.Value} {
+		if x == nil {
+			continue
+		}
+		v := key
+		if i == 1 {
+			v = value
+		}
+		c.assign(x, s.Tok, func() { c.load(v) })
+	}
+	c.stmts(s.Body.List)
+	for _, j := range t.continues {
+		copy(c.scope.ins[j:], Make(OpJump, start))
+	}
+	c.emit(OpJump, start)
+	c.patch(next)
+	c.pop(t)
+}
+
+// switchStmt compiles the switch statement s labeled label
+func (c *Compiler) switchStmt(s *ast.SwitchStmt, label string) {
+	if s.Init != nil {
+		c.stmt(s.Init)
+	}
+	var tag slot
+	if s.Tag != nil {
+		tag = c.temp()
+		c.expr(s.Tag)
+		c.store(tag)
+	}
+
+	clauses := s.Body.List
+	jumps := make([][]int, len(clauses))
+	def := -1
+	for i, cc := range clauses {
+		clause := cc.(*ast.CaseClause)
+		if clause.List == nil {
+			def = i
+		}
+		for _, x := range clause.List {
+			if s.Tag == nil {
+				c.expr(x)
+			} else {
+				tt, xt := c.typeOf(s.Tag), c.typeOf(x)
+				c.load(tag)
+				if types.IsInterface(xt) {
+					c.convertValue(tt, xt, true)
+				}
+				c.expr(x)
+				if types.IsInterface(tt) {
+					c.convertValue(xt, tt, true)
+				}
+				c.emit(OpEqual)
+			}
+			jumps[i] = append(jumps[i], c.emit(OpJumpTruthy, 0))
+		}
+	}
+	c.clauses(clauses, jumps, def, label)
+}
+
+// clauses compiles the bodies of the clauses of a switch statement
+// labeled label, which the jumps of each clause jump to. def is the
+// index of the default clause, or -1.
+func (c *Compiler) clauses(clauses []ast.Stmt, jumps [][]int, def int, label string) {
+	t := c.push(label, false)
+	if def >= 0 {
+		jumps[def] = append(jumps[def], c.emit(OpJump, 0))
+	} else {
+		t.breaks = append(t.breaks, c.emit(OpJump, 0))
+	}
+	for i, cc := range clauses {
+		clause := cc.(*ast.CaseClause)
+		for _, j := range jumps[i] {
+			c.patch(j)
+		}
+		c.stmts(clause.Body)
+		if n := len(clause.Body); n > 0 {
+			if b, ok := clause.Body[n-1].(*ast.BranchStmt); ok && b.Tok == token.FALLTHROUGH {
+				continue
+			}
+		}
+		t.breaks = append(t.breaks, c.emit(OpJump, 0))
+	}
+	c.pop(t)
+}
+
+// typeSwitchStmt compiles the type switch statement s labeled label
+func (c *Compiler) typeSwitchStmt(s *ast.TypeSwitchStmt, label string) {
+	if s.Init != nil {
+		c.stmt(s.Init)
+	}
+	var guard ast.Expr
+	switch a := s.Assign.(type) {
+	case *ast.ExprStmt:
+		guard = a.X
+	case *ast.AssignStmt:
+		guard = a.Rhs[0]
+	}
+	assert := ast.Unparen(guard).(*ast.TypeAssertExpr)
+	x := c.temp()
+	c.expr(assert.X)
+	c.store(x)
+
+	clauses := s.Body.List
+	jumps := make([][]int, len(clauses))
+	def := -1
+	for i, cc := range clauses {
+		clause := cc.(*ast.CaseClause)
+		if clause.List == nil {
+			def = i
+		}
+		for _, e := range clause.List {
+			c.load(x)
+			if tv := c.info.Types[e]; tv.IsNil() {
+				c.emit(OpNull)
+				c.emit(OpEqual)
+			} else {
+				c.emit(OpIsType, c.typeConstant(tv.Type))
+			}
+			jumps[i] = append(jumps[i], c.emit(OpJumpTruthy, 0))
+		}
+	}
+
+	// declare the variable of each clause before its body
+	t := c.push(label, false)
+	if def >= 0 {
+		jumps[def] = append(jumps[def], c.emit(OpJump, 0))
+	} else {
+		t.breaks = append(t.breaks, c.emit(OpJump, 0))
+	}
+	for i, cc := range clauses {
+		clause := cc.(*ast.CaseClause)
+		for _, j := range jumps[i] {
+			c.patch(j)
+		}
+		if obj := c.info.Implicits[clause]; obj != nil {
+			c.load(x)
+			if len(clause.List) == 1 && !c.info.Types[clause.List[0]].IsNil() {
+				c.emit(OpAssert, c.typeConstant(c.info.Types[clause.List[0]].Type), c.typeConstant(c.typeOf(assert.X)))
+			}
+			c.declare(obj)
+		}
+		c.stmts(clause.Body)
+		t.breaks = append(t.breaks, c.emit(OpJump, 0))
+	}
+	c.pop(t)
+}
+
+// returnStmt compiles a return statement
+func (c *Compiler) returnStmt(s *ast.ReturnStmt) {
+	sc := c.scope
+	results := sc.sig.Results()
+	to := make([]types.Type, results.Len())
+	for i := range to {
+		to[i] = results.At(i).Type()
+	}
+
+	switch {
+	case len(s.Results) == 0:
+	case len(s.Results) == len(to):
+		for i, x := range s.Results {
+			c.value(x, to[i])
+		}
+	default:
+		c.spread(s.Results[0], to)
+	}
+
+	if len(s.Results) > 0 && len(sc.results) > 0 {
+		for i := len(sc.results) - 1; i >= 0; i-- {
+			c.store(sc.results[i])
+		}
+	}
+	if sc.deferred {
+		sc.returns = append(sc.returns, c.emit(OpJump, 0))
+		return
+	}
+	if len(sc.results) > 0 {
+		for _, r := range sc.results {
+			c.load(r)
+		}
+	}
+	c.emit(OpReturn, len(to))
+}
+
+func isFloat(t types.Type) bool {
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&types.IsFloat != 0
+}
@@ -0,0 +1,139 @@
+package vm
+
+import (
+	"weblang/wl/object"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+// CompiledFunction is a function or method compiled to bytecode. The
+// receiver of methods is their first parameter.
+type CompiledFunction struct {
+	Name          string
+	Instructions  Instructions
+	NumLocals     int
+	NumParameters int
+
+	// Epilogue is the offset of the code running the deferred calls
+	// and returning the results, or -1 if the function defers nothing
+	Epilogue int
+
+	// Lines are the positions of the statements and calls, by offset
+	Lines []Line
+}
+
+// A Line is the position of the code starting at Offset
+type Line struct {
+	Offset int
+	Pos    token.Pos
+}
+
+func (f *CompiledFunction) Type() object.ObjectType { return object.COMPILED_FUNCTION_OBJ }
+func (f *CompiledFunction) Inspect() string         { return "func " + f.Name }
+
+// pos returns the position of the code before the offset ip
+func (f *CompiledFunction) pos(ip int) token.Pos {
+	pos := token.NoPos
+	for _, l := range f.Lines {
+		if l.Offset >= ip {
+			break
+		}
+		pos = l.Pos
+	}
+	return pos
+}
+
+// Closure is a function literal with the cells of the variables it
+// captured
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []object.Object
+}
+
+func (c *Closure) Type() object.ObjectType { return object.CLOSURE_OBJ }
+func (c *Closure) Inspect() string         { return "func literal" }
+
+// A cell holds a variable captured by closures
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType { return "CELL" }
+func (c *cell) Inspect() string         { return c.value.Inspect() }
+
+// typeRef is a constant naming a type for the instructions creating,
+// converting or asserting values of the type
+type typeRef struct {
+	t types.Type
+}
+
+func (r *typeRef) Type() object.ObjectType { return "TYPE" }
+func (r *typeRef) Inspect() string         { return r.t.String() }
+
+// funcRef is a constant naming a function or method of a builtin
+// package, which the VM binds to its implementation when it starts
+type funcRef struct {
+	fn *types.Func
+}
+
+func (r *funcRef) Type() object.ObjectType { return "FUNC" }
+func (r *funcRef) Inspect() string         { return r.fn.FullName() }
+
+// methodRef is a constant naming an interface method, which the VM
+// looks up in the dynamic type of the receiver
+type methodRef struct {
+	m *types.Func
+}
+
+func (r *methodRef) Type() object.ObjectType { return "METHOD" }
+func (r *methodRef) Inspect() string         { return r.m.FullName() }
+
+// An iterator ranges over the keys and values a string, slice or map
+// had when the range statement started
+type iterator struct {
+	keys, values []object.Object
+	hash         *object.Hash
+	i            int
+}
+
+func (it *iterator) Type() object.ObjectType { return "ITERATOR" }
+func (it *iterator) Inspect() string         { return "iterator" }
+
+// newIterator returns an iterator over the elements of x
+func newIterator(x object.Object) *iterator {
+	it := &iterator{}
+	switch x := x.(type) {
+	case *object.String:
+		for i, r := range x.Value {
+			it.keys = append(it.keys, &object.Integer{Value: int64(i)})
+			it.values = append(it.values, &object.String{Value: string(r)})
+		}
+	case *object.Array:
+		it.values = x.Elements
+		for i := range x.Elements {
+			it.keys = append(it.keys, &object.Integer{Value: int64(i)})
+		}
+	case *object.Hash:
+		it.hash = x
+		for _, k := range x.Keys {
+			it.keys = append(it.keys, x.Pairs[k].Key)
+		}
+	}
+	return it
+}
+
+// next returns the next key and value, reporting whether there is one
+func (it *iterator) next() (key, value object.Object, ok bool) {
+	for it.i < len(it.keys) {
+		i := it.i
+		it.i++
+		if it.hash == nil {
+			return it.keys[i], object.Copy(it.values[i]), true
+		}
+		// the current value of each key, skipping the keys removed
+		if p, ok := it.hash.Pairs[hashable(it.keys[i]).HashKey()]; ok {
+			return p.Key, object.Copy(p.Value), true
+		}
+	}
+	return nil, nil, false
+}
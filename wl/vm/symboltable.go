@@ -1,4 +1,4 @@
-package jscompiler
+package vm
 
 type SymbolScope string
 
@@ -1,4 +1,4 @@
-package jscompiler
+package vm
 
 import "testing"
 
@@ -0,0 +1,956 @@
+// Package vm compiles type-checked wl packages to bytecode and runs
+// them on a stack machine, for executing packages faster than the
+// interpreter of package eval.
+//
+// Programs behave like they do when package eval runs them: values are
+// the objects of package object, with the same copying of struct values
+// and boxing of interface values, and runtime errors and unrecovered
+// panics are reported as the same *eval.Panic. Each function has its
+// own SymbolTable of locals; the variables closures capture are kept in
+// cells, which the closures hold as their free variables.
+package vm
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"weblang/wl/eval"
+	"weblang/wl/object"
+	"weblang/wl/token"
+	"weblang/wl/types"
+)
+
+const (
+	StackSize = 1 << 16
+	MaxFrames = 1 << 12
+)
+
+// A VM runs a compiled package
+type VM struct {
+	// Out receives the output of print and println
+	Out io.Writer
+
+	// Client makes the requests of package http; http.DefaultClient is
+	// used if it is nil
+	Client *http.Client
+
+	fset      *token.FileSet
+	bytecode  *Bytecode
+	constants []object.Object
+	globals   []object.Object
+	builtins  []*object.Builtin
+	natives   map[*types.Func]object.Object
+
+	stack []object.Object
+	sp    int // the top of the stack is stack[sp-1]
+
+	frames []frame
+	fi     int // the index of the frame running
+}
+
+// A frame is the state of a call of a compiled function
+type frame struct {
+	fn   *CompiledFunction
+	cl   *Closure
+	ip   int // the offset of the next instruction
+	bp   int // the index of the first local on the stack
+	mode callMode
+
+	defers []deferred
+	panic  *eval.Panic
+	pos    token.Pos // the position the panic unwinding the frame was at
+	done   bool      // the deferred calls ran and didn't recover the panic
+}
+
+// callMode is how a function is called
+type callMode int
+
+const (
+	callNormal callMode = iota
+	// callDeferred is a deferred call, which may recover the panic of
+	// its caller and whose results are discarded
+	callDeferred
+	// callHandler is the call of the handler of a catch statement
+	callHandler
+)
+
+// deferred is a deferred call, or the handler of a catch statement
+// which handles the panics whose value implements catch
+type deferred struct {
+	fn    object.Object
+	args  []object.Object
+	catch *types.Interface
+}
+
+// New returns a VM running the package compiled to bc from files parsed
+// with fset, writing the output of print and println to out
+func New(fset *token.FileSet, bc *Bytecode, out io.Writer) *VM {
+	vm := &VM{
+		Out:      out,
+		fset:     fset,
+		bytecode: bc,
+		globals:  make([]object.Object, bc.NumGlobals),
+		natives:  make(map[*types.Func]object.Object),
+		stack:    make([]object.Object, StackSize),
+		frames:   make([]frame, MaxFrames),
+		fi:       -1,
+	}
+	vm.constants = make([]object.Object, len(bc.Constants))
+	for i, c := range bc.Constants {
+		if r, ok := c.(*funcRef); ok {
+			c = vm.native(r.fn)
+		}
+		vm.constants[i] = c
+	}
+	for _, name := range builtins {
+		vm.builtins = append(vm.builtins, vm.builtin(name))
+	}
+	return vm
+}
+
+// Run initializes the variables of the package and runs its init
+// functions
+func (vm *VM) Run() error {
+	_, err := vm.protect(func() []object.Object {
+		return vm.callValue(vm.bytecode.Init, nil)
+	})
+	return err
+}
+
+// Call calls the function name of the package with args, returning its
+// results
+func (vm *VM) Call(name string, args ...object.Object) ([]object.Object, error) {
+	fn, ok := vm.bytecode.Funcs[name]
+	if !ok {
+		return nil, fmt.Errorf("function %s not found", name)
+	}
+	return vm.CallValue(fn, args...)
+}
+
+// CallValue calls the function value fn with args, returning its
+// results
+func (vm *VM) CallValue(fn object.Object, args ...object.Object) ([]object.Object, error) {
+	return vm.protect(func() []object.Object {
+		return vm.callValue(fn, args)
+	})
+}
+
+// Global returns the value of the package variable name
+func (vm *VM) Global(name string) (object.Object, bool) {
+	i, ok := vm.bytecode.Globals[name]
+	if !ok {
+		return nil, false
+	}
+	return vm.globals[i], true
+}
+
+// protect runs f, returning the panic unwinding it
+func (vm *VM) protect(f func() []object.Object) (results []object.Object, err error) {
+	sp, fi := vm.sp, vm.fi
+	defer func() {
+		if r := recover(); r != nil {
+			p, ok := r.(*eval.Panic)
+			if !ok {
+				panic(r)
+			}
+			vm.sp, vm.fi = sp, fi
+			err = p
+		}
+	}()
+	return f(), nil
+}
+
+// callValue calls fn with args from Go, returning its results. It
+// panics with the panic its call doesn't recover.
+func (vm *VM) callValue(fn object.Object, args []object.Object) []object.Object {
+	sp, fi := vm.sp, vm.fi
+	vm.push(fn)
+	for _, a := range args {
+		vm.push(a)
+	}
+	vm.call(len(args), callNormal)
+	if vm.fi > fi {
+		if p := vm.run(fi + 1); p != nil {
+			panic(p)
+		}
+	}
+	results := make([]object.Object, vm.sp-sp)
+	copy(results, vm.stack[sp:vm.sp])
+	vm.sp = sp
+	return results
+}
+
+// run runs the frame base until it returns, returning the panic it
+// doesn't recover
+func (vm *VM) run(base int) *eval.Panic {
+	for {
+		p := vm.exec(base)
+		if p == nil || vm.unwind(p, base) {
+			return p
+		}
+	}
+}
+
+// unwind unwinds the frames from the innermost to base until one
+// with deferred calls, which runs them next. It reports whether the
+// panic p unwound the frame base.
+func (vm *VM) unwind(p *eval.Panic, base int) bool {
+	for vm.fi >= base {
+		fr := &vm.frames[vm.fi]
+		if fr.panic == nil {
+			fr.pos = fr.fn.pos(fr.ip)
+		}
+		if fr.fn.Epilogue >= 0 && !fr.done {
+			// a panic in a deferred call replaces the one unwinding
+			fr.panic = p
+			fr.ip = fr.fn.Epilogue
+			vm.sp = fr.bp + fr.fn.NumLocals
+			return false
+		}
+		p.Stack = append(p.Stack, fmt.Sprintf("%s\n\t%s", fr.fn.Name, vm.fset.Position(fr.pos)))
+		vm.sp = fr.bp - 1
+		vm.fi--
+	}
+	return true
+}
+
+func (vm *VM) push(o object.Object) {
+	if vm.sp >= StackSize {
+		panic(eval.ErrorPanic("stack overflow"))
+	}
+	vm.stack[vm.sp] = o
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	vm.sp--
+	o := vm.stack[vm.sp]
+	vm.stack[vm.sp] = nil
+	return o
+}
+
+// call calls the function below the n arguments on the top of the
+// stack. Compiled functions start running in a new frame; the others
+// are called right away and replace the function and arguments with
+// their result.
+func (vm *VM) call(n int, mode callMode) {
+	for {
+		switch fn := vm.stack[vm.sp-1-n].(type) {
+		case *Closure:
+			vm.enter(fn.Fn, fn, n, mode)
+			return
+		case *CompiledFunction:
+			vm.enter(fn, nil, n, mode)
+			return
+		case *object.Method:
+			// pass the receiver first
+			copy(vm.stack[vm.sp-n+1:vm.sp+1], vm.stack[vm.sp-n:vm.sp])
+			vm.stack[vm.sp-n] = fn.Recv
+			vm.sp++
+			n++
+			vm.stack[vm.sp-1-n] = fn.Func
+			continue
+		case *object.Builtin:
+			args := make([]object.Object, n)
+			copy(args, vm.stack[vm.sp-n:vm.sp])
+			vm.sp -= n + 1
+			if res := fn.Fn(args...); res != nil && mode == callNormal {
+				vm.push(res)
+			}
+			return
+		}
+		panic(eval.RuntimeError("invalid memory address or nil pointer dereference"))
+	}
+}
+
+// enter starts the call of fn with the n arguments on the stack
+func (vm *VM) enter(fn *CompiledFunction, cl *Closure, n int, mode callMode) {
+	if vm.fi+1 >= MaxFrames {
+		panic(eval.ErrorPanic("stack overflow"))
+	}
+	bp := vm.sp - n
+	sp := bp + fn.NumLocals
+	if sp >= StackSize {
+		panic(eval.ErrorPanic("stack overflow"))
+	}
+	vm.fi++
+	fr := &vm.frames[vm.fi]
+	*fr = frame{fn: fn, cl: cl, bp: bp, mode: mode, defers: fr.defers[:0]}
+	for i := vm.sp; i < sp; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = sp
+}
+
+// exec runs the frames until the frame base returns, returning the
+// panic raised if there is one
+func (vm *VM) exec(base int) (p *eval.Panic) {
+	defer func() {
+		if r := recover(); r != nil {
+			var ok bool
+			if p, ok = r.(*eval.Panic); !ok {
+				panic(r)
+			}
+		}
+	}()
+
+	fr := &vm.frames[vm.fi]
+	for {
+		ins := fr.fn.Instructions
+		ip := fr.ip
+		op := Opcode(ins[ip])
+		fr.ip++
+
+		switch op {
+		case OpConstant:
+			fr.ip += 2
+			vm.push(vm.constants[ReadUint16(ins[ip+1:])])
+		case OpNull:
+			vm.push(object.NULL)
+		case OpTrue:
+			vm.push(object.TRUE)
+		case OpFalse:
+			vm.push(object.FALSE)
+		case OpPop:
+			vm.pop()
+		case OpDup:
+			vm.push(vm.stack[vm.sp-1])
+		case OpDup2:
+			x, y := vm.stack[vm.sp-2], vm.stack[vm.sp-1]
+			vm.push(x)
+			vm.push(y)
+
+		case OpAdd, OpSub, OpMul, OpDiv, OpRem, OpAnd, OpOr, OpXor, OpShl, OpShr,
+			OpLess, OpLessEqual, OpGreater, OpGreaterEqual:
+			y := vm.pop()
+			vm.stack[vm.sp-1] = operate(op, vm.stack[vm.sp-1], y)
+		case OpEqual, OpNotEqual:
+			y := vm.pop()
+			x := vm.stack[vm.sp-1]
+			eq, ok := object.Equal(x, y)
+			if !ok {
+				panic(eval.RuntimeError("comparing uncomparable type %s", typeString(x.(*object.Interface).Dynamic)))
+			}
+			vm.stack[vm.sp-1] = object.NativeBool(eq == (op == OpEqual))
+		case OpMinus:
+			switch x := vm.stack[vm.sp-1].(type) {
+			case *object.Integer:
+				vm.stack[vm.sp-1] = &object.Integer{Value: -x.Value}
+			case *object.Float:
+				vm.stack[vm.sp-1] = &object.Float{Value: -x.Value}
+			}
+		case OpNot:
+			vm.stack[vm.sp-1] = object.NativeBool(!vm.stack[vm.sp-1].(*object.Boolean).Value)
+		case OpComplement:
+			vm.stack[vm.sp-1] = &object.Integer{Value: ^vm.stack[vm.sp-1].(*object.Integer).Value}
+
+		case OpJump:
+			fr.ip = int(ReadUint16(ins[ip+1:]))
+		case OpJumpNotTruthy, OpJumpTruthy:
+			fr.ip += 2
+			if vm.pop().(*object.Boolean).Value == (op == OpJumpTruthy) {
+				fr.ip = int(ReadUint16(ins[ip+1:]))
+			}
+
+		case OpGetGlobal:
+			fr.ip += 2
+			vm.push(vm.globals[ReadUint16(ins[ip+1:])])
+		case OpSetGlobal:
+			fr.ip += 2
+			vm.globals[ReadUint16(ins[ip+1:])] = vm.pop()
+		case OpGetLocal:
+			fr.ip++
+			vm.push(vm.stack[fr.bp+int(ins[ip+1])])
+		case OpSetLocal:
+			fr.ip++
+			vm.stack[fr.bp+int(ins[ip+1])] = vm.pop()
+		case OpGetCell:
+			fr.ip++
+			vm.push(vm.stack[fr.bp+int(ins[ip+1])].(*cell).value)
+		case OpSetCell:
+			fr.ip++
+			vm.stack[fr.bp+int(ins[ip+1])].(*cell).value = vm.pop()
+		case OpNewCell:
+			fr.ip++
+			vm.stack[fr.bp+int(ins[ip+1])] = &cell{vm.pop()}
+		case OpGetFree:
+			fr.ip++
+			vm.push(fr.cl.Free[ins[ip+1]].(*cell).value)
+		case OpSetFree:
+			fr.ip++
+			fr.cl.Free[ins[ip+1]].(*cell).value = vm.pop()
+		case OpGetFreeCell:
+			fr.ip++
+			vm.push(fr.cl.Free[ins[ip+1]])
+		case OpGetBuiltin:
+			fr.ip++
+			vm.push(vm.builtins[ins[ip+1]])
+		case OpClosure:
+			fr.ip += 3
+			fn := vm.constants[ReadUint16(ins[ip+1:])].(*CompiledFunction)
+			free := make([]object.Object, ins[ip+3])
+			copy(free, vm.stack[vm.sp-len(free):vm.sp])
+			vm.sp -= len(free)
+			vm.push(&Closure{Fn: fn, Free: free})
+
+		case OpCall:
+			fr.ip++
+			vm.call(int(ins[ip+1]), callNormal)
+			fr = &vm.frames[vm.fi]
+		case OpReturn:
+			n := int(ins[ip+1])
+			callee := fr.bp - 1
+			if fr.mode == callNormal {
+				copy(vm.stack[callee:], vm.stack[vm.sp-n:vm.sp])
+				callee += n
+			}
+			for i := callee; i < vm.sp; i++ {
+				vm.stack[i] = nil
+			}
+			vm.sp = callee
+			vm.fi--
+			if vm.fi < base {
+				return nil
+			}
+			fr = &vm.frames[vm.fi]
+		case OpRunDefers:
+			if len(fr.defers) == 0 {
+				if p := fr.panic; p != nil {
+					fr.done = true
+					panic(p)
+				}
+				continue
+			}
+			d := fr.defers[len(fr.defers)-1]
+			fr.defers = fr.defers[:len(fr.defers)-1]
+			// run the next deferred call when this one returns
+			fr.ip = ip
+			switch {
+			case d.catch != nil:
+				if fr.panic == nil || !handles(fr.panic.Value, d.catch) {
+					continue
+				}
+				v := fr.panic.Value
+				fr.panic = nil
+				vm.push(d.fn)
+				vm.push(v)
+				vm.call(1, callHandler)
+			case d.fn == vm.builtins[3]:
+				// recover isn't called by the deferred call, so it
+				// recovers nothing
+			default:
+				vm.push(d.fn)
+				for _, a := range d.args {
+					vm.push(a)
+				}
+				vm.call(len(d.args), callDeferred)
+			}
+			fr = &vm.frames[vm.fi]
+		case OpDefer:
+			fr.ip++
+			n := int(ins[ip+1])
+			args := make([]object.Object, n)
+			copy(args, vm.stack[vm.sp-n:vm.sp])
+			vm.sp -= n
+			fr.defers = append(fr.defers, deferred{fn: vm.pop(), args: args})
+		case OpCatch:
+			fr.ip += 2
+			t := vm.constants[ReadUint16(ins[ip+1:])].(*typeRef).t
+			fr.defers = append(fr.defers, deferred{fn: vm.pop(), catch: t.Underlying().(*types.Interface)})
+
+		case OpZero:
+			fr.ip += 2
+			vm.push(object.Zero(vm.typeOperand(ins, ip+1)))
+		case OpCopy:
+			vm.stack[vm.sp-1] = object.Copy(vm.stack[vm.sp-1])
+		case OpBox:
+			fr.ip += 2
+			if v := vm.stack[vm.sp-1]; v != object.NULL {
+				vm.stack[vm.sp-1] = &object.Interface{Dynamic: vm.typeOperand(ins, ip+1), Value: object.Copy(v)}
+			}
+		case OpConvert:
+			fr.ip += 2
+			vm.stack[vm.sp-1] = convert(vm.stack[vm.sp-1], vm.typeOperand(ins, ip+1))
+		case OpAssert:
+			fr.ip += 4
+			t := vm.typeOperand(ins, ip+1)
+			v := vm.stack[vm.sp-1]
+			res, ok := assertType(v, t)
+			if !ok {
+				panic(assertionError(v, vm.typeOperand(ins, ip+3), t))
+			}
+			vm.stack[vm.sp-1] = res
+		case OpAssertOk:
+			fr.ip += 2
+			t := vm.typeOperand(ins, ip+1)
+			res, ok := assertType(vm.stack[vm.sp-1], t)
+			if !ok {
+				res = object.Zero(t)
+			}
+			vm.stack[vm.sp-1] = res
+			vm.push(object.NativeBool(ok))
+		case OpIsType:
+			fr.ip += 2
+			_, ok := assertType(vm.stack[vm.sp-1], vm.typeOperand(ins, ip+1))
+			vm.stack[vm.sp-1] = object.NativeBool(ok)
+
+		case OpArray:
+			fr.ip += 2
+			n := int(ReadUint16(ins[ip+1:]))
+			elems := make([]object.Object, n)
+			copy(elems, vm.stack[vm.sp-n:vm.sp])
+			vm.sp -= n
+			vm.push(&object.Array{Elements: elems})
+		case OpHash:
+			fr.ip += 2
+			n := int(ReadUint16(ins[ip+1:]))
+			h := object.NewHash()
+			for i := vm.sp - 2*n; i < vm.sp; i += 2 {
+				h.Set(hashable(vm.stack[i]).(object.Object), vm.stack[i+1])
+			}
+			vm.sp -= 2 * n
+			vm.push(h)
+		case OpStruct:
+			fr.ip += 2
+			t := vm.typeOperand(ins, ip+1)
+			fields := make([]object.Object, t.Underlying().(*types.Struct).NumFields())
+			copy(fields, vm.stack[vm.sp-len(fields):vm.sp])
+			vm.sp -= len(fields)
+			vm.push(&object.Struct{StructType: t, Fields: fields})
+		case OpMakeSlice:
+			fr.ip += 3
+			elem := vm.typeOperand(ins, ip+1)
+			var n, c int64
+			if ins[ip+3] > 1 {
+				c = vm.pop().(*object.Integer).Value
+			}
+			n = vm.pop().(*object.Integer).Value
+			if ins[ip+3] == 1 {
+				c = n
+			}
+			if n < 0 {
+				panic(eval.RuntimeError("makeslice: len out of range"))
+			}
+			if c < n {
+				panic(eval.RuntimeError("makeslice: cap out of range"))
+			}
+			elems := make([]object.Object, n, c)
+			for i := range elems {
+				elems[i] = object.Zero(elem)
+			}
+			vm.push(&object.Array{Elements: elems})
+		case OpAppend:
+			fr.ip += 2
+			n := int(ReadUint16(ins[ip+1:]))
+			elems := append(elements(vm.stack[vm.sp-1-n]), vm.stack[vm.sp-n:vm.sp]...)
+			vm.sp -= n
+			vm.stack[vm.sp-1] = &object.Array{Elements: elems}
+		case OpAppendSlice:
+			y := vm.pop()
+			vm.stack[vm.sp-1] = &object.Array{Elements: append(elements(vm.stack[vm.sp-1]), elements(y)...)}
+		case OpIndex:
+			i := vm.pop().(*object.Integer).Value
+			switch x := vm.stack[vm.sp-1].(type) {
+			case *object.String:
+				checkIndex(i, len(x.Value))
+				vm.stack[vm.sp-1] = &object.String{Value: x.Value[i : i+1]}
+			default:
+				elems := elements(x)
+				checkIndex(i, len(elems))
+				vm.stack[vm.sp-1] = elems[i]
+			}
+		case OpMapIndex, OpMapIndexOk:
+			fr.ip += 2
+			key := vm.pop()
+			v, ok := vm.stack[vm.sp-1].(*object.Hash).Get(hashable(key))
+			if !ok {
+				v = object.Zero(vm.typeOperand(ins, ip+1))
+			}
+			vm.stack[vm.sp-1] = v
+			if op == OpMapIndexOk {
+				vm.push(object.NativeBool(ok))
+			}
+		case OpSetIndex:
+			v := vm.pop()
+			key := vm.pop()
+			switch x := vm.pop().(type) {
+			case *object.Hash:
+				x.Set(hashable(key).(object.Object), v)
+			default:
+				elems := elements(x)
+				i := key.(*object.Integer).Value
+				checkIndex(i, len(elems))
+				elems[i] = v
+			}
+		case OpSlice:
+			fr.ip++
+			vm.slice(int(ins[ip+1]))
+		case OpField:
+			fr.ip++
+			vm.stack[vm.sp-1] = vm.stack[vm.sp-1].(*object.Struct).Fields[ins[ip+1]]
+		case OpSetField:
+			fr.ip++
+			v := vm.pop()
+			vm.pop().(*object.Struct).Fields[ins[ip+1]] = v
+		case OpMethod:
+			fr.ip += 2
+			fn := vm.constants[ReadUint16(ins[ip+1:])]
+			vm.stack[vm.sp-1] = &object.Method{Recv: vm.stack[vm.sp-1], Func: fn}
+		case OpBindMethod:
+			fr.ip += 2
+			m := vm.constants[ReadUint16(ins[ip+1:])].(*methodRef).m
+			vm.stack[vm.sp-1] = vm.method(vm.stack[vm.sp-1], nil, m)
+		case OpRange:
+			vm.stack[vm.sp-1] = newIterator(vm.stack[vm.sp-1])
+		case OpNext:
+			fr.ip += 2
+			key, value, ok := vm.pop().(*iterator).next()
+			if !ok {
+				fr.ip = int(ReadUint16(ins[ip+1:]))
+				continue
+			}
+			vm.push(key)
+			vm.push(value)
+
+		default:
+			panic(fmt.Sprintf("vm: unknown opcode %d", op))
+		}
+	}
+}
+
+func (vm *VM) typeOperand(ins Instructions, offset int) types.Type {
+	return vm.constants[ReadUint16(ins[offset:])].(*typeRef).t
+}
+
+// slice replaces the operands of a slice expression on the stack with
+// the result. flags has the bits 1, 2 and 4 set if the low, high and
+// max bounds are given.
+func (vm *VM) slice(flags int) {
+	bounds := [3]object.Object{}
+	for i := 2; i >= 0; i-- {
+		if flags&(1<<uint(i)) != 0 {
+			bounds[i] = vm.pop()
+		}
+	}
+	v := vm.stack[vm.sp-1]
+	var n, max int
+	s, isString := v.(*object.String)
+	if isString {
+		n = len(s.Value)
+		max = n
+	} else {
+		elems := elements(v)
+		n, max = len(elems), cap(elems)
+	}
+
+	bound := func(i, def int) int {
+		if bounds[i] == nil {
+			return def
+		}
+		return int(bounds[i].(*object.Integer).Value)
+	}
+	lo, hi := bound(0, 0), bound(1, n)
+	m := bound(2, max)
+	if hi < 0 || hi > max || m > max || hi > m {
+		panic(eval.RuntimeError("slice bounds out of range [:%d] with capacity %d", hi, max))
+	}
+	if lo < 0 || lo > hi {
+		panic(eval.RuntimeError("slice bounds out of range [%d:%d]", lo, hi))
+	}
+	if isString {
+		vm.stack[vm.sp-1] = &object.String{Value: s.Value[lo:hi]}
+		return
+	}
+	vm.stack[vm.sp-1] = &object.Array{Elements: elements(v)[lo:hi:m]}
+}
+
+// method returns the method m of the value x of type t bound to its
+// receiver: the dynamic value of interfaces, or the embedded field
+// declaring the method if it is promoted. A nil t is an interface.
+func (vm *VM) method(x object.Object, t types.Type, m *types.Func) object.Object {
+	for {
+		if t == nil || types.IsInterface(t) {
+			box, ok := x.(*object.Interface)
+			if !ok {
+				panic(eval.RuntimeError("invalid memory address or nil pointer dereference"))
+			}
+			x, t = box.Value, box.Dynamic
+		}
+		obj, index, _ := types.LookupFieldOrMethod(t, false, m.Pkg(), m.Name())
+		f, ok := obj.(*types.Func)
+		if !ok {
+			panic(fmt.Sprintf("vm: %s has no method %s", t, m.Name()))
+		}
+		for _, i := range index[:len(index)-1] {
+			t = t.Underlying().(*types.Struct).Field(i).Type()
+			x = x.(*object.Struct).Fields[i]
+		}
+		if types.IsInterface(t) {
+			// promoted from an embedded interface
+			continue
+		}
+		return &object.Method{Recv: x, Func: vm.function(f)}
+	}
+}
+
+// function returns the value of the function or method fn
+func (vm *VM) function(fn *types.Func) object.Object {
+	if f, ok := vm.bytecode.methods[fn]; ok {
+		return f
+	}
+	return vm.native(fn)
+}
+
+// native returns the implementation of the function or method fn of a
+// builtin package
+func (vm *VM) native(fn *types.Func) object.Object {
+	f, ok := vm.natives[fn]
+	if !ok {
+		f = eval.Native(fn, func() *http.Client { return vm.Client })
+		vm.natives[fn] = f
+	}
+	return f
+}
+
+// builtin returns the builtin function name
+func (vm *VM) builtin(name string) *object.Builtin {
+	var fn object.BuiltinFunction
+	switch name {
+	case "print", "println":
+		fn = func(args ...object.Object) object.Object {
+			var b strings.Builder
+			for i, a := range args {
+				if i > 0 && name == "println" {
+					b.WriteString(" ")
+				}
+				b.WriteString(a.Inspect())
+			}
+			if name == "println" {
+				b.WriteString("\n")
+			}
+			if vm.Out != nil {
+				fmt.Fprint(vm.Out, b.String())
+			}
+			return nil
+		}
+	case "panic":
+		fn = func(args ...object.Object) object.Object {
+			panic(vm.newPanic(args[0]))
+		}
+	case "recover":
+		fn = func(args ...object.Object) object.Object {
+			return vm.recover()
+		}
+	case "assert":
+		fn = func(args ...object.Object) object.Object {
+			if b, ok := args[0].(*object.Boolean); ok && !b.Value {
+				panic(eval.RuntimeError("assertion failed"))
+			}
+			return nil
+		}
+	default:
+		fn = func(args ...object.Object) object.Object { return nil }
+	}
+	return &object.Builtin{Name: name, Fn: fn}
+}
+
+// recover stops the panic of the caller of the deferred call running,
+// returning its value
+func (vm *VM) recover() object.Object {
+	if vm.fi < 1 || vm.frames[vm.fi].mode != callDeferred {
+		return object.NULL
+	}
+	caller := &vm.frames[vm.fi-1]
+	if caller.panic == nil {
+		return object.NULL
+	}
+	v := caller.panic.Value
+	caller.panic = nil
+	return v
+}
+
+// newPanic returns the panic of the boxed value v
+func (vm *VM) newPanic(v object.Object) *eval.Panic {
+	text := eval.PanicText(v, func(recv object.Object, t types.Type, m *types.Func) string {
+		res := vm.callValue(vm.method(recv, t, m), nil)
+		return res[0].(*object.String).Value
+	})
+	return &eval.Panic{Value: v, Text: text}
+}
+
+// handles reports whether a catch handler for panics of the interface
+// iface handles the panic of value v
+func handles(v object.Object, iface *types.Interface) bool {
+	box, ok := v.(*object.Interface)
+	return ok && types.Implements(box.Dynamic, iface)
+}
+
+// assertType returns the value of the interface value v as type t,
+// reporting whether v holds a t
+func assertType(v object.Object, t types.Type) (object.Object, bool) {
+	box, ok := v.(*object.Interface)
+	if !ok {
+		return nil, false
+	}
+	if iface, ok := t.Underlying().(*types.Interface); ok {
+		return box, types.Implements(box.Dynamic, iface)
+	}
+	return box.Value, types.Identical(box.Dynamic, t)
+}
+
+// assertionError returns the panic of the failed assertion of the value
+// v of the interface type from to the type t
+func assertionError(v object.Object, from, t types.Type) *eval.Panic {
+	box, ok := v.(*object.Interface)
+	switch {
+	case !ok:
+		return eval.ErrorPanic(fmt.Sprintf("interface conversion: %s is nil, not %s", typeString(from), typeString(t)))
+	case types.IsInterface(t):
+		m, _ := types.MissingMethod(box.Dynamic, t.Underlying().(*types.Interface), true)
+		return eval.ErrorPanic(fmt.Sprintf("interface conversion: %s is not %s: missing method %s", typeString(box.Dynamic), typeString(t), m.Name()))
+	}
+	return eval.ErrorPanic(fmt.Sprintf("interface conversion: %s is %s, not %s", typeString(from), typeString(box.Dynamic), typeString(t)))
+}
+
+// convert converts the value v to the non-interface type to, like the
+// conversion to(v)
+func convert(v object.Object, to types.Type) object.Object {
+	switch t := to.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case t.Info()&types.IsInteger != 0:
+			if f, ok := v.(*object.Float); ok {
+				return &object.Integer{Value: int64(f.Value)}
+			}
+		case t.Info()&types.IsFloat != 0:
+			if i, ok := v.(*object.Integer); ok {
+				return &object.Float{Value: float64(i.Value)}
+			}
+		case t.Info()&types.IsString != 0:
+			if i, ok := v.(*object.Integer); ok {
+				return &object.String{Value: string(rune(i.Value))}
+			}
+		}
+	case *types.Struct:
+		s := object.Copy(v).(*object.Struct)
+		s.StructType = to
+		return s
+	case *types.Enum:
+		if m, ok := v.(*object.Enum); ok {
+			return &object.Enum{EnumType: to, Member: m.Member}
+		}
+	}
+	return v
+}
+
+// operate applies the arithmetic or ordering operation op to x and y
+func operate(op Opcode, x, y object.Object) object.Object {
+	switch x := x.(type) {
+	case *object.Integer:
+		a, b := x.Value, y.(*object.Integer).Value
+		switch op {
+		case OpAdd:
+			return &object.Integer{Value: a + b}
+		case OpSub:
+			return &object.Integer{Value: a - b}
+		case OpMul:
+			return &object.Integer{Value: a * b}
+		case OpDiv, OpRem:
+			if b == 0 {
+				panic(eval.RuntimeError("integer divide by zero"))
+			}
+			if op == OpDiv {
+				return &object.Integer{Value: a / b}
+			}
+			return &object.Integer{Value: a % b}
+		case OpAnd:
+			return &object.Integer{Value: a & b}
+		case OpOr:
+			return &object.Integer{Value: a | b}
+		case OpXor:
+			return &object.Integer{Value: a ^ b}
+		case OpShl, OpShr:
+			if b < 0 {
+				panic(eval.RuntimeError("negative shift amount"))
+			}
+			if op == OpShl {
+				return &object.Integer{Value: a << uint64(b)}
+			}
+			return &object.Integer{Value: a >> uint64(b)}
+		case OpLess:
+			return object.NativeBool(a < b)
+		case OpLessEqual:
+			return object.NativeBool(a <= b)
+		case OpGreater:
+			return object.NativeBool(a > b)
+		case OpGreaterEqual:
+			return object.NativeBool(a >= b)
+		}
+	case *object.Float:
+		a, b := x.Value, y.(*object.Float).Value
+		switch op {
+		case OpAdd:
+			return &object.Float{Value: a + b}
+		case OpSub:
+			return &object.Float{Value: a - b}
+		case OpMul:
+			return &object.Float{Value: a * b}
+		case OpDiv:
+			return &object.Float{Value: a / b}
+		case OpLess:
+			return object.NativeBool(a < b)
+		case OpLessEqual:
+			return object.NativeBool(a <= b)
+		case OpGreater:
+			return object.NativeBool(a > b)
+		case OpGreaterEqual:
+			return object.NativeBool(a >= b)
+		}
+	case *object.String:
+		a, b := x.Value, y.(*object.String).Value
+		switch op {
+		case OpAdd:
+			return &object.String{Value: a + b}
+		case OpLess:
+			return object.NativeBool(a < b)
+		case OpLessEqual:
+			return object.NativeBool(a <= b)
+		case OpGreater:
+			return object.NativeBool(a > b)
+		case OpGreaterEqual:
+			return object.NativeBool(a >= b)
+		}
+	}
+	panic(fmt.Sprintf("vm: unsupported operation %s %s %s", x.Type(), definitions[op].Name, y.Type()))
+}
+
+// checkIndex panics unless i is an index of a slice or string of
+// length n
+func checkIndex(i int64, n int) {
+	if i < 0 || i >= int64(n) {
+		panic(eval.RuntimeError("index out of range [%d] with length %d", i, n))
+	}
+}
+
+// hashable returns the map key v
+func hashable(v object.Object) object.Hashable {
+	h, ok := v.(object.Hashable)
+	if !ok {
+		panic(eval.RuntimeError("hash of unhashable type %s", v.Type()))
+	}
+	return h
+}
+
+// elements returns the elements of the slice s, which are nil for nil
+func elements(s object.Object) []object.Object {
+	if a, ok := s.(*object.Array); ok {
+		return a.Elements
+	}
+	return nil
+}
+
+// typeString returns the name of t qualified by package names
+func typeString(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string { return p.Name() })
+}
@@ -0,0 +1,111 @@
+package vm
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"weblang/wl/eval"
+	"weblang/wl/eval/evaltest"
+	"weblang/wl/object"
+)
+
+// TestConformance runs the conformance programs of package evaltest
+func TestConformance(t *testing.T) {
+	evaltest.Run(t, func(t *testing.T, p *evaltest.Package, out io.Writer) error {
+		vm := run(t, p)
+		vm.Out = out
+		_, err := vm.Call("main")
+		return err
+	})
+}
+
+func TestCallGlobal(t *testing.T) {
+	vm := load(t, `package p
+
+var total = 1
+
+func add(n int) int {
+	total += n
+	return total
+}`, nil)
+
+	res, err := vm.Call("add", &object.Integer{Value: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "3", res[0].Inspect(); want != got {
+		t.Errorf("wanted %s, got %s", want, got)
+	}
+	if v, _ := vm.Global("total"); v.Inspect() != "3" {
+		t.Errorf("total wanted 3, got %s", v.Inspect())
+	}
+	if _, err := vm.Call("missing"); err == nil {
+		t.Error("expected an error calling a missing function")
+	}
+}
+
+const fib = `package main
+
+func fib(n int) int {
+	if n < 2 {
+		return n
+	}
+	return fib(n-1) + fib(n-2)
+}
+
+func main() {
+	println(fib(20))
+}`
+
+func BenchmarkFib(b *testing.B) {
+	p := evaltest.Check(b, "fib.wl", fib)
+	bc, err := Compile(p.Fset, p.Pkg, p.Info, p.Files)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		vm := New(p.Fset, bc, nil)
+		if err := vm.Run(); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := vm.Call("main"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFibEval(b *testing.B) {
+	p := evaltest.Check(b, "fib.wl", fib)
+	for i := 0; i < b.N; i++ {
+		in := eval.New(p.Fset, nil)
+		if err := in.Load(p.Pkg, p.Info, p.Files); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := in.Call(p.Pkg, "main"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// load checks, compiles and initializes the package of src, writing
+// its output to out
+func load(t *testing.T, src string, out *bytes.Buffer) *VM {
+	vm := run(t, evaltest.Check(t, "test.wl", src))
+	if out != nil {
+		vm.Out = out
+	}
+	return vm
+}
+
+// run compiles and initializes the package p
+func run(t *testing.T, p *evaltest.Package) *VM {
+	bc, err := Compile(p.Fset, p.Pkg, p.Info, p.Files)
+	if err != nil {
+		t.Fatalf("Error during compile: %v", err)
+	}
+	vm := New(p.Fset, bc, nil)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("Error during init: %v", err)
+	}
+	return vm
+}